@@ -33,6 +33,7 @@ package auth
 import (
 	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -49,8 +50,18 @@ const (
 	tokenAttrRoles   = "roles"
 	tokenAttrHomeDir = "home-dir"
 	tokenAttrCluster = "cluster-tag"
+	tokenAttrQuota   = "quota"
+	tokenAttrScope   = "scope"
+	tokenAttrID      = "jti"
+	tokenAttrOrigIat = "orig_iat" // set by JWT middleware, kept on refresh
 
 	AdminRole = "admin"
+
+	// marks locked login attempt
+	lockedKey = "auth-locked"
+
+	// marks revoked JWT token
+	revokedKey = "auth-revoked"
 )
 
 // UserInfo is a user credentials and related information such a home directory.
@@ -61,6 +72,13 @@ type UserInfo struct {
 	Roles      []string `json:"roles,omitempty" yaml:"roles,omitempty"`       // "admin", "user"
 	HomeDir    string   `json:"home,omitempty" yaml:"home,omitempty"`
 	ClusterTag string   `json:"cluster-tag,omitempty" yaml:"cluster-tag,omitempty"`
+	Quota      string   `json:"quota,omitempty" yaml:"quota,omitempty"` // storage quota, "10GB" for example
+
+	Tokens []*ApiToken `json:"tokens,omitempty" yaml:"tokens,omitempty"` // API keys
+
+	Scope     []string `json:"-" yaml:"-"` // permissions of the API key used to authenticate
+	TokenID   string   `json:"-" yaml:"-"` // the API key used to authenticate
+	SessionID string   `json:"-" yaml:"-"` // the JWT token used to authenticate
 }
 
 // get as string
@@ -74,6 +92,10 @@ func (u *UserInfo) WipeOut() *UserInfo {
 	w := *u // copy
 	w.Password = ""
 	w.Passhash = ""
+	w.Tokens = nil
+	for _, t := range u.Tokens {
+		w.Tokens = append(w.Tokens, t.WipeOut())
+	}
 	return &w
 }
 
@@ -112,10 +134,18 @@ type Manager interface {
 	Delete(names []string) ([]*UserInfo, error)
 }
 
+// used to verify bearer tokens issued by external identity provider
+type BearerVerifier interface {
+	VerifyBearer(token string) (*UserInfo, error)
+}
+
 type Middleware struct {
 	provider Provider
 	realm    string
 	jwt      *jwt.GinJWTMiddleware
+	cluster  *ClusterToken // node-to-node authentication
+	lockout  *Lockout      // failed login throttling
+	revoked  *Revocation   // JWT token denylist
 
 	userCache     map[string]*UserInfo
 	userCacheLock sync.Mutex
@@ -150,6 +180,33 @@ func (mw *Middleware) EnableJwt(key []byte, alg string, tokenLifetime time.Durat
 	mw.jwt.Unauthorized = mw.unauthorized
 }
 
+// Enable node-to-node authentication
+// requests with "Cluster " tokens are verified by cluster secret
+func (mw *Middleware) EnableClusterAuth(ct *ClusterToken) {
+	mw.cluster = ct
+}
+
+// Enable failed login throttling
+// users and client IPs with too many failed attempts are locked for a while
+func (mw *Middleware) EnableLockout(l *Lockout) {
+	mw.lockout = l
+}
+
+// Enable JWT token revocation
+// revoked tokens are rejected even if they are not expired yet
+func (mw *Middleware) EnableRevocation(r *Revocation) {
+	mw.revoked = r
+}
+
+// TokenMaxAge gets the longest JWT token lifetime (including refreshes).
+func (mw *Middleware) TokenMaxAge() time.Duration {
+	if mw.jwt == nil {
+		return 0
+	}
+
+	return mw.jwt.MaxRefresh + mw.jwt.Timeout
+}
+
 // Login handler for JWT
 func (mw *Middleware) LoginHandler() gin.HandlerFunc {
 	return mw.jwt.LoginHandler
@@ -161,15 +218,62 @@ func (mw *Middleware) RefreshHandler() gin.HandlerFunc {
 }
 
 // Authentication middleware function
-// tries Basic Auth first, then JWT
+// tries cluster token first, then API key, then external token, then Basic Auth, then JWT
 func (mw *Middleware) Authentication() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Search user in the slice of allowed credentials
 		h := c.Request.Header.Get("Authorization")
 
+		// API key from "X-Api-Key" or "Authorization: Bearer" header
+		key := c.Request.Header.Get(ApiKeyHeader)
+		if len(key) == 0 && strings.HasPrefix(h, "Bearer ") && IsApiKey(h[len("Bearer "):]) {
+			key = h[len("Bearer "):]
+		}
+
+		if mw.cluster != nil && strings.HasPrefix(h, ClusterAuthScheme) {
+			// node-to-node request
+			if user, err := mw.cluster.Verify(h); err != nil {
+				mw.unauthorized(c, http.StatusUnauthorized, err.Error())
+				c.Abort()
+			} else {
+				c.Set(gin.AuthUserKey, user)
+			}
+			return
+		}
+
+		if len(key) != 0 {
+			tm, ok := mw.provider.(TokenManager)
+			if !ok {
+				mw.unauthorized(c, http.StatusUnauthorized, "API keys are not supported")
+				c.Abort()
+			} else if user, err := tm.VerifyToken(key, RemoteIP(c.Request)); err != nil {
+				mw.unauthorized(c, http.StatusUnauthorized, err.Error())
+				c.Abort()
+			} else {
+				c.Set(gin.AuthUserKey, user)
+			}
+			return
+		}
+
+		if bv, ok := mw.provider.(BearerVerifier); ok && strings.HasPrefix(h, "Bearer ") {
+			// token issued by identity provider
+			if user, err := bv.VerifyBearer(h[len("Bearer "):]); err != nil {
+				mw.unauthorized(c, http.StatusUnauthorized, err.Error())
+				c.Abort()
+			} else {
+				c.Set(gin.AuthUserKey, user)
+			}
+			return
+		}
+
 		username, password, ok, err := parseBasicAuth(h)
 		if ok && err == nil { // basic authentication
-			user := mw.provider.Verify(username, password)
+			if mw.isLocked(c, username) {
+				mw.unauthorized(c, http.StatusTooManyRequests, "")
+				c.Abort()
+				return
+			}
+			user := mw.verify(c, username, password)
 			if user == nil {
 				// Credentials doesn't match, we return 401 and abort handlers chain.
 				c.Header("WWW-Authenticate", "Basic realm="+strconv.Quote(mw.realm))
@@ -193,7 +297,10 @@ func (mw *Middleware) Authentication() gin.HandlerFunc {
 
 // authenticator: checks userId exists and password is correct
 func (mw *Middleware) authenticator(userId string, password string, c *gin.Context) (string, bool) {
-	user := mw.provider.Verify(userId, password)
+	if mw.isLocked(c, userId) {
+		return userId, false
+	}
+	user := mw.verify(c, userId, password)
 	if user != nil {
 		mw.putUserToCache(userId, user)
 		c.Set(gin.AuthUserKey, user)
@@ -201,9 +308,13 @@ func (mw *Middleware) authenticator(userId string, password string, c *gin.Conte
 	return userId, user != nil
 }
 
-// authorizator: all logged in users have access
+// authorizator: all logged in users have access unless token is revoked
 func (mw *Middleware) authorizator(userId string, ctx *gin.Context) bool {
 	if user := getUserFromJwt(userId, ctx); user != nil {
+		if mw.revoked != nil && mw.revoked.IsRevoked(user.SessionID, user.Name, getJwtIssued(ctx)) {
+			ctx.Set(revokedKey, true)
+			return false
+		}
 		ctx.Set(gin.AuthUserKey, user)
 	}
 	return true
@@ -218,6 +329,8 @@ func getUserFromJwt(userId string, ctx *gin.Context) *UserInfo {
 			user.Roles, _ = utils.AsStringSlice(val[tokenAttrRoles])
 			user.HomeDir, _ = utils.AsString(val[tokenAttrHomeDir])
 			user.ClusterTag, _ = utils.AsString(val[tokenAttrCluster])
+			user.Quota, _ = utils.AsString(val[tokenAttrQuota])
+			user.SessionID, _ = utils.AsString(val[tokenAttrID])
 			return user
 		}
 	}
@@ -225,6 +338,53 @@ func getUserFromJwt(userId string, ctx *gin.Context) *UserInfo {
 	return nil
 }
 
+// get token issue time (zero if unknown)
+// the original issue time is used for tokens issued before "iat" was added
+func getJwtIssued(ctx *gin.Context) time.Time {
+	if ival, ok := ctx.Get("JWT_PAYLOAD"); ok && ival != nil {
+		if val, ok := ival.(map[string]interface{}); ok {
+			for _, attr := range []string{tokenAttrIssued, tokenAttrOrigIat} {
+				if t, err := utils.AsInt64(val[attr]); err == nil && t > 0 {
+					return time.Unix(t, 0)
+				}
+			}
+		}
+	}
+
+	return time.Time{} // unknown
+}
+
+// check user or client IP is locked
+// the "Retry-After" header is reported
+func (mw *Middleware) isLocked(c *gin.Context, username string) bool {
+	if mw.lockout == nil {
+		return false
+	}
+
+	d := mw.lockout.Check(username, RemoteIP(c.Request))
+	if d <= 0 {
+		return false
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int((d+time.Second-1)/time.Second)))
+	c.Set(lockedKey, true)
+	return true
+}
+
+// verify user credentials and register failed attempts
+func (mw *Middleware) verify(c *gin.Context, username, password string) *UserInfo {
+	user := mw.provider.Verify(username, password)
+	if mw.lockout != nil {
+		if user != nil {
+			mw.lockout.Succeeded(username)
+		} else {
+			mw.lockout.Failed(username, RemoteIP(c.Request))
+		}
+	}
+
+	return user
+}
+
 // put user to cache
 func (mw *Middleware) putUserToCache(username string, user *UserInfo) {
 	mw.userCacheLock.Lock()
@@ -236,6 +396,15 @@ func (mw *Middleware) putUserToCache(username string, user *UserInfo) {
 
 // report unauthorized access
 func (mw *Middleware) unauthorized(c *gin.Context, code int, message string) {
+	if _, locked := c.Get(lockedKey); locked {
+		// the JWT login handler reports locked attempts as unauthorized
+		code = http.StatusTooManyRequests
+		message = "too many failed login attempts, try again later"
+	} else if _, revoked := c.Get(revokedKey); revoked {
+		// the JWT middleware reports rejected tokens as forbidden
+		code = http.StatusUnauthorized
+		message = "token is revoked"
+	}
 	c.JSON(code, gin.H{
 		"status":  code,
 		"message": message,
@@ -252,6 +421,9 @@ func (mw *Middleware) payload(userId string) map[string]interface{} {
 			tokenAttrRoles:   user.Roles,
 			tokenAttrHomeDir: user.HomeDir,
 			tokenAttrCluster: user.ClusterTag,
+			tokenAttrQuota:   user.Quota,
+			tokenAttrID:      newTokenID(),
+			tokenAttrIssued:  time.Now().Unix(),
 		}
 	}
 
@@ -282,3 +454,14 @@ func parseBasicAuth(auth string) (username, password string, ok bool, err error)
 
 	return cs[:s], cs[s+1:], ok, nil
 }
+
+// RemoteIP gets the IP address the request is received from.
+// X-Forwarded-For and X-Real-IP headers are not trusted.
+func RemoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		return strings.TrimSpace(req.RemoteAddr)
+	}
+
+	return host
+}
@@ -0,0 +1,269 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"fmt"
+)
+
+// used to check the user is known by provider
+type UserChecker interface {
+	HasUser(username string) (bool, error)
+}
+
+// ChainAuth tries a few providers in order.
+// User management and API keys are routed to the provider owning the user.
+type ChainAuth struct {
+	providers []Provider
+
+	// stop on the first provider that knows the user but rejects the password
+	stopOnFailure bool
+}
+
+// NewChain returns new chain of providers
+func NewChain(providers []Provider, stopOnFailure bool) (*ChainAuth, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no authentication providers in chain")
+	}
+	for _, p := range providers {
+		switch p.(type) {
+		case BearerVerifier:
+			return nil, fmt.Errorf("external token providers cannot be chained")
+		case *ChainAuth:
+			return nil, fmt.Errorf("nested chains are not supported")
+		}
+	}
+
+	return &ChainAuth{
+		providers:     providers,
+		stopOnFailure: stopOnFailure,
+	}, nil // OK
+}
+
+// reload all providers
+func (c *ChainAuth) Reload() error {
+	for _, p := range c.providers {
+		if err := p.Reload(); err != nil {
+			return err
+		}
+	}
+
+	return nil // OK
+}
+
+// verify user credentials
+func (c *ChainAuth) Verify(username, password string) *UserInfo {
+	for _, p := range c.providers {
+		if user := p.Verify(username, password); user != nil {
+			return user // OK
+		}
+
+		if c.stopOnFailure && ownsUser(p, username) {
+			return nil // definitive failure
+		}
+	}
+
+	return nil // not found
+}
+
+// check the provider knows the user
+func ownsUser(p Provider, username string) bool {
+	if uc, ok := p.(UserChecker); ok {
+		found, err := uc.HasUser(username)
+		return err == nil && found
+	}
+
+	return false
+}
+
+// get the user manager owning the user
+func (c *ChainAuth) getManager(username string) (Manager, error) {
+	for _, p := range c.providers {
+		if m, ok := p.(Manager); ok && ownsUser(p, username) {
+			return m, nil // found
+		}
+	}
+
+	return nil, fmt.Errorf(`no "%s" user found`, username)
+}
+
+// get the list of all users (of all user managers)
+func (c *ChainAuth) GetAllUsers() ([]*UserInfo, error) {
+	var res []*UserInfo
+	seen := make(map[string]bool)
+	for _, p := range c.providers {
+		m, ok := p.(Manager)
+		if !ok {
+			continue // not a user manager
+		}
+
+		users, err := m.GetAllUsers()
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			if !seen[u.Name] { // the first provider wins
+				seen[u.Name] = true
+				res = append(res, u)
+			}
+		}
+	}
+
+	return res, nil // OK
+}
+
+// get requested users
+func (c *ChainAuth) GetUsers(names []string) ([]*UserInfo, error) {
+	res := make([]*UserInfo, 0, len(names))
+	for _, name := range names {
+		m, err := c.getManager(name)
+		if err != nil {
+			return nil, err
+		}
+
+		users, err := m.GetUsers([]string{name})
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, users...)
+	}
+
+	return res, nil // OK
+}
+
+// create new user (by the first user manager)
+func (c *ChainAuth) CreateNew(user *UserInfo) (*UserInfo, error) {
+	var first Manager
+	for _, p := range c.providers {
+		if ownsUser(p, user.Name) {
+			return nil, fmt.Errorf(`"%s" user already exists`, user.Name)
+		}
+		if m, ok := p.(Manager); ok && first == nil {
+			first = m
+		}
+	}
+
+	if first == nil {
+		return nil, fmt.Errorf("no user manager found")
+	}
+
+	return first.CreateNew(user)
+}
+
+// update existing user
+func (c *ChainAuth) Update(user *UserInfo, missing string) (*UserInfo, error) {
+	m, err := c.getManager(user.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Update(user, missing)
+}
+
+// delete selected users
+func (c *ChainAuth) Delete(names []string) ([]*UserInfo, error) {
+	// all users should exist
+	managers := make([]Manager, 0, len(names))
+	for _, name := range names {
+		m, err := c.getManager(name)
+		if err != nil {
+			return nil, err
+		}
+		managers = append(managers, m)
+	}
+
+	res := make([]*UserInfo, 0, len(names))
+	for i, name := range names {
+		users, err := managers[i].Delete([]string{name})
+		if err != nil {
+			return res, err
+		}
+		res = append(res, users...)
+	}
+
+	return res, nil // OK
+}
+
+// get the API keys manager owning the user
+func (c *ChainAuth) getTokenManager(username string) (TokenManager, error) {
+	for _, p := range c.providers {
+		if tm, ok := p.(TokenManager); ok && ownsUser(p, username) {
+			return tm, nil // found
+		}
+	}
+
+	return nil, fmt.Errorf(`no "%s" user found or API keys are not supported`, username)
+}
+
+// get the list of user's API keys
+func (c *ChainAuth) GetTokens(username string) ([]*ApiToken, error) {
+	tm, err := c.getTokenManager(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return tm.GetTokens(username)
+}
+
+// add new API key to user
+func (c *ChainAuth) CreateToken(username string, token *ApiToken) error {
+	tm, err := c.getTokenManager(username)
+	if err != nil {
+		return err
+	}
+
+	return tm.CreateToken(username, token)
+}
+
+// revoke user's API key
+func (c *ChainAuth) RevokeToken(username string, id string) (*ApiToken, error) {
+	tm, err := c.getTokenManager(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return tm.RevokeToken(username, id)
+}
+
+// verify API key by any provider
+func (c *ChainAuth) VerifyToken(key string, remoteIP string) (*UserInfo, error) {
+	err := fmt.Errorf("API keys are not supported")
+	for _, p := range c.providers {
+		if tm, ok := p.(TokenManager); ok {
+			var user *UserInfo
+			if user, err = tm.VerifyToken(key, remoteIP); err == nil {
+				return user, nil // OK
+			}
+		}
+	}
+
+	return nil, err
+}
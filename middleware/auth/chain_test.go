@@ -0,0 +1,217 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fake provider (name -> password)
+type testProvider struct {
+	users map[string]string
+	tag   string
+}
+
+// reload
+func (p *testProvider) Reload() error {
+	return nil
+}
+
+// verify password
+func (p *testProvider) Verify(username, password string) *UserInfo {
+	if pass, ok := p.users[username]; ok && pass == password {
+		return &UserInfo{Name: username, ClusterTag: p.tag}
+	}
+
+	return nil
+}
+
+// check user exists
+func (p *testProvider) HasUser(username string) (bool, error) {
+	_, ok := p.users[username]
+	return ok, nil
+}
+
+// fake user manager
+type testManager struct {
+	testProvider
+}
+
+// get all users
+func (m *testManager) GetAllUsers() ([]*UserInfo, error) {
+	var res []*UserInfo
+	for name := range m.users {
+		res = append(res, &UserInfo{Name: name, ClusterTag: m.tag})
+	}
+	return res, nil
+}
+
+// get requested users
+func (m *testManager) GetUsers(names []string) ([]*UserInfo, error) {
+	var res []*UserInfo
+	for _, name := range names {
+		if _, ok := m.users[name]; !ok {
+			return nil, fmt.Errorf(`no "%s" user found`, name)
+		}
+		res = append(res, &UserInfo{Name: name, ClusterTag: m.tag})
+	}
+	return res, nil
+}
+
+// create new user
+func (m *testManager) CreateNew(user *UserInfo) (*UserInfo, error) {
+	m.users[user.Name] = user.Password
+	return &UserInfo{Name: user.Name, ClusterTag: m.tag}, nil
+}
+
+// update user
+func (m *testManager) Update(user *UserInfo, missing string) (*UserInfo, error) {
+	if user.Password != missing {
+		m.users[user.Name] = user.Password
+	}
+	return &UserInfo{Name: user.Name, ClusterTag: m.tag}, nil
+}
+
+// delete users
+func (m *testManager) Delete(names []string) ([]*UserInfo, error) {
+	var res []*UserInfo
+	for _, name := range names {
+		delete(m.users, name)
+		res = append(res, &UserInfo{Name: name, ClusterTag: m.tag})
+	}
+	return res, nil
+}
+
+// test chained authentication
+func TestChainVerify(t *testing.T) {
+	file := &testManager{testProvider{users: map[string]string{"svc": "123", "joe": "file"}, tag: "file"}}
+	ldap := &testProvider{users: map[string]string{"joe": "ldap", "foo": "456"}, tag: "ldap"}
+
+	c, err := NewChain([]Provider{file, ldap}, false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	check := func(username, password string, expectedTag string) {
+		user := c.Verify(username, password)
+		if expectedTag == "" {
+			assert.Nil(t, user, "%s:%s", username, password)
+		} else if assert.NotNil(t, user, "%s:%s", username, password) {
+			assert.Equal(t, expectedTag, user.ClusterTag)
+		}
+	}
+
+	check("svc", "123", "file")
+	check("foo", "456", "ldap")
+	check("joe", "file", "file")
+	check("joe", "ldap", "ldap") // next provider is tried
+	check("joe", "bad", "")
+	check("missing", "123", "")
+
+	// stop on failure
+	c.stopOnFailure = true
+	check("joe", "file", "file")
+	check("joe", "ldap", "") // known by file provider
+	check("foo", "456", "ldap")
+
+	// bad chains
+	_, err = NewChain(nil, false)
+	assert.Error(t, err)
+	_, err = NewChain([]Provider{c}, false)
+	assert.Error(t, err)
+}
+
+// test user management is routed to the owner
+func TestChainManager(t *testing.T) {
+	ldap := &testProvider{users: map[string]string{"joe": "ldap"}, tag: "ldap"}
+	file1 := &testManager{testProvider{users: map[string]string{"svc": "123"}, tag: "file1"}}
+	file2 := &testManager{testProvider{users: map[string]string{"svc": "456", "bot": "789"}, tag: "file2"}}
+
+	c, err := NewChain([]Provider{ldap, file1, file2}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	users, err := c.GetAllUsers()
+	if assert.NoError(t, err) {
+		tags := make(map[string]string)
+		for _, u := range users {
+			tags[u.Name] = u.ClusterTag
+		}
+		assert.Equal(t, map[string]string{"svc": "file1", "bot": "file2"}, tags)
+	}
+
+	users, err = c.GetUsers([]string{"bot", "svc"})
+	if assert.NoError(t, err) && assert.Len(t, users, 2) {
+		assert.Equal(t, "file2", users[0].ClusterTag)
+		assert.Equal(t, "file1", users[1].ClusterTag)
+	}
+	_, err = c.GetUsers([]string{"joe"}) // not managed
+	assert.Error(t, err)
+
+	// create
+	_, err = c.CreateNew(&UserInfo{Name: "joe", Password: "new"})
+	assert.EqualError(t, err, `"joe" user already exists`)
+	user, err := c.CreateNew(&UserInfo{Name: "new", Password: "new"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "file1", user.ClusterTag)
+	}
+
+	// update
+	user, err = c.Update(&UserInfo{Name: "bot", Password: "000"}, "*")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "file2", user.ClusterTag)
+		assert.Equal(t, "000", file2.users["bot"])
+	}
+	_, err = c.Update(&UserInfo{Name: "joe", Password: "000"}, "*")
+	assert.Error(t, err)
+
+	// delete
+	_, err = c.Delete([]string{"bot", "missing"})
+	assert.Error(t, err)
+	assert.Contains(t, file2.users, "bot") // nothing deleted
+	users, err = c.Delete([]string{"bot", "new"})
+	if assert.NoError(t, err) && assert.Len(t, users, 2) {
+		assert.Equal(t, "file2", users[0].ClusterTag)
+		assert.Equal(t, "file1", users[1].ClusterTag)
+	}
+	assert.NotContains(t, file2.users, "bot")
+	assert.NotContains(t, file1.users, "new")
+
+	// API keys are not supported by fake providers
+	_, err = c.GetTokens("svc")
+	assert.Error(t, err)
+	_, err = c.VerifyToken("ryft_1_2", "127.0.0.1")
+	assert.EqualError(t, err, "API keys are not supported")
+}
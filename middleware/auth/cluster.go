@@ -0,0 +1,147 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/getryft/ryft-server/search/utils"
+
+	"gopkg.in/dgrijalva/jwt-go.v2"
+)
+
+const (
+	// Authorization scheme of node-to-node requests
+	ClusterAuthScheme = "Cluster "
+
+	tokenAttrSubject = "sub"
+	tokenAttrIssuer  = "iss"
+	tokenAttrExpire  = "exp"
+	tokenAttrIssued  = "iat"
+	tokenAttrKind    = "kind"
+
+	clusterTokenKind = "cluster"
+)
+
+// ClusterToken issues and verifies cluster-signed service tokens.
+// The service token is used for node-to-node requests instead of
+// the user's credentials and carries the user identity as claims.
+type ClusterToken struct {
+	key      []byte
+	method   jwt.SigningMethod
+	lifetime time.Duration
+}
+
+// NewClusterToken creates new cluster token issuer/verifier.
+// `alg` - signing algorithm
+func NewClusterToken(key []byte, alg string, lifetime time.Duration) (*ClusterToken, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("no cluster secret provided")
+	}
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("failed to get signing method for %q", alg)
+	}
+	if lifetime <= 0 {
+		return nil, fmt.Errorf("invalid cluster token lifetime: %s", lifetime)
+	}
+
+	return &ClusterToken{
+		key:      key,
+		method:   method,
+		lifetime: lifetime,
+	}, nil // OK
+}
+
+// Issue creates new service token (including "Cluster " prefix) for the user.
+// `node` is the name of issuing node.
+func (ct *ClusterToken) Issue(user *UserInfo, node string) (string, error) {
+	now := time.Now()
+
+	token := jwt.New(ct.method)
+	token.Claims[tokenAttrKind] = clusterTokenKind
+	token.Claims[tokenAttrSubject] = user.Name
+	token.Claims[tokenAttrIssuer] = node
+	token.Claims[tokenAttrIssued] = now.Unix()
+	token.Claims[tokenAttrExpire] = now.Add(ct.lifetime).Unix()
+	token.Claims[tokenAttrRoles] = user.Roles
+	token.Claims[tokenAttrHomeDir] = user.HomeDir
+	token.Claims[tokenAttrCluster] = user.ClusterTag
+	token.Claims[tokenAttrQuota] = user.Quota
+	if len(user.Scope) != 0 {
+		token.Claims[tokenAttrScope] = user.Scope
+	}
+
+	signed, err := token.SignedString(ct.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign cluster token: %s", err)
+	}
+
+	return ClusterAuthScheme + signed, nil // OK
+}
+
+// Verify parses the service token (including "Cluster " prefix)
+// and gets the user information.
+func (ct *ClusterToken) Verify(header string) (*UserInfo, error) {
+	if !strings.HasPrefix(header, ClusterAuthScheme) {
+		return nil, fmt.Errorf("no cluster token provided")
+	}
+
+	token, err := jwt.Parse(header[len(ClusterAuthScheme):], func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != ct.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %s", t.Method.Alg())
+		}
+		return ct.key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cluster token: %s", err)
+	}
+	if kind, _ := utils.AsString(token.Claims[tokenAttrKind]); kind != clusterTokenKind {
+		return nil, fmt.Errorf("not a cluster token")
+	}
+	if _, ok := token.Claims[tokenAttrExpire]; !ok {
+		return nil, fmt.Errorf("cluster token has no expiration time")
+	}
+
+	user := new(UserInfo)
+	user.Name, _ = utils.AsString(token.Claims[tokenAttrSubject])
+	user.Roles, _ = utils.AsStringSlice(token.Claims[tokenAttrRoles])
+	user.HomeDir, _ = utils.AsString(token.Claims[tokenAttrHomeDir])
+	user.ClusterTag, _ = utils.AsString(token.Claims[tokenAttrCluster])
+	user.Quota, _ = utils.AsString(token.Claims[tokenAttrQuota])
+	user.Scope, _ = utils.AsStringSlice(token.Claims[tokenAttrScope])
+	if len(user.Name) == 0 {
+		return nil, fmt.Errorf("cluster token has no subject")
+	}
+
+	return user, nil // OK
+}
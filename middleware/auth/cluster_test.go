@@ -0,0 +1,121 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// test cluster token issue/verify
+func TestClusterToken(t *testing.T) {
+	_, err := NewClusterToken(nil, "HS256", time.Minute)
+	assert.Error(t, err)
+	_, err = NewClusterToken([]byte("secret"), "bad", time.Minute)
+	assert.Error(t, err)
+
+	ct, err := NewClusterToken([]byte("secret"), "HS256", time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	user := &UserInfo{
+		Name:       "joe",
+		Passhash:   "hash",
+		Roles:      []string{"user"},
+		HomeDir:    "/joe",
+		ClusterTag: "joe-tag",
+		Quota:      "10GB",
+	}
+	token, err := ct.Issue(user, "node-1")
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(token, ClusterAuthScheme))
+
+		u, err := ct.Verify(token)
+		if assert.NoError(t, err) {
+			assert.Equal(t, user.WipeOut(), u)
+		}
+	}
+
+	// wrong secret
+	other, _ := NewClusterToken([]byte("other"), "HS256", time.Minute)
+	_, err = other.Verify(token)
+	assert.Error(t, err)
+
+	// expired
+	old, _ := NewClusterToken([]byte("secret"), "HS256", time.Nanosecond)
+	expired, _ := old.Issue(user, "node-1")
+	time.Sleep(1100 * time.Millisecond)
+	_, err = ct.Verify(expired)
+	assert.Error(t, err)
+
+	// not a cluster token
+	_, err = ct.Verify("Bearer " + strings.TrimPrefix(token, ClusterAuthScheme))
+	assert.Error(t, err)
+}
+
+// test middleware with cluster token
+func TestClusterAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ct, _ := NewClusterToken([]byte("secret"), "HS256", time.Minute)
+	mw := NewMiddleware(nil, "")
+	mw.EnableClusterAuth(ct)
+
+	router := gin.New()
+	router.Use(mw.Authentication())
+	router.GET("/whoami", func(c *gin.Context) {
+		user := c.MustGet(gin.AuthUserKey).(*UserInfo)
+		c.String(http.StatusOK, "%s:%s", user.Name, user.HomeDir)
+	})
+
+	check := func(header string, expectedStatus int, expectedBody string) {
+		req, _ := http.NewRequest("GET", "/whoami", nil)
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expectedStatus, w.Code)
+		if expectedBody != "" {
+			assert.Equal(t, expectedBody, w.Body.String())
+		}
+	}
+
+	token, _ := ct.Issue(&UserInfo{Name: "joe", HomeDir: "/joe"}, "node-1")
+	check(token, http.StatusOK, "joe:/joe")
+	check(token+"bad", http.StatusUnauthorized, "")
+	check("", http.StatusUnauthorized, "")
+}
@@ -31,6 +31,7 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -39,6 +40,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -47,14 +49,19 @@ import (
 
 const (
 	PasswordCost = bcrypt.DefaultCost
+
+	// API key last-used timestamps are saved not often than
+	tokenSaveInterval = time.Minute
 )
 
 // FileAuth contains dictionary of users
 type FileAuth struct {
 	Users    map[string]*UserInfo
 	FileName string
+	Policy   PasswordPolicy // checked for new passwords
 
-	mx sync.Mutex
+	mx          sync.Mutex
+	tokensSaved time.Time // last time the API key timestamps saved
 }
 
 // NewFile returns new File based credentials
@@ -96,21 +103,55 @@ func (f *FileAuth) Reload() error {
 }
 
 // verify user credentials
+// plain passwords are replaced with hashes on successful login
 func (f *FileAuth) Verify(username, password string) *UserInfo {
-	if u, ok := f.Users[username]; ok {
-		if u.Passhash != "" {
-			if err := bcrypt.CompareHashAndPassword([]byte(u.Passhash), []byte(password)); err == nil {
-				return u // verified!
-			}
-		} else {
-			// fallback to plain password check
-			if u.Password == password {
-				return u // verified!
-			}
+	f.mx.Lock()
+	u, ok := f.Users[username]
+	var passhash, plain string
+	if ok {
+		passhash, plain = u.Passhash, u.Password
+	}
+	f.mx.Unlock()
+
+	if !ok || len(password) == 0 {
+		return nil // not found or no password
+	}
+
+	if passhash != "" {
+		// hash is checked without lock, it's slow
+		if err := bcrypt.CompareHashAndPassword([]byte(passhash), []byte(password)); err == nil {
+			return u // verified!
 		}
+	} else if subtle.ConstantTimeCompare([]byte(plain), []byte(password)) == 1 {
+		// fallback to plain password check
+		f.migratePassword(u, password)
+		return u // verified!
 	}
 
-	return nil // not found or invalid password
+	return nil // invalid password
+}
+
+// replace plain password with hash
+func (f *FileAuth) migratePassword(u *UserInfo, password string) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return // keep plain password
+	}
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if u.Passhash != "" || u.Password != password {
+		return // already changed
+	}
+
+	u.Passhash = string(hash)
+	u.Password = ""
+	if err := f.saveFile(); err != nil {
+		// will try next time
+		u.Passhash = ""
+		u.Password = password
+	}
 }
 
 // get all users
@@ -143,6 +184,15 @@ func (f *FileAuth) GetUsers(names []string) ([]*UserInfo, error) {
 	return res, nil // OK
 }
 
+// check user exists
+func (f *FileAuth) HasUser(username string) (bool, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	_, ok := f.Users[username]
+	return ok, nil
+}
+
 // create new user
 func (f *FileAuth) CreateNew(user *UserInfo) (*UserInfo, error) {
 	f.mx.Lock()
@@ -151,6 +201,9 @@ func (f *FileAuth) CreateNew(user *UserInfo) (*UserInfo, error) {
 	if _, ok := f.Users[user.Name]; ok {
 		return nil, fmt.Errorf(`"%s" user already exists`, user.Name)
 	}
+	if err := f.Policy.Check(user.Name, user.Password); err != nil {
+		return nil, err
+	}
 
 	// calculate hash on password
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), PasswordCost)
@@ -159,6 +212,7 @@ func (f *FileAuth) CreateNew(user *UserInfo) (*UserInfo, error) {
 	}
 	user.Passhash = string(hash)
 	user.Password = ""
+	user.Tokens = nil // API keys are created separately
 
 	// save updated file
 	f.Users[user.Name] = user
@@ -182,6 +236,9 @@ func (f *FileAuth) Update(newUser *UserInfo, missing string) (*UserInfo, error)
 
 	// change the password
 	if newUser.Password != missing {
+		if err := f.Policy.Check(user.Name, newUser.Password); err != nil {
+			return nil, err
+		}
 		hash, err := bcrypt.GenerateFromPassword([]byte(newUser.Password), PasswordCost)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate password hash: %s", err)
@@ -203,6 +260,12 @@ func (f *FileAuth) Update(newUser *UserInfo, missing string) (*UserInfo, error)
 		changed = true
 	}
 
+	// change the storage quota
+	if newUser.Quota != missing && user.Quota != newUser.Quota {
+		user.Quota = newUser.Quota
+		changed = true
+	}
+
 	// change the roles
 	if strings.Join(newUser.Roles, ":") != missing && strings.Join(user.Roles, ":") != strings.Join(newUser.Roles, ":") {
 		user.Roles = newUser.Roles
@@ -246,6 +309,110 @@ func (f *FileAuth) Delete(names []string) ([]*UserInfo, error) {
 	return res, nil // OK
 }
 
+// get user's API keys
+func (f *FileAuth) GetTokens(username string) ([]*ApiToken, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	u, ok := f.Users[username]
+	if !ok {
+		return nil, fmt.Errorf(`no "%s" user found`, username)
+	}
+
+	res := make([]*ApiToken, 0, len(u.Tokens))
+	for _, t := range u.Tokens {
+		res = append(res, t.WipeOut())
+	}
+
+	return res, nil // OK
+}
+
+// add new API key to user
+func (f *FileAuth) CreateToken(username string, token *ApiToken) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	u, ok := f.Users[username]
+	if !ok {
+		return fmt.Errorf(`no "%s" user found`, username)
+	}
+
+	// save updated file
+	u.Tokens = append(u.Tokens, token)
+	if err := f.saveFile(); err != nil {
+		u.Tokens = u.Tokens[:len(u.Tokens)-1]
+		return fmt.Errorf("failed to save users: %s", err)
+	}
+
+	return nil // OK
+}
+
+// revoke user's API key
+func (f *FileAuth) RevokeToken(username string, id string) (*ApiToken, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	u, ok := f.Users[username]
+	if !ok {
+		return nil, fmt.Errorf(`no "%s" user found`, username)
+	}
+
+	for i, t := range u.Tokens {
+		if t.ID != id {
+			continue
+		}
+
+		// save updated file
+		u.Tokens = append(u.Tokens[:i:i], u.Tokens[i+1:]...)
+		if err := f.saveFile(); err != nil {
+			return nil, fmt.Errorf("failed to save users: %s", err)
+		}
+
+		return t.WipeOut(), nil // OK
+	}
+
+	return nil, fmt.Errorf(`no "%s" API key found`, id)
+}
+
+// verify API key
+func (f *FileAuth) VerifyToken(key string, remoteIP string) (*UserInfo, error) {
+	id, secret, ok := parseApiKey(key)
+	if !ok {
+		return nil, fmt.Errorf("invalid API key")
+	}
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	for _, u := range f.Users {
+		for _, t := range u.Tokens {
+			if t.ID != id {
+				continue
+			}
+
+			now := time.Now().UTC()
+			if err := t.verify(secret, remoteIP, now); err != nil {
+				return nil, err
+			}
+
+			// last-used timestamps are saved periodically
+			t.LastUsed = now.Format(time.RFC3339)
+			if now.Sub(f.tokensSaved) >= tokenSaveInterval {
+				f.tokensSaved = now
+				_ = f.saveFile() // ignore errors
+			}
+
+			user := u.WipeOut()
+			user.Tokens = nil
+			user.Scope = t.Scope
+			user.TokenID = t.ID
+			return user, nil // OK
+		}
+	}
+
+	return nil, fmt.Errorf("invalid API key")
+}
+
 // save user credentials
 func (f *FileAuth) saveFile() error {
 	// get list of users
@@ -95,5 +95,78 @@ func TestReadUsersFileYaml(t *testing.T) {
 	}
 }
 
+// test plain passwords are replaced with hashes
+func TestFileAuthMigratePassword(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "auth_test_")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	file := filepath.Join(tmpdir, "users.yaml")
+	data := `
+- username: "joe"
+  password: "123"
+`
+	if !assert.NoError(t, ioutil.WriteFile(file, []byte(data), 0644)) {
+		return
+	}
+
+	f, err := NewFile(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Nil(t, f.Verify("joe", "bad"))
+	assert.Nil(t, f.Verify("joe", ""))
+	assert.Nil(t, f.Verify("missing", "123"))
+	assert.NotNil(t, f.Verify("joe", "123"))
+
+	// hash should be saved
+	users, err := readUsersFile(file)
+	if assert.NoError(t, err) && assert.Len(t, users, 1) {
+		assert.Empty(t, users[0].Password)
+		assert.NotEmpty(t, users[0].Passhash)
+	}
+	assert.NotNil(t, f.Verify("joe", "123"))
+	assert.Nil(t, f.Verify("joe", "bad"))
+}
+
+// test password policy is checked for new passwords
+func TestFileAuthPasswordPolicy(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "auth_test_")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	file := filepath.Join(tmpdir, "users.json")
+	if !assert.NoError(t, ioutil.WriteFile(file, []byte(`[]`), 0644)) {
+		return
+	}
+
+	f, err := NewFile(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+	f.Policy = PasswordPolicy{MinLength: 8, RequireDigit: true}
+
+	_, err = f.CreateNew(&UserInfo{Name: "joe", Password: "short"})
+	assert.IsType(t, &PasswordPolicyError{}, err)
+	_, err = f.CreateNew(&UserInfo{Name: "joe", Password: "long-secret-1"})
+	assert.NoError(t, err)
+
+	const missing = "{{missing}}"
+	update := func(password string) error {
+		_, err := f.Update(&UserInfo{Name: "joe", Password: password, Passhash: missing,
+			Roles: []string{missing}, HomeDir: missing, ClusterTag: missing, Quota: missing}, missing)
+		return err
+	}
+	assert.IsType(t, &PasswordPolicyError{}, update("no-digits-here"))
+	assert.NotNil(t, f.Verify("joe", "long-secret-1"))
+	assert.NoError(t, update("new-secret-2"))
+	assert.NotNil(t, f.Verify("joe", "new-secret-2"))
+}
+
 // TODO: check bad extension
 // TODO: check duplicate user info
@@ -27,16 +27,39 @@
  * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
  * ============
  */
-
 package auth
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/ldap.v2"
 )
 
+const (
+	// verified users are cached for
+	defaultLdapCacheTTL = time.Minute
+
+	// maximum number of LDAP connections
+	defaultLdapPoolSize = 4
+)
+
+// LDAP attribute names
+type LdapAttributes struct {
+	HomeDir    string `yaml:"home,omitempty"`        // "postalAddress" by default
+	ClusterTag string `yaml:"cluster-tag,omitempty"` // "postalCode" by default
+	Quota      string `yaml:"quota,omitempty"`       // not used by default
+	MemberOf   string `yaml:"member-of,omitempty"`   // "memberOf" by default
+}
+
 // LDAP configuration
 type LdapConfig struct {
 	ServerAddress string `yaml:"server,omitempty"`
@@ -45,6 +68,18 @@ type LdapConfig struct {
 	QueryFormat   string `yaml:"query,omitempty"`
 	BaseDN        string `yaml:"basedn,omitempty"`
 
+	Roles []string `yaml:"roles,omitempty"` // roles of all LDAP users
+
+	Attributes LdapAttributes `yaml:"attributes,omitempty"`
+
+	// group membership (in addition to "memberOf" attribute)
+	GroupBaseDN string              `yaml:"group-basedn,omitempty"` // BaseDN by default
+	GroupQuery  string              `yaml:"group-query,omitempty"`  // "(member=%s)", %s is user DN
+	GroupRoles  map[string][]string `yaml:"group-roles,omitempty"`  // group DN or name -> roles
+
+	CacheTTL string `yaml:"cache-ttl,omitempty"` // "1m" by default, "0" disables cache
+	PoolSize int    `yaml:"pool-size,omitempty"` // maximum number of connections
+
 	InsecureSkipTLS    bool `yaml:"insecure-skip-tls,omitempty"`
 	InsecureSkipVerify bool `yaml:"insecure-skip-verify,omitempty"`
 }
@@ -52,67 +87,195 @@ type LdapConfig struct {
 // LdapAuth contains LDAP related information
 type LdapAuth struct {
 	LdapConfig
+	cacheTTL time.Duration
+
+	// verified users
+	cache    map[string]*ldapCacheItem
+	cacheKey []byte // to hash cached passwords
+	cacheMx  sync.Mutex
+
+	// connection pool
+	slots chan struct{}   // limits number of connections
+	idle  chan *ldap.Conn // idle connections
+}
 
-	// TODO: conn *ldap.Conn for caching
+// verified user
+type ldapCacheItem struct {
+	user    *UserInfo
+	hash    []byte // password hash
+	expires time.Time
 }
 
 const (
-	// TODO: appropriate attribute names
 	attrHomeDir    = "postalAddress"
 	attrClusterTag = "postalCode"
+	attrMemberOf   = "memberOf"
 )
 
 // NewLDAP returns new LDAP based credentials
 func NewLDAP(config LdapConfig) (*LdapAuth, error) {
-	a := &LdapAuth{config}
+	a := &LdapAuth{LdapConfig: config}
+
+	// default attribute names
+	if len(a.Attributes.HomeDir) == 0 {
+		a.Attributes.HomeDir = attrHomeDir
+	}
+	if len(a.Attributes.ClusterTag) == 0 {
+		a.Attributes.ClusterTag = attrClusterTag
+	}
+	if len(a.Attributes.MemberOf) == 0 {
+		a.Attributes.MemberOf = attrMemberOf
+	}
+	if len(a.GroupBaseDN) == 0 {
+		a.GroupBaseDN = a.BaseDN
+	}
+
+	a.cacheTTL = defaultLdapCacheTTL
+	if len(a.CacheTTL) != 0 {
+		ttl, err := time.ParseDuration(a.CacheTTL)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("%q is not a valid LDAP cache TTL", a.CacheTTL)
+		}
+		a.cacheTTL = ttl
+	}
+	a.cache = make(map[string]*ldapCacheItem)
+	a.cacheKey = make([]byte, 32)
+	if _, err := rand.Read(a.cacheKey); err != nil {
+		return nil, fmt.Errorf("failed to generate cache key: %s", err)
+	}
+
+	switch {
+	case a.PoolSize == 0:
+		a.PoolSize = defaultLdapPoolSize
+	case a.PoolSize < 0:
+		return nil, fmt.Errorf("%d is not a valid LDAP pool size", a.PoolSize)
+	}
+	a.slots = make(chan struct{}, a.PoolSize)
+	a.idle = make(chan *ldap.Conn, a.PoolSize)
+
 	return a, nil // OK
 }
 
 // reload user credentials
 func (a *LdapAuth) Reload() error {
-	// TODO: update LDAP options?
-	return nil // OK
+	// drop cached users
+	a.cacheMx.Lock()
+	a.cache = make(map[string]*ldapCacheItem)
+	a.cacheMx.Unlock()
+
+	// close idle connections
+	for {
+		select {
+		case conn := <-a.idle:
+			conn.Close()
+		default:
+			return nil // OK
+		}
+	}
 }
 
 // verify user credentials
 func (a *LdapAuth) Verify(username, password string) *UserInfo {
+	if len(password) == 0 {
+		return nil // unauthenticated bind is not allowed
+	}
+
+	if user := a.getCached(username, password); user != nil {
+		return user
+	}
+
 	user, err := a.verify(username, password)
 	if err != nil {
 		return nil // not found or invalid password
 		// or failed to dial LDAP server
 	}
 
+	a.putCached(username, password, user)
 	return user
 }
 
 // check LDAP server
 func (a *LdapAuth) verify(username, password string) (*UserInfo, error) {
-	// Connect to LDAP server
-	conn, err := ldap.Dial("tcp", a.ServerAddress)
+	conn, err := a.getConn()
 	if err != nil {
-		return nil, fmt.Errorf("failed to dial LDAP: %s", err)
+		return nil, err
 	}
-	defer conn.Close()
+	healthy := false
+	defer func() {
+		a.putConn(conn, healthy)
+	}()
 
-	// Reconnect with TLS
-	if !a.InsecureSkipTLS {
-		err = conn.StartTLS(&tls.Config{InsecureSkipVerify: a.InsecureSkipVerify})
+	// Search for the given username
+	attrs := []string{"dn", a.Attributes.HomeDir, a.Attributes.ClusterTag, a.Attributes.MemberOf}
+	if len(a.Attributes.Quota) != 0 {
+		attrs = append(attrs, a.Attributes.Quota)
+	}
+	entries, err := a.searchUser(conn, username, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) != 1 {
+		healthy = true
+		return nil, fmt.Errorf("user %q does not exist or too many entries returned", username)
+	}
+
+	entry := entries[0]
+	groups := entry.GetAttributeValues(a.Attributes.MemberOf)
+	if len(a.GroupQuery) != 0 {
+		found, err := a.searchGroups(conn, entry.DN)
 		if err != nil {
-			return nil, fmt.Errorf("failed to use TLS: %s", err)
+			return nil, err
 		}
+		groups = append(groups, found...)
 	}
 
-	// First bind with a read only user
-	err = conn.Bind(a.BindUsername, a.BindPassword)
+	// Bind as the user to verify their password
+	err = conn.Bind(entry.DN, password)
+	healthy = err == nil || ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials)
 	if err != nil {
-		return nil, fmt.Errorf("failed to bind readonly: %s", err)
+		return nil, fmt.Errorf("failed to bind user: %s", err)
 	}
 
-	// Search for the given username
+	user := new(UserInfo)
+	user.Name = entry.DN
+	// user.Password = password
+	user.HomeDir = entry.GetAttributeValue(a.Attributes.HomeDir)
+	user.ClusterTag = entry.GetAttributeValue(a.Attributes.ClusterTag)
+	if len(a.Attributes.Quota) != 0 {
+		user.Quota = entry.GetAttributeValue(a.Attributes.Quota)
+	}
+	user.Roles = a.getRoles(groups)
+
+	return user, nil // OK
+}
+
+// check user exists
+func (a *LdapAuth) HasUser(username string) (bool, error) {
+	conn, err := a.getConn()
+	if err != nil {
+		return false, err
+	}
+	healthy := false
+	defer func() {
+		a.putConn(conn, healthy)
+	}()
+
+	entries, err := a.searchUser(conn, username, []string{"dn"})
+	if err != nil {
+		return false, err
+	}
+	healthy = true
+
+	return len(entries) == 1, nil
+}
+
+// search for the given username
+func (a *LdapAuth) searchUser(conn *ldap.Conn, username string, attrs []string) ([]*ldap.Entry, error) {
 	req := ldap.NewSearchRequest(a.BaseDN, ldap.ScopeWholeSubtree,
 		ldap.NeverDerefAliases, 0, 0, false,
-		fmt.Sprintf(a.QueryFormat, username),
-		[]string{"dn", attrHomeDir, attrClusterTag},
+		fmt.Sprintf(a.QueryFormat, escapeFilter(username)),
+		attrs,
 		nil,
 	)
 
@@ -121,25 +284,207 @@ func (a *LdapAuth) verify(username, password string) (*UserInfo, error) {
 		return nil, fmt.Errorf("failed to search: %s", err)
 	}
 
-	if len(resp.Entries) != 1 {
-		return nil, fmt.Errorf("user does not exist or too many entries returned: %v", req)
+	return resp.Entries, nil // OK
+}
+
+// search groups the user is member of
+func (a *LdapAuth) searchGroups(conn *ldap.Conn, userdn string) ([]string, error) {
+	req := ldap.NewSearchRequest(a.GroupBaseDN, ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(a.GroupQuery, escapeFilter(userdn)),
+		[]string{"dn"},
+		nil,
+	)
+
+	resp, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search groups: %s", err)
+	}
+
+	groups := make([]string, 0, len(resp.Entries))
+	for _, e := range resp.Entries {
+		groups = append(groups, e.DN)
 	}
 
-	userdn := resp.Entries[0].DN
-	homeDir := resp.Entries[0].GetAttributeValue(attrHomeDir)
-	clusterTag := resp.Entries[0].GetAttributeValue(attrClusterTag)
+	return groups, nil // OK
+}
 
-	// Bind as the user to verify their password
-	err = conn.Bind(userdn, password)
+// get user roles based on group membership
+func (a *LdapAuth) getRoles(groups []string) []string {
+	roles := append([]string{}, a.Roles...)
+
+	// sorted for stable result
+	names := make([]string, 0, len(a.GroupRoles))
+	for name := range a.GroupRoles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, g := range groups {
+			if !strings.EqualFold(name, g) && !strings.EqualFold(name, groupName(g)) {
+				continue
+			}
+
+			for _, r := range a.GroupRoles[name] {
+				if !hasString(roles, r) {
+					roles = append(roles, r)
+				}
+			}
+			break
+		}
+	}
+
+	return roles
+}
+
+// get group name, i.e. the first RDN value
+// "cn=admins,ou=groups,dc=example,dc=com" -> "admins"
+func groupName(dn string) string {
+	if d, err := ldap.ParseDN(dn); err == nil && len(d.RDNs) != 0 && len(d.RDNs[0].Attributes) != 0 {
+		return d.RDNs[0].Attributes[0].Value
+	}
+
+	return dn // as is
+}
+
+// escape special characters of LDAP filter value (RFC 4515)
+func escapeFilter(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&buf, "\\%02x", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String()
+}
+
+// get connection bound as the read-only user
+// the number of connections is limited by pool size
+func (a *LdapAuth) getConn() (*ldap.Conn, error) {
+	a.slots <- struct{}{} // wait for free slot
+
+	for {
+		var conn *ldap.Conn
+		reused := false
+		select {
+		case conn = <-a.idle:
+			reused = true
+		default:
+			var err error
+			if conn, err = a.dial(); err != nil {
+				<-a.slots
+				return nil, err
+			}
+		}
+
+		// First bind with a read only user
+		if err := conn.Bind(a.BindUsername, a.BindPassword); err != nil {
+			conn.Close()
+			if reused {
+				continue // stale connection, try another one
+			}
+			<-a.slots
+			return nil, fmt.Errorf("failed to bind readonly: %s", err)
+		}
+
+		return conn, nil // OK
+	}
+}
+
+// release connection
+// healthy connection is kept for later use
+func (a *LdapAuth) putConn(conn *ldap.Conn, healthy bool) {
+	if healthy {
+		select {
+		case a.idle <- conn:
+		default:
+			conn.Close()
+		}
+	} else {
+		conn.Close()
+	}
+
+	<-a.slots // release slot
+}
+
+// connect to LDAP server
+func (a *LdapAuth) dial() (*ldap.Conn, error) {
+	// Connect to LDAP server
+	conn, err := ldap.Dial("tcp", a.ServerAddress)
 	if err != nil {
-		return nil, fmt.Errorf("failed to bind user: %s", err)
+		return nil, fmt.Errorf("failed to dial LDAP: %s", err)
 	}
 
-	user := new(UserInfo)
-	user.Name = userdn
-	// user.Password = password
-	user.HomeDir = homeDir
-	user.ClusterTag = clusterTag
+	// Reconnect with TLS
+	if !a.InsecureSkipTLS {
+		err = conn.StartTLS(&tls.Config{InsecureSkipVerify: a.InsecureSkipVerify})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to use TLS: %s", err)
+		}
+	}
 
-	return user, nil // OK
+	return conn, nil // OK
+}
+
+// get verified user from cache
+func (a *LdapAuth) getCached(username, password string) *UserInfo {
+	if a.cacheTTL <= 0 {
+		return nil // cache disabled
+	}
+
+	a.cacheMx.Lock()
+	defer a.cacheMx.Unlock()
+
+	item, ok := a.cache[username]
+	if !ok {
+		return nil // not found
+	}
+	if !time.Now().Before(item.expires) {
+		delete(a.cache, username)
+		return nil // expired
+	}
+	if !hmac.Equal(item.hash, a.hashPassword(password)) {
+		return nil // password changed?
+	}
+
+	user := *item.user // copy
+	return &user
+}
+
+// put verified user to cache
+func (a *LdapAuth) putCached(username, password string, user *UserInfo) {
+	if a.cacheTTL <= 0 {
+		return // cache disabled
+	}
+
+	a.cacheMx.Lock()
+	defer a.cacheMx.Unlock()
+
+	// remove expired items
+	now := time.Now()
+	for name, item := range a.cache {
+		if !now.Before(item.expires) {
+			delete(a.cache, name)
+		}
+	}
+
+	cached := *user // copy
+	a.cache[username] = &ldapCacheItem{
+		user:    &cached,
+		hash:    a.hashPassword(password),
+		expires: now.Add(a.cacheTTL),
+	}
+}
+
+// get password hash, passwords are never kept in memory as is
+func (a *LdapAuth) hashPassword(password string) []byte {
+	mac := hmac.New(sha256.New, a.cacheKey)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
 }
@@ -0,0 +1,134 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test LDAP configuration
+func TestLdapConfig(t *testing.T) {
+	a, err := NewLDAP(LdapConfig{BaseDN: "dc=example,dc=com"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "postalAddress", a.Attributes.HomeDir)
+		assert.Equal(t, "postalCode", a.Attributes.ClusterTag)
+		assert.Equal(t, "memberOf", a.Attributes.MemberOf)
+		assert.Equal(t, "dc=example,dc=com", a.GroupBaseDN)
+		assert.Equal(t, time.Minute, a.cacheTTL)
+		assert.Equal(t, 4, cap(a.slots))
+	}
+
+	a, err = NewLDAP(LdapConfig{
+		Attributes: LdapAttributes{HomeDir: "homeDirectory"},
+		CacheTTL:   "0",
+		PoolSize:   1,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "homeDirectory", a.Attributes.HomeDir)
+		assert.Equal(t, time.Duration(0), a.cacheTTL)
+		assert.Equal(t, 1, cap(a.slots))
+	}
+
+	_, err = NewLDAP(LdapConfig{CacheTTL: "bad"})
+	assert.Error(t, err)
+	_, err = NewLDAP(LdapConfig{PoolSize: -1})
+	assert.Error(t, err)
+}
+
+// test group to role mapping
+func TestLdapRoles(t *testing.T) {
+	a, err := NewLDAP(LdapConfig{
+		Roles: []string{"user"},
+		GroupRoles: map[string][]string{
+			"cn=admins,ou=groups,dc=example,dc=com": {"admin"},
+			"Analysts":                              {"analyst", "user"},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"user"}, a.getRoles(nil))
+	assert.Equal(t, []string{"user"}, a.getRoles([]string{"cn=others,ou=groups,dc=example,dc=com"}))
+	assert.Equal(t, []string{"user", "analyst"}, a.getRoles([]string{"cn=analysts,ou=groups,dc=example,dc=com"}))
+	assert.Equal(t, []string{"user", "analyst", "admin"}, a.getRoles([]string{
+		"cn=analysts,ou=groups,dc=example,dc=com",
+		"CN=Admins,OU=Groups,DC=example,DC=com",
+	}))
+
+	assert.Equal(t, "admins", groupName("cn=admins,ou=groups,dc=example,dc=com"))
+	assert.Equal(t, "admins", groupName("admins"))
+}
+
+// test LDAP filter escaping
+func TestLdapEscapeFilter(t *testing.T) {
+	assert.Equal(t, "joe", escapeFilter("joe"))
+	assert.Equal(t, `\2a\29\28uid=\2a`, escapeFilter("*)(uid=*"))
+	assert.Equal(t, `a\5cb\00`, escapeFilter("a\\b\x00"))
+}
+
+// test verified users cache
+func TestLdapCache(t *testing.T) {
+	a, err := NewLDAP(LdapConfig{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	user := &UserInfo{Name: "cn=joe,dc=example,dc=com", Roles: []string{"user"}}
+	assert.Nil(t, a.getCached("joe", "secret"))
+
+	a.putCached("joe", "secret", user)
+	if cached := a.getCached("joe", "secret"); assert.NotNil(t, cached) {
+		assert.Equal(t, user.Name, cached.Name)
+		assert.Equal(t, user.Roles, cached.Roles)
+		assert.False(t, user == cached) // copy
+	}
+	assert.Nil(t, a.getCached("joe", "bad"))
+	assert.Nil(t, a.getCached("foo", "secret"))
+
+	// expired
+	a.cache["joe"].expires = time.Now().Add(-time.Second)
+	assert.Nil(t, a.getCached("joe", "secret"))
+	assert.Empty(t, a.cache)
+
+	// reload drops cache
+	a.putCached("joe", "secret", user)
+	assert.NoError(t, a.Reload())
+	assert.Nil(t, a.getCached("joe", "secret"))
+
+	// disabled
+	a.cacheTTL = 0
+	a.putCached("joe", "secret", user)
+	assert.Nil(t, a.getCached("joe", "secret"))
+}
@@ -0,0 +1,274 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// lockout entries are cleaned up not often than
+	lockoutCleanupInterval = time.Minute
+)
+
+// LockoutConfig contains failed login throttling options.
+type LockoutConfig struct {
+	MaxFailures   int    `yaml:"max-failures,omitempty"`    // per user, 0 to disable
+	MaxIpFailures int    `yaml:"max-ip-failures,omitempty"` // per client IP, 0 to disable
+	Delay         string `yaml:"delay,omitempty"`           // the first lockout, doubled for each next failure
+	MaxDelay      string `yaml:"max-delay,omitempty"`       // the longest lockout
+	ResetAfter    string `yaml:"reset-after,omitempty"`     // failures are forgotten after
+}
+
+// LockoutInfo contains failed login attempts of a user or a client IP.
+type LockoutInfo struct {
+	User        string `json:"user,omitempty"`
+	IP          string `json:"ip,omitempty"`
+	Failures    int    `json:"failures"`
+	LastFailure string `json:"last-failure"`           // RFC3339
+	LockedUntil string `json:"locked-until,omitempty"` // RFC3339, empty - not locked
+}
+
+// failed login attempts
+type lockoutEntry struct {
+	failures int
+	last     time.Time // the last failure
+	until    time.Time // locked until
+}
+
+// lockout key
+type lockoutKey struct {
+	user string
+	ip   string
+}
+
+// Lockout tracks failed login attempts per user and per client IP.
+// Once there are too many failures the user (or IP) is locked
+// for exponentially growing period.
+type Lockout struct {
+	maxFailures   int
+	maxIpFailures int
+	delay         time.Duration
+	maxDelay      time.Duration
+	resetAfter    time.Duration
+
+	mx      sync.Mutex
+	entries map[lockoutKey]*lockoutEntry
+	cleaned time.Time // last cleanup
+	now     func() time.Time
+}
+
+// NewLockout creates new failed login tracker.
+func NewLockout(config LockoutConfig) (*Lockout, error) {
+	l := &Lockout{
+		maxFailures:   config.MaxFailures,
+		maxIpFailures: config.MaxIpFailures,
+		entries:       make(map[lockoutKey]*lockoutEntry),
+		now:           time.Now,
+	}
+	if l.maxFailures < 0 || l.maxIpFailures < 0 {
+		return nil, fmt.Errorf("maximum number of failures cannot be negative")
+	}
+
+	parse := func(s string, def time.Duration) (time.Duration, error) {
+		if len(s) == 0 {
+			return def, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("%q is not a valid lockout duration", s)
+		}
+		return d, nil
+	}
+
+	var err error
+	if l.delay, err = parse(config.Delay, time.Minute); err != nil {
+		return nil, err
+	}
+	if l.maxDelay, err = parse(config.MaxDelay, time.Hour); err != nil {
+		return nil, err
+	}
+	if l.resetAfter, err = parse(config.ResetAfter, time.Hour); err != nil {
+		return nil, err
+	}
+	if l.maxDelay < l.delay {
+		l.maxDelay = l.delay
+	}
+	if l.resetAfter < l.maxDelay {
+		l.resetAfter = l.maxDelay // keep failures while locked
+	}
+
+	return l, nil // OK
+}
+
+// Check reports the remaining lockout period of the user or client IP.
+// Zero means login attempt is allowed.
+func (l *Lockout) Check(username, remoteIP string) time.Duration {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := l.now()
+	var res time.Duration
+	for _, k := range l.keys(username, remoteIP) {
+		if e, ok := l.entries[k]; ok && now.Before(e.until) {
+			if d := e.until.Sub(now); d > res {
+				res = d
+			}
+		}
+	}
+
+	return res
+}
+
+// Failed registers failed login attempt.
+func (l *Lockout) Failed(username, remoteIP string) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	for _, k := range l.keys(username, remoteIP) {
+		e, ok := l.entries[k]
+		if !ok || now.Sub(e.last) >= l.resetAfter {
+			e = new(lockoutEntry)
+			l.entries[k] = e
+		}
+
+		e.failures++
+		e.last = now
+
+		limit := l.maxFailures
+		if len(k.ip) != 0 {
+			limit = l.maxIpFailures
+		}
+		if e.failures >= limit {
+			d := l.maxDelay
+			if n := uint(e.failures - limit); n < 32 && l.delay<<n < l.maxDelay {
+				d = l.delay << n
+			}
+			e.until = now.Add(d)
+		}
+	}
+}
+
+// Succeeded resets failed login attempts of the user.
+// The client IP failures are not reset.
+func (l *Lockout) Succeeded(username string) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	delete(l.entries, lockoutKey{user: username})
+}
+
+// GetAll reports all users and client IPs with failed login attempts.
+func (l *Lockout) GetAll() []*LockoutInfo {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	res := make([]*LockoutInfo, 0, len(l.entries))
+	for k, e := range l.entries {
+		info := &LockoutInfo{
+			User:        k.user,
+			IP:          k.ip,
+			Failures:    e.failures,
+			LastFailure: e.last.UTC().Format(time.RFC3339),
+		}
+		if now.Before(e.until) {
+			info.LockedUntil = e.until.UTC().Format(time.RFC3339)
+		}
+		res = append(res, info)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].User != res[j].User {
+			return res[i].User < res[j].User
+		}
+		return res[i].IP < res[j].IP
+	})
+	return res
+}
+
+// Unlock removes failed login attempts of the user and/or client IP.
+func (l *Lockout) Unlock(username, remoteIP string) []*LockoutInfo {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	res := make([]*LockoutInfo, 0, 2)
+	for _, k := range []lockoutKey{{user: username}, {ip: remoteIP}} {
+		if len(k.user) == 0 && len(k.ip) == 0 {
+			continue
+		}
+		if e, ok := l.entries[k]; ok {
+			res = append(res, &LockoutInfo{
+				User:        k.user,
+				IP:          k.ip,
+				Failures:    e.failures,
+				LastFailure: e.last.UTC().Format(time.RFC3339),
+			})
+			delete(l.entries, k)
+		}
+	}
+
+	return res
+}
+
+// get tracked keys (should be called under lock)
+func (l *Lockout) keys(username, remoteIP string) []lockoutKey {
+	keys := make([]lockoutKey, 0, 2)
+	if l.maxFailures > 0 && len(username) != 0 {
+		keys = append(keys, lockoutKey{user: username})
+	}
+	if l.maxIpFailures > 0 && len(remoteIP) != 0 {
+		keys = append(keys, lockoutKey{ip: remoteIP})
+	}
+	return keys
+}
+
+// remove forgotten entries (should be called under lock)
+func (l *Lockout) cleanup(now time.Time) {
+	if now.Sub(l.cleaned) < lockoutCleanupInterval {
+		return
+	}
+	l.cleaned = now
+
+	for k, e := range l.entries {
+		if now.Sub(e.last) >= l.resetAfter && !now.Before(e.until) {
+			delete(l.entries, k)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test failed logins lock user and client IP
+func TestLockout(t *testing.T) {
+	l, err := NewLockout(LockoutConfig{
+		MaxFailures:   3,
+		MaxIpFailures: 5,
+		Delay:         "1m",
+		MaxDelay:      "5m",
+		ResetAfter:    "10m",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	// user is locked after 3 failures
+	l.Failed("foo", "10.0.0.1")
+	l.Failed("foo", "10.0.0.1")
+	assert.Zero(t, l.Check("foo", "10.0.0.1"))
+	l.Failed("foo", "10.0.0.1")
+	assert.Equal(t, time.Minute, l.Check("foo", "10.0.0.2"))
+	assert.Zero(t, l.Check("bar", "10.0.0.2"))
+
+	// lockout period is doubled
+	now = now.Add(time.Minute)
+	assert.Zero(t, l.Check("foo", "10.0.0.2"))
+	l.Failed("foo", "10.0.0.2")
+	assert.Equal(t, 2*time.Minute, l.Check("foo", "10.0.0.2"))
+
+	// client IP is locked after 5 failures
+	now = now.Add(2 * time.Minute)
+	l.Failed("bar", "10.0.0.1")
+	l.Failed("baz", "10.0.0.1")
+	assert.Equal(t, time.Minute, l.Check("any", "10.0.0.1"))
+
+	// ... up to the maximum
+	for i := 0; i < 10; i++ {
+		l.Failed("foo", "10.0.0.3")
+	}
+	assert.Equal(t, 5*time.Minute, l.Check("foo", ""))
+
+	info := l.GetAll()
+	if assert.Len(t, info, 6) {
+		assert.Equal(t, "10.0.0.1", info[0].IP)
+		assert.Equal(t, 5, info[0].Failures)
+		assert.NotEmpty(t, info[0].LockedUntil)
+		assert.Equal(t, "bar", info[3].User)
+		assert.Empty(t, info[3].LockedUntil)
+		assert.Equal(t, "foo", info[5].User)
+		assert.Equal(t, 14, info[5].Failures)
+	}
+
+	// unlock
+	res := l.Unlock("foo", "10.0.0.1")
+	assert.Len(t, res, 2)
+	assert.Zero(t, l.Check("foo", "10.0.0.1"))
+	assert.Empty(t, l.Unlock("foo", ""))
+
+	// success resets user failures
+	l.Failed("bar", "")
+	l.Succeeded("bar")
+	l.Failed("bar", "")
+	l.Failed("bar", "")
+	assert.Zero(t, l.Check("bar", ""))
+
+	// failures are forgotten
+	now = now.Add(time.Hour)
+	l.Failed("bar", "")
+	assert.Zero(t, l.Check("bar", ""))
+	assert.Len(t, l.GetAll(), 1)
+
+	// bad config
+	_, err = NewLockout(LockoutConfig{MaxFailures: -1})
+	assert.Error(t, err)
+	_, err = NewLockout(LockoutConfig{MaxFailures: 1, Delay: "bad"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,434 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getryft/ryft-server/search/utils"
+
+	"gopkg.in/dgrijalva/jwt-go.v2"
+)
+
+const (
+	// JWKS is refreshed periodically to get rotated keys
+	defaultJwksRefresh = time.Hour
+
+	// JWKS is refreshed not often than
+	// (also used when unknown key identifier is found)
+	jwksMinRefresh = time.Minute
+
+	// JWKS download timeout
+	jwksTimeout = 10 * time.Second
+)
+
+// OIDC claim names
+// nested claims are separated by dots: "realm_access.roles"
+type OidcClaims struct {
+	Username   string `yaml:"username,omitempty"`    // "sub" by default
+	Roles      string `yaml:"roles,omitempty"`       // "roles" by default
+	HomeDir    string `yaml:"home,omitempty"`        // "home-dir" by default
+	ClusterTag string `yaml:"cluster-tag,omitempty"` // "cluster-tag" by default
+}
+
+// OpenID Connect configuration
+type OidcConfig struct {
+	Issuer      string   `yaml:"issuer,omitempty"`       // expected "iss" claim
+	Audience    string   `yaml:"audience,omitempty"`     // expected "aud" claim
+	JwksUrl     string   `yaml:"jwks-url,omitempty"`     // JWKS document URL
+	JwksFile    string   `yaml:"jwks-file,omitempty"`    // or local JWKS file
+	JwksRefresh string   `yaml:"jwks-refresh,omitempty"` // "1h" by default
+	Algorithms  []string `yaml:"algorithms,omitempty"`   // RS256, ES256 by default
+
+	Claims OidcClaims `yaml:"claims,omitempty"`
+	Roles  []string   `yaml:"roles,omitempty"` // roles of users with no roles claim
+
+	InsecureSkipVerify bool `yaml:"insecure-skip-verify,omitempty"`
+}
+
+// OidcAuth verifies tokens issued by external identity provider
+type OidcAuth struct {
+	OidcConfig
+	refresh time.Duration
+	client  *http.Client
+
+	mx      sync.Mutex
+	keys    []*jsonWebKey
+	loaded  time.Time // last successful JWKS load
+	checked time.Time // last JWKS load attempt
+}
+
+// JSON web key (public keys only)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+
+	key interface{} // *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// NewOIDC returns new OpenID Connect token verifier
+func NewOIDC(config OidcConfig) (*OidcAuth, error) {
+	a := &OidcAuth{OidcConfig: config}
+
+	if len(a.JwksUrl) == 0 && len(a.JwksFile) == 0 {
+		return nil, fmt.Errorf("no JWKS URL or file provided")
+	}
+
+	a.refresh = defaultJwksRefresh
+	if len(a.JwksRefresh) != 0 {
+		d, err := time.ParseDuration(a.JwksRefresh)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%q is not a valid JWKS refresh interval", a.JwksRefresh)
+		}
+		a.refresh = d
+	}
+
+	if len(a.Algorithms) == 0 {
+		a.Algorithms = []string{"RS256", "ES256"}
+	}
+	for _, alg := range a.Algorithms {
+		// symmetric keys cannot be published
+		if strings.HasPrefix(alg, "HS") || jwt.GetSigningMethod(alg) == nil {
+			return nil, fmt.Errorf("%q is not a supported signing algorithm", alg)
+		}
+	}
+
+	// default claim names
+	if len(a.Claims.Username) == 0 {
+		a.Claims.Username = tokenAttrSubject
+	}
+	if len(a.Claims.Roles) == 0 {
+		a.Claims.Roles = tokenAttrRoles
+	}
+	if len(a.Claims.HomeDir) == 0 {
+		a.Claims.HomeDir = tokenAttrHomeDir
+	}
+	if len(a.Claims.ClusterTag) == 0 {
+		a.Claims.ClusterTag = tokenAttrCluster
+	}
+
+	a.client = &http.Client{
+		Timeout: jwksTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: a.InsecureSkipVerify},
+		},
+	}
+
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil // OK
+}
+
+// reload JWKS
+func (a *OidcAuth) Reload() error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	return a.reload(time.Now())
+}
+
+// passwords are not supported, identity provider should be used
+func (a *OidcAuth) Verify(username, password string) *UserInfo {
+	return nil
+}
+
+// verify bearer token issued by identity provider
+func (a *OidcAuth) VerifyBearer(tokenString string) (*UserInfo, error) {
+	token, err := jwt.Parse(tokenString, a.getKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %s", err)
+	}
+
+	claims := token.Claims
+	if _, ok := claims[tokenAttrExpire]; !ok {
+		return nil, fmt.Errorf("token has no expiration time")
+	}
+	if len(a.Issuer) != 0 {
+		if iss, _ := utils.AsString(claims[tokenAttrIssuer]); iss != a.Issuer {
+			return nil, fmt.Errorf("unexpected token issuer %q", iss)
+		}
+	}
+	if len(a.Audience) != 0 {
+		if aud, _ := utils.AsStringSlice(claims["aud"]); !hasString(aud, a.Audience) {
+			return nil, fmt.Errorf("unexpected token audience %q", aud)
+		}
+	}
+
+	user := new(UserInfo)
+	user.Name, _ = utils.AsString(getClaim(claims, a.Claims.Username))
+	user.Roles, _ = utils.AsStringSlice(getClaim(claims, a.Claims.Roles))
+	user.HomeDir, _ = utils.AsString(getClaim(claims, a.Claims.HomeDir))
+	user.ClusterTag, _ = utils.AsString(getClaim(claims, a.Claims.ClusterTag))
+	if len(user.Name) == 0 {
+		return nil, fmt.Errorf("token has no %q claim", a.Claims.Username)
+	}
+	if len(user.Roles) == 0 {
+		user.Roles = a.Roles
+	}
+
+	return user, nil // OK
+}
+
+// get the public key to verify token signature
+func (a *OidcAuth) getKey(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	if !hasString(a.Algorithms, alg) {
+		return nil, fmt.Errorf("unexpected signing method: %s", alg)
+	}
+	kid, _ := utils.AsString(token.Header["kid"])
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	// periodic refresh, old keys are used on failure
+	now := time.Now()
+	if now.Sub(a.loaded) >= a.refresh && now.Sub(a.checked) >= jwksMinRefresh {
+		_ = a.reload(now)
+	}
+
+	key := a.findKey(kid, alg)
+	if key == nil && now.Sub(a.checked) >= jwksMinRefresh {
+		// keys might be rotated
+		if err := a.reload(now); err == nil {
+			key = a.findKey(kid, alg)
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("no %q key found", kid)
+	}
+
+	return key, nil // OK
+}
+
+// find public key by identifier
+// if there is no identifier the only key is used
+func (a *OidcAuth) findKey(kid string, alg string) interface{} {
+	var found *jsonWebKey
+	for _, k := range a.keys {
+		if len(k.Alg) != 0 && k.Alg != alg {
+			continue // not this algorithm
+		}
+		if len(kid) == 0 {
+			if found != nil {
+				return nil // ambiguous
+			}
+			found = k
+		} else if k.Kid == kid {
+			return k.key
+		}
+	}
+
+	if found != nil {
+		return found.key
+	}
+	return nil // not found
+}
+
+// reload JWKS (should be called under lock)
+func (a *OidcAuth) reload(now time.Time) error {
+	a.checked = now
+
+	var data []byte
+	var err error
+	if len(a.JwksFile) != 0 {
+		data, err = ioutil.ReadFile(a.JwksFile)
+	} else {
+		data, err = a.download()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get JWKS: %s", err)
+	}
+
+	keys, err := parseJwks(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse JWKS: %s", err)
+	}
+
+	a.keys = keys
+	a.loaded = now
+	return nil // OK
+}
+
+// download JWKS document
+func (a *OidcAuth) download() ([]byte, error) {
+	resp, err := a.client.Get(a.JwksUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// parse JWKS document, unsupported keys are ignored
+func parseJwks(data []byte) ([]*jsonWebKey, error) {
+	var jwks struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make([]*jsonWebKey, 0, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if len(k.Use) != 0 && k.Use != "sig" {
+			continue // not a signing key
+		}
+
+		var err error
+		switch k.Kty {
+		case "RSA":
+			k.key, err = k.rsaKey()
+		case "EC":
+			k.key, err = k.ecKey()
+		default:
+			continue // not supported
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad %q key: %s", k.Kid, err)
+		}
+
+		keys = append(keys, k)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found")
+	}
+
+	return keys, nil // OK
+}
+
+// get RSA public key
+func (k *jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("bad exponent")
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil // OK
+}
+
+// get EC public key
+func (k *jsonWebKey) ecKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("%q is not supported curve", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point is not on curve")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil // OK
+}
+
+// decode base64url encoded big integer
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no data")
+	}
+
+	return new(big.Int).SetBytes(data), nil // OK
+}
+
+// get claim by name, nested claims are separated by dots
+func getClaim(claims map[string]interface{}, name string) interface{} {
+	if v, ok := claims[name]; ok {
+		return v
+	}
+
+	parts := strings.Split(name, ".")
+	var v interface{} = claims
+	for _, p := range parts {
+		m, err := utils.AsStringMap(v)
+		if err != nil || m == nil {
+			return nil
+		}
+		v = m[p]
+	}
+
+	return v
+}
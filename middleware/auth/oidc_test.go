@@ -0,0 +1,323 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/dgrijalva/jwt-go.v2"
+)
+
+// fake identity provider
+type testIssuer struct {
+	sync.Mutex
+	keys []map[string]string // JWKS
+}
+
+// add RSA public key
+func (iss *testIssuer) addRSA(kid string, key *rsa.PublicKey) {
+	iss.Lock()
+	defer iss.Unlock()
+	iss.keys = append(iss.keys, map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   b64(key.N),
+		"e":   b64(big.NewInt(int64(key.E))),
+	})
+}
+
+// add EC public key
+func (iss *testIssuer) addEC(kid string, key *ecdsa.PublicKey) {
+	iss.Lock()
+	defer iss.Unlock()
+	iss.keys = append(iss.keys, map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   b64(key.X),
+		"y":   b64(key.Y),
+	})
+}
+
+// get JWKS document
+func (iss *testIssuer) jwks() []byte {
+	iss.Lock()
+	defer iss.Unlock()
+	data, _ := json.Marshal(map[string]interface{}{"keys": iss.keys})
+	return data
+}
+
+// serve JWKS document
+func (iss *testIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(iss.jwks())
+}
+
+// encode big integer
+func b64(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+// issue token
+func testSign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims map[string]interface{}) string {
+	token := jwt.New(method)
+	if len(kid) != 0 {
+		token.Header["kid"] = kid
+	}
+	for k, v := range claims {
+		token.Claims[k] = v
+	}
+
+	s, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return s
+}
+
+// test tokens verification
+func TestOidcVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	iss := new(testIssuer)
+	iss.addRSA("rsa1", &rsaKey.PublicKey)
+	iss.addEC("ec1", &ecKey.PublicKey)
+	srv := httptest.NewServer(iss)
+	defer srv.Close()
+
+	a, err := NewOIDC(OidcConfig{
+		Issuer:   "https://idp.example.com",
+		Audience: "ryft",
+		JwksUrl:  srv.URL,
+		Claims: OidcClaims{
+			Username: "preferred_username",
+			Roles:    "realm_access.roles",
+		},
+		Roles: []string{"user"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	claims := map[string]interface{}{
+		"iss":                "https://idp.example.com",
+		"aud":                []string{"ryft", "other"},
+		"exp":                exp,
+		"sub":                "1234",
+		"preferred_username": "joe",
+		"realm_access":       map[string]interface{}{"roles": []string{"admin"}},
+		"home-dir":           "/joe",
+		"cluster-tag":        "joe-tag",
+	}
+
+	user, err := a.VerifyBearer(testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa1", claims))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "joe", user.Name)
+		assert.Equal(t, []string{"admin"}, user.Roles)
+		assert.Equal(t, "/joe", user.HomeDir)
+		assert.Equal(t, "joe-tag", user.ClusterTag)
+	}
+
+	user, err = a.VerifyBearer(testSign(t, jwt.SigningMethodES256, ecKey, "ec1", claims))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "joe", user.Name)
+	}
+
+	// default roles
+	delete(claims, "realm_access")
+	user, err = a.VerifyBearer(testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa1", claims))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"user"}, user.Roles)
+	}
+
+	// bad tokens
+	bad := func(key string, val interface{}) map[string]interface{} {
+		res := make(map[string]interface{})
+		for k, v := range claims {
+			res[k] = v
+		}
+		if val != nil {
+			res[key] = val
+		} else {
+			delete(res, key)
+		}
+		return res
+	}
+	check := func(token string, expectedError string) {
+		_, err := a.VerifyBearer(token)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), expectedError)
+		}
+	}
+	check(testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa1", bad("iss", "https://evil.example.com")), "unexpected token issuer")
+	check(testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa1", bad("aud", "other")), "unexpected token audience")
+	check(testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa1", bad("exp", time.Now().Add(-time.Hour).Unix())), "failed to parse token")
+	check(testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa1", bad("exp", nil)), "no expiration time")
+	check(testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa1", bad("preferred_username", nil)), `no "preferred_username" claim`)
+	check(testSign(t, jwt.SigningMethodRS256, rsaKey, "ec1", claims), "failed to parse token")
+	check(testSign(t, jwt.SigningMethodRS256, rsaKey, "missing", claims), `no "missing" key found`)
+	check(testSign(t, jwt.SigningMethodHS256, []byte("secret"), "rsa1", claims), "unexpected signing method")
+	check(testSign(t, jwt.SigningMethodRS256, rsaKey, "", claims), `no "" key found`) // ambiguous
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if assert.NoError(t, err) {
+		check(testSign(t, jwt.SigningMethodRS256, otherKey, "rsa1", claims), "failed to parse token")
+	}
+}
+
+// test JWKS key rotation
+func TestOidcKeyRotation(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err) {
+		return
+	}
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	iss := new(testIssuer)
+	iss.addRSA("key1", &key1.PublicKey)
+	srv := httptest.NewServer(iss)
+	defer srv.Close()
+
+	a, err := NewOIDC(OidcConfig{JwksUrl: srv.URL})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims := map[string]interface{}{
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"sub": "joe",
+	}
+
+	_, err = a.VerifyBearer(testSign(t, jwt.SigningMethodRS256, key1, "key1", claims))
+	assert.NoError(t, err)
+
+	// new key is published
+	iss.addRSA("key2", &key2.PublicKey)
+	_, err = a.VerifyBearer(testSign(t, jwt.SigningMethodRS256, key2, "key2", claims))
+	assert.Error(t, err) // JWKS was refreshed too recently
+
+	a.checked = time.Time{} // emulate time passed
+	user, err := a.VerifyBearer(testSign(t, jwt.SigningMethodRS256, key2, "key2", claims))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "joe", user.Name)
+	}
+}
+
+// test local JWKS file
+func TestOidcJwksFile(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tmpdir, err := ioutil.TempDir("", "auth_test_")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	iss := new(testIssuer)
+	iss.addEC("", &key.PublicKey)
+	file := filepath.Join(tmpdir, "jwks.json")
+	if !assert.NoError(t, ioutil.WriteFile(file, iss.jwks(), 0644)) {
+		return
+	}
+
+	a, err := NewOIDC(OidcConfig{JwksFile: file})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the only key is used if there is no key identifier
+	user, err := a.VerifyBearer(testSign(t, jwt.SigningMethodES256, key, "", map[string]interface{}{
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"sub": "joe",
+	}))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "joe", user.Name)
+		assert.Empty(t, user.Roles)
+	}
+
+	// bad configurations
+	_, err = NewOIDC(OidcConfig{})
+	assert.Error(t, err)
+	_, err = NewOIDC(OidcConfig{JwksFile: file, Algorithms: []string{"HS256"}})
+	assert.Error(t, err)
+	_, err = NewOIDC(OidcConfig{JwksFile: file, JwksRefresh: "bad"})
+	assert.Error(t, err)
+	_, err = NewOIDC(OidcConfig{JwksFile: filepath.Join(tmpdir, "missing.json")})
+	assert.Error(t, err)
+}
+
+// test JWKS parsing
+func TestParseJwks(t *testing.T) {
+	_, err := parseJwks([]byte(`{"keys":[]}`))
+	assert.EqualError(t, err, "no signing keys found")
+
+	_, err = parseJwks([]byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`))
+	assert.EqualError(t, err, "no signing keys found")
+
+	_, err = parseJwks([]byte(`{"keys":[{"kty":"RSA","kid":"k1","n":"","e":"AQAB"}]}`))
+	assert.EqualError(t, err, `bad "k1" key: no data`)
+
+	_, err = parseJwks([]byte(`{"keys":[{"kty":"EC","kid":"k2","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+	assert.EqualError(t, err, `bad "k2" key: point is not on curve`)
+
+	keys, err := parseJwks([]byte(`{"keys":[{"kty":"RSA","kid":"k1","use":"enc","n":"AQAB","e":"AQAB"},{"kty":"RSA","kid":"k3","n":"AQAB","e":"AQAB"}]}`))
+	if assert.NoError(t, err) && assert.Len(t, keys, 1) {
+		assert.Equal(t, "k3", keys[0].Kid)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy contains password strength requirements.
+// The policy is checked when password is set or changed.
+type PasswordPolicy struct {
+	MinLength      int  `yaml:"min-length,omitempty"`
+	RequireUpper   bool `yaml:"require-upper,omitempty"`
+	RequireLower   bool `yaml:"require-lower,omitempty"`
+	RequireDigit   bool `yaml:"require-digit,omitempty"`
+	RequireSpecial bool `yaml:"require-special,omitempty"`
+	AllowUsername  bool `yaml:"allow-username,omitempty"` // password may contain username
+}
+
+// PasswordPolicyError is reported when password doesn't satisfy the policy.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+// get error message
+func (e *PasswordPolicyError) Error() string {
+	return e.Reason
+}
+
+// Check checks the password satisfies the policy.
+func (p PasswordPolicy) Check(username, password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return &PasswordPolicyError{
+			Reason: fmt.Sprintf("password should contain at least %d characters", p.MinLength),
+		}
+	}
+
+	var upper, lower, digit, special bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			special = true
+		}
+	}
+
+	if p.RequireUpper && !upper {
+		return &PasswordPolicyError{Reason: "password should contain an upper case letter"}
+	}
+	if p.RequireLower && !lower {
+		return &PasswordPolicyError{Reason: "password should contain a lower case letter"}
+	}
+	if p.RequireDigit && !digit {
+		return &PasswordPolicyError{Reason: "password should contain a digit"}
+	}
+	if p.RequireSpecial && !special {
+		return &PasswordPolicyError{Reason: "password should contain a special character"}
+	}
+	if !p.AllowUsername && len(username) != 0 &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return &PasswordPolicyError{Reason: "password should not contain username"}
+	}
+
+	return nil // OK
+}
@@ -0,0 +1,229 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// permission names
+const (
+	PermSearch      = "search"
+	PermCount       = "count"
+	PermFilesRead   = "files:read"
+	PermFilesWrite  = "files:write"
+	PermFilesDelete = "files:delete"
+	PermRun         = "run"
+	PermPcap        = "pcap"
+	PermAdmin       = "admin"
+
+	PermAll = "*" // all permissions except "admin"
+)
+
+// all known permissions
+var knownPermissions = []string{
+	PermSearch,
+	PermCount,
+	PermFilesRead,
+	PermFilesWrite,
+	PermFilesDelete,
+	PermRun,
+	PermPcap,
+	PermAdmin,
+}
+
+// PathRule restricts permissions inside a home directory prefix
+type PathRule struct {
+	Prefix string   `yaml:"prefix" json:"prefix"`                   // path relative to home, "/shared" for example
+	Allow  []string `yaml:"allow,omitempty" json:"allow,omitempty"` // permissions allowed inside
+	Roles  []string `yaml:"roles,omitempty" json:"roles,omitempty"` // roles the rule applies to, empty - all roles
+}
+
+// PermissionsConfig permissions configuration
+type PermissionsConfig struct {
+	Roles map[string][]string `yaml:"roles,omitempty"` // role -> permissions
+	Paths []PathRule          `yaml:"paths,omitempty"`
+}
+
+// Authorizer checks user permissions
+type Authorizer struct {
+	roles map[string][]string
+	paths []PathRule
+}
+
+// NewAuthorizer creates new authorizer.
+// if no roles configured all users have all permissions
+// except "admin" which is granted to the "admin" role only.
+func NewAuthorizer(cfg PermissionsConfig) (*Authorizer, error) {
+	a := new(Authorizer)
+	a.roles = make(map[string][]string)
+	for role, perms := range cfg.Roles {
+		for _, p := range perms {
+			if err := checkPermission(p); err != nil {
+				return nil, fmt.Errorf("role %q: %s", role, err)
+			}
+		}
+		a.roles[role] = perms
+	}
+
+	for _, rule := range cfg.Paths {
+		if len(strings.Trim(rule.Prefix, "/")) == 0 {
+			return nil, fmt.Errorf("no path prefix provided")
+		}
+		for _, p := range rule.Allow {
+			if err := checkPermission(p); err != nil {
+				return nil, fmt.Errorf("path %q: %s", rule.Prefix, err)
+			}
+		}
+
+		rule.Prefix = path.Clean("/" + rule.Prefix)
+		a.paths = append(a.paths, rule)
+	}
+
+	return a, nil // OK
+}
+
+// check the permission name is known
+func checkPermission(perm string) error {
+	if perm == PermAll || hasString(knownPermissions, perm) {
+		return nil // OK
+	}
+
+	return fmt.Errorf("%q is unknown permission", perm)
+}
+
+// check string is in list
+func hasString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsAdmin checks user has the "admin" permission.
+// nil user means no authentication - full access.
+func (a *Authorizer) IsAdmin(user *UserInfo) bool {
+	return user == nil || a.hasPermission(user, PermAdmin)
+}
+
+// check user has permission granted by roles
+// (and by the API key scope if any)
+func (a *Authorizer) hasPermission(user *UserInfo, perm string) bool {
+	if len(user.Scope) != 0 && !allowsPermission(user.Scope, perm) {
+		return false
+	}
+
+	if len(a.roles) == 0 {
+		// backward compatibility: admin role has full access
+		return perm != PermAdmin || user.HasRole(AdminRole)
+	}
+
+	for _, role := range user.Roles {
+		if allowsPermission(a.roles[role], perm) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check permission is in the list
+func allowsPermission(perms []string, perm string) bool {
+	return hasString(perms, PermAdmin) || hasString(perms, perm) ||
+		(perm != PermAdmin && hasString(perms, PermAll))
+}
+
+// Check checks user has permission.
+// nil user means no authentication - full access.
+// "admin" permission grants all other permissions.
+func (a *Authorizer) Check(user *UserInfo, perm string) bool {
+	return user == nil || a.hasPermission(user, perm)
+}
+
+// CheckPath checks user has permission on path (relative to home).
+// path rules are not applied to admin.
+// if the path contains wildcards all rules it might match are applied.
+func (a *Authorizer) CheckPath(user *UserInfo, perm string, p string) bool {
+	if !a.Check(user, perm) {
+		return false
+	}
+	if user == nil || a.hasPermission(user, PermAdmin) {
+		return true // no path restrictions
+	}
+
+	for _, rule := range a.paths {
+		if !rule.matchRoles(user) || !rule.matchPath(p) {
+			continue
+		}
+		if !hasString(rule.Allow, perm) && !(perm != PermAdmin && hasString(rule.Allow, PermAll)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// check the rule applies to the user
+func (r PathRule) matchRoles(user *UserInfo) bool {
+	if len(r.Roles) == 0 {
+		return true // all roles
+	}
+
+	for _, role := range r.Roles {
+		if user.HasRole(role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check the path is inside the rule prefix
+// (or might be for wildcard paths)
+func (r PathRule) matchPath(p string) bool {
+	// literal part of wildcard path
+	if i := strings.IndexAny(p, "*?[{"); i >= 0 {
+		literal := path.Join("/", p[:i])
+		if strings.HasSuffix(p[:i], "/") && literal != "/" {
+			literal += "/"
+		}
+		return strings.HasPrefix(r.Prefix, literal) ||
+			strings.HasPrefix(literal, r.Prefix+"/")
+	}
+
+	p = path.Clean("/" + p)
+	return p == r.Prefix || strings.HasPrefix(p, r.Prefix+"/")
+}
@@ -0,0 +1,129 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test default permissions
+func TestPermissionsDefault(t *testing.T) {
+	a, err := NewAuthorizer(PermissionsConfig{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	user := &UserInfo{Name: "joe", Roles: []string{"user"}}
+	admin := &UserInfo{Name: "root", Roles: []string{"admin"}}
+
+	assert.True(t, a.Check(user, PermFilesDelete))
+	assert.False(t, a.Check(user, PermAdmin))
+	assert.False(t, a.IsAdmin(user))
+	assert.True(t, a.IsAdmin(admin))
+	assert.True(t, a.Check(nil, PermAdmin))
+}
+
+// test role permissions
+func TestPermissionsRoles(t *testing.T) {
+	a, err := NewAuthorizer(PermissionsConfig{
+		Roles: map[string][]string{
+			"analyst": {PermSearch, PermCount, PermFilesRead},
+			"user":    {PermAll},
+			"ops":     {PermAdmin},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	analyst := &UserInfo{Name: "joe", Roles: []string{"analyst"}}
+	user := &UserInfo{Name: "foo", Roles: []string{"user"}}
+	ops := &UserInfo{Name: "boo", Roles: []string{"ops"}}
+	none := &UserInfo{Name: "none"}
+
+	assert.True(t, a.Check(analyst, PermSearch))
+	assert.False(t, a.Check(analyst, PermFilesDelete))
+	assert.False(t, a.Check(analyst, PermRun))
+	assert.True(t, a.Check(user, PermRun))
+	assert.False(t, a.Check(user, PermAdmin))
+	assert.True(t, a.Check(ops, PermFilesDelete))
+	assert.True(t, a.IsAdmin(ops))
+	assert.False(t, a.Check(none, PermSearch))
+
+	// bad configuration
+	_, err = NewAuthorizer(PermissionsConfig{
+		Roles: map[string][]string{"user": {"files:exec"}},
+	})
+	assert.EqualError(t, err, `role "user": "files:exec" is unknown permission`)
+	_, err = NewAuthorizer(PermissionsConfig{
+		Paths: []PathRule{{Prefix: "/"}},
+	})
+	assert.EqualError(t, err, "no path prefix provided")
+}
+
+// test path rules
+func TestPermissionsPaths(t *testing.T) {
+	a, err := NewAuthorizer(PermissionsConfig{
+		Paths: []PathRule{
+			{Prefix: "shared/", Allow: []string{PermSearch, PermFilesRead}},
+			{Prefix: "/tmp", Allow: []string{PermAll}, Roles: []string{"guest"}},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	user := &UserInfo{Name: "joe", Roles: []string{"user"}}
+	guest := &UserInfo{Name: "foo", Roles: []string{"guest"}}
+	admin := &UserInfo{Name: "root", Roles: []string{"admin"}}
+
+	assert.True(t, a.CheckPath(user, PermFilesRead, "/shared/a.txt"))
+	assert.True(t, a.CheckPath(user, PermSearch, "shared"))
+	assert.False(t, a.CheckPath(user, PermFilesDelete, "/shared/a.txt"))
+	assert.False(t, a.CheckPath(user, PermFilesWrite, "shared/../shared/a.txt"))
+	assert.True(t, a.CheckPath(user, PermFilesDelete, "/shared2/a.txt"))
+	assert.True(t, a.CheckPath(user, PermFilesDelete, "/tmp/a.txt"))
+	assert.True(t, a.CheckPath(admin, PermFilesDelete, "/shared/a.txt"))
+	assert.True(t, a.CheckPath(nil, PermFilesDelete, "/shared/a.txt"))
+
+	// wildcards
+	assert.False(t, a.CheckPath(user, PermFilesDelete, "*"))
+	assert.False(t, a.CheckPath(user, PermFilesDelete, "/sh*/a.txt"))
+	assert.False(t, a.CheckPath(user, PermFilesDelete, "shared/*.txt"))
+	assert.True(t, a.CheckPath(user, PermFilesDelete, "/shared2/*.txt"))
+	assert.True(t, a.CheckPath(user, PermFilesRead, "*.txt"))
+
+	// role specific rule
+	assert.True(t, a.CheckPath(guest, PermFilesDelete, "/tmp/a.txt"))
+	assert.False(t, a.CheckPath(guest, PermAdmin, "/tmp/a.txt"))
+}
@@ -0,0 +1,178 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RevocationStore persists revoked JWT tokens.
+type RevocationStore interface {
+	// revoke token by ID, the token is valid until `expires` at most
+	RevokeToken(id string, user string, expires time.Time) error
+
+	// revoke all user's tokens issued before
+	RevokeUserTokens(user string, before time.Time) error
+
+	// get not expired revoked tokens and users
+	GetRevocations(now time.Time) (tokens map[string]time.Time, users map[string]time.Time, err error)
+}
+
+// Revocation is a JWT token denylist.
+// Revoked tokens are cached in memory and persisted in the store.
+type Revocation struct {
+	store  RevocationStore
+	maxAge time.Duration // the longest token lifetime (including refreshes)
+
+	mx     sync.Mutex
+	tokens map[string]time.Time // token ID -> expiration
+	users  map[string]time.Time // user -> tokens issued before are revoked
+	now    func() time.Time
+}
+
+// NewRevocation creates new token denylist and loads it from the store.
+// `maxAge` is the longest token lifetime, revocations are forgotten after.
+func NewRevocation(store RevocationStore, maxAge time.Duration) (*Revocation, error) {
+	r := &Revocation{
+		store:  store,
+		maxAge: maxAge,
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+		now:    time.Now,
+	}
+
+	if store != nil {
+		tokens, users, err := store.GetRevocations(r.now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load revoked tokens: %s", err)
+		}
+		for id, expires := range tokens {
+			r.tokens[id] = expires
+		}
+		for user, before := range users {
+			r.users[user] = before
+		}
+	}
+
+	return r, nil // OK
+}
+
+// generate new token ID
+func newTokenID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// RevokeToken revokes the token (and all its refreshed copies) by ID.
+func (r *Revocation) RevokeToken(id string, user string) error {
+	if len(id) == 0 {
+		return fmt.Errorf("no token ID provided")
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	now := r.now()
+	expires := now.Add(r.maxAge)
+	if r.store != nil {
+		if err := r.store.RevokeToken(id, user, expires); err != nil {
+			return fmt.Errorf("failed to save revoked token: %s", err)
+		}
+	}
+
+	r.cleanup(now)
+	r.tokens[id] = expires
+	return nil // OK
+}
+
+// RevokeUser revokes all the tokens issued to the user so far.
+func (r *Revocation) RevokeUser(user string) error {
+	if len(user) == 0 {
+		return fmt.Errorf("no user provided")
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	now := r.now()
+	if r.store != nil {
+		if err := r.store.RevokeUserTokens(user, now); err != nil {
+			return fmt.Errorf("failed to save revoked user: %s", err)
+		}
+	}
+
+	r.cleanup(now)
+	r.users[user] = now
+	return nil // OK
+}
+
+// IsRevoked checks the token is revoked.
+// `issued` is the token issue time (zero if unknown).
+func (r *Revocation) IsRevoked(id string, user string, issued time.Time) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if len(id) != 0 {
+		if _, ok := r.tokens[id]; ok {
+			return true
+		}
+	}
+
+	if before, ok := r.users[user]; ok {
+		// issue time has one second resolution,
+		// so tokens issued in the same second are revoked too
+		return issued.IsZero() || issued.Unix() <= before.Unix()
+	}
+
+	return false // OK
+}
+
+// remove expired revocations (all tokens are expired anyway)
+func (r *Revocation) cleanup(now time.Time) {
+	for id, expires := range r.tokens {
+		if now.After(expires) {
+			delete(r.tokens, id)
+		}
+	}
+	for user, before := range r.users {
+		if now.After(before.Add(r.maxAge)) {
+			delete(r.users, user)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// in-memory revocation store
+type fakeRevocationStore struct {
+	tokens map[string]time.Time
+	users  map[string]time.Time
+	fail   bool
+}
+
+func (s *fakeRevocationStore) RevokeToken(id string, user string, expires time.Time) error {
+	if s.fail {
+		return fmt.Errorf("disk is full")
+	}
+	s.tokens[id] = expires
+	return nil
+}
+
+func (s *fakeRevocationStore) RevokeUserTokens(user string, before time.Time) error {
+	if s.fail {
+		return fmt.Errorf("disk is full")
+	}
+	s.users[user] = before
+	return nil
+}
+
+func (s *fakeRevocationStore) GetRevocations(now time.Time) (map[string]time.Time, map[string]time.Time, error) {
+	if s.fail {
+		return nil, nil, fmt.Errorf("no database")
+	}
+	return s.tokens, s.users, nil
+}
+
+// test JWT token denylist
+func TestRevocation(t *testing.T) {
+	store := &fakeRevocationStore{
+		tokens: map[string]time.Time{"old": time.Now().Add(time.Hour)},
+		users:  map[string]time.Time{},
+	}
+
+	r, err := NewRevocation(store, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	assert.True(t, r.IsRevoked("old", "foo", now)) // loaded from store
+	assert.False(t, r.IsRevoked("t1", "foo", now))
+	assert.False(t, r.IsRevoked("", "foo", time.Time{}))
+
+	// revoke token
+	assert.Error(t, r.RevokeToken("", "foo"))
+	assert.NoError(t, r.RevokeToken("t1", "foo"))
+	assert.True(t, r.IsRevoked("t1", "foo", now))
+	assert.False(t, r.IsRevoked("t2", "foo", now))
+	assert.Equal(t, now.Add(time.Hour), store.tokens["t1"])
+
+	// revoke user
+	assert.Error(t, r.RevokeUser(""))
+	assert.NoError(t, r.RevokeUser("bar"))
+	assert.True(t, r.IsRevoked("t3", "bar", now.Add(-time.Minute)))
+	assert.True(t, r.IsRevoked("t3", "bar", now)) // the same second
+	assert.True(t, r.IsRevoked("", "bar", time.Time{}))
+	assert.False(t, r.IsRevoked("t4", "bar", now.Add(time.Second)))
+	assert.False(t, r.IsRevoked("t3", "foo", now.Add(-time.Minute)))
+	assert.Equal(t, now, store.users["bar"])
+
+	// store failure
+	store.fail = true
+	assert.Error(t, r.RevokeToken("t5", "foo"))
+	assert.False(t, r.IsRevoked("t5", "foo", now))
+	assert.Error(t, r.RevokeUser("foo"))
+	store.fail = false
+
+	// expired revocations are forgotten
+	now = now.Add(2 * time.Hour)
+	assert.NoError(t, r.RevokeToken("t6", "foo"))
+	assert.False(t, r.IsRevoked("t1", "foo", now))
+	assert.False(t, r.IsRevoked("t3", "bar", now.Add(-3*time.Hour)))
+	assert.True(t, r.IsRevoked("t6", "foo", now))
+
+	// failed to load
+	store.fail = true
+	_, err = NewRevocation(store, time.Hour)
+	assert.Error(t, err)
+
+	// no store
+	r, err = NewRevocation(nil, time.Hour)
+	if assert.NoError(t, err) {
+		assert.NoError(t, r.RevokeToken("t1", "foo"))
+		assert.True(t, r.IsRevoked("t1", "foo", time.Now()))
+	}
+}
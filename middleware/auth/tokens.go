@@ -0,0 +1,207 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// API key header (the "Authorization: Bearer <key>" is also supported)
+	ApiKeyHeader = "X-Api-Key"
+
+	apiKeyPrefix = "ryft_"
+)
+
+// ApiToken is a personal access token (API key) of a user.
+// Only the hash of the secret part is stored.
+type ApiToken struct {
+	ID       string   `json:"id" yaml:"id"`
+	Name     string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Hash     string   `json:"hash,omitempty" yaml:"hash,omitempty"`           // SHA-256 of the secret
+	Scope    []string `json:"scope,omitempty" yaml:"scope,omitempty"`         // permissions, empty - all user's permissions
+	AllowIPs []string `json:"allow-ips,omitempty" yaml:"allow-ips,omitempty"` // IP addresses or CIDRs, empty - any address
+	Created  string   `json:"created" yaml:"created"`                         // RFC3339
+	Expires  string   `json:"expires,omitempty" yaml:"expires,omitempty"`     // RFC3339, empty - never
+	LastUsed string   `json:"last-used,omitempty" yaml:"last-used,omitempty"` // RFC3339
+}
+
+// used to manage API keys of users
+type TokenManager interface {
+	// get the list of user's tokens (no hashes)
+	GetTokens(username string) ([]*ApiToken, error)
+
+	// add new token to user
+	CreateToken(username string, token *ApiToken) error
+
+	// revoke user's token
+	RevokeToken(username string, id string) (*ApiToken, error)
+
+	// verify API key and get the user
+	VerifyToken(key string, remoteIP string) (*UserInfo, error)
+}
+
+// NewApiToken creates new token and the API key.
+// The API key is reported only once and cannot be restored.
+// zero lifetime means the token never expires.
+func NewApiToken(name string, lifetime time.Duration, scope []string, allowIPs []string) (string, *ApiToken, error) {
+	for _, p := range scope {
+		if err := checkPermission(p); err != nil {
+			return "", nil, err
+		}
+	}
+	for _, ip := range allowIPs {
+		if _, err := parseAllowIP(ip); err != nil {
+			return "", nil, err
+		}
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+	token := &ApiToken{
+		ID:       id,
+		Name:     name,
+		Hash:     hashSecret(secret),
+		Scope:    scope,
+		AllowIPs: allowIPs,
+		Created:  now.Format(time.RFC3339),
+	}
+	if lifetime > 0 {
+		token.Expires = now.Add(lifetime).Format(time.RFC3339)
+	}
+
+	return apiKeyPrefix + id + "_" + secret, token, nil // OK
+}
+
+// WipeOut creates copy of token with no hash
+func (t *ApiToken) WipeOut() *ApiToken {
+	w := *t // copy
+	w.Hash = ""
+	return &w
+}
+
+// check the secret, expiration time and remote address
+func (t *ApiToken) verify(secret string, remoteIP string, now time.Time) error {
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(t.Hash)) != 1 {
+		return fmt.Errorf("invalid API key")
+	}
+
+	if len(t.Expires) != 0 {
+		expires, err := time.Parse(time.RFC3339, t.Expires)
+		if err != nil || !now.Before(expires) {
+			return fmt.Errorf("API key expired")
+		}
+	}
+
+	if len(t.AllowIPs) != 0 {
+		ip := net.ParseIP(remoteIP)
+		for _, allow := range t.AllowIPs {
+			if n, err := parseAllowIP(allow); err == nil && ip != nil && n.Contains(ip) {
+				return nil // OK
+			}
+		}
+		return fmt.Errorf("API key is not allowed from %s", remoteIP)
+	}
+
+	return nil // OK
+}
+
+// parse IP address or CIDR
+func parseAllowIP(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not a valid IP address", s)
+		}
+		bits := 8 * len(ip)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid CIDR", s)
+	}
+	return n, nil
+}
+
+// split API key into identifier and secret
+func parseApiKey(key string) (id string, secret string, ok bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return
+	}
+
+	parts := strings.SplitN(key[len(apiKeyPrefix):], "_", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return
+	}
+
+	return parts[0], parts[1], true
+}
+
+// check it's an API key
+func IsApiKey(key string) bool {
+	_, _, ok := parseApiKey(key)
+	return ok
+}
+
+// get SHA-256 of the secret (hex)
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// get random bytes (hex)
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random data: %s", err)
+	}
+
+	return hex.EncodeToString(buf), nil // OK
+}
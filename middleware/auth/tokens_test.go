@@ -0,0 +1,175 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test API key creation and verification
+func TestApiTokenVerify(t *testing.T) {
+	key, token, err := NewApiToken("test", time.Hour, []string{PermSearch}, []string{"10.0.0.0/8", "127.0.0.1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, IsApiKey(key))
+	assert.False(t, IsApiKey("Basic dGVzdDp0ZXN0"))
+	assert.False(t, strings.Contains(token.Hash, key))
+
+	id, secret, ok := parseApiKey(key)
+	if assert.True(t, ok) {
+		assert.Equal(t, token.ID, id)
+
+		now := time.Now()
+		assert.NoError(t, token.verify(secret, "127.0.0.1", now))
+		assert.NoError(t, token.verify(secret, "10.1.2.3", now))
+		assert.EqualError(t, token.verify(secret, "192.168.1.1", now), "API key is not allowed from 192.168.1.1")
+		assert.EqualError(t, token.verify(secret+"0", "127.0.0.1", now), "invalid API key")
+		assert.EqualError(t, token.verify(secret, "127.0.0.1", now.Add(2*time.Hour)), "API key expired")
+	}
+
+	// bad parameters
+	_, _, err = NewApiToken("test", 0, []string{"bad"}, nil)
+	assert.Error(t, err)
+	_, _, err = NewApiToken("test", 0, nil, []string{"300.0.0.1"})
+	assert.Error(t, err)
+
+	// never expires
+	_, token, err = NewApiToken("test", 0, nil, nil)
+	if assert.NoError(t, err) {
+		assert.Empty(t, token.Expires)
+	}
+}
+
+// test API keys stored in users file
+func TestFileAuthTokens(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "auth_test_")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	file := filepath.Join(tmpdir, "users.json")
+	data := `[{"username":"joe", "password":"123", "home":"/joe", "roles":["user"]}]`
+	if !assert.NoError(t, ioutil.WriteFile(file, []byte(data), 0644)) {
+		return
+	}
+
+	f, err := NewFile(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	key, token, err := NewApiToken("ci", 0, []string{PermSearch}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, f.CreateToken("joe", token))
+	assert.Error(t, f.CreateToken("missing", token))
+
+	tokens, err := f.GetTokens("joe")
+	if assert.NoError(t, err) && assert.Len(t, tokens, 1) {
+		assert.Equal(t, token.ID, tokens[0].ID)
+		assert.Empty(t, tokens[0].Hash)
+	}
+
+	user, err := f.VerifyToken(key, "127.0.0.1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "joe", user.Name)
+		assert.Equal(t, "/joe", user.HomeDir)
+		assert.Equal(t, token.ID, user.TokenID)
+		assert.Equal(t, []string{PermSearch}, user.Scope)
+		assert.Empty(t, user.Tokens)
+	}
+	_, err = f.VerifyToken(key+"0", "127.0.0.1")
+	assert.Error(t, err)
+
+	// tokens should be saved
+	f2, err := NewFile(file)
+	if assert.NoError(t, err) {
+		_, err = f2.VerifyToken(key, "127.0.0.1")
+		assert.NoError(t, err)
+	}
+
+	_, err = f.RevokeToken("joe", token.ID)
+	assert.NoError(t, err)
+	_, err = f.RevokeToken("joe", token.ID)
+	assert.Error(t, err)
+	_, err = f.VerifyToken(key, "127.0.0.1")
+	assert.Error(t, err)
+}
+
+// test API key scope limits permissions
+func TestApiTokenScope(t *testing.T) {
+	a, err := NewAuthorizer(PermissionsConfig{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	user := &UserInfo{Name: "joe"}
+	assert.True(t, a.Check(user, PermSearch))
+	assert.True(t, a.Check(user, PermFilesWrite))
+
+	user.Scope = []string{PermSearch, PermFilesRead}
+	assert.True(t, a.Check(user, PermSearch))
+	assert.True(t, a.Check(user, PermFilesRead))
+	assert.False(t, a.Check(user, PermFilesWrite))
+
+	user.Scope = []string{PermAll}
+	assert.True(t, a.Check(user, PermFilesWrite))
+	assert.False(t, a.Check(user, PermAdmin))
+}
+
+// test the IP address the request is received from
+func TestRemoteIP(t *testing.T) {
+	check := func(addr string, forwarded string, expected string) {
+		req, _ := http.NewRequest("GET", "/search", nil)
+		req.RemoteAddr = addr
+		if len(forwarded) != 0 {
+			req.Header.Set("X-Forwarded-For", forwarded)
+			req.Header.Set("X-Real-IP", forwarded)
+		}
+		assert.Equal(t, expected, RemoteIP(req), "%s", addr)
+	}
+
+	check("192.168.1.1:12345", "", "192.168.1.1")
+	check("192.168.1.1:12345", "127.0.0.1", "192.168.1.1")
+	check("[::1]:8765", "10.0.0.1", "::1")
+	check("10.0.0.1", "", "10.0.0.1")
+}
@@ -0,0 +1,94 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"strings"
+)
+
+// WorkspacePrefix marks shared workspace paths, "@team/data.txt" for example.
+const WorkspacePrefix = "@"
+
+// Workspace is a shared directory outside of user home directories.
+// Write access implies read access. "*" means any user (or any role).
+type Workspace struct {
+	Dir        string   `yaml:"dir" json:"-"` // directory inside mount point, like user's home
+	ReadUsers  []string `yaml:"read-users,omitempty" json:"-"`
+	ReadRoles  []string `yaml:"read-roles,omitempty" json:"-"`
+	WriteUsers []string `yaml:"write-users,omitempty" json:"-"`
+	WriteRoles []string `yaml:"write-roles,omitempty" json:"-"`
+}
+
+// CanRead checks user has read access to the workspace.
+// nil user means no authentication - full access.
+func (w Workspace) CanRead(user *UserInfo) bool {
+	return w.CanWrite(user) || matchAcl(user, w.ReadUsers, w.ReadRoles)
+}
+
+// CanWrite checks user has read-write access to the workspace.
+// nil user means no authentication - full access.
+func (w Workspace) CanWrite(user *UserInfo) bool {
+	return matchAcl(user, w.WriteUsers, w.WriteRoles)
+}
+
+// check user is in the list of users or has any of roles
+func matchAcl(user *UserInfo, users []string, roles []string) bool {
+	if user == nil {
+		return true
+	}
+	if hasString(users, "*") || hasString(users, user.Name) {
+		return true
+	}
+	for _, role := range user.Roles {
+		if hasString(roles, "*") || hasString(roles, role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseWorkspacePath splits "@team/dir/file.txt" path
+// into workspace name "team" and path inside workspace "dir/file.txt".
+// The leading slash is ignored. ok=false means it's not a workspace path.
+func ParseWorkspacePath(path string) (name string, rel string, ok bool) {
+	p := strings.TrimPrefix(path, "/")
+	if !strings.HasPrefix(p, WorkspacePrefix) {
+		return "", path, false
+	}
+
+	p = p[len(WorkspacePrefix):]
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		return p[:i], p[i+1:], true
+	}
+
+	return p, "", true // workspace root
+}
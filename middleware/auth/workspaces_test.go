@@ -0,0 +1,103 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test workspace access lists
+func TestWorkspaceAcl(t *testing.T) {
+	ws := Workspace{
+		Dir:        "/shared/team",
+		ReadUsers:  []string{"bob"},
+		ReadRoles:  []string{"analyst"},
+		WriteUsers: []string{"alice"},
+		WriteRoles: []string{"editor"},
+	}
+
+	alice := &UserInfo{Name: "alice"}
+	bob := &UserInfo{Name: "bob"}
+	eve := &UserInfo{Name: "eve", Roles: []string{"analyst"}}
+	joe := &UserInfo{Name: "joe", Roles: []string{"user", "editor"}}
+	foo := &UserInfo{Name: "foo", Roles: []string{"user"}}
+
+	assert.True(t, ws.CanRead(nil))
+	assert.True(t, ws.CanWrite(nil))
+
+	assert.True(t, ws.CanRead(alice)) // write implies read
+	assert.True(t, ws.CanWrite(alice))
+
+	assert.True(t, ws.CanRead(bob))
+	assert.False(t, ws.CanWrite(bob))
+
+	assert.True(t, ws.CanRead(eve))
+	assert.False(t, ws.CanWrite(eve))
+
+	assert.True(t, ws.CanRead(joe))
+	assert.True(t, ws.CanWrite(joe))
+
+	assert.False(t, ws.CanRead(foo))
+	assert.False(t, ws.CanWrite(foo))
+
+	// wildcards
+	ws = Workspace{ReadUsers: []string{"*"}, WriteRoles: []string{"*"}}
+	assert.True(t, ws.CanRead(foo))
+	assert.True(t, ws.CanWrite(foo))
+	assert.True(t, ws.CanRead(bob))
+	assert.False(t, ws.CanWrite(bob)) // no roles
+
+	// empty lists
+	ws = Workspace{}
+	assert.False(t, ws.CanRead(alice))
+	assert.False(t, ws.CanWrite(alice))
+}
+
+// test workspace path parsing
+func TestParseWorkspacePath(t *testing.T) {
+	check := func(path string, expectedName, expectedRel string, expectedOk bool) {
+		name, rel, ok := ParseWorkspacePath(path)
+		assert.EqualValues(t, expectedName, name, "bad name for %q", path)
+		assert.EqualValues(t, expectedRel, rel, "bad path for %q", path)
+		assert.EqualValues(t, expectedOk, ok, "bad flag for %q", path)
+	}
+
+	check("@team/dir/file.txt", "team", "dir/file.txt", true)
+	check("/@team/dir/file.txt", "team", "dir/file.txt", true)
+	check("@team/", "team", "", true)
+	check("@team", "team", "", true)
+	check("/@team/*.txt", "team", "*.txt", true)
+	check("dir/file.txt", "", "dir/file.txt", false)
+	check("/dir/@team/file.txt", "", "/dir/@team/file.txt", false)
+	check("", "", "", false)
+}
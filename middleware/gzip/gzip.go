@@ -89,6 +89,14 @@ func shouldCompress(req *http.Request) bool {
 	if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
 		return false
 	}
+	// gRPC frames are never compressed by HTTP layer
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+		return false
+	}
+	// byte ranges are related to the original (not compressed) content
+	if len(req.Header.Get("Range")) != 0 {
+		return false
+	}
 	extension := filepath.Ext(req.URL.Path)
 	if len(extension) < 4 { // fast path
 		return true
@@ -0,0 +1,253 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils"
+	"github.com/getryft/ryft-server/search/utils/audit"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// audit record of the request
+	auditRecordKey = "audit-record"
+
+	// default number of reported audit records
+	defaultAuditLimit = 1000
+)
+
+// AuditParams contains all the bound parameters for the /audit endpoint.
+type AuditParams struct {
+	User   string `form:"user" json:"user,omitempty"`
+	Action string `form:"action" json:"action,omitempty"` // action or its prefix
+	From   string `form:"from" json:"from,omitempty"`     // RFC3339
+	To     string `form:"to" json:"to,omitempty"`         // RFC3339
+	Limit  int    `form:"limit" json:"limit,omitempty"`   // the most recent records
+}
+
+// open audit log
+func (s *Server) prepareAudit() error {
+	if len(s.Config.Audit.File) == 0 {
+		return nil // disabled
+	}
+
+	var maxSize uint64
+	if len(s.Config.Audit.MaxSize) != 0 {
+		var err error
+		if maxSize, err = utils.ParseDataSize(s.Config.Audit.MaxSize); err != nil {
+			return fmt.Errorf("failed to parse max size: %s", err)
+		}
+	}
+
+	l, err := audit.Open(s.Config.Audit.File, int64(maxSize),
+		s.Config.Audit.MaxAge, s.Config.Audit.MaxBackups)
+	if err != nil {
+		return err
+	}
+
+	s.auditLog = l
+	return nil // OK
+}
+
+// IsAuditEnabled checks the audit log is enabled
+func (s *Server) IsAuditEnabled() bool {
+	return s.auditLog != nil
+}
+
+// AuditAction is an audit middleware: records the request once it's handled.
+// the handler may put details or change the action (empty to skip)
+func (server *Server) AuditAction(action string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if server.auditLog == nil {
+			return // disabled
+		}
+
+		start := time.Now()
+		rec := &audit.Record{
+			Action:   action,
+			ClientIP: auth.RemoteIP(ctx.Request), // forwarding headers are not trusted
+			Node:     server.Config.HostName,
+			Method:   ctx.Request.Method,
+			Path:     ctx.Request.URL.Path,
+		}
+		ctx.Set(auditRecordKey, rec)
+
+		ctx.Next()
+
+		if len(rec.Action) == 0 {
+			return // skipped
+		}
+		rec.Time = start.UTC()
+		rec.Duration = float64(time.Since(start)) / float64(time.Millisecond)
+		rec.Status = ctx.Writer.Status()
+		if user := getAuthUser(ctx); user != nil {
+			rec.User = user.Name
+		}
+		if err := ctx.Errors.Last(); err != nil {
+			rec.Error = err.Error()
+		}
+
+		if err := server.auditLog.Write(rec); err != nil {
+			log.WithError(err).Warnf("[%s]: failed to write audit record", CORE)
+		}
+	}
+}
+
+// get audit record of the request (nil if audit is disabled)
+func getAuditRecord(ctx *gin.Context) *audit.Record {
+	if v, ok := ctx.Get(auditRecordKey); ok && v != nil {
+		if rec, ok := v.(*audit.Record); ok {
+			return rec
+		}
+	}
+
+	return nil
+}
+
+// put search details to the audit record
+func auditSearch(ctx *gin.Context, cfg *search.Config, res *search.Result) {
+	rec := getAuditRecord(ctx)
+	if rec == nil {
+		return // disabled
+	}
+
+	rec.RequestID = cfg.RequestID
+	rec.Query = cfg.Query
+	rec.Files = cfg.Files
+	if res != nil && res.Stat != nil {
+		rec.Matches = res.Stat.Matches
+		rec.TotalBytes = res.Stat.TotalBytes
+		rec.Nodes = getStatHosts(res.Stat)
+	}
+}
+
+// put accessed files to the audit record
+func auditFiles(ctx *gin.Context, paths ...string) {
+	if rec := getAuditRecord(ctx); rec != nil {
+		rec.Files = append(rec.Files, paths...)
+	}
+}
+
+// put detail to the audit record
+func auditDetail(ctx *gin.Context, name string, value interface{}) {
+	if rec := getAuditRecord(ctx); rec != nil {
+		rec.SetDetail(name, value)
+	}
+}
+
+// change action of the audit record (empty to skip)
+func setAuditAction(ctx *gin.Context, action string) {
+	if rec := getAuditRecord(ctx); rec != nil {
+		rec.Action = action
+	}
+}
+
+// get all hosts of the search statistics
+func getStatHosts(stat *search.Stat) []string {
+	hosts := make(map[string]bool)
+	var collect func(s *search.Stat)
+	collect = func(s *search.Stat) {
+		if len(s.Host) != 0 {
+			hosts[s.Host] = true
+		}
+		for _, d := range s.Details {
+			if d != nil {
+				collect(d)
+			}
+		}
+	}
+	collect(stat)
+
+	res := make([]string, 0, len(hosts))
+	for h := range hosts {
+		res = append(res, h)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Handle GET /audit endpoint - query local audit log
+func (server *Server) DoAudit(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	// parse request parameters
+	var params AuditParams
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+
+	if server.auditLog == nil {
+		panic(NewError(http.StatusNotFound, "audit log is disabled"))
+	}
+	if params.Limit < 0 {
+		panic(NewError(http.StatusBadRequest, "limit should not be negative"))
+	}
+
+	filter := audit.Filter{
+		User:   params.User,
+		Action: params.Action,
+		Limit:  params.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if len(params.From) != 0 {
+		var err error
+		if filter.From, err = time.Parse(time.RFC3339, params.From); err != nil {
+			panic(NewError(http.StatusBadRequest, err.Error()).
+				WithDetails("failed to parse start time"))
+		}
+	}
+	if len(params.To) != 0 {
+		var err error
+		if filter.To, err = time.Parse(time.RFC3339, params.To); err != nil {
+			panic(NewError(http.StatusBadRequest, err.Error()).
+				WithDetails("failed to parse end time"))
+		}
+	}
+
+	res, err := server.auditLog.Query(filter)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to query audit log"))
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,122 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils/audit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// test audit records are written by middleware
+func TestAuditAction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewServer()
+	s.Config.HostName = "node-1"
+	s.auditLog, err = audit.Open(filepath.Join(dir, "audit.log"), 0, 0, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.auditLog.Close()
+
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set(gin.AuthUserKey, &auth.UserInfo{Name: "foo"})
+	})
+	router.GET("/search", s.AuditAction("search"), func(ctx *gin.Context) {
+		defer RecoverFromPanic(ctx)
+		cfg := search.NewConfig("hello", "1.txt")
+		cfg.RequestID = "req-1"
+		auditSearch(ctx, cfg, nil)
+		auditSearch(ctx, cfg, &search.Result{Stat: &search.Stat{
+			Matches:    10,
+			TotalBytes: 1000,
+			Details: []*search.Stat{
+				{Host: "node-2"},
+				{Host: "node-1"},
+				{Host: "node-2"},
+			},
+		}})
+		ctx.String(http.StatusOK, "OK")
+	})
+	router.DELETE("/files", s.AuditAction("files.delete"), func(ctx *gin.Context) {
+		defer RecoverFromPanic(ctx)
+		auditFiles(ctx, "1.txt", "2.txt")
+		panic(NewError(http.StatusForbidden, "access denied"))
+	})
+	router.POST("/skip", s.AuditAction("grpc"), func(ctx *gin.Context) {
+		setAuditAction(ctx, "")
+		ctx.String(http.StatusOK, "OK")
+	})
+
+	for _, r := range []struct{ method, path string }{
+		{"GET", "/search"},
+		{"DELETE", "/files"},
+		{"POST", "/skip"},
+	} {
+		req, _ := http.NewRequest(r.method, r.path, nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", "1.2.3.4") // not trusted
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	res, err := s.auditLog.Query(audit.Filter{})
+	if assert.NoError(t, err) && assert.Len(t, res, 2) {
+		assert.Equal(t, "search", res[0].Action)
+		assert.Equal(t, "foo", res[0].User)
+		assert.Equal(t, "node-1", res[0].Node)
+		assert.Equal(t, http.StatusOK, res[0].Status)
+		assert.Equal(t, "hello", res[0].Query)
+		assert.Equal(t, []string{"1.txt"}, res[0].Files)
+		assert.EqualValues(t, 10, res[0].Matches)
+		assert.EqualValues(t, 1000, res[0].TotalBytes)
+		assert.Equal(t, []string{"node-1", "node-2"}, res[0].Nodes)
+		assert.Equal(t, "req-1", res[0].RequestID)
+		assert.Equal(t, "10.0.0.1", res[0].ClientIP)
+
+		assert.Equal(t, "files.delete", res[1].Action)
+		assert.Equal(t, http.StatusForbidden, res[1].Status)
+		assert.Equal(t, []string{"1.txt", "2.txt"}, res[1].Files)
+		assert.Contains(t, res[1].Error, "access denied")
+	}
+}
@@ -52,6 +52,8 @@ func (server *Server) startUpdatingBusyness() {
 	// dedicated goroutine to monitor and update metric
 	go func(metric int32) {
 		var reported int32 = -1 // to force update metric ASAP
+		var reportedLoad NodeLoad
+		var loadUpdated time.Time
 
 		defer func() {
 			if r := recover(); r != nil {
@@ -74,6 +76,19 @@ func (server *Server) startUpdatingBusyness() {
 					}
 				}
 
+				// load vector is updated less frequently
+				if server.isLoadPolicy() && time.Since(loadUpdated) >= server.Config.Busyness.LoadInterval {
+					loadUpdated = time.Now()
+					if load := server.collectNodeLoad(); load != reportedLoad {
+						busyLog.WithField("load", load).Debugf("[%s]: load reporting...", BUSY)
+						if err := server.updateNodeLoad(load); err != nil {
+							busyLog.WithError(err).Warnf("[%s]: failed to update load", BUSY)
+						} else {
+							reportedLoad = load
+						}
+					}
+				}
+
 			case <-server.closeCh:
 				return
 			}
@@ -38,7 +38,9 @@ import (
 	"net/url"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/demon-xxi/wildmatch"
 	"github.com/gin-gonic/gin"
@@ -157,9 +159,20 @@ func (s *Server) getConsulInfo(userTag string, files []string) (services []*cons
 	if err != nil {
 		return services, tags, fmt.Errorf("failed to get node metrics: %s", err)
 	}
-	services = s.rearrangeServices(services, metrics, s.Config.Busyness.Tolerance)
+	if s.isLoadPolicy() {
+		loads, err := s.getLoadForAllNodes(metrics)
+		if err != nil {
+			return services, tags, fmt.Errorf("failed to get node loads: %s", err)
+		}
+		services = s.arrangeByLoad(services, loads, s.Config.Busyness.Policy)
+	} else {
+		services = s.rearrangeServices(services, metrics, s.Config.Busyness.Tolerance)
+	}
 	log.WithField("metrics", metrics).Debugf("cluster node metrics")
 
+	// unhealthy nodes go last
+	services = s.health.arrange(services, time.Now())
+
 	return services, tags, err
 }
 
@@ -307,14 +320,39 @@ func getServiceUrl(service *consul.CatalogService) string {
 	return fmt.Sprintf("http://%s:%d", address, port)
 }
 
+// get URL of the cluster node by name
+func (s *Server) getNodeUrl(node string) (string, error) {
+	services, _, err := s.getConsulInfo("", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get cluster nodes: %s", err)
+	}
+	for _, service := range services {
+		if service.Node == node {
+			return getServiceUrl(service), nil
+		}
+	}
+
+	return "", fmt.Errorf("cluster node %q not found", node)
+}
+
 // get partition info from the KV storage
 // return map: mask -> list of tags
 func getPartitionInfo(client *consul.Client, userTag string) (map[string][]string, error) {
+	tags, err := getTagsInfo(client, filepath.Join(userTag, "partitions")+"/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags from KV: %s", err)
+	}
+
+	log.WithField("tags", tags).Debugf("partition info")
+	return tags, nil // OK
+}
+
+// get mask -> list of tags map from the KV storage
+func getTagsInfo(client *consul.Client, prefix string) (map[string][]string, error) {
 	// get all wildcards (keys) and tags
-	prefix := filepath.Join(userTag, "partitions") + "/"
 	pairs, _, err := client.KV().List(prefix, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tags from KV: %s", err)
+		return nil, err
 	}
 
 	tags := make(map[string][]string)
@@ -336,7 +374,6 @@ func getPartitionInfo(client *consul.Client, userTag string) (map[string][]strin
 		}
 	}
 
-	log.WithField("tags", tags).Debugf("partition info")
 	return tags, nil // OK
 }
 
@@ -397,12 +434,18 @@ func findAllMatches(client *consul.Client, userTag string, files []string) ([][]
 		return nil, nil // no files - no tags
 	}
 
-	// get partition info from consul KV
-	tags, err := getPartitionInfo(client, userTag)
+	// get partition info (including pending rules) from consul KV
+	tags, err := getPlacementInfo(client, userTag)
 	if err != nil {
 		return nil, err
 	}
 
+	return matchAllTags(tags, files), nil // OK
+}
+
+// match each file to the partition tags
+// no tags means "use all nodes"
+func matchAllTags(tags map[string][]string, files []string) [][]string {
 	// extract keys
 	keys := make([]string, 0, len(tags))
 	for k, _ := range tags {
@@ -435,5 +478,73 @@ func findAllMatches(client *consul.Client, userTag string, files []string) ([][]
 		}
 	}
 
-	return res, nil // OK
+	return res
+}
+
+// get replication info from the KV storage
+// return map: mask -> replication factor
+func getReplicationInfo(client *consul.Client, userTag string) (map[string]int, error) {
+	// get all wildcards (keys) and factors
+	prefix := filepath.Join(userTag, "replication") + "/"
+	pairs, _, err := client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replication factors from KV: %s", err)
+	}
+
+	factors := make(map[string]int)
+	for _, kvp := range pairs {
+		mask, _ := url.QueryUnescape(kvp.Key)
+		k := strings.TrimPrefix(mask, prefix)
+		v, err := strconv.Atoi(strings.TrimSpace(string(kvp.Value)))
+		if err != nil || v < 0 {
+			log.WithField("mask", k).WithField("value", string(kvp.Value)).
+				Warnf("bad replication factor, ignored")
+			continue
+		}
+
+		factors[k] = v
+	}
+
+	log.WithField("factors", factors).Debugf("replication info")
+	return factors, nil // OK
+}
+
+// match each file to the replication factor
+// zero means replication is not configured
+func matchReplicationFactors(factors map[string]int, files []string) []int {
+	// extract keys
+	keys := make([]string, 0, len(factors))
+	for k := range factors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // stable match
+
+	res := make([]int, len(files))
+	for i, f := range files {
+		// use relative path to compare, since keys cannot contain first '/'
+		if rel, err := filepath.Rel("/", f); err == nil {
+			f = rel
+		}
+
+		if found := wildmatch.IsSubsetOfAny(f, keys...); found >= 0 {
+			res[i] = factors[keys[found]]
+		}
+	}
+
+	return res
+}
+
+// get the replication factors for the file list
+func (s *Server) getReplicationFactors(userTag string, files []string) ([]int, error) {
+	client, err := s.getConsulClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consul client: %s", err)
+	}
+
+	factors, err := getReplicationInfo(client, userTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return matchReplicationFactors(factors, files), nil // OK
 }
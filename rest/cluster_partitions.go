@@ -0,0 +1,909 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/demon-xxi/wildmatch"
+	"github.com/getryft/ryft-server/search"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	consul "github.com/hashicorp/consul/api"
+)
+
+// partition key used for files not matched by any rule
+const noPartition = "-"
+
+// PartitionRule partition rule: filename mask -> partition tags
+type PartitionRule struct {
+	Mask   string   `json:"mask"`
+	Tags   []string `json:"tags,omitempty"`   // target partition tags
+	Active []string `json:"active,omitempty"` // tags currently used to search (KV mapping)
+	Count  int      `json:"count,omitempty"`  // number of tags to assign automatically
+}
+
+// is the rule not applied yet?
+func (r PartitionRule) isPending() bool {
+	return len(r.Tags) != 0 && !reflect.DeepEqual(sortedTags(r.Tags), sortedTags(r.Active))
+}
+
+// BalanceParams query parameters for GET /cluster/balance and POST /cluster/rebalance
+type BalanceParams struct {
+	Dir    string `form:"dir" json:"dir"`         // directory to check (relative to home)
+	DryRun bool   `form:"dry-run" json:"dry-run"` // just report, do not move data
+}
+
+// NodeBalance data stored on a node
+type NodeBalance struct {
+	Node       string           `json:"node"`
+	Tags       []string         `json:"tags"`
+	Bytes      int64            `json:"bytes"`      // total size of files and catalogs
+	Items      int              `json:"items"`      // number of files and catalogs
+	Partitions map[string]int64 `json:"partitions"` // mask -> bytes
+	Misplaced  int64            `json:"misplaced"`  // bytes not related to node tags
+	Deviation  float64          `json:"deviation"`  // (bytes - average) / average
+}
+
+// BalanceReport GET /cluster/balance report
+type BalanceReport struct {
+	Dir       string         `json:"dir"`
+	Nodes     []*NodeBalance `json:"nodes"`
+	Average   int64          `json:"average"`   // average number of bytes per node
+	Imbalance float64        `json:"imbalance"` // (max - min) / average
+
+	Errors map[string]string `json:"errors,omitempty"` // node -> listing error
+}
+
+// RebalanceItem file or catalog to be moved
+type RebalanceItem struct {
+	User    string   `json:"user,omitempty"`    // owner of the home
+	Path    string   `json:"path"`              // file or catalog path (relative to home)
+	Type    string   `json:"type"`              // "file" or "catalog"
+	Mask    string   `json:"mask,omitempty"`    // matched partition mask
+	Length  int64    `json:"length"`            // data size in bytes
+	Source  string   `json:"source"`            // node to copy data from
+	Targets []string `json:"targets,omitempty"` // nodes where data should be copied
+	Remove  []string `json:"remove,omitempty"`  // nodes where data should be removed
+	Copied  []string `json:"copied,omitempty"`  // nodes where data is copied
+	Removed []string `json:"removed,omitempty"` // nodes where data is removed
+	Status  string   `json:"status"`            // "DRY-RUN", "MOVED", "FAILED" or "NO-TARGET"
+
+	Errors map[string]string `json:"errors,omitempty"` // node -> error
+}
+
+// RebalanceReport POST /cluster/rebalance report
+type RebalanceReport struct {
+	Dir      string           `json:"dir"`
+	DryRun   bool             `json:"dry-run,omitempty"`
+	Checked  int              `json:"checked"`            // number of files and catalogs checked
+	Items    []*RebalanceItem `json:"items"`              // only items to be moved are reported
+	Mappings []string         `json:"mappings,omitempty"` // updated (or to be updated) partition masks
+
+	Errors map[string]string `json:"errors,omitempty"` // node or mask -> error
+}
+
+// get tags sorted (copy)
+func sortedTags(tags []string) []string {
+	res := append([]string{}, tags...)
+	sort.Strings(res)
+	return res
+}
+
+// get partition rules from the KV storage
+// return map: mask -> list of target tags
+func getPartitionRules(client *consul.Client, userTag string) (map[string][]string, error) {
+	rules, err := getTagsInfo(client, filepath.Join(userTag, "partition-rules")+"/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partition rules from KV: %s", err)
+	}
+
+	log.WithField("rules", rules).Debugf("partition rules")
+	return rules, nil // OK
+}
+
+// get partition info used to place new data:
+// the current partition tags and the tags of pending rules.
+// data is written to both old and new partitions until rebalanced.
+func getPlacementInfo(client *consul.Client, userTag string) (map[string][]string, error) {
+	tags, err := getPartitionInfo(client, userTag)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := getPartitionRules(client, userTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergePartitionTags(tags, rules, true), nil // OK
+}
+
+// merge partition tags and rules.
+// if union is false rule tags replace the partition tags.
+func mergePartitionTags(tags map[string][]string, rules map[string][]string, union bool) map[string][]string {
+	res := make(map[string][]string, len(tags)+len(rules))
+	for mask, list := range tags {
+		res[mask] = list
+	}
+
+	for mask, list := range rules {
+		if old, ok := res[mask]; ok && union {
+			for _, t := range list {
+				if !hasSomeTag(old, []string{t}) {
+					old = append(old, t)
+				}
+			}
+			res[mask] = old
+		} else {
+			res[mask] = list
+		}
+	}
+
+	return res
+}
+
+// put mask -> list of tags to the KV storage.
+// the existing key is re-used if any, empty tags remove the key.
+func putTagsInfo(client *consul.Client, prefix string, mask string, tags []string) error {
+	pairs, _, err := client.KV().List(prefix, nil)
+	if err != nil {
+		return err
+	}
+
+	key := prefix + mask
+	for _, kvp := range pairs {
+		if k, _ := url.QueryUnescape(kvp.Key); strings.TrimPrefix(k, prefix) == mask {
+			key = kvp.Key
+			break
+		}
+	}
+
+	if len(tags) == 0 {
+		_, err = client.KV().Delete(key, nil)
+		return err
+	}
+
+	pair := new(consul.KVPair)
+	pair.Key = key
+	pair.Value = []byte(strings.Join(tags, ","))
+	_, err = client.KV().Put(pair, nil)
+	return err
+}
+
+// match the first partition mask (in sorted order) for each file.
+// empty mask means no partition matched.
+func matchPartitionMasks(tags map[string][]string, files []string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // stable match
+
+	res := make([]string, len(files))
+	for i, f := range files {
+		// use relative path to compare, since keys cannot contain first '/'
+		if rel, err := filepath.Rel("/", f); err == nil {
+			f = rel
+		}
+
+		if found := wildmatch.IsSubsetOfAny(f, keys...); found >= 0 {
+			res[i] = keys[found]
+		}
+	}
+
+	return res
+}
+
+// get sorted list of files and catalogs found on nodes: path -> info
+func listingItems(nodes []repairNode, listing map[string]map[string]search.NodeInfo) (paths []string, items map[string]search.NodeInfo) {
+	items = make(map[string]search.NodeInfo)
+	for _, node := range nodes {
+		for path, info := range listing[node.Name] {
+			if _, ok := items[path]; ok {
+				continue
+			}
+			if info.Type == "file" || info.Type == "catalog" {
+				items[path] = info
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	return
+}
+
+// compute data balance of nodes.
+// partitions are the target partition tags (mask -> tags).
+func computeBalance(nodes []repairNode, listing map[string]map[string]search.NodeInfo, partitions map[string][]string) (res []*NodeBalance, average int64, imbalance float64) {
+	paths, items := listingItems(nodes, listing)
+	masks := matchPartitionMasks(partitions, paths)
+
+	res = make([]*NodeBalance, 0, len(nodes))
+	var total, min, max int64
+	for k, node := range nodes {
+		nb := &NodeBalance{
+			Node:       node.Name,
+			Tags:       node.Tags,
+			Partitions: make(map[string]int64),
+		}
+
+		for i, path := range paths {
+			info, ok := listing[node.Name][path]
+			if !ok || info.Type != items[path].Type {
+				continue
+			}
+
+			mask := masks[i]
+			if len(mask) == 0 {
+				mask = noPartition
+			} else if !hasSomeTag(node.Tags, partitions[mask]) {
+				nb.Misplaced += info.Length
+			}
+
+			nb.Partitions[mask] += info.Length
+			nb.Bytes += info.Length
+			nb.Items++
+		}
+
+		total += nb.Bytes
+		if k == 0 || nb.Bytes < min {
+			min = nb.Bytes
+		}
+		if k == 0 || nb.Bytes > max {
+			max = nb.Bytes
+		}
+		res = append(res, nb)
+	}
+
+	if len(res) != 0 {
+		average = total / int64(len(res))
+	}
+	if average != 0 {
+		for _, nb := range res {
+			nb.Deviation = float64(nb.Bytes-average) / float64(average)
+		}
+		imbalance = float64(max-min) / float64(average)
+	}
+
+	return
+}
+
+// choose count partition tags with the lowest data load.
+// tag load is the average number of bytes on nodes having the tag.
+func assignPartitionTags(balance []*NodeBalance, count int) ([]string, error) {
+	bytes := make(map[string]int64)
+	nodes := make(map[string]int64)
+	for _, nb := range balance {
+		for _, t := range nb.Tags {
+			bytes[t] += nb.Bytes
+			nodes[t]++
+		}
+	}
+
+	tags := make([]string, 0, len(nodes))
+	for t := range nodes {
+		tags = append(tags, t)
+	}
+	if len(tags) < count {
+		return nil, fmt.Errorf("only %d of %d partition tags available", len(tags), count)
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		a, b := bytes[tags[i]]/nodes[tags[i]], bytes[tags[j]]/nodes[tags[j]]
+		if a != b {
+			return a < b
+		}
+		return tags[i] < tags[j]
+	})
+
+	return tags[:count], nil // OK
+}
+
+// plan data moves according to target partition tags.
+// listing is the node content: [node] -> [path] -> info.
+// new replicas are placed to the least loaded related nodes,
+// replicas on unrelated nodes are removed.
+// only items to be moved are reported.
+func planRebalance(nodes []repairNode, listing map[string]map[string]search.NodeInfo,
+	partitions map[string][]string, factors map[string]int) (items []*RebalanceItem, checked int) {
+	paths, infos := listingItems(nodes, listing)
+	masks := matchPartitionMasks(partitions, paths)
+	replicas := matchReplicationFactors(factors, paths)
+
+	// current node load
+	usage := make(map[string]int64)
+	for _, node := range nodes {
+		for path, info := range listing[node.Name] {
+			if base, ok := infos[path]; ok && base.Type == info.Type {
+				usage[node.Name] += info.Length
+			}
+		}
+	}
+
+	for i, path := range paths {
+		info := infos[path]
+		item := &RebalanceItem{
+			Path:   path,
+			Type:   info.Type,
+			Mask:   masks[i],
+			Length: info.Length,
+		}
+		checked++
+
+		// split nodes: keep, misplaced and candidates
+		var tags []string
+		if len(item.Mask) != 0 {
+			tags = partitions[item.Mask]
+		}
+		var keep, candidates []repairNode
+		var keepTime, removeTime time.Time
+		var keepSource, removeSource string
+		for _, node := range nodes {
+			related := len(tags) == 0 || hasSomeTag(node.Tags, tags)
+			x, ok := listing[node.Name][path]
+			if !ok || x.Type != info.Type {
+				if related {
+					candidates = append(candidates, node)
+				}
+				continue
+			}
+
+			// the newest replica is used as a source
+			mt, _ := time.Parse(time.RFC3339, x.ModTime)
+			if related {
+				keep = append(keep, node)
+				if len(keepSource) == 0 || mt.After(keepTime) {
+					keepSource, keepTime = node.Name, mt
+				}
+			} else {
+				item.Remove = append(item.Remove, node.Name)
+				if len(removeSource) == 0 || mt.After(removeTime) {
+					removeSource, removeTime = node.Name, mt
+				}
+			}
+		}
+
+		// related replica is preferred
+		if item.Source = keepSource; len(item.Source) == 0 {
+			item.Source = removeSource
+		}
+
+		if len(item.Remove) == 0 {
+			continue // nothing to move
+		}
+
+		// zero replication factor - all related nodes
+		n := replicas[i]
+		if n == 0 || n > len(keep)+len(candidates) {
+			n = len(keep) + len(candidates)
+		}
+
+		// the least loaded nodes first
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return usage[candidates[a].Name] < usage[candidates[b].Name]
+		})
+		for k := 0; k < n-len(keep) && k < len(candidates); k++ {
+			item.Targets = append(item.Targets, candidates[k].Name)
+			usage[candidates[k].Name] += item.Length
+		}
+		for _, name := range item.Remove {
+			usage[name] -= item.Length
+		}
+
+		if len(keep)+len(item.Targets) == 0 {
+			item.Remove = nil // do not lose data
+			item.Status = "NO-TARGET"
+		} else {
+			item.Status = "DRY-RUN" // to be moved
+		}
+
+		items = append(items, item)
+	}
+
+	return
+}
+
+// GET /cluster/partitions method
+/* to test method:
+curl -s "http://localhost:8765/cluster/partitions" | jq .
+*/
+func (server *Server) DoGetPartitions(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	if server.Config.LocalOnly {
+		panic(NewError(http.StatusBadRequest,
+			"partitions are not available in local mode"))
+	}
+
+	_, _, _, userTag := server.parseAuthAndHome(ctx)
+	client, err := server.getConsulClient()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get consul client"))
+	}
+
+	rules, err := server.getPartitionRuleList(client, userTag)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get partition rules"))
+	}
+
+	ctx.JSON(http.StatusOK, rules)
+}
+
+// get all partition rules and active partition tags sorted by mask
+func (server *Server) getPartitionRuleList(client *consul.Client, userTag string) ([]PartitionRule, error) {
+	active, err := getPartitionInfo(client, userTag)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := getPartitionRules(client, userTag)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]PartitionRule, 0, len(active)+len(rules))
+	for mask, tags := range mergePartitionTags(active, rules, false) {
+		res = append(res, PartitionRule{
+			Mask:   mask,
+			Tags:   tags,
+			Active: active[mask],
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Mask < res[j].Mask
+	})
+
+	return res, nil // OK
+}
+
+// PUT /cluster/partitions method
+/* to test method:
+curl -X PUT -s "http://localhost:8765/cluster/partitions" --data '{"mask":"logs/*","count":1}' | jq .
+*/
+func (server *Server) DoPutPartition(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	if !server.isAdmin(getAuthUser(ctx)) {
+		panic(NewError(http.StatusForbidden, "only admin can change partition rules"))
+	}
+
+	rule := PartitionRule{}
+	if err := binding.JSON.Bind(ctx.Request, &rule); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request JSON parameters"))
+	}
+	rule.Mask = strings.TrimPrefix(strings.TrimSpace(rule.Mask), "/")
+	if len(rule.Mask) == 0 {
+		panic(NewError(http.StatusBadRequest, "no partition mask provided"))
+	}
+	if rule.Count < 0 {
+		panic(NewError(http.StatusBadRequest, "partition tag count cannot be negative"))
+	}
+
+	if server.Config.LocalOnly {
+		panic(NewError(http.StatusBadRequest,
+			"partitions are not available in local mode"))
+	}
+
+	userName, authToken, homeDir, userTag := server.parseAuthAndHome(ctx)
+	client, err := server.getConsulClient()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get consul client"))
+	}
+
+	// assign tags automatically to the least loaded partitions
+	if len(rule.Tags) == 0 {
+		if rule.Count == 0 {
+			rule.Count = 1
+		}
+
+		mountPoint, err := server.getMountPoint()
+		if err != nil {
+			panic(NewError(http.StatusInternalServerError, err.Error()).
+				WithDetails("failed to get mount point"))
+		}
+		mountPoint = filepath.Join(mountPoint, homeDir)
+
+		report := server.getBalanceReport(client, mountPoint, authToken, userTag, "/")
+		if len(report.Errors) != 0 {
+			panic(NewError(http.StatusServiceUnavailable,
+				"some nodes failed to report their content").
+				WithDetails("failed to assign partition tags"))
+		}
+		if rule.Tags, err = assignPartitionTags(report.Nodes, rule.Count); err != nil {
+			panic(NewError(http.StatusBadRequest, err.Error()).
+				WithDetails("failed to assign partition tags"))
+		}
+	}
+	rule.Count = 0
+
+	log.WithFields(map[string]interface{}{
+		"mask": rule.Mask,
+		"tags": rule.Tags,
+		"user": userName,
+	}).Infof("[%s]: saving partition rule", CORE)
+
+	prefix := filepath.Join(userTag, "partition-rules") + "/"
+	if err := putTagsInfo(client, prefix, rule.Mask, rule.Tags); err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to save partition rule"))
+	}
+
+	active, err := getPartitionInfo(client, userTag)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get partition info"))
+	}
+	rule.Active = active[rule.Mask]
+
+	ctx.JSON(http.StatusOK, rule)
+}
+
+// DELETE /cluster/partitions method
+/* to test method:
+curl -X DELETE -s "http://localhost:8765/cluster/partitions?mask=logs/*" | jq .
+*/
+func (server *Server) DoDeletePartition(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	if !server.isAdmin(getAuthUser(ctx)) {
+		panic(NewError(http.StatusForbidden, "only admin can change partition rules"))
+	}
+
+	mask := strings.TrimPrefix(strings.TrimSpace(ctx.Query("mask")), "/")
+	if len(mask) == 0 {
+		panic(NewError(http.StatusBadRequest, "no partition mask provided"))
+	}
+
+	if server.Config.LocalOnly {
+		panic(NewError(http.StatusBadRequest,
+			"partitions are not available in local mode"))
+	}
+
+	userName, _, _, userTag := server.parseAuthAndHome(ctx)
+	client, err := server.getConsulClient()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get consul client"))
+	}
+
+	log.WithFields(map[string]interface{}{
+		"mask": mask,
+		"user": userName,
+	}).Infof("[%s]: removing partition rule", CORE)
+
+	prefix := filepath.Join(userTag, "partition-rules") + "/"
+	if err := putTagsInfo(client, prefix, mask, nil); err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to remove partition rule"))
+	}
+
+	ctx.JSON(http.StatusOK, map[string]interface{}{"mask": mask})
+}
+
+// GET /cluster/balance method
+/* to test method:
+curl -s "http://localhost:8765/cluster/balance?dir=foo" | jq .
+*/
+func (server *Server) DoClusterBalance(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	params, mountPoint := server.parseBalanceParams(ctx)
+	_, authToken, homeDir, userTag := server.parseAuthAndHome(ctx)
+	mountPoint = filepath.Join(mountPoint, homeDir)
+	client, err := server.getConsulClient()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get consul client"))
+	}
+
+	report := server.getBalanceReport(client, mountPoint, authToken, userTag, params.Dir)
+	ctx.JSON(http.StatusOK, report)
+}
+
+// parse GET /cluster/balance and POST /cluster/rebalance parameters.
+// the mount point returned doesn't include home directory.
+func (server *Server) parseBalanceParams(ctx *gin.Context) (BalanceParams, string) {
+	params := BalanceParams{}
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+	if len(params.Dir) == 0 {
+		params.Dir = "/"
+	}
+
+	if server.Config.LocalOnly {
+		panic(NewError(http.StatusBadRequest,
+			"data balance is not available in local mode"))
+	}
+
+	mountPoint, err := server.getMountPoint()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get mount point"))
+	}
+
+	// checks the directory is relative to home
+	if !search.IsRelativeToHome(mountPoint, filepath.Join(mountPoint, params.Dir)) {
+		panic(NewError(http.StatusBadRequest,
+			fmt.Sprintf("path %q is not relative to home", params.Dir)))
+	}
+	params.Dir = filepath.Clean(params.Dir)
+
+	return params, mountPoint
+}
+
+// get data balance report of all nodes
+func (server *Server) getBalanceReport(client *consul.Client, mountPoint string, authToken string, userTag string, dir string) BalanceReport {
+	services, _, err := client.Catalog().Service("ryft-rest-api", "", nil)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get consul services"))
+	}
+	partitions, err := getPlacementTargets(client, userTag)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get partition info"))
+	}
+
+	report := BalanceReport{
+		Dir:    dir,
+		Errors: make(map[string]string),
+	}
+
+	nodes := server.listClusterReplicas(services, mountPoint, authToken, dir)
+	listing, _, available := splitReplicaListing(nodes, report.Errors)
+	report.Nodes, report.Average, report.Imbalance = computeBalance(available, listing, partitions)
+
+	return report
+}
+
+// get target partition tags: rule tags replace the current partition tags
+func getPlacementTargets(client *consul.Client, userTag string) (map[string][]string, error) {
+	tags, err := getPartitionInfo(client, userTag)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := getPartitionRules(client, userTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergePartitionTags(tags, rules, false), nil // OK
+}
+
+// home directory to rebalance
+type rebalanceHome struct {
+	repairHome
+	MountPoint string                  // including home directory
+	Nodes      map[string]*replicaNode // node name -> node
+}
+
+// get home directories to rebalance.
+// partition rules are shared by all users with the same tag,
+// so all homes under the tag are rebalanced.
+func (server *Server) getRebalanceHomes(ctx *gin.Context, userTag string) []repairHome {
+	var homes []repairHome
+	for _, home := range server.getRepairHomes(ctx, nil) {
+		if home.UserTag == userTag {
+			homes = append(homes, home)
+		}
+	}
+
+	return homes
+}
+
+// POST /cluster/rebalance method
+/* to test method:
+curl -X POST -s "http://localhost:8765/cluster/rebalance?dir=foo&dry-run=true" | jq .
+*/
+func (server *Server) DoClusterRebalance(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	if !server.isAdmin(getAuthUser(ctx)) {
+		panic(NewError(http.StatusForbidden, "only admin can rebalance data"))
+	}
+
+	params, mountPoint := server.parseBalanceParams(ctx)
+	userName, _, _, userTag := server.parseAuthAndHome(ctx)
+	homes := server.getRebalanceHomes(ctx, userTag)
+
+	log.WithFields(map[string]interface{}{
+		"params": params,
+		"user":   userName,
+		"tag":    userTag,
+		"homes":  len(homes),
+	}).Infof("[%s]: rebalancing data...", CORE)
+
+	client, err := server.getConsulClient()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get consul client"))
+	}
+	services, _, err := client.Catalog().Service("ryft-rest-api", "", nil)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get consul services"))
+	}
+	rules, err := server.getPartitionRuleList(client, userTag)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get partition rules"))
+	}
+	factors, err := getReplicationInfo(client, userTag)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get replication info"))
+	}
+
+	report := RebalanceReport{
+		Dir:    params.Dir,
+		DryRun: params.DryRun,
+		Items:  []*RebalanceItem{},
+		Errors: make(map[string]string),
+	}
+
+	partitions := make(map[string][]string)
+	pending := make(map[string][]string)
+	for _, rule := range rules {
+		partitions[rule.Mask] = rule.Tags
+		if rule.isPending() {
+			pending[rule.Mask] = rule.Tags
+			report.Mappings = append(report.Mappings, rule.Mask)
+		}
+	}
+
+	// get content of all nodes and plan moves for each home
+	itemHomes := make(map[*RebalanceItem]*rebalanceHome)
+	for _, home := range homes {
+		h := &rebalanceHome{
+			repairHome: home,
+			MountPoint: filepath.Join(mountPoint, home.HomeDir),
+		}
+
+		nodes := server.listClusterReplicas(services, h.MountPoint, h.AuthToken, params.Dir)
+		listing, byName, available := splitReplicaListing(nodes, report.Errors)
+		h.Nodes = byName
+
+		items, checked := planRebalance(available, listing, partitions, factors)
+		report.Checked += checked
+		for _, item := range items {
+			item.User = h.User
+			itemHomes[item] = h
+			report.Items = append(report.Items, item)
+		}
+	}
+	if len(report.Errors) != 0 && !params.DryRun {
+		// data cannot be removed safely
+		panic(NewError(http.StatusServiceUnavailable,
+			"some nodes failed to report their content").
+			WithDetails("failed to rebalance data"))
+	}
+
+	if params.DryRun {
+		log.WithField("checked", report.Checked).
+			WithField("moves", len(report.Items)).
+			Infof("[%s]: rebalance planned", CORE)
+		ctx.JSON(http.StatusOK, report)
+		return
+	}
+
+	// copy data of all homes to target nodes first
+	failed := make(map[string]bool) // masks failed to copy
+	for _, item := range report.Items {
+		if item.Status == "NO-TARGET" {
+			failed[item.Mask] = true // data stays on the old nodes
+			continue
+		}
+		if item.Status != "DRY-RUN" {
+			continue // nothing to do
+		}
+
+		home := itemHomes[item]
+		item.Errors = make(map[string]string)
+		for _, name := range item.Targets {
+			if err := server.copyReplica(home.MountPoint, home.AuthToken, home.Nodes[name], item.Source, item.Type, item.Path, item.Path); err != nil {
+				item.Errors[name] = err.Error()
+			} else {
+				item.Copied = append(item.Copied, name)
+			}
+		}
+		if len(item.Errors) != 0 {
+			failed[item.Mask] = true
+		}
+	}
+
+	// update KV mapping once all data is copied
+	mappings := report.Mappings
+	report.Mappings = nil
+	for _, mask := range mappings {
+		if failed[mask] {
+			report.Errors[mask] = "partition tags are not updated: failed to move data"
+			continue
+		}
+
+		prefix := filepath.Join(userTag, "partitions") + "/"
+		if err := putTagsInfo(client, prefix, mask, pending[mask]); err != nil {
+			report.Errors[mask] = fmt.Sprintf("failed to update partition tags: %s", err)
+			failed[mask] = true
+			continue
+		}
+		report.Mappings = append(report.Mappings, mask)
+	}
+
+	// and only then remove source data
+	for _, item := range report.Items {
+		if item.Status != "DRY-RUN" {
+			continue // nothing to do
+		}
+
+		home := itemHomes[item]
+		if len(item.Errors) == 0 && !failed[item.Mask] {
+			for _, name := range item.Remove {
+				node := home.Nodes[name]
+				if err := server.removeReplica(home.MountPoint, home.AuthToken, node.IsLocal, node.Address, item.Path); err != nil {
+					item.Errors[name] = err.Error()
+				} else {
+					item.Removed = append(item.Removed, name)
+				}
+			}
+		}
+
+		if len(item.Errors) != 0 || len(item.Removed) != len(item.Remove) {
+			item.Status = "FAILED"
+		} else {
+			item.Status = "MOVED"
+		}
+	}
+
+	log.WithField("checked", report.Checked).
+		WithField("moves", len(report.Items)).
+		WithField("mappings", report.Mappings).
+		Infof("[%s]: data rebalanced", CORE)
+	ctx.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,180 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"testing"
+
+	"github.com/getryft/ryft-server/search"
+	"github.com/stretchr/testify/assert"
+)
+
+// partition tags merge test
+func TestPartitionTagsMerge(t *testing.T) {
+	tags := map[string][]string{
+		"a/*": {"a"},
+		"b/*": {"b"},
+	}
+	rules := map[string][]string{
+		"a/*": {"c"},
+		"d/*": {"d"},
+	}
+
+	assert.Equal(t, map[string][]string{
+		"a/*": {"a", "c"},
+		"b/*": {"b"},
+		"d/*": {"d"},
+	}, mergePartitionTags(tags, rules, true))
+
+	assert.Equal(t, map[string][]string{
+		"a/*": {"c"},
+		"b/*": {"b"},
+		"d/*": {"d"},
+	}, mergePartitionTags(map[string][]string{"a/*": {"a"}, "b/*": {"b"}}, rules, false))
+
+	assert.True(t, PartitionRule{Tags: []string{"a", "b"}, Active: []string{"a"}}.isPending())
+	assert.False(t, PartitionRule{Tags: []string{"a", "b"}, Active: []string{"b", "a"}}.isPending())
+	assert.False(t, PartitionRule{Active: []string{"a"}}.isPending())
+
+	assert.Equal(t, []string{"a/*", "", "*.txt"},
+		matchPartitionMasks(map[string][]string{"a/*": nil, "*.txt": nil},
+			[]string{"/a/1.txt", "b/2.dat", "c.txt"}))
+}
+
+// data balance test
+func TestClusterBalance(t *testing.T) {
+	nodes := []repairNode{
+		{Name: "n1", Tags: []string{"a"}},
+		{Name: "n2", Tags: []string{"b"}},
+		{Name: "n3", Tags: []string{"c"}},
+	}
+	partitions := map[string][]string{
+		"a/*": {"a"},
+	}
+	listing := map[string]map[string]search.NodeInfo{
+		"n1": {
+			"a/1.txt": {Type: "file", Length: 100},
+			"x.txt":   {Type: "file", Length: 20},
+			"a/dir":   {Type: "dir"},
+		},
+		"n2": {
+			"a/1.txt": {Type: "file", Length: 100},
+		},
+		"n3": {},
+	}
+
+	res, average, imbalance := computeBalance(nodes, listing, partitions)
+	assert.EqualValues(t, 73, average)
+	assert.InDelta(t, 120.0/73, imbalance, 0.001)
+	if assert.Len(t, res, 3) {
+		assert.EqualValues(t, 120, res[0].Bytes)
+		assert.Equal(t, 2, res[0].Items)
+		assert.Equal(t, map[string]int64{"a/*": 100, "-": 20}, res[0].Partitions)
+		assert.EqualValues(t, 0, res[0].Misplaced)
+
+		assert.EqualValues(t, 100, res[1].Misplaced)
+		assert.EqualValues(t, 0, res[2].Bytes)
+		assert.InDelta(t, -1.0, res[2].Deviation, 0.001)
+	}
+
+	// the least loaded tags
+	tags, err := assignPartitionTags(res, 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"c", "b"}, tags)
+	}
+	_, err = assignPartitionTags(res, 4)
+	assert.EqualError(t, err, "only 3 of 4 partition tags available")
+}
+
+// rebalance planning test
+func TestRebalancePlan(t *testing.T) {
+	nodes := []repairNode{
+		{Name: "n1", Tags: []string{"a"}},
+		{Name: "n2", Tags: []string{"a"}},
+		{Name: "n3", Tags: []string{"b"}},
+		{Name: "n4", Tags: []string{"b"}},
+	}
+	partitions := map[string][]string{
+		"a/*": {"a"},
+		"b/*": {"b"},
+	}
+	factors := map[string]int{
+		"b/*": 1,
+	}
+
+	file := func(length int64, mtime string) search.NodeInfo {
+		return search.NodeInfo{Type: "file", Length: length, ModTime: mtime}
+	}
+	old := "2018-01-01T00:00:00Z"
+	now := "2018-02-01T00:00:00Z"
+
+	listing := map[string]map[string]search.NodeInfo{
+		"n1": {
+			"a/ok.txt": file(5, old),
+			"b/1.txt":  file(7, old),
+			"b/2.txt":  file(3, now),
+			"c.txt":    file(1, old),
+		},
+		"n2": {
+			"a/ok.txt": file(5, old),
+			"b/2.txt":  file(3, old),
+		},
+		"n3": {
+			"b/big.txt": file(1000, old),
+			"b/2.txt":   file(3, old),
+		},
+		"n4": {},
+	}
+
+	items, checked := planRebalance(nodes, listing, partitions, factors)
+	assert.Equal(t, 5, checked)
+	if assert.Len(t, items, 2) {
+		// b/1.txt: moved to the least loaded node
+		assert.Equal(t, "b/1.txt", items[0].Path)
+		assert.Equal(t, "b/*", items[0].Mask)
+		assert.Equal(t, "n1", items[0].Source)
+		assert.Equal(t, []string{"n4"}, items[0].Targets)
+		assert.Equal(t, []string{"n1"}, items[0].Remove)
+		assert.Equal(t, "DRY-RUN", items[0].Status)
+
+		// b/2.txt: related replica is kept
+		assert.Equal(t, "b/2.txt", items[1].Path)
+		assert.Equal(t, "n3", items[1].Source)
+		assert.Empty(t, items[1].Targets)
+		assert.Equal(t, []string{"n1", "n2"}, items[1].Remove)
+	}
+
+	// no related nodes - data is not removed
+	items, _ = planRebalance(nodes, listing, map[string][]string{"a/*": {"x"}}, nil)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "a/ok.txt", items[0].Path)
+		assert.Empty(t, items[0].Remove)
+		assert.Equal(t, "NO-TARGET", items[0].Status)
+	}
+}
@@ -0,0 +1,629 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/ryftprim"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	consul "github.com/hashicorp/consul/api"
+)
+
+// RepairParams query parameters for POST /cluster/repair
+type RepairParams struct {
+	Dir    string   `form:"dir" json:"dir"`         // directory to check (relative to home)
+	Users  []string `form:"user" json:"user"`       // users to check, all users by default
+	DryRun bool     `form:"dry-run" json:"dry-run"` // just report, do not repair
+}
+
+// RepairItem replication status of a file or catalog
+type RepairItem struct {
+	User     string   `json:"user,omitempty"`     // owner of the home
+	Path     string   `json:"path"`               // file or catalog path (relative to home)
+	Type     string   `json:"type"`               // "file" or "catalog"
+	Replicas int      `json:"replicas"`           // required number of replicas
+	Nodes    []string `json:"nodes"`              // nodes with up-to-date replica
+	Missing  []string `json:"missing,omitempty"`  // nodes where replica should be created
+	Outdated []string `json:"outdated,omitempty"` // nodes with out-of-date replica
+	Repaired []string `json:"repaired,omitempty"` // nodes where replica is repaired
+	Status   string   `json:"status"`             // "OK", "REPAIRED", "UNDER-REPLICATED", "FAILED" or "DRY-RUN"
+
+	Errors map[string]string `json:"errors,omitempty"` // node -> repair error
+
+	source string // node with the reference replica
+}
+
+// RepairReport POST /cluster/repair report
+type RepairReport struct {
+	Dir     string        `json:"dir"`
+	DryRun  bool          `json:"dry-run,omitempty"`
+	Checked int           `json:"checked"` // number of files and catalogs checked
+	Items   []*RepairItem `json:"items"`   // only items with issues are reported
+
+	Errors map[string]string `json:"errors,omitempty"` // node -> listing error
+}
+
+// home directory to repair
+type repairHome struct {
+	User      string // the first user with this home
+	HomeDir   string // relative to mount point
+	UserTag   string
+	AuthToken string // to access the home on other nodes
+}
+
+// cluster node used for repair planning
+type repairNode struct {
+	Name string
+	Tags []string
+}
+
+// replica version: type, length, part count and checksum
+func replicaVersion(info search.NodeInfo) string {
+	return fmt.Sprintf("%s:%d:%d:%s", info.Type,
+		info.Length, info.PartCount, info.Checksum)
+}
+
+// plan repair of all files and catalogs found on nodes.
+// listing is the node content: [node] -> [path] -> info.
+// the reference replica is the newest version (the most common is used in case of tie).
+// only items with issues are reported.
+func planRepair(nodes []repairNode, listing map[string]map[string]search.NodeInfo,
+	partitions map[string][]string, factors map[string]int) (items []*RepairItem, checked int) {
+	// all known paths
+	pathMap := make(map[string]string) // path -> type
+	for _, content := range listing {
+		for path, info := range content {
+			if info.Type == "file" || info.Type == "catalog" {
+				pathMap[path] = info.Type
+			}
+		}
+	}
+	paths := make([]string, 0, len(pathMap))
+	for path := range pathMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	tags := matchAllTags(partitions, paths)
+	replicas := matchReplicationFactors(factors, paths)
+
+	for i, path := range paths {
+		item := &RepairItem{
+			Path:  path,
+			Type:  pathMap[path],
+			Nodes: []string{},
+		}
+
+		// group nodes by replica version
+		groups := make(map[string][]string)
+		mtimes := make(map[string]time.Time)
+		versions := make(map[string]string) // node -> version
+		for _, node := range nodes {
+			info, ok := listing[node.Name][path]
+			if !ok || info.Type != item.Type {
+				continue
+			}
+
+			v := replicaVersion(info)
+			versions[node.Name] = v
+			groups[v] = append(groups[v], node.Name)
+			if mt, err := time.Parse(time.RFC3339, info.ModTime); err == nil && mt.After(mtimes[v]) {
+				mtimes[v] = mt
+			}
+		}
+
+		// reference version: older data never overwrites newer one
+		var ref string
+		for v, g := range groups {
+			if ref == "" || mtimes[v].After(mtimes[ref]) ||
+				(mtimes[v].Equal(mtimes[ref]) && (len(g) > len(groups[ref]) ||
+					(len(g) == len(groups[ref]) && v < ref))) {
+				ref = v
+			}
+		}
+		if ref == "" {
+			continue // should never happen
+		}
+		item.source = groups[ref][0]
+
+		// check related nodes (no tags - all nodes)
+		related, missing := 0, []string{}
+		for _, node := range nodes {
+			if len(tags[i]) != 0 && !hasSomeTag(node.Tags, tags[i]) {
+				continue
+			}
+
+			related++
+			switch v, ok := versions[node.Name]; {
+			case !ok:
+				missing = append(missing, node.Name)
+			case v == ref:
+				item.Nodes = append(item.Nodes, node.Name)
+			default:
+				item.Outdated = append(item.Outdated, node.Name)
+			}
+		}
+
+		// zero replication factor - all related nodes
+		item.Replicas = replicas[i]
+		if item.Replicas == 0 {
+			item.Replicas = related
+		}
+
+		// outdated replicas are always repaired,
+		// missing replicas are created up to the replication factor
+		if n := item.Replicas - len(item.Nodes) - len(item.Outdated); n > 0 {
+			if n > len(missing) {
+				n = len(missing)
+			}
+			item.Missing = missing[:n]
+		}
+
+		checked++
+		switch {
+		case len(item.Missing) != 0 || len(item.Outdated) != 0:
+			item.Status = "DRY-RUN" // to be repaired
+		case len(item.Nodes) < item.Replicas:
+			item.Status = "UNDER-REPLICATED"
+		default:
+			continue // OK
+		}
+
+		items = append(items, item)
+	}
+
+	return
+}
+
+// POST /cluster/repair method
+/* to test method:
+curl -X POST -s "http://localhost:8765/cluster/repair?dir=foo&dry-run=true" | jq .
+*/
+func (server *Server) DoClusterRepair(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	// parse request parameters
+	params := RepairParams{}
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+	if len(params.Dir) == 0 {
+		params.Dir = "/"
+	}
+
+	if server.Config.LocalOnly {
+		panic(NewError(http.StatusBadRequest,
+			"replica repair is not available in local mode"))
+	}
+
+	mountPoint, err := server.getMountPoint()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get mount point"))
+	}
+
+	// checks the directory is relative to home
+	if !search.IsRelativeToHome(mountPoint, filepath.Join(mountPoint, params.Dir)) {
+		panic(NewError(http.StatusBadRequest,
+			fmt.Sprintf("path %q is not relative to home", params.Dir)))
+	}
+	params.Dir = filepath.Clean(params.Dir)
+
+	homes := server.getRepairHomes(ctx, params.Users)
+	log.WithFields(map[string]interface{}{
+		"params": params,
+		"homes":  len(homes),
+	}).Infof("[%s]: checking replicas...", CORE)
+
+	client, err := server.getConsulClient()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get consul client"))
+	}
+	services, _, err := client.Catalog().Service("ryft-rest-api", "", nil)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get consul services"))
+	}
+
+	report := RepairReport{
+		Dir:    params.Dir,
+		DryRun: params.DryRun,
+		Items:  []*RepairItem{},
+		Errors: make(map[string]string),
+	}
+	for _, home := range homes {
+		items, checked := server.repairHome(client, services,
+			filepath.Join(mountPoint, home.HomeDir), home, params, report.Errors)
+		report.Items = append(report.Items, items...)
+		report.Checked += checked
+	}
+
+	log.WithField("checked", report.Checked).
+		WithField("issues", len(report.Items)).
+		Infof("[%s]: replicas checked", CORE)
+	ctx.JSON(http.StatusOK, report)
+}
+
+// get home directories to repair.
+// all users are checked by default, the same home is checked once.
+func (server *Server) getRepairHomes(ctx *gin.Context, names []string) []repairHome {
+	user := getAuthUser(ctx)
+	if user == nil || server.AuthManager == nil {
+		// no authentication - just one home
+		userName, authToken, homeDir, userTag := server.parseAuthAndHome(ctx)
+		return []repairHome{{User: userName, HomeDir: homeDir, UserTag: userTag, AuthToken: authToken}}
+	}
+
+	// other homes are accessed on behalf of the admin
+	if server.ClusterAuth == nil {
+		panic(NewError(http.StatusNotImplemented,
+			"replica repair requires node-to-node authentication"))
+	}
+
+	var users []*auth.UserInfo
+	var err error
+	if len(names) == 0 {
+		users, err = server.AuthManager.GetAllUsers()
+	} else {
+		users, err = server.AuthManager.GetUsers(names)
+	}
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get users"))
+	}
+
+	homes := make([]repairHome, 0, len(users))
+	seen := make(map[string]bool)
+	for _, u := range users {
+		key := u.ClusterTag + "\x00" + u.HomeDir
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		// admin's permissions, user's home
+		impersonated := *user // copy
+		impersonated.HomeDir = u.HomeDir
+		impersonated.ClusterTag = u.ClusterTag
+		impersonated.Quota = u.Quota
+		token, err := server.ClusterAuth.Issue(&impersonated, server.Config.HostName)
+		if err != nil {
+			panic(NewError(http.StatusInternalServerError, err.Error()).
+				WithDetails("failed to issue cluster token"))
+		}
+
+		homes = append(homes, repairHome{
+			User:      u.Name,
+			HomeDir:   filepath.Join(server.Config.InstanceHome, u.HomeDir),
+			UserTag:   u.ClusterTag,
+			AuthToken: token,
+		})
+	}
+
+	return homes
+}
+
+// check and repair replicas of one home.
+// nodes failed to report their content are put into errors map.
+func (server *Server) repairHome(client *consul.Client, services []*consul.CatalogService, mountPoint string,
+	home repairHome, params RepairParams, errors map[string]string) ([]*RepairItem, int) {
+	partitions, err := getPartitionInfo(client, home.UserTag)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get partition info"))
+	}
+	factors, err := getReplicationInfo(client, home.UserTag)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get replication info"))
+	}
+
+	// get content of all nodes
+	nodes := server.listClusterReplicas(services, mountPoint, home.AuthToken, params.Dir)
+
+	// nodes failed to report its content are not checked
+	listErrors := make(map[string]string)
+	listing, byName, available := splitReplicaListing(nodes, listErrors)
+	for name, msg := range listErrors {
+		if _, ok := errors[name]; !ok {
+			errors[name] = msg
+		}
+	}
+
+	items, checked := planRepair(available, listing, partitions, factors)
+	for _, item := range items {
+		item.User = home.User
+	}
+
+	// repair items one by one
+	for _, item := range items {
+		if params.DryRun || item.Status != "DRY-RUN" {
+			continue // nothing to do
+		}
+
+		source := byName[item.source]
+		item.Errors = make(map[string]string)
+		for _, name := range item.Outdated {
+			if err := server.replaceReplica(mountPoint, home.AuthToken, byName[name], source.Name, item.Type, item.Path); err != nil {
+				item.Errors[name] = err.Error()
+			} else {
+				item.Repaired = append(item.Repaired, name)
+			}
+		}
+		for _, name := range item.Missing {
+			if err := server.copyReplica(mountPoint, home.AuthToken, byName[name], source.Name, item.Type, item.Path, item.Path); err != nil {
+				item.Errors[name] = err.Error()
+			} else {
+				item.Repaired = append(item.Repaired, name)
+			}
+		}
+
+		switch {
+		case len(item.Errors) != 0:
+			item.Status = "FAILED"
+		case len(item.Nodes)+len(item.Repaired) < item.Replicas:
+			item.Status = "UNDER-REPLICATED"
+		default:
+			item.Status = "REPAIRED"
+		}
+	}
+
+	return items, checked
+}
+
+// cluster node and its content
+type replicaNode struct {
+	IsLocal bool
+	Name    string
+	Address string
+	Tags    []string
+
+	Content map[string]search.NodeInfo
+	Error   error
+}
+
+// get content of all nodes in dedicated goroutines
+func (server *Server) listClusterReplicas(services []*consul.CatalogService, mountPoint string, authToken string, dir string) []*replicaNode {
+	nodes := make([]*replicaNode, len(services))
+	var wg sync.WaitGroup
+	for i, service := range services {
+		node := &replicaNode{
+			IsLocal: server.isLocalService(service),
+			Name:    service.Node,
+			Address: getServiceUrl(service),
+			Tags:    service.ServiceTags,
+		}
+		nodes[i] = node
+
+		wg.Add(1)
+		go func(node *replicaNode) {
+			defer wg.Done()
+			if node.IsLocal {
+				node.Content, node.Error = listLocalReplicas(mountPoint, dir)
+			} else {
+				node.Content, node.Error = listRemoteReplicas(node.Address, authToken, dir)
+			}
+		}(node)
+	}
+	wg.Wait()
+
+	return nodes
+}
+
+// split node content into listing and available nodes.
+// nodes failed to report its content are put into errors map.
+func splitReplicaListing(nodes []*replicaNode, errors map[string]string) (listing map[string]map[string]search.NodeInfo, byName map[string]*replicaNode, available []repairNode) {
+	listing = make(map[string]map[string]search.NodeInfo)
+	byName = make(map[string]*replicaNode)
+	available = make([]repairNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Error != nil {
+			errors[node.Name] = node.Error.Error()
+			continue
+		}
+
+		listing[node.Name] = node.Content
+		byName[node.Name] = node
+		available = append(available, repairNode{Name: node.Name, Tags: node.Tags})
+	}
+
+	return
+}
+
+// get local directory content (recursive with checksums)
+func listLocalReplicas(mountPoint string, dir string) (map[string]search.NodeInfo, error) {
+	info, err := ryftprim.ReadDirOrCatalog(mountPoint, dir,
+		search.FilesOptions{Recursive: true, Checksum: true}, true, "")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]search.NodeInfo{}, nil // no data
+		}
+		return nil, err
+	}
+
+	return replicaPaths(dir, info), nil // OK
+}
+
+// get remote directory content (recursive with checksums)
+func listRemoteReplicas(address string, authToken string, dir string) (map[string]search.NodeInfo, error) {
+	engine, err := search.NewEngine("ryfthttp", map[string]interface{}{
+		"server-url": address,
+		"auth-token": authToken,
+		"local-only": true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP engine: %s", err)
+	}
+
+	info, err := engine.Files(dir, search.FilesOptions{Recursive: true, Checksum: true})
+	if err != nil {
+		if strings.Contains(err.Error(), fmt.Sprintf("status: %d", http.StatusNotFound)) {
+			return map[string]search.NodeInfo{}, nil // no data
+		}
+		return nil, err
+	}
+
+	return replicaPaths(dir, info), nil // OK
+}
+
+// convert directory details to the path (relative to home) -> info map
+func replicaPaths(dir string, info *search.DirInfo) map[string]search.NodeInfo {
+	res := make(map[string]search.NodeInfo)
+	for _, details := range info.Details {
+		for name, node := range details {
+			res[filepath.Join(dir, name)] = node
+		}
+	}
+
+	return res
+}
+
+// replace out-of-date replica on local or remote node.
+// the reference replica is copied to a temporary path first,
+// so the out-of-date replica is removed only if the copy succeeded.
+func (server *Server) replaceReplica(mountPoint string, authToken string, node *replicaNode, sourceNode string, itemType string, path string) error {
+	tmp := filepath.Join(filepath.Dir(path),
+		fmt.Sprintf(".repair-%d-%s", time.Now().UnixNano(), filepath.Base(path)))
+	if err := server.copyReplica(mountPoint, authToken, node, sourceNode, itemType, path, tmp); err != nil {
+		server.removeReplica(mountPoint, authToken, node.IsLocal, node.Address, tmp) // ignore errors
+		return err
+	}
+
+	if err := server.removeReplica(mountPoint, authToken, node.IsLocal, node.Address, path); err != nil {
+		server.removeReplica(mountPoint, authToken, node.IsLocal, node.Address, tmp) // ignore errors
+		return fmt.Errorf("failed to remove out-of-date replica: %s", err)
+	}
+
+	if err := server.renameReplica(mountPoint, authToken, node, itemType, tmp, path); err != nil {
+		return fmt.Errorf("failed to rename %q: %s", tmp, err)
+	}
+
+	return nil // OK
+}
+
+// copy replica from the source node to local or remote node
+func (server *Server) copyReplica(mountPoint string, authToken string, node *replicaNode, sourceNode string, itemType string, path string, newPath string) error {
+	cp := CopyFilesParams{Local: true, InternalSource: sourceNode}
+	if itemType == "catalog" {
+		cp.Catalog, cp.NewCatalog = path, newPath
+	} else {
+		cp.File, cp.New = path, newPath
+	}
+
+	var results []CopyFilesResult
+	if node.IsLocal {
+		results = append(results, server.copyLocalFiles(mountPoint, authToken, cp, nil, false, nil))
+	} else {
+		var err error
+		if results, err = server.copyRemoteFiles(node.Address, authToken, cp); err != nil {
+			return err
+		}
+	}
+	for _, res := range results {
+		if len(res.Error) != 0 {
+			return fmt.Errorf("%s", res.Error)
+		}
+	}
+
+	return nil // OK
+}
+
+// remove replica on local or remote node
+func (server *Server) removeReplica(mountPoint string, authToken string, isLocal bool, address string, path string) error {
+	if isLocal {
+		for _, err := range deleteAll(mountPoint, []string{path}) {
+			if err != nil {
+				return err
+			}
+		}
+		return nil // OK
+	}
+
+	results, err := server.deleteRemoteFiles(address, authToken,
+		DeleteFilesParams{Files: []string{path}, Local: true})
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		if len(res.Error) != 0 {
+			return fmt.Errorf("%s", res.Error)
+		}
+	}
+
+	return nil // OK
+}
+
+// rename replica on local or remote node
+func (server *Server) renameReplica(mountPoint string, authToken string, node *replicaNode, itemType string, path string, newPath string) error {
+	params := RenameFileParams{New: newPath, Local: true}
+	if itemType == "catalog" {
+		params.Catalog = path
+	} else {
+		params.File = path
+	}
+
+	if node.IsLocal {
+		renamer, err := getRename(mountPoint, params, "")
+		if err != nil {
+			return err
+		}
+		if err := renamer.Validate(); err != nil {
+			return err
+		}
+		_, err = server.renameLocalFile(renamer)
+		return err
+	}
+
+	results, err := server.renameRemoteFile(node.Address, authToken, params, "")
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		if len(res.Error) != 0 {
+			return fmt.Errorf("%s", res.Error)
+		}
+	}
+
+	return nil // OK
+}
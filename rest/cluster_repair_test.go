@@ -0,0 +1,152 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"testing"
+
+	"github.com/getryft/ryft-server/search"
+	"github.com/stretchr/testify/assert"
+)
+
+// replication factor matching test
+func TestReplicationFactors(t *testing.T) {
+	factors := map[string]int{
+		"logs/*":   2,
+		"*.pcap":   3,
+		"backup/*": 0,
+	}
+
+	assert.Equal(t, []int{2, 3, 0, 0},
+		matchReplicationFactors(factors, []string{"/logs/a.txt", "b.pcap", "c.txt", "/backup/d.txt"}))
+	assert.Equal(t, []int{0}, matchReplicationFactors(nil, []string{"a.txt"}))
+}
+
+// upload node selection test
+func TestLimitReplicas(t *testing.T) {
+	check := func(local int, selected []bool, replicas int, expectedCount int, expected []bool) {
+		count := limitReplicas(len(selected), replicas,
+			func(i int) bool { return i == local },
+			func(i int) bool { return selected[i] },
+			func(i int) { selected[i] = false })
+		assert.Equal(t, expectedCount, count)
+		assert.Equal(t, expected, selected)
+	}
+
+	check(2, []bool{true, true, true, true}, 2, 2, []bool{true, false, true, false})
+	check(-1, []bool{false, true, true, true}, 2, 2, []bool{false, true, true, false})
+	check(0, []bool{true, false, true}, 5, 2, []bool{true, false, true})
+}
+
+// repair planning test
+func TestRepairPlan(t *testing.T) {
+	nodes := []repairNode{
+		{Name: "n1", Tags: []string{"a"}},
+		{Name: "n2", Tags: []string{"a"}},
+		{Name: "n3", Tags: []string{"a", "b"}},
+		{Name: "n4", Tags: []string{"b"}},
+	}
+	partitions := map[string][]string{
+		"a/*": {"a"},
+		"b/*": {"b"},
+	}
+	factors := map[string]int{
+		"a/*": 3,
+		"c/*": 2,
+	}
+
+	file := func(length int64, sum string, mtime string) search.NodeInfo {
+		return search.NodeInfo{Type: "file", Length: length, Checksum: sum, ModTime: mtime}
+	}
+	old := "2018-01-01T00:00:00Z"
+	now := "2018-02-01T00:00:00Z"
+
+	listing := map[string]map[string]search.NodeInfo{
+		"n1": {
+			"a/ok.txt":   file(5, "aaa", old),
+			"a/bad.txt":  file(5, "aaa", old),
+			"a/miss.txt": file(5, "aaa", old),
+			"a/same.txt": file(5, "aaa", old),
+			"a/dir":      {Type: "dir"},
+			"c/2.txt":    file(1, "x", old),
+			"c/ok.txt":   file(1, "x", old),
+		},
+		"n2": {
+			"a/ok.txt":   file(5, "aaa", old),
+			"a/bad.txt":  file(5, "bbb", now),
+			"a/same.txt": file(5, "bbb", old),
+			"b/tie.txt":  file(7, "new", now),
+			"c/ok.txt":   file(1, "x", old),
+		},
+		"n3": {
+			"a/ok.txt":   file(5, "aaa", old),
+			"a/bad.txt":  file(5, "aaa", old),
+			"a/miss.txt": file(5, "aaa", old),
+			"a/same.txt": file(5, "aaa", old),
+			"b/tie.txt":  file(7, "old", old),
+		},
+		"n4": {},
+	}
+
+	items, checked := planRepair(nodes, listing, partitions, factors)
+	assert.Equal(t, 7, checked)
+	if assert.Len(t, items, 5) {
+		// a/bad.txt: the newest version wins even if it's not the most common
+		assert.Equal(t, "a/bad.txt", items[0].Path)
+		assert.Equal(t, 3, items[0].Replicas)
+		assert.Equal(t, "n2", items[0].source)
+		assert.Equal(t, []string{"n2"}, items[0].Nodes)
+		assert.Equal(t, []string{"n1", "n3"}, items[0].Outdated)
+		assert.Empty(t, items[0].Missing)
+		assert.Equal(t, "DRY-RUN", items[0].Status)
+
+		// a/miss.txt: one replica is missing
+		assert.Equal(t, "a/miss.txt", items[1].Path)
+		assert.Equal(t, []string{"n2"}, items[1].Missing)
+		assert.Contains(t, []string{"n1", "n3"}, items[1].source)
+
+		// a/same.txt: the same time - the most common version wins
+		assert.Equal(t, "a/same.txt", items[2].Path)
+		assert.Equal(t, []string{"n1", "n3"}, items[2].Nodes)
+		assert.Equal(t, []string{"n2"}, items[2].Outdated)
+
+		// b/tie.txt: the newest version wins, no replication factor - all related nodes
+		assert.Equal(t, "b/tie.txt", items[3].Path)
+		assert.Equal(t, 2, items[3].Replicas)
+		assert.Equal(t, "n2", items[3].source)
+		assert.Equal(t, []string{"n3"}, items[3].Outdated)
+		assert.Equal(t, []string{"n4"}, items[3].Missing)
+
+		// c/2.txt: no tags - all nodes, but just two replicas required
+		assert.Equal(t, "c/2.txt", items[4].Path)
+		assert.Equal(t, 2, items[4].Replicas)
+		assert.Equal(t, []string{"n1"}, items[4].Nodes)
+		assert.Equal(t, []string{"n2"}, items[4].Missing)
+	}
+}
@@ -87,6 +87,7 @@ type CountParams struct {
 	Local       bool   `form:"local" json:"local,omitempty" msgpack:"local,omitempty"`
 	ShareMode   string `form:"share-mode" json:"share-mode,omitempty" msgpack:"share-mode,omitempty"` // share mode to use
 	Performance bool   `form:"performance" json:"performance,omitempty" msgpack:"performance,omitempty"`
+	Priority    string `form:"priority" json:"priority,omitempty" msgpack:"priority,omitempty"` // "interactive" or "batch"
 
 	// internal parameters
 	//InternalErrorPrefix bool `form:"--internal-error-prefix" json:"-" msgpack:"-"` // include host prefixes for error messages
@@ -137,6 +138,11 @@ func (server *Server) DoCount0(ctx *gin.Context) {
 			"no file or catalog provided"))
 	}
 
+	// shared workspace files (outputs are written to the workspace)
+	keep := len(params.KeepDataAs) != 0 || len(params.KeepIndexAs) != 0 || len(params.KeepViewAs) != 0
+	params.Files = server.useWorkspace(ctx, params.Local, keep, params.Files...)
+	server.checkOutputPermission(ctx, params.KeepDataAs, params.KeepIndexAs, params.KeepViewAs)
+
 	accept := ctx.NegotiateFormat(codec.GetSupportedMimeTypes()...)
 	// default to JSON
 	if accept == "" {
@@ -167,6 +173,8 @@ func (server *Server) DoCount0(ctx *gin.Context) {
 	cfg.Backend.Tool = params.Backend
 	cfg.Backend.Opts = params.BackendOpts
 	cfg.Backend.Mode = params.BackendMode
+	cfg.User = userName
+	cfg.Priority = server.getPriority(ctx, params.Priority)
 	cfg.KeepDataAs = randomizePath(params.KeepDataAs)
 	cfg.KeepIndexAs = randomizePath(params.KeepIndexAs)
 	cfg.KeepViewAs = randomizePath(params.KeepViewAs)
@@ -222,9 +230,15 @@ func (server *Server) DoCount0(ctx *gin.Context) {
 		"cluster":   userTag,
 		"post-proc": cfg.Transforms,
 	}).Infof("[%s]: start GET /count", CORE)
+	// check storage quota before any results are kept
+	server.prepareKeptResults(ctx, homeDir, cfg)
+
+	auditSearch(ctx, cfg, nil)
+
 	searchStartTime := time.Now() // performance metric
 	res, err := engine.Search(cfg)
 	if err != nil {
+		checkQueueTimeout(ctx, err)
 		panic(NewError(http.StatusInternalServerError, err.Error()).
 			WithDetails("failed to start search"))
 	}
@@ -261,6 +275,7 @@ func (server *Server) DoCount0(ctx *gin.Context) {
 		case err, ok := <-res.ErrorChan:
 			if ok && err != nil {
 				// log.WithField("error", err).Debugf("[%s]: error received", CORE) // FIXME: DEBUG
+				checkQueueTimeout(ctx, err)
 				panic(NewError(http.StatusInternalServerError, err.Error()).
 					WithDetails("failed to do search"))
 			}
@@ -275,11 +290,14 @@ func (server *Server) DoCount0(ctx *gin.Context) {
 			// ... and errors
 			for err := range res.ErrorChan {
 				// log.WithField("error", err).Debugf("[%s]: error received", CORE) // FIXME: DEBUG
+				checkQueueTimeout(ctx, err)
 				panic(NewError(http.StatusInternalServerError, err.Error()).
 					WithDetails("failed to do search"))
 			}
 
 			transferStopTime := time.Now() // performance metric
+			server.onSearchStat(res.Stat)
+			auditSearch(ctx, cfg, res)
 
 			if res.Stat != nil {
 				if server.Config.ExtraRequest {
@@ -362,6 +380,11 @@ func (server *Server) DoCountDryRun(ctx *gin.Context) {
 			"no file or catalog provided"))
 	}
 
+	// shared workspace files (outputs are written to the workspace)
+	keep := len(params.KeepDataAs) != 0 || len(params.KeepIndexAs) != 0 || len(params.KeepViewAs) != 0
+	params.Files = server.useWorkspace(ctx, params.Local, keep, params.Files...)
+	server.checkOutputPermission(ctx, params.KeepDataAs, params.KeepIndexAs, params.KeepViewAs)
+
 	accept := ctx.NegotiateFormat(codec.GetSupportedMimeTypes()...)
 	// default to JSON
 	if accept == "" {
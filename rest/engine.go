@@ -37,6 +37,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/getryft/ryft-server/search"
 	"github.com/getryft/ryft-server/search/ryftdec"
@@ -44,6 +45,7 @@ import (
 	"github.com/getryft/ryft-server/search/ryftmux"
 	_ "github.com/getryft/ryft-server/search/ryftprim"
 	"github.com/getryft/ryft-server/search/utils"
+	consul "github.com/hashicorp/consul/api"
 	"gopkg.in/yaml.v2"
 )
 
@@ -75,46 +77,25 @@ func (s *Server) getClusterSearchEngine(files []string, authToken, homeDir, user
 	}
 
 	// go through service tags and update `tags_required` map
-	// return match count, matched tags are removed
-	update_tags := func(serviceTags []string) int {
-		count := 0
+	// return matched tags, matched tags are removed
+	update_tags := func(serviceTags []string) []string {
+		matched := []string{}
 		for _, s := range serviceTags {
 			if _, ok := tags_required[s]; ok {
 				delete(tags_required, s)
-				count += 1
+				matched = append(matched, s)
 			}
 		}
-		return count
+		return matched
 	}
 
-	// all services should be already arranged based on metrics
-	backends := []search.Engine{}
-	nodes := []string{}
-	for _, service := range services {
-		// stop if no more tags required
-		if !all_nodes && len(tags_required) == 0 {
-			break
-		}
-
-		// skip if no required tags found
-		log.WithField("service", service.Node).WithField("tags", service.ServiceTags).Debug("remote node tags")
-		if !all_nodes && update_tags(service.ServiceTags) == 0 {
-			continue // no tags found, skip this node
-		}
-		log.WithField("tags", tags_required).Debug("remain (remote) tags required")
-
+	// create search engine for a service
+	new_backend := func(service *consul.CatalogService) (search.Engine, error) {
 		// use native search engine for local services!
 		// (no sense to do extra HTTP call)
 		if s.isLocalService(service) {
-			engine, err := s.getLocalSearchEngine(homeDir,
+			return s.getLocalSearchEngine(homeDir,
 				service.Node, getServiceUrl(service))
-			if err != nil {
-				return nil, err
-			}
-			backends = append(backends, engine)
-			nodes = append(nodes, service.Node)
-
-			continue
 		}
 
 		// remote node: use RyftHTTP backend
@@ -134,9 +115,58 @@ func (s *Server) getClusterSearchEngine(files []string, authToken, homeDir, user
 		if err != nil {
 			return nil, fmt.Errorf("failed to create HTTP engine: %s", err)
 		}
-		backends = append(backends, engine)
-		nodes = append(nodes, service.Node)
-		is_local = false
+		return engine, nil // OK
+	}
+
+	// all services should be already arranged based on metrics
+	backends := []search.Engine{}
+	backend_tags := [][]string{} // tags each backend is used for
+	nodes := []string{}
+	used := make(map[*consul.CatalogService]bool)
+	use_services := func(services []*consul.CatalogService) error {
+		for _, service := range services {
+			// stop if no more tags required
+			if !all_nodes && len(tags_required) == 0 {
+				break
+			}
+
+			// skip if no required tags found
+			log.WithField("service", service.Node).WithField("tags", service.ServiceTags).Debug("remote node tags")
+			var matched []string
+			if !all_nodes {
+				if matched = update_tags(service.ServiceTags); len(matched) == 0 {
+					continue // no tags found, skip this node
+				}
+			}
+			log.WithField("tags", tags_required).Debug("remain (remote) tags required")
+
+			engine, err := new_backend(service)
+			if err != nil {
+				return err
+			}
+			backends = append(backends, engine)
+			backend_tags = append(backend_tags, matched)
+			nodes = append(nodes, service.Node)
+			used[service] = true
+			if !s.isLocalService(service) {
+				is_local = false
+			}
+		}
+
+		return nil // OK
+	}
+
+	// open circuit nodes are dropped and used only
+	// if healthy nodes do not cover the required tags
+	services, unhealthy := s.health.split(services, time.Now())
+	if err := use_services(services); err != nil {
+		return nil, err
+	}
+	if len(unhealthy) != 0 && ((all_nodes && len(backends) == 0) || (!all_nodes && len(tags_required) > 0)) {
+		log.WithField("tags", tags_required).Warnf("use open circuit nodes as a fallback")
+		if err := use_services(unhealthy); err != nil {
+			return nil, err
+		}
 	}
 
 	// fail if there is remaining required tags
@@ -152,8 +182,34 @@ func (s *Server) getClusterSearchEngine(files []string, authToken, homeDir, user
 
 	if len(backends) > 0 && !is_local {
 		engine, err := ryftmux.NewEngine(backends...)
+		if err != nil {
+			return nil, err
+		}
+
+		// unused nodes having the same tags are replicas
+		// (no tags - all nodes are used, so no replicas)
+		for i, backend := range backends {
+			if all_nodes {
+				break
+			}
+
+			for _, service := range services {
+				if used[service] || !hasAllTags(service.ServiceTags, backend_tags[i]) {
+					continue
+				}
+
+				replica, err := new_backend(service)
+				if err != nil {
+					return nil, err
+				}
+				engine.AddFallback(backend, replica)
+				log.WithField("node", nodes[i]).WithField("replica", service.Node).
+					Debug("cluster search replica")
+			}
+		}
+
 		log.WithField("engine", engine).Debug("cluster search")
-		return engine, err
+		return engine, nil // OK
 	}
 
 	// no services from consule, just use local search as a fallback
@@ -44,6 +44,8 @@ type Error struct {
 	Status  int    `json:"status" msgpack:"status"`                       // HTTP status
 	Message string `json:"message,omitempty" msgpack:"message,omitempty"` // error message
 	Details string `json:"details,omitempty" msgpack:"details,omitempty"` // error details
+
+	Usage *QuotaUsage `json:"usage,omitempty" msgpack:"usage,omitempty"` // storage usage (quota errors only)
 }
 
 // NewError creates new server error using status and message.
@@ -69,6 +71,12 @@ func (err *Error) WithDetails(details string) *Error {
 	return err
 }
 
+// WithUsage adds storage usage to the error.
+func (err *Error) WithUsage(usage *QuotaUsage) *Error {
+	err.Usage = usage
+	return err
+}
+
 // RecoverFromPanic checks panics and report them via HTTP response.
 func RecoverFromPanic(ctx *gin.Context) {
 	// check for specific encoder
@@ -108,6 +116,7 @@ func RecoverFromPanic(ctx *gin.Context) {
 		// first try to report via encoder...
 		// (skip the first attempt and report full error)
 		if ctx.Writer.Written() && reportEncoderError(err) {
+			ctx.Error(err)
 			return
 		}
 
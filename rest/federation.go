@@ -0,0 +1,232 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/ryftmux"
+)
+
+const (
+	defaultLocalCluster = "local" // default name of the local cluster
+	allClusters         = "*"     // all the clusters
+)
+
+// RemoteCredentials are used to access a remote cluster.
+type RemoteCredentials struct {
+	Username string `yaml:"username,omitempty"` // basic authentication
+	Password string `yaml:"password,omitempty"`
+	Token    string `yaml:"token,omitempty"` // bearer token, used instead of username/password
+}
+
+// get authorization token (empty if no credentials)
+func (c RemoteCredentials) authToken() string {
+	switch {
+	case len(c.Token) != 0:
+		return "Bearer " + c.Token
+	case len(c.Username) != 0:
+		creds := c.Username + ":" + c.Password
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(creds))
+	}
+
+	return "" // no credentials
+}
+
+// RemoteCluster is an independent ryft-server cluster used by federated search.
+type RemoteCluster struct {
+	Name     string `yaml:"name"`
+	URL      string `yaml:"url"`                // cluster's entry point
+	Username string `yaml:"username,omitempty"` // basic authentication
+	Password string `yaml:"password,omitempty"`
+	Token    string `yaml:"token,omitempty"` // bearer token, used instead of username/password
+
+	Roles []string                     `yaml:"roles,omitempty"` // local roles allowed to use the credentials above
+	Users map[string]RemoteCredentials `yaml:"users,omitempty"` // local user -> remote credentials
+}
+
+// get authorization token to access remote cluster on behalf of the local user.
+// local user's credentials are never forwarded.
+func (rc *RemoteCluster) authToken(user *auth.UserInfo) (string, error) {
+	shared := RemoteCredentials{Username: rc.Username, Password: rc.Password, Token: rc.Token}
+	if user == nil {
+		return shared.authToken(), nil // no authentication
+	}
+
+	if creds, ok := rc.Users[user.Name]; ok {
+		return creds.authToken(), nil
+	}
+	if len(shared.authToken()) != 0 {
+		for _, role := range rc.Roles {
+			if user.HasRole(role) {
+				return shared.authToken(), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("user %q is not allowed to access %q cluster", user.Name, rc.Name)
+}
+
+// prepare federated search configuration
+func (s *Server) prepareFederation() error {
+	if len(s.Config.Federation.Name) == 0 {
+		s.Config.Federation.Name = defaultLocalCluster
+	}
+
+	names := map[string]bool{s.Config.Federation.Name: true}
+	for _, rc := range s.Config.Federation.Clusters {
+		switch {
+		case len(rc.Name) == 0:
+			return fmt.Errorf("no remote cluster name provided")
+		case rc.Name == allClusters || strings.ContainsAny(rc.Name, ",/"):
+			return fmt.Errorf("bad remote cluster name: %q", rc.Name)
+		case names[rc.Name]:
+			return fmt.Errorf("duplicate cluster name: %q", rc.Name)
+		}
+		names[rc.Name] = true
+
+		if u, err := url.Parse(rc.URL); err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return fmt.Errorf("bad %q cluster URL: %q", rc.Name, rc.URL)
+		}
+		for name, creds := range rc.Users {
+			if len(creds.authToken()) == 0 {
+				return fmt.Errorf("no %q cluster credentials for user %q", rc.Name, name)
+			}
+		}
+	}
+
+	return nil // OK
+}
+
+// find remote cluster by name (nil if not found)
+func (s *Server) getRemoteCluster(name string) *RemoteCluster {
+	for i := range s.Config.Federation.Clusters {
+		if rc := &s.Config.Federation.Clusters[i]; rc.Name == name {
+			return rc
+		}
+	}
+
+	return nil // not found
+}
+
+// parse requested cluster names
+// names might be comma-separated, "*" means all the clusters
+func (s *Server) parseClusters(names []string) ([]string, error) {
+	var res []string
+	used := make(map[string]bool)
+	add := func(name string) {
+		if !used[name] {
+			used[name] = true
+			res = append(res, name)
+		}
+	}
+
+	local := s.Config.Federation.Name
+	for _, n := range names {
+		for _, name := range strings.Split(n, ",") {
+			name = strings.TrimSpace(name)
+			switch {
+			case len(name) == 0:
+				continue // ignore empty
+			case name == allClusters:
+				add(local)
+				for _, rc := range s.Config.Federation.Clusters {
+					add(rc.Name)
+				}
+			case name == local || s.getRemoteCluster(name) != nil:
+				add(name)
+			default:
+				return nil, fmt.Errorf("unknown cluster: %q", name)
+			}
+		}
+	}
+
+	return res, nil // OK
+}
+
+// get authorization tokens to access remote clusters: [cluster] -> token
+func (s *Server) getRemoteAuthTokens(user *auth.UserInfo, clusters []string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, name := range clusters {
+		if rc := s.getRemoteCluster(name); rc != nil {
+			token, err := rc.authToken(user)
+			if err != nil {
+				return nil, err
+			}
+			tokens[name] = token
+		}
+	}
+
+	return tokens, nil // OK
+}
+
+// get federated search engine
+// the local cluster is searched as usual, each remote cluster's
+// entry point is accessed via RyftHTTP (see remoteTokens) and does its own fan-out
+func (s *Server) getFederatedSearchEngine(clusters []string, remoteTokens map[string]string, localOnly bool, files []string, authToken, homeDir, userTag string) (search.Engine, error) {
+	mux, err := ryftmux.NewEngine()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MUX engine: %s", err)
+	}
+
+	for _, name := range clusters {
+		var backend search.Engine
+		if rc := s.getRemoteCluster(name); rc != nil {
+			opts := map[string]interface{}{
+				"--cluster-node-name": rc.Name,
+				"--cluster-node-addr": rc.URL,
+
+				"server-url": rc.URL,
+				"auth-token": remoteTokens[name],
+				"local-only": false, // remote fan-out
+				"skip-stat":  false,
+			}
+
+			if backend, err = search.NewEngine("ryfthttp", opts); err != nil {
+				return nil, fmt.Errorf("failed to create HTTP engine: %s", err)
+			}
+		} else {
+			if backend, err = s.getSearchEngine(localOnly, files, authToken, homeDir, userTag); err != nil {
+				return nil, err
+			}
+		}
+
+		mux.AddCluster(backend, name)
+	}
+
+	log.WithField("clusters", clusters).Infof("federated search")
+	return mux, nil // OK
+}
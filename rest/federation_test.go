@@ -0,0 +1,136 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"testing"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// test remote clusters configuration
+func TestFederationPrepare(t *testing.T) {
+	check := func(expectedError string, clusters ...RemoteCluster) {
+		s := NewServer()
+		s.Config.Federation.Clusters = clusters
+		err := s.prepareFederation()
+		if len(expectedError) != 0 {
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), expectedError)
+			}
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, "local", s.Config.Federation.Name)
+		}
+	}
+
+	check("")
+	check("", RemoteCluster{Name: "site-b", URL: "http://site-b:8765"})
+	check("no remote cluster name", RemoteCluster{URL: "http://site-b:8765"})
+	check("bad remote cluster name", RemoteCluster{Name: "a,b", URL: "http://site-b:8765"})
+	check("duplicate cluster name", RemoteCluster{Name: "local", URL: "http://site-b:8765"})
+	check("bad \"site-b\" cluster URL", RemoteCluster{Name: "site-b", URL: "site-b"})
+	check("no \"site-b\" cluster credentials for user \"foo\"", RemoteCluster{Name: "site-b", URL: "http://site-b:8765",
+		Users: map[string]RemoteCredentials{"foo": {}}})
+}
+
+// test requested clusters
+func TestFederationClusters(t *testing.T) {
+	s := NewServer()
+	s.Config.Federation.Name = "site-a"
+	s.Config.Federation.Clusters = []RemoteCluster{
+		{Name: "site-b", URL: "http://site-b:8765", Username: "admin", Password: "admin"},
+		{Name: "site-c", URL: "https://site-c:8766", Token: "secret"},
+		{Name: "site-d", URL: "http://site-d:8765"},
+	}
+	assert.NoError(t, s.prepareFederation())
+
+	check := func(names []string, expected ...string) {
+		clusters, err := s.parseClusters(names)
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, clusters)
+		}
+	}
+
+	check([]string{"site-b"}, "site-b")
+	check([]string{"site-a,site-c", " site-b "}, "site-a", "site-c", "site-b")
+	check([]string{"site-b", "*"}, "site-b", "site-a", "site-c", "site-d")
+	_, err := s.parseClusters([]string{"site-a,site-x"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `unknown cluster: "site-x"`)
+	}
+
+	assert.Nil(t, s.getRemoteCluster("site-a"))
+}
+
+// test remote cluster credentials
+func TestFederationCredentials(t *testing.T) {
+	s := NewServer()
+	s.Config.Federation.Clusters = []RemoteCluster{
+		{Name: "site-b", URL: "http://site-b:8765", Username: "admin", Password: "admin", Roles: []string{"analyst"}},
+		{Name: "site-c", URL: "https://site-c:8766", Token: "secret",
+			Users: map[string]RemoteCredentials{"bob": {Token: "bob-secret"}}},
+		{Name: "site-d", URL: "http://site-d:8765"},
+	}
+	assert.NoError(t, s.prepareFederation())
+
+	check := func(user *auth.UserInfo, cluster string, expected string) {
+		token, err := s.getRemoteCluster(cluster).authToken(user)
+		if len(expected) != 0 {
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, token)
+			}
+		} else if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "is not allowed to access")
+		}
+	}
+
+	alice := &auth.UserInfo{Name: "alice", Roles: []string{"analyst"}}
+	bob := &auth.UserInfo{Name: "bob", Roles: []string{"user"}}
+
+	check(alice, "site-b", "Basic YWRtaW46YWRtaW4=")
+	check(bob, "site-b", "")
+	check(alice, "site-c", "")
+	check(bob, "site-c", "Bearer bob-secret")
+	check(alice, "site-d", "") // local credentials are never forwarded
+
+	// no authentication
+	token, err := s.getRemoteCluster("site-c").authToken(nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Bearer secret", token)
+	}
+
+	tokens, err := s.getRemoteAuthTokens(bob, []string{"local", "site-c"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{"site-c": "Bearer bob-secret"}, tokens)
+	}
+	_, err = s.getRemoteAuthTokens(bob, []string{"site-c", "site-d"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,921 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/ryftprim"
+	"github.com/getryft/ryft-server/search/utils"
+	"github.com/getryft/ryft-server/search/utils/catalog"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// CopyFilesResult contains information related to COPY/MOVE operation.
+type CopyFilesResult struct {
+	Status map[string]interface{} `json:"details,omitempty"` // list of items copied and associated status
+	Host   string                 `json:"host,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// CopyFilesParams query parameters for PUT /copy and PUT /move
+type CopyFilesParams struct {
+	File       string `form:"file" json:"file"`               // source file (standalone or inside catalog)
+	Dir        string `form:"dir" json:"dir"`                 // source directory
+	Catalog    string `form:"catalog" json:"catalog"`         // source catalog
+	New        string `form:"new" json:"new"`                 // destination path or filename inside catalog
+	NewCatalog string `form:"new-catalog" json:"new-catalog"` // destination catalog
+	Delimiter  string `form:"delimiter" json:"delimiter"`     // destination catalog's data delimiter
+	Local      bool   `form:"local" json:"local"`
+
+	// internal parameters (node-to-node requests only)
+	InternalSource     string `form:"--internal-source" json:"-"`      // node name to get source data from
+	InternalRemoveOnly bool   `form:"--internal-remove-only" json:"-"` // just remove the source (move only)
+}
+
+// has internal parameters?
+func (p CopyFilesParams) isInternal() bool {
+	return len(p.InternalSource) != 0 || p.InternalRemoveOnly
+}
+
+// is empty?
+func (p CopyFilesParams) isEmpty() bool {
+	return len(p.File) == 0 && len(p.Dir) == 0 && len(p.Catalog) == 0
+}
+
+// to string
+func (p CopyFilesParams) String() string {
+	res := make([]string, 0)
+
+	if p.Dir != "" {
+		res = append(res, fmt.Sprintf("dir:%s", p.Dir))
+	}
+	if p.Catalog != "" {
+		res = append(res, fmt.Sprintf("catalog:%s", p.Catalog))
+	}
+	if p.File != "" {
+		res = append(res, fmt.Sprintf("file:%s", p.File))
+	}
+	if p.NewCatalog != "" {
+		res = append(res, fmt.Sprintf("new-catalog:%s", p.NewCatalog))
+	}
+	if p.New != "" {
+		res = append(res, fmt.Sprintf("new:%s", p.New))
+	}
+	if p.InternalSource != "" {
+		res = append(res, fmt.Sprintf("source:%s", p.InternalSource))
+	}
+	if p.Local {
+		res = append(res, "local")
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(res, ", "))
+}
+
+// get source path: file, directory or catalog (relative to home)
+func (p CopyFilesParams) sourcePath() string {
+	switch {
+	case len(p.Catalog) != 0:
+		return p.Catalog
+	case len(p.Dir) != 0:
+		return p.Dir
+	}
+
+	return p.File
+}
+
+// get destination path: file, directory or catalog (relative to home)
+func (p CopyFilesParams) targetPath() string {
+	if len(p.NewCatalog) != 0 {
+		return p.NewCatalog
+	}
+
+	return p.New
+}
+
+// add directory prefix from "path" parameter
+// so the following URLs are the same:
+// - PUT http://host:port/copy/foo?file=a.txt&new=b.txt
+// - PUT http://host:port/copy?file=foo/a.txt&new=foo/b.txt
+func (p *CopyFilesParams) addPathPrefix(prefix string) {
+	if len(prefix) == 0 {
+		return // nothing to do
+	}
+
+	add := func(path string) string {
+		if len(path) != 0 {
+			return filepath.Clean(strings.Join([]string{prefix, path},
+				string(filepath.Separator)))
+		}
+		return path
+	}
+
+	p.Dir = add(p.Dir)
+	p.Catalog = add(p.Catalog)
+	if len(p.Catalog) == 0 {
+		p.File = add(p.File) // standalone file
+	}
+	p.NewCatalog = add(p.NewCatalog)
+	if len(p.NewCatalog) == 0 {
+		p.New = add(p.New) // standalone file or directory
+	}
+}
+
+// check the parameters are consistent
+func (p CopyFilesParams) validate(mountPoint string) error {
+	if p.isEmpty() {
+		return fmt.Errorf("missing source filename")
+	}
+	if len(p.Dir) != 0 && (len(p.Catalog) != 0 || len(p.File) != 0) {
+		return fmt.Errorf("only one source (directory, catalog or file) is allowed")
+	}
+	if len(p.New) == 0 && len(p.NewCatalog) == 0 {
+		return fmt.Errorf("missing destination filename")
+	}
+
+	// checks all the inputs are relative to home
+	src := filepath.Join(mountPoint, p.sourcePath())
+	if !search.IsRelativeToHome(mountPoint, src) {
+		return fmt.Errorf("path %q is not relative to home", p.sourcePath())
+	}
+	dst := filepath.Join(mountPoint, p.targetPath())
+	if !search.IsRelativeToHome(mountPoint, dst) {
+		return fmt.Errorf("path %q is not relative to home", p.targetPath())
+	}
+
+	// directory cannot be copied into itself
+	if len(p.Dir) != 0 && search.IsRelativeToHome(src, dst) {
+		return fmt.Errorf("cannot copy directory %q into itself", p.Dir)
+	}
+	if src == dst && len(p.Catalog) == 0 && len(p.InternalSource) == 0 {
+		return fmt.Errorf("source and destination are the same")
+	}
+
+	return nil // OK
+}
+
+// copy item: a standalone file or a file inside catalog
+type copyItem struct {
+	Catalog string // source catalog (relative to home), empty for standalone file
+	File    string // source file (relative to home) or filename inside catalog
+
+	NewCatalog string // destination catalog (relative to home), empty for standalone file
+	New        string // destination file (relative to home) or filename inside catalog
+
+	IsDir bool // directory to create (no content)
+}
+
+// get item's name (used to report status)
+func (item copyItem) String() string {
+	if len(item.Catalog) != 0 {
+		return fmt.Sprintf("%s:%s", item.Catalog, item.File)
+	}
+
+	return item.File
+}
+
+// lists directory content (recursive) or catalog content
+type copyLister func(path string) (*search.DirInfo, error)
+
+// opens copy item content, returns data length (or -1 if unknown)
+type copyOpener func(item copyItem) (io.ReadCloser, int64, error)
+
+// planCopy gets the list of items to copy
+func planCopy(params CopyFilesParams, list copyLister) ([]copyItem, error) {
+	// get destination for a standalone file or a file inside catalog
+	// `name` is relative to the source directory or catalog
+	target := func(name string, defaultName string) copyItem {
+		if len(params.NewCatalog) != 0 {
+			if len(params.New) != 0 {
+				if len(name) == 0 {
+					// exact filename for a single file
+					return copyItem{NewCatalog: params.NewCatalog, New: params.New}
+				}
+				return copyItem{NewCatalog: params.NewCatalog, New: filepath.Join(params.New, name)}
+			}
+			return copyItem{NewCatalog: params.NewCatalog, New: defaultName}
+		}
+
+		return copyItem{New: filepath.Join(params.New, name)}
+	}
+
+	switch {
+	case len(params.Catalog) != 0 && len(params.File) != 0: // single file from catalog
+		item := target("", params.File)
+		item.Catalog, item.File = params.Catalog, params.File
+		return []copyItem{item}, nil
+
+	case len(params.Catalog) != 0: // whole catalog
+		info, err := list(params.Catalog)
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(info.Files)
+		items := make([]copyItem, 0, len(info.Files))
+		for _, name := range info.Files {
+			item := target(name, name)
+			item.Catalog, item.File = params.Catalog, name
+			items = append(items, item)
+		}
+		return items, nil
+
+	case len(params.Dir) != 0: // directory (recursive)
+		info, err := list(params.Dir)
+		if err != nil {
+			return nil, err
+		}
+
+		// keep the order stable
+		sort.Strings(info.Dirs)
+		sort.Strings(info.Files)
+		sort.Strings(info.Catalogs)
+
+		items := make([]copyItem, 0, len(info.Files)+len(info.Dirs))
+		if len(params.NewCatalog) == 0 {
+			// re-create directory structure
+			items = append(items, copyItem{File: params.Dir, New: params.New, IsDir: true})
+			for _, name := range info.Dirs {
+				items = append(items, copyItem{
+					File:  filepath.Join(params.Dir, name),
+					New:   filepath.Join(params.New, name),
+					IsDir: true,
+				})
+			}
+		}
+		for _, name := range info.Files {
+			// standalone file
+			item := target(name, name)
+			item.File = filepath.Join(params.Dir, name)
+			items = append(items, item)
+		}
+		for _, name := range info.Catalogs {
+			// nested catalog
+			catPath := filepath.Join(params.Dir, name)
+			catInfo, err := list(catPath)
+			if err != nil {
+				return nil, err
+			}
+
+			sort.Strings(catInfo.Files)
+			for _, file := range catInfo.Files {
+				var item copyItem
+				if len(params.NewCatalog) != 0 {
+					// flatten: put to the destination catalog
+					item = target(filepath.Join(name, file), filepath.Join(name, file))
+				} else {
+					// catalog to catalog
+					item = copyItem{NewCatalog: filepath.Join(params.New, name), New: file}
+				}
+				item.Catalog, item.File = catPath, file
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+
+	// single standalone file
+	item := target("", params.File)
+	item.File = params.File
+	return []copyItem{item}, nil
+}
+
+// PUT /copy method
+/* to test method:
+curl -X PUT -s "http://localhost:8765/copy?file=foo/a.txt&new-catalog=foo/a.catalog" | jq .
+*/
+func (server *Server) DoCopyFiles(ctx *gin.Context) {
+	server.doCopyFiles(ctx, false)
+}
+
+// PUT /move method
+/* to test method:
+curl -X PUT -s "http://localhost:8765/move?catalog=foo/a.catalog&file=a.txt&new=foo/b.txt" | jq .
+*/
+func (server *Server) DoMoveFiles(ctx *gin.Context) {
+	server.doCopyFiles(ctx, true)
+}
+
+// COPY or MOVE files
+func (server *Server) doCopyFiles(ctx *gin.Context, move bool) {
+	defer RecoverFromPanic(ctx)
+
+	// parse request parameters
+	params := CopyFilesParams{}
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+	params.addPathPrefix(ctx.Param("path"))
+
+	// internal parameters are passed by other cluster nodes only
+	if params.isInternal() && !server.isInternalRequest(ctx) {
+		panic(NewError(http.StatusForbidden, "internal parameters are not allowed"))
+	}
+	if params.InternalRemoveOnly && !move {
+		panic(NewError(http.StatusBadRequest, "source can be removed by move only"))
+	}
+
+	// shared workspace (both source and target)
+	paths := server.useWorkspace(ctx, params.Local, true,
+		params.sourcePath(), params.targetPath())
+	switch {
+	case len(params.Catalog) != 0:
+		params.Catalog = paths[0]
+	case len(params.Dir) != 0:
+		params.Dir = paths[0]
+	default:
+		params.File = paths[0]
+	}
+	if len(params.NewCatalog) != 0 {
+		params.NewCatalog = paths[1]
+	} else {
+		params.New = paths[1]
+	}
+
+	// if delimiter is provided this value will be NOT NIL
+	var delim *string
+	if len(params.Delimiter) != 0 {
+		tmp := mustParseDelim(params.Delimiter)
+		delim = &tmp
+	}
+
+	userName, authToken, homeDir, userTag := server.parseAuthAndHome(ctx)
+	mountPoint, err := server.getMountPoint()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get mount point"))
+	}
+	mountPoint = filepath.Join(mountPoint, homeDir)
+
+	// checks all the inputs are relative to home
+	if err := params.validate(mountPoint); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()))
+	}
+	server.checkPathPermission(ctx, auth.PermFilesRead, params.sourcePath())
+	if move {
+		server.checkPathPermission(ctx, auth.PermFilesDelete, params.sourcePath())
+	}
+	if !params.InternalRemoveOnly {
+		server.checkPathPermission(ctx, auth.PermFilesWrite, params.targetPath())
+	}
+	auditFiles(ctx, params.sourcePath())
+	auditDetail(ctx, "target", params.targetPath())
+
+	action, method := "copying", "COPY"
+	if move {
+		action, method = "moving", "MOVE"
+	}
+	log.WithFields(map[string]interface{}{
+		"params": params,
+		"user":   userName,
+		"home":   homeDir,
+	}).Infof("[%s]: %s...", CORE, action)
+
+	// for the source and destination get list of tags from consul KV/partition.
+	// based on these tags determine the list of nodes having the source
+	// and the list of nodes which should have a copy.
+	// each destination node copies data locally or gets it from a source node.
+
+	// storage quota is checked on each node locally
+	quota := server.getQuotaChecker(ctx, mountPoint)
+
+	results := make([]CopyFilesResult, 0, 1)
+	if !params.Local && !server.Config.LocalOnly {
+		files := []string{params.sourcePath(), params.targetPath()}
+		services, tags, err := server.getConsulInfoForFiles(userTag, files)
+		if err != nil || len(tags) != len(files) {
+			panic(NewError(http.StatusInternalServerError, fmt.Sprintf("%v", err)).
+				WithDetails("failed to map files to tags"))
+		}
+		log.WithField("source", tags[0]).WithField("target", tags[1]).Debugf("[%s]: related tags", CORE)
+
+		type Node struct {
+			// input
+			IsLocal  bool
+			IsSource bool
+			IsTarget bool
+			Name     string
+			Address  string
+			Params   CopyFilesParams
+
+			// output
+			Results []CopyFilesResult
+			Error   error
+		}
+
+		// build list of nodes to call (no tags - all nodes)
+		nodes := make([]*Node, len(services))
+		var source *Node // the preferred source node
+		for i, service := range services {
+			node := new(Node)
+			node.Address = getServiceUrl(service)
+			node.IsLocal = server.isLocalService(service)
+			node.Name = service.Node
+			node.IsSource = len(tags[0]) == 0 || hasSomeTag(service.ServiceTags, tags[0])
+			node.IsTarget = len(tags[1]) == 0 || hasSomeTag(service.ServiceTags, tags[1])
+			if node.IsSource && (source == nil || node.IsLocal) {
+				source = node
+			}
+
+			nodes[i] = node
+		}
+		if source == nil {
+			panic(NewError(http.StatusInternalServerError, "no source node found"))
+		}
+
+		// internal parameters are accepted by node-to-node requests only
+		if server.ClusterAuth == nil && getAuthUser(ctx) != nil {
+			for _, node := range nodes {
+				if !node.IsLocal && (node.IsTarget && !node.IsSource || move && node.IsSource) {
+					panic(NewError(http.StatusNotImplemented,
+						"copying between cluster nodes requires node-to-node authentication"))
+				}
+			}
+		}
+
+		// call each node in dedicated goroutine
+		callNodes := func(prepare func(node *Node) bool) []*Node {
+			called := make([]*Node, 0, len(nodes))
+			var wg sync.WaitGroup
+			for _, node := range nodes {
+				if !prepare(node) {
+					continue // nothing to do
+				}
+
+				called = append(called, node)
+				wg.Add(1)
+				go func(node *Node) {
+					defer wg.Done()
+					defer func() {
+						if r := recover(); r != nil {
+							log.WithField("error", r).Errorf("[%s]: copy file failed", CORE)
+							if err, ok := r.(error); ok {
+								node.Error = err
+							} else {
+								node.Error = fmt.Errorf("%v", r)
+							}
+						}
+					}()
+
+					if node.IsLocal {
+						log.WithField("what", node.Params).Debugf("[%s]: %s on local node", CORE, action)
+						res := server.copyLocalFiles(mountPoint, authToken, node.Params, delim, false, quota)
+						node.Results = append(node.Results, res)
+					} else {
+						log.WithFields(map[string]interface{}{
+							"what": node.Params,
+							"node": node.Name,
+							"addr": node.Address,
+						}).Debugf("[%s]: %s on remote node", CORE, action)
+						node.Results, node.Error = server.copyRemoteFiles(node.Address, authToken, node.Params)
+					}
+				}(node)
+			}
+
+			wg.Wait()
+			return called
+		}
+
+		// report node results, return number of failures
+		report := func(called []*Node) int {
+			failed := 0
+			for _, node := range called {
+				if err := node.Error; err != nil {
+					// failed, no status
+					results = append(results, CopyFilesResult{
+						Host:  node.Name,
+						Error: err.Error(),
+					})
+					failed++
+				} else {
+					for _, res := range node.Results {
+						if len(res.Error) != 0 {
+							failed++
+						}
+					}
+					results = append(results, node.Results...)
+				}
+			}
+			return failed
+		}
+
+		// copy to all target nodes (source is never removed here)
+		failed := report(callNodes(func(node *Node) bool {
+			if !node.IsTarget {
+				return false
+			}
+			node.Params = params
+			node.Params.Local = true
+			if !node.IsSource {
+				// get source data from another node
+				node.Params.InternalSource = source.Name
+			}
+			return true
+		}))
+
+		// remove the source from all source nodes
+		if move && failed == 0 {
+			report(callNodes(func(node *Node) bool {
+				if !node.IsSource {
+					return false
+				}
+				node.Params = params
+				node.Params.Local = true
+				node.Params.InternalRemoveOnly = true
+				node.Results, node.Error = nil, nil
+				return true
+			}))
+		}
+	} else {
+		results = append(results, server.copyLocalFiles(mountPoint, authToken, params, delim, move, quota))
+	}
+
+	// detect errors (skip in cluster mode)
+	if len(results) == 1 && results[0].Error != "" {
+		if quota.isExceeded() {
+			panic(quota.error())
+		}
+		panic(NewError(http.StatusInternalServerError, results[0].Error).
+			WithDetails(fmt.Sprintf("failed to %s files", method)))
+	}
+
+	ctx.JSON(http.StatusOK, results)
+}
+
+// copy (or move) files locally.
+// source data might be on a remote node (see params.InternalSource)
+func (server *Server) copyLocalFiles(mountPoint string, authToken string, params CopyFilesParams, delim *string, move bool, quota *quotaChecker) CopyFilesResult {
+	res := CopyFilesResult{
+		Host:   server.Config.HostName,
+		Status: make(map[string]interface{}),
+	}
+
+	// just remove the source
+	if params.InternalRemoveOnly {
+		if err := removeCopySource(mountPoint, params); err != nil {
+			res.Status[params.sourcePath()] = err.Error()
+			res.Error = err.Error()
+		} else {
+			res.Status[params.sourcePath()] = "REMOVED"
+		}
+		return res
+	}
+
+	// local or remote source
+	var list copyLister
+	var open copyOpener
+	if len(params.InternalSource) != 0 {
+		// source node is resolved via consul, never by address
+		address, err := server.getNodeUrl(params.InternalSource)
+		if err != nil {
+			res.Error = fmt.Sprintf("failed to get source node: %s", err)
+			return res
+		}
+		list = server.remoteCopyLister(address, authToken)
+		open = server.remoteCopyOpener(address, authToken)
+	} else {
+		list = localCopyLister(mountPoint)
+		open = localCopyOpener(mountPoint)
+	}
+
+	items, err := planCopy(params, list)
+	if err != nil {
+		res.Error = fmt.Sprintf("failed to get source content: %s", err)
+		return res
+	}
+
+	// copy all items
+	failed := 0
+	var lastErr error
+	for _, item := range items {
+		if err := copyOneItem(mountPoint, item, open, delim, quota); err != nil {
+			res.Status[item.String()] = err.Error()
+			lastErr = err
+			failed++
+		} else {
+			res.Status[item.String()] = "OK"
+		}
+	}
+
+	if failed == 1 && len(items) == 1 {
+		res.Error = lastErr.Error() // report the reason as is
+	} else if failed != 0 {
+		res.Error = fmt.Sprintf("%d of %d items failed", failed, len(items))
+	} else if move && len(params.InternalSource) == 0 {
+		if err := removeCopySource(mountPoint, params); err != nil {
+			res.Status[params.sourcePath()] = err.Error()
+			res.Error = fmt.Sprintf("failed to remove source: %s", err)
+		}
+	}
+
+	return res
+}
+
+// copy one item
+func copyOneItem(mountPoint string, item copyItem, open copyOpener, delim *string, quota *quotaChecker) error {
+	if item.IsDir {
+		return os.MkdirAll(filepath.Join(mountPoint, item.New), 0755)
+	}
+
+	// destination should not exist
+	if len(item.NewCatalog) != 0 {
+		path := filepath.Join(mountPoint, item.NewCatalog)
+		if cat, err := catalog.OpenCatalogReadOnly(path); err == nil {
+			f, err := cat.GetFile(item.New)
+			cat.Close()
+			if err == nil {
+				f.Close()
+				return fmt.Errorf("%q already exists in %q", item.New, item.NewCatalog)
+			} else if err != os.ErrNotExist {
+				return err
+			}
+		} else if err != catalog.ErrNotACatalog && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		if _, err := os.Stat(filepath.Join(mountPoint, item.New)); !os.IsNotExist(err) {
+			return fmt.Errorf("%q already exists", item.New)
+		}
+	}
+
+	data, length, err := open(item)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	// check storage quota (data length might be unknown)
+	if err := quota.check(length); err != nil {
+		return err
+	}
+
+	params := PostFilesParams{
+		Catalog: item.NewCatalog,
+		File:    item.New,
+		Offset:  -1, // automatic
+		Length:  length,
+	}
+	if len(item.NewCatalog) != 0 {
+		_, _, _, err = updateCatalog(mountPoint, params, delim, quota.reader(data))
+	} else {
+		var n int64
+		_, _, n, err = createFile(mountPoint, params, quota.reader(data))
+		if err == nil && 0 <= length && n != length {
+			err = fmt.Errorf("only %d bytes copied of %d", n, length)
+		}
+	}
+
+	return err
+}
+
+// remove the copy source: file, directory, catalog or file inside catalog
+func removeCopySource(mountPoint string, params CopyFilesParams) error {
+	if len(params.Catalog) != 0 && len(params.File) != 0 {
+		cat, err := catalog.OpenCatalog(filepath.Join(mountPoint, params.Catalog))
+		if err != nil {
+			return err
+		}
+		defer cat.Close()
+
+		_, err = cat.DeleteFileParts(params.File)
+		return err
+	}
+
+	for _, err := range deleteAll(mountPoint, []string{params.sourcePath()}) {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil // OK
+}
+
+// get local directory or catalog content
+func localCopyLister(mountPoint string) copyLister {
+	return func(path string) (*search.DirInfo, error) {
+		return ryftprim.ReadDirOrCatalog(mountPoint, path,
+			search.FilesOptions{Recursive: true}, false, "")
+	}
+}
+
+// open local file or file inside catalog
+func localCopyOpener(mountPoint string) copyOpener {
+	return func(item copyItem) (io.ReadCloser, int64, error) {
+		if len(item.Catalog) != 0 {
+			cat, err := catalog.OpenCatalogReadOnly(filepath.Join(mountPoint, item.Catalog))
+			if err != nil {
+				return nil, -1, err
+			}
+			defer cat.Close()
+
+			f, err := cat.GetFile(item.File)
+			if err != nil {
+				return nil, -1, err
+			}
+
+			return f, f.Size(), nil // OK
+		}
+
+		f, err := os.Open(filepath.Join(mountPoint, item.File))
+		if err != nil {
+			return nil, -1, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, -1, err
+		}
+		if info.IsDir() {
+			f.Close()
+			return nil, -1, fmt.Errorf("is a directory")
+		}
+
+		return f, info.Size(), nil // OK
+	}
+}
+
+// get remote directory or catalog content
+func (server *Server) remoteCopyLister(address string, authToken string) copyLister {
+	return func(path string) (*search.DirInfo, error) {
+		engine, err := search.NewEngine("ryfthttp", map[string]interface{}{
+			"server-url": address,
+			"auth-token": authToken,
+			"local-only": true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create HTTP engine: %s", err)
+		}
+
+		return engine.Files(path, search.FilesOptions{Recursive: true})
+	}
+}
+
+// open remote file or file inside catalog
+func (server *Server) remoteCopyOpener(address string, authToken string) copyOpener {
+	return func(item copyItem) (io.ReadCloser, int64, error) {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, -1, fmt.Errorf("failed to parse URL: %s", err)
+		}
+		q := url.Values{}
+		q.Set("local", "true")
+		q.Set("file", item.File)
+		if len(item.Catalog) != 0 {
+			q.Set("catalog", item.Catalog)
+		}
+		u.RawQuery = q.Encode()
+		u.Path += "/files"
+
+		// prepare request
+		req, err := http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			return nil, -1, fmt.Errorf("failed to create request: %s", err)
+		}
+
+		// authorization
+		if len(authToken) != 0 {
+			req.Header.Set("Authorization", authToken)
+		}
+
+		// do HTTP request
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, -1, fmt.Errorf("failed to send HTTP request: %s", err)
+		}
+
+		// check status code
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, -1, decodeRemoteError(resp)
+		}
+
+		return resp.Body, resp.ContentLength, nil // OK
+	}
+}
+
+// copy or move on remote node
+func (server *Server) copyRemoteFiles(address string, authToken string, params CopyFilesParams) ([]CopyFilesResult, error) {
+	// prepare query
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %s", err)
+	}
+	q := url.Values{}
+	q.Set("local", fmt.Sprintf("%t", params.Local))
+	if len(params.File) != 0 {
+		q.Set("file", params.File)
+	}
+	if len(params.Dir) != 0 {
+		q.Set("dir", params.Dir)
+	}
+	if len(params.Catalog) != 0 {
+		q.Set("catalog", params.Catalog)
+	}
+	if len(params.New) != 0 {
+		q.Set("new", params.New)
+	}
+	if len(params.NewCatalog) != 0 {
+		q.Set("new-catalog", params.NewCatalog)
+	}
+	if len(params.Delimiter) != 0 {
+		q.Set("delimiter", params.Delimiter)
+	}
+	if len(params.InternalSource) != 0 {
+		q.Set("--internal-source", params.InternalSource)
+	}
+	if params.InternalRemoveOnly {
+		q.Set("--internal-remove-only", "true")
+	}
+
+	u.RawQuery = q.Encode()
+	if params.InternalRemoveOnly {
+		u.Path += "/move"
+	} else {
+		u.Path += "/copy" // data is copied, source is removed later
+	}
+
+	// prepare request
+	req, err := http.NewRequest("PUT", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %s", err)
+	}
+
+	// authorization
+	if len(authToken) != 0 {
+		req.Header.Set("Authorization", authToken)
+	}
+
+	// do HTTP request
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send HTTP request: %s", err)
+	}
+
+	defer resp.Body.Close() // close it later
+
+	// check status code
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeRemoteError(resp)
+	}
+
+	var results []CopyFilesResult
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&results); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %s", err)
+	}
+
+	return results, nil // OK
+}
+
+// try to decode error response
+func decodeRemoteError(resp *http.Response) error {
+	var errorBody map[string]interface{}
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&errorBody); err == nil {
+		if msg, err := utils.AsString(errorBody["message"]); err == nil {
+			return fmt.Errorf("%d: %s", resp.StatusCode, msg)
+		}
+	}
+
+	return fmt.Errorf("invalid HTTP response status: %d (%s)", resp.StatusCode, resp.Status)
+}
@@ -0,0 +1,244 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// copy planning test
+func TestCopyPlan(t *testing.T) {
+	list := func(path string) (*search.DirInfo, error) {
+		switch path {
+		case "foo":
+			return &search.DirInfo{
+				Dirs:     []string{"bar"},
+				Files:    []string{"bar/b.txt", "a.txt"},
+				Catalogs: []string{"c.cat"},
+			}, nil
+		case "foo/c.cat", "c.cat":
+			return &search.DirInfo{
+				Files: []string{"1.txt", "2.txt"},
+			}, nil
+		}
+
+		return nil, fmt.Errorf("%q not found", path)
+	}
+
+	// test case
+	check := func(params CopyFilesParams, expected ...copyItem) {
+		items, err := planCopy(params, list)
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, expected, items)
+		}
+	}
+
+	// standalone file
+	check(CopyFilesParams{File: "a.txt", New: "b.txt"},
+		copyItem{File: "a.txt", New: "b.txt"})
+	check(CopyFilesParams{File: "a.txt", NewCatalog: "b.cat"},
+		copyItem{File: "a.txt", NewCatalog: "b.cat", New: "a.txt"})
+	check(CopyFilesParams{File: "a.txt", NewCatalog: "b.cat", New: "b.txt"},
+		copyItem{File: "a.txt", NewCatalog: "b.cat", New: "b.txt"})
+
+	// catalog's file
+	check(CopyFilesParams{Catalog: "c.cat", File: "1.txt", New: "b.txt"},
+		copyItem{Catalog: "c.cat", File: "1.txt", New: "b.txt"})
+	check(CopyFilesParams{Catalog: "c.cat", File: "1.txt", NewCatalog: "d.cat"},
+		copyItem{Catalog: "c.cat", File: "1.txt", NewCatalog: "d.cat", New: "1.txt"})
+
+	// whole catalog
+	check(CopyFilesParams{Catalog: "c.cat", NewCatalog: "d.cat"},
+		copyItem{Catalog: "c.cat", File: "1.txt", NewCatalog: "d.cat", New: "1.txt"},
+		copyItem{Catalog: "c.cat", File: "2.txt", NewCatalog: "d.cat", New: "2.txt"})
+	check(CopyFilesParams{Catalog: "c.cat", New: "d"},
+		copyItem{Catalog: "c.cat", File: "1.txt", New: "d/1.txt"},
+		copyItem{Catalog: "c.cat", File: "2.txt", New: "d/2.txt"})
+
+	// directory
+	check(CopyFilesParams{Dir: "foo", New: "foo2"},
+		copyItem{File: "foo", New: "foo2", IsDir: true},
+		copyItem{File: "foo/bar", New: "foo2/bar", IsDir: true},
+		copyItem{File: "foo/a.txt", New: "foo2/a.txt"},
+		copyItem{File: "foo/bar/b.txt", New: "foo2/bar/b.txt"},
+		copyItem{Catalog: "foo/c.cat", File: "1.txt", NewCatalog: "foo2/c.cat", New: "1.txt"},
+		copyItem{Catalog: "foo/c.cat", File: "2.txt", NewCatalog: "foo2/c.cat", New: "2.txt"})
+	check(CopyFilesParams{Dir: "foo", NewCatalog: "d.cat"},
+		copyItem{File: "foo/a.txt", NewCatalog: "d.cat", New: "a.txt"},
+		copyItem{File: "foo/bar/b.txt", NewCatalog: "d.cat", New: "bar/b.txt"},
+		copyItem{Catalog: "foo/c.cat", File: "1.txt", NewCatalog: "d.cat", New: "c.cat/1.txt"},
+		copyItem{Catalog: "foo/c.cat", File: "2.txt", NewCatalog: "d.cat", New: "c.cat/2.txt"})
+
+	// bad source
+	_, err := planCopy(CopyFilesParams{Dir: "missing", New: "foo2"}, list)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not found")
+	}
+}
+
+// PUT /copy and PUT /move test
+func TestCopyFiles(t *testing.T) {
+	for k, v := range makeDefaultLoggingOptions(testLogLevel) {
+		setLoggingLevel(k, v)
+	}
+
+	fs := newFake()
+	defer fs.cleanup()
+
+	hostname := fs.server.Config.HostName
+
+	go func() {
+		err := fs.worker.ListenAndServe()
+		assert.NoError(t, err, "failed to serve fake server")
+	}()
+	time.Sleep(testServerStartTO) // wait a bit until server is started
+	defer func() {
+		fs.worker.Stop(testServerStopTO)
+		<-fs.worker.StopChan()
+	}()
+
+	// test case
+	check := func(url string, expectedStatus int, expectedErrors ...string) {
+		body, status, err := fs.PUT(url, "", "", "", 30*time.Second)
+		if err != nil {
+			for _, msg := range expectedErrors {
+				assert.Contains(t, err.Error(), msg)
+			}
+		} else {
+			assert.EqualValues(t, expectedStatus, status)
+			for _, msg := range expectedErrors {
+				assert.Contains(t, string(body), msg)
+			}
+		}
+	}
+
+	// ensure file exists and has expected content
+	content := func(path string, expected string) {
+		data, err := ioutil.ReadFile(filepath.Join(fs.homeDir(), path))
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, expected, string(data))
+		}
+	}
+
+	// ensure catalog's file has expected content
+	catContent := func(cat, file string, expected string) {
+		body, status, err := fs.GET(fmt.Sprintf("/files?catalog=%s&file=%s", cat, file), "", 30*time.Second)
+		if assert.NoError(t, err) && assert.EqualValues(t, http.StatusOK, status) {
+			assert.EqualValues(t, expected, string(body))
+		}
+	}
+
+	// ensure file does not exist
+	notExists := func(path string) {
+		_, err := os.Stat(filepath.Join(fs.homeDir(), path))
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// bad requests
+	check("/copy?new=1.txt", http.StatusBadRequest, "missing source filename")
+	check("/copy?file=1.txt", http.StatusBadRequest, "missing destination filename")
+	check("/copy?file=1.txt&new=/../../var/data/1.txt", http.StatusBadRequest, "is not relative to home")
+	check("/copy?dir=foo&new=foo/bar", http.StatusBadRequest, "cannot copy directory")
+
+	// file to file
+	check("/copy?file=1.txt&new=2.txt", http.StatusOK, fmt.Sprintf(`[{"details":{"1.txt":"OK"},"host":"%s"}]`, hostname))
+	content("2.txt", "\n11111-hello-11111\n22222-hello-22222\n33333-hello-33333\n44444-hello-44444\n55555-hello-55555\n")
+	check("/copy?file=1.txt&new=2.txt", http.StatusInternalServerError, "failed to COPY files", "already exists")
+
+	// file to catalog
+	check("/copy/foo?file=a.txt&new-catalog=a.cat", http.StatusOK, fmt.Sprintf(`[{"details":{"/foo/a.txt":"OK"},"host":"%s"}]`, hostname))
+	catContent("foo/a.cat", "/foo/a.txt", "\n11111-hello-11111\n22222-hello-22222\n33333-hello-33333\n44444-hello-44444\n55555-hello-55555\n")
+
+	// catalog's file to file
+	check("/copy?catalog=catalog.test&file=1.txt&new=c1.txt", http.StatusOK, fmt.Sprintf(`[{"details":{"catalog.test:1.txt":"OK"},"host":"%s"}]`, hostname))
+	content("c1.txt", "11111-hello-11111aaaaa-hello-aaaaa")
+
+	// whole catalog to directory
+	check("/copy?catalog=catalog.test&new=cat", http.StatusOK, `"catalog.test:2.txt":"OK"`, `"catalog.test:3.txt":"OK"`)
+	content("cat/2.txt", "22222-hello-22222bbbbb-hello-bbbbb")
+	content("cat/3.txt", "33333-hello-33333ccccc-hello-ccccc")
+
+	// directory to directory
+	check("/copy?dir=foo&new=foo2", http.StatusOK, `"foo/a.txt":"OK"`, `"foo/a.cat:/foo/a.txt":"OK"`)
+	content("foo2/a.txt", "\n11111-hello-11111\n22222-hello-22222\n33333-hello-33333\n44444-hello-44444\n55555-hello-55555\n")
+	catContent("foo2/a.cat", "/foo/a.txt", "\n11111-hello-11111\n22222-hello-22222\n33333-hello-33333\n44444-hello-44444\n55555-hello-55555\n")
+
+	// move catalog's file to file
+	check("/move?catalog=catalog.test&file=3.txt&new=c3.txt", http.StatusOK, fmt.Sprintf(`[{"details":{"catalog.test:3.txt":"OK"},"host":"%s"}]`, hostname))
+	content("c3.txt", "33333-hello-33333ccccc-hello-ccccc")
+	body, status, err := fs.GET("/files?catalog=catalog.test&file=3.txt", "", 30*time.Second)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, http.StatusNotFound, status, string(body))
+	}
+
+	// move directory
+	check("/move?dir=foo2&new=foo3", http.StatusOK, `"foo2/a.txt":"OK"`)
+	notExists("foo2")
+	content("foo3/a.txt", "\n11111-hello-11111\n22222-hello-22222\n33333-hello-33333\n44444-hello-44444\n55555-hello-55555\n")
+}
+
+// internal copy parameters are accepted from other nodes only
+func TestCopyInternalParams(t *testing.T) {
+	s := NewServer()
+
+	check := func(user *auth.UserInfo, url string, expected int) {
+		router := gin.New()
+		router.Use(func(ctx *gin.Context) {
+			if user != nil {
+				ctx.Set(gin.AuthUserKey, user)
+			}
+		})
+		router.PUT("/copy", s.DoCopyFiles)
+		router.PUT("/move", s.DoMoveFiles)
+
+		req, _ := http.NewRequest("PUT", url, strings.NewReader(""))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expected, w.Code, "%v %s", user, url)
+	}
+
+	foo := &auth.UserInfo{Name: "foo"}
+	check(foo, "/copy?file=1.txt&new=2.txt&local=true&--internal-source=http://localhost:8500", http.StatusForbidden)
+	check(foo, "/copy?file=1.txt&new=2.txt&local=true&--internal-remove-only=true", http.StatusForbidden)
+	check(foo, "/move?file=1.txt&new=2.txt&local=true&--internal-remove-only=true", http.StatusForbidden)
+	check(nil, "/copy?file=1.txt&new=2.txt&local=true&--internal-remove-only=true", http.StatusBadRequest)
+}
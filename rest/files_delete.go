@@ -40,6 +40,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/getryft/ryft-server/middleware/auth"
 	"github.com/getryft/ryft-server/search"
 	"github.com/getryft/ryft-server/search/utils"
 	"github.com/getryft/ryft-server/search/utils/catalog"
@@ -106,6 +107,9 @@ func (server *Server) DoDeleteFiles(ctx *gin.Context) {
 		}
 	}
 
+	// shared workspace files
+	params.Files = server.useWorkspace(ctx, params.Local, true, params.Files...)
+
 	userName, authToken, homeDir, userTag := server.parseAuthAndHome(ctx)
 	mountPoint, err := server.getMountPoint()
 	if err != nil {
@@ -121,6 +125,8 @@ func (server *Server) DoDeleteFiles(ctx *gin.Context) {
 				fmt.Sprintf("path %q is not relative to home", path)))
 		}
 	}
+	server.checkPathPermission(ctx, auth.PermFilesDelete, params.Files...)
+	auditFiles(ctx, params.Files...)
 
 	log.WithFields(map[string]interface{}{
 		"files": params.Files,
@@ -268,6 +274,7 @@ func (s *Server) deleteLocalFiles(mountPoint string, params DeleteFilesParams) m
 	for dir, err := range deleteAll(mountPoint, params.Files) {
 		updateResult(dir, err)
 	}
+	s.usage.reset(mountPoint) // re-calculate storage usage
 
 	return res
 }
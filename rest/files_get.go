@@ -39,6 +39,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/getryft/ryft-server/middleware/auth"
 	"github.com/getryft/ryft-server/search"
 	"github.com/getryft/ryft-server/search/utils/catalog"
 	"github.com/gin-gonic/gin"
@@ -52,6 +53,35 @@ type GetFilesParams struct {
 	File    string `form:"file" json:"file"`       // file to get content of
 	Hidden  bool   `form:"hidden" json:"hidden"`   // show hidden files/dirs
 	Local   bool   `form:"local" json:"local"`
+
+	Recursive bool   `form:"recursive" json:"recursive"` // report all subdirectories
+	Glob      string `form:"glob" json:"glob"`           // name filter (wildcard)
+	Regexp    string `form:"regexp" json:"regexp"`       // name filter (regular expression)
+	Checksum  bool   `form:"checksum" json:"checksum"`   // report SHA-1 of regular files
+
+	// flat list options
+	Details bool   `form:"details" json:"details"` // report size, mtime, etc
+	Sort    string `form:"sort" json:"sort"`       // sort field: name, size, mtime, type, parts
+	Order   string `form:"order" json:"order"`     // sort order: asc, desc
+	Limit   int    `form:"limit" json:"limit"`     // page size
+	Cursor  string `form:"cursor" json:"cursor"`   // page cursor
+}
+
+// get engine's files options
+func (p GetFilesParams) filesOptions() search.FilesOptions {
+	return search.FilesOptions{
+		Hidden:    p.Hidden,
+		Recursive: p.Recursive,
+		Glob:      p.Glob,
+		Regexp:    p.Regexp,
+		Checksum:  p.Checksum,
+	}
+}
+
+// check if flat list is requested
+func (p GetFilesParams) isList() bool {
+	return p.Details || len(p.Sort) != 0 || len(p.Order) != 0 ||
+		p.Limit > 0 || len(p.Cursor) != 0
 }
 
 // GET /files method
@@ -75,6 +105,26 @@ func (server *Server) DoGetFiles(ctx *gin.Context) {
 		// filepath.Join() cleans the path, we don't need it yet!
 	}
 
+	// shared workspace is addressed by the first path
+	switch {
+	case len(params.Dir) != 0:
+		params.Dir = server.useWorkspace(ctx, params.Local, false, params.Dir)[0]
+	case len(params.Catalog) != 0:
+		params.Catalog = server.useWorkspace(ctx, params.Local, false, params.Catalog)[0]
+	default:
+		params.File = server.useWorkspace(ctx, params.Local, false, params.File)[0]
+	}
+
+	// check name filters and sort parameters
+	if _, err := params.filesOptions().NameFilter(); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse name filter"))
+	}
+	if err := checkFilesListSort(params.Sort, params.Order); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse sort parameters"))
+	}
+
 	// get search engine
 	userName, authToken, homeDir, userTag := server.parseAuthAndHome(ctx)
 	engine, err := server.getSearchEngine(params.Local, nil /*no files*/, authToken, homeDir, userTag)
@@ -106,6 +156,7 @@ func (server *Server) DoGetFiles(ctx *gin.Context) {
 			fmt.Sprintf("path %q is not relative to home", path)))
 	}
 	relPath = filepath.Clean(relPath)
+	server.checkPathPermission(ctx, auth.PermFilesRead, relPath)
 
 	// stat the requested path...
 	if info, err := os.Stat(path); err != nil {
@@ -124,20 +175,13 @@ func (server *Server) DoGetFiles(ctx *gin.Context) {
 			"home":    homeDir,
 			"cluster": userTag,
 		}).Infof("[%s]: start GET /files (directory content)", CORE)
-		info, err := engine.Files(relPath, params.Hidden)
+		info, err := engine.Files(relPath, params.filesOptions())
 		if err != nil {
 			panic(NewError(http.StatusInternalServerError, err.Error()).
 				WithDetails("failed to get files"))
 		}
 
-		// TODO: if params.Sort {
-		// sort names in the ascending order
-		sort.Strings(info.Catalogs)
-		sort.Strings(info.Files)
-		sort.Strings(info.Dirs)
-
-		// TODO: use transcoder/dedicated structure instead of simple map!
-		ctx.JSON(http.StatusOK, info)
+		server.reportDirInfo(ctx, info, params)
 	} else { // catalog or regular file
 		cat, err := catalog.OpenCatalogReadOnly(path)
 		if err != nil {
@@ -146,7 +190,7 @@ func (server *Server) DoGetFiles(ctx *gin.Context) {
 					WithDetails("failed to open catalog"))
 			}
 
-			server.doGetRegularFile(ctx, path, info.ModTime())
+			server.doGetRegularFile(ctx, path, info)
 		} else {
 			defer cat.Close()
 
@@ -157,21 +201,13 @@ func (server *Server) DoGetFiles(ctx *gin.Context) {
 					"home":    homeDir,
 					"cluster": userTag,
 				}).Infof("[%s]: start GET /files (catalog content)", CORE)
-				info, err := engine.Files(relPath, params.Hidden)
+				info, err := engine.Files(relPath, params.filesOptions())
 				if err != nil {
 					panic(NewError(http.StatusInternalServerError, err.Error()).
 						WithDetails("failed to get catalog parts"))
 				}
 
-				// TODO: if params.Sort {
-				// sort names in the ascending order
-				sort.Strings(info.Catalogs)
-				sort.Strings(info.Files)
-				sort.Strings(info.Dirs)
-
-				// TODO: use transcoder/dedicated structure instead of simple map!
-				ctx.JSON(http.StatusOK, info)
-
+				server.reportDirInfo(ctx, info, params)
 			} else {
 				server.doGetCatalog(ctx, cat, params.File, info.ModTime())
 			}
@@ -179,8 +215,38 @@ func (server *Server) DoGetFiles(ctx *gin.Context) {
 	}
 }
 
+// GET /files method: report directory or catalog content
+func (server *Server) reportDirInfo(ctx *gin.Context, info *search.DirInfo, params GetFilesParams) {
+	if !params.isList() {
+		// sort names in the ascending order
+		sort.Strings(info.Catalogs)
+		sort.Strings(info.Files)
+		sort.Strings(info.Dirs)
+
+		// TODO: use transcoder/dedicated structure instead of simple map!
+		ctx.JSON(http.StatusOK, info)
+		return
+	}
+
+	// flat list (sorted and paginated)
+	items := makeFilesList(info, params.Details)
+	page, next, err := sortFilesList(items, params.Sort, params.Order, params.Cursor, params.Limit)
+	if err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to get files page"))
+	}
+
+	ctx.JSON(http.StatusOK, FilesList{
+		DirPath: info.DirPath,
+		Catalog: info.Catalog,
+		Items:   page,
+		Total:   len(items),
+		Next:    next,
+	})
+}
+
 // GET /files method: standalone FILE
-func (server *Server) doGetRegularFile(ctx *gin.Context, path string, mt time.Time) {
+func (server *Server) doGetRegularFile(ctx *gin.Context, path string, info os.FileInfo) {
 	f, err := os.Open(path)
 	if err != nil {
 		panic(NewError(http.StatusInternalServerError, err.Error()).
@@ -188,7 +254,9 @@ func (server *Server) doGetRegularFile(ctx *gin.Context, path string, mt time.Ti
 	}
 	defer f.Close()
 
-	http.ServeContent(ctx.Writer, ctx.Request, path, mt, f)
+	// strong ETag is based on file size and modification time
+	setDownloadHeaders(ctx, fmt.Sprintf("%x-%x", info.Size(), info.ModTime().UnixNano()))
+	http.ServeContent(ctx.Writer, ctx.Request, path, info.ModTime(), f)
 }
 
 // GET /files method: CATALOG
@@ -205,5 +273,15 @@ func (server *Server) doGetCatalog(ctx *gin.Context, cat *catalog.Catalog, filen
 	}
 	defer f.Close()
 
-	http.ServeContent(ctx.Writer, ctx.Request, cat.GetPath(), mt, f)
+	// strong ETag is based on file parts metadata
+	setDownloadHeaders(ctx, fmt.Sprintf("%x-%s", f.Size(), f.Tag()))
+	http.ServeContent(ctx.Writer, ctx.Request, filename, mt, f)
+}
+
+// set ETag and Accept-Ranges headers.
+// the Range, If-Range, If-None-Match and If-Modified-Since
+// headers are handled by http.ServeContent based on these values.
+func setDownloadHeaders(ctx *gin.Context, tag string) {
+	ctx.Header("Accept-Ranges", "bytes")
+	ctx.Header("ETag", fmt.Sprintf(`"%s"`, tag))
 }
@@ -29,6 +29,8 @@
 package rest
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"testing"
 	"time"
@@ -107,6 +109,16 @@ func TestFilesGetUsual(t *testing.T) {
 		check("/files/foo?dir=../..", "", TO, http.StatusBadRequest, "is not relative to home")
 	}
 
+	if all {
+		check("/files?recursive=true&glob=*.txt&details=true", "", TO, http.StatusOK,
+			`"name":"1.txt"`, `"name":"foo/a.txt"`, `"type":"file"`, `"length":`, `"total":2`)
+		check("/files?recursive=true&glob=*.txt&limit=1", "", TO, http.StatusOK,
+			`"name":"1.txt"`, `"total":2`, `"next":`)
+		check("/files?regexp=(", "", TO, http.StatusBadRequest, "failed to parse name filter")
+		check("/files?sort=bad", "", TO, http.StatusBadRequest, "failed to parse sort parameters")
+		check("/files?limit=1&cursor=bad", "", TO, http.StatusBadRequest, "failed to get files page")
+	}
+
 	if all {
 		check("/files/foo?dir=..&file=missing.txt", "", TO, http.StatusNotFound, "no such file or directory")
 	}
@@ -126,3 +138,91 @@ func TestFilesGetUsual(t *testing.T) {
 			"11111-hello-11111", "aaaaa-hello-aaaaa")
 	}
 }
+
+// GET /files tests (Range, ETag and conditional requests)
+func TestFilesGetRange(t *testing.T) {
+	for k, v := range makeDefaultLoggingOptions(testLogLevel) {
+		setLoggingLevel(k, v)
+	}
+
+	fs := newFake()
+	defer fs.cleanup()
+
+	go func() {
+		err := fs.worker.ListenAndServe()
+		assert.NoError(t, err, "failed to serve fake server")
+	}()
+	time.Sleep(testServerStartTO) // wait a bit until server is started
+	defer func() {
+		fs.worker.Stop(testServerStopTO)
+		<-fs.worker.StopChan()
+	}()
+
+	// test case
+	check := func(url string, headers map[string]string, expectedStatus int, expectedBody string) http.Header {
+		req, err := http.NewRequest("GET", fs.location()+url, nil)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, expectedStatus, resp.StatusCode)
+			if len(expectedBody) != 0 {
+				assert.Contains(t, string(body), expectedBody)
+			}
+		}
+
+		return resp.Header
+	}
+
+	// note, the regular file starts with a new line
+	for url, off := range map[string]int{
+		"/files?file=1.txt":                      1,
+		"/files?catalog=catalog.test&file=1.txt": 0,
+	} {
+		single := fmt.Sprintf("bytes=%d-%d", off, off+4)        // "11111"
+		multi := fmt.Sprintf("%s,%d-%d", single, off+6, off+10) // "11111" + "hello"
+
+		h := check(url, nil, http.StatusOK, "11111-hello-11111")
+		if assert.NotNil(t, h) {
+			etag := h.Get("ETag")
+			assert.NotEmpty(t, etag)
+			assert.EqualValues(t, "bytes", h.Get("Accept-Ranges"))
+
+			// single range
+			h = check(url, map[string]string{"Range": single}, http.StatusPartialContent, "11111")
+			assert.EqualValues(t, etag, h.Get("ETag"))
+			assert.Contains(t, h.Get("Content-Range"), single[len("bytes="):]+"/")
+
+			// multiple ranges
+			h = check(url, map[string]string{"Range": multi}, http.StatusPartialContent, "hello")
+			assert.Contains(t, h.Get("Content-Type"), "multipart/byteranges")
+
+			// not satisfiable range
+			check(url, map[string]string{"Range": "bytes=100000-"}, http.StatusRequestedRangeNotSatisfiable, "")
+
+			// If-Range: matched and mismatched ETag
+			check(url, map[string]string{"Range": single, "If-Range": etag}, http.StatusPartialContent, "11111")
+			check(url, map[string]string{"Range": single, "If-Range": `"bad-tag"`}, http.StatusOK, "hello")
+
+			// If-None-Match
+			check(url, map[string]string{"If-None-Match": etag}, http.StatusNotModified, "")
+			check(url, map[string]string{"If-None-Match": `"bad-tag"`}, http.StatusOK, "hello")
+
+			// If-Modified-Since
+			if lm := h.Get("Last-Modified"); assert.NotEmpty(t, lm) {
+				check(url, map[string]string{"If-Modified-Since": lm}, http.StatusNotModified, "")
+			}
+		}
+	}
+}
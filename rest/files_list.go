@@ -0,0 +1,253 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getryft/ryft-server/search"
+)
+
+// FilesListItem is an entry of the GET /files flat list.
+type FilesListItem struct {
+	Name string `json:"name"`           // relative path
+	Host string `json:"host,omitempty"` // host reported the entry
+
+	search.NodeInfo // type and optional details
+}
+
+// FilesList is the GET /files flat list (with pagination).
+type FilesList struct {
+	DirPath string `json:"dir,omitempty"`     // directory path (relative to home)
+	Catalog string `json:"catalog,omitempty"` // catalog path (relative to home)
+
+	Items []FilesListItem `json:"items"`          // current page
+	Total int             `json:"total"`          // total number of items
+	Next  string          `json:"next,omitempty"` // cursor to get the next page
+}
+
+// files list cursor (is passed to the client base64-encoded)
+type filesListCursor struct {
+	Sort  string        `json:"sort"`
+	Order string        `json:"order"`
+	Item  FilesListItem `json:"item"` // last reported item
+}
+
+// check the sort field and order are supported
+func checkFilesListSort(field, order string) error {
+	switch strings.ToLower(field) {
+	case "", "name", "size", "mtime", "type", "parts":
+	default:
+		return fmt.Errorf("%q is unknown sort field", field)
+	}
+
+	switch strings.ToLower(order) {
+	case "", "asc", "desc":
+	default:
+		return fmt.Errorf("%q is unknown sort order", order)
+	}
+
+	return nil // OK
+}
+
+// makeFilesList converts directory content to a flat list.
+// Each host's entry is reported separately.
+// Details (size, mtime, etc) are reported if requested.
+func makeFilesList(info *search.DirInfo, details bool) []FilesListItem {
+	items := make([]FilesListItem, 0, len(info.Files)+len(info.Dirs))
+	reported := make(map[string]bool)
+
+	// entries reported with host attribution
+	for host, nodes := range info.Details {
+		for name, node := range nodes {
+			if !details {
+				node = search.NodeInfo{Type: node.Type}
+			}
+
+			items = append(items, FilesListItem{
+				Name:     name,
+				Host:     host,
+				NodeInfo: node,
+			})
+			reported[name] = true
+		}
+	}
+
+	// entries reported without any details
+	add := func(names []string, kind string) {
+		for _, name := range names {
+			if !reported[name] {
+				items = append(items, FilesListItem{
+					Name:     name,
+					NodeInfo: search.NodeInfo{Type: kind},
+				})
+				reported[name] = true
+			}
+		}
+	}
+	add(info.Catalogs, "catalog") // should be processed before files!
+	add(info.Dirs, "dir")
+	add(info.Files, "file")
+
+	return items
+}
+
+// get the files list item comparison function
+func lessFilesListItems(field, order string) func(a, b *FilesListItem) bool {
+	var cmp func(a, b *FilesListItem) int
+	switch strings.ToLower(field) {
+	case "size":
+		cmp = func(a, b *FilesListItem) int {
+			return compareInt64(a.Length, b.Length)
+		}
+
+	case "mtime":
+		cmp = func(a, b *FilesListItem) int {
+			ta, ea := time.Parse(time.RFC3339, a.ModTime)
+			tb, eb := time.Parse(time.RFC3339, b.ModTime)
+			if ea != nil || eb != nil {
+				return strings.Compare(a.ModTime, b.ModTime)
+			}
+			return compareInt64(ta.UnixNano(), tb.UnixNano())
+		}
+
+	case "type":
+		cmp = func(a, b *FilesListItem) int {
+			return strings.Compare(a.Type, b.Type)
+		}
+
+	case "parts":
+		cmp = func(a, b *FilesListItem) int {
+			return compareInt64(a.PartCount, b.PartCount)
+		}
+
+	default: // by name
+		cmp = func(a, b *FilesListItem) int {
+			return 0 // name is always used
+		}
+	}
+
+	desc := strings.ToLower(order) == "desc"
+	return func(a, b *FilesListItem) bool {
+		// name and host are used to provide strict order
+		res := cmp(a, b)
+		if res == 0 {
+			res = strings.Compare(a.Name, b.Name)
+		}
+		if res == 0 {
+			res = strings.Compare(a.Host, b.Host)
+		}
+
+		if desc {
+			return res > 0
+		}
+		return res < 0
+	}
+}
+
+// compare two integers
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return +1
+	}
+
+	return 0
+}
+
+// sortFilesList sorts the items and get the requested page.
+func sortFilesList(items []FilesListItem, field, order string, cursor string, limit int) (page []FilesListItem, next string, err error) {
+	less := lessFilesListItems(field, order)
+	sort.Slice(items, func(i, j int) bool {
+		return less(&items[i], &items[j])
+	})
+
+	// skip all items up to the cursor
+	if len(cursor) != 0 {
+		c, err := decodeFilesListCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.EqualFold(c.Sort, field) || !strings.EqualFold(c.Order, order) {
+			return nil, "", fmt.Errorf("cursor does not match sort parameters")
+		}
+
+		items = items[sort.Search(len(items), func(i int) bool {
+			return less(&c.Item, &items[i])
+		}):]
+	}
+
+	// limit the page size
+	if limit > 0 && len(items) > limit {
+		items = items[0:limit]
+		next, err = encodeFilesListCursor(filesListCursor{
+			Sort:  field,
+			Order: order,
+			Item:  items[limit-1],
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return items, next, nil // OK
+}
+
+// encode files list cursor
+func encodeFilesListCursor(c filesListCursor) (string, error) {
+	c.Item.Parts = nil // not used
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %s", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil // OK
+}
+
+// decode files list cursor
+func decodeFilesListCursor(s string) (c filesListCursor, err error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("failed to decode cursor: %s", err)
+	}
+
+	if err = json.Unmarshal(buf, &c); err != nil {
+		return c, fmt.Errorf("failed to decode cursor: %s", err)
+	}
+
+	return c, nil // OK
+}
@@ -0,0 +1,128 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"testing"
+
+	"github.com/getryft/ryft-server/search"
+	"github.com/stretchr/testify/assert"
+)
+
+// get item names
+func testFilesListNames(items []FilesListItem) []string {
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.Host+":"+item.Name)
+	}
+	return res
+}
+
+// test files list conversion
+func TestFilesListMake(t *testing.T) {
+	info := search.NewDirInfo("foo", "")
+	info.AddFile("a.txt", "b.txt", "c.cat", "x.txt")
+	info.AddCatalog("c.cat")
+	info.AddDir("dir")
+	info.AddDetails("node-1", "a.txt", search.NodeInfo{Type: "file", Length: 100})
+	info.AddDetails("node-2", "a.txt", search.NodeInfo{Type: "file", Length: 200})
+	info.AddDetails("node-2", "b.txt", search.NodeInfo{Type: "file", Length: 50})
+
+	items := makeFilesList(info, true)
+	page, next, err := sortFilesList(items, "", "", "", 0)
+	if assert.NoError(t, err) {
+		assert.Empty(t, next)
+		assert.EqualValues(t, []string{"node-1:a.txt", "node-2:a.txt",
+			"node-2:b.txt", ":c.cat", ":dir", ":x.txt"}, testFilesListNames(page))
+		assert.EqualValues(t, 200, page[1].Length)
+		assert.EqualValues(t, "catalog", page[3].Type)
+		assert.EqualValues(t, "dir", page[4].Type)
+		assert.EqualValues(t, "file", page[5].Type)
+	}
+
+	// no details
+	items = makeFilesList(info, false)
+	for _, item := range items {
+		assert.EqualValues(t, 0, item.Length)
+		assert.NotEmpty(t, item.Type)
+	}
+}
+
+// test files list sorting and pagination
+func TestFilesListSort(t *testing.T) {
+	items := []FilesListItem{
+		{Name: "a.txt", Host: "node-1", NodeInfo: search.NodeInfo{Type: "file", Length: 300, ModTime: "2018-01-03T00:00:00Z"}},
+		{Name: "b.txt", Host: "node-1", NodeInfo: search.NodeInfo{Type: "file", Length: 100, ModTime: "2018-01-01T00:00:00Z"}},
+		{Name: "c.cat", Host: "node-1", NodeInfo: search.NodeInfo{Type: "catalog", Length: 200, ModTime: "2018-01-02T00:00:00Z", PartCount: 5}},
+		{Name: "d", Host: "node-2", NodeInfo: search.NodeInfo{Type: "dir", ModTime: "2018-01-04T00:00:00Z"}},
+		{Name: "e.txt", Host: "node-2", NodeInfo: search.NodeInfo{Type: "file", Length: 100, ModTime: "2018-01-05T00:00:00Z"}},
+	}
+
+	check := func(field, order string, limit int, expected ...[]string) {
+		cursor := ""
+		for _, exp := range expected {
+			page, next, err := sortFilesList(items, field, order, cursor, limit)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.EqualValues(t, exp, testFilesListNames(page), "sort:%s order:%s", field, order)
+			cursor = next
+		}
+		assert.Empty(t, cursor, "no more pages expected")
+	}
+
+	check("", "", 0, []string{"node-1:a.txt", "node-1:b.txt", "node-1:c.cat", "node-2:d", "node-2:e.txt"})
+	check("name", "desc", 0, []string{"node-2:e.txt", "node-2:d", "node-1:c.cat", "node-1:b.txt", "node-1:a.txt"})
+	check("size", "", 2, []string{"node-2:d", "node-1:b.txt"}, []string{"node-2:e.txt", "node-1:c.cat"}, []string{"node-1:a.txt"})
+	check("mtime", "desc", 3, []string{"node-2:e.txt", "node-2:d", "node-1:a.txt"}, []string{"node-1:c.cat", "node-1:b.txt"})
+	check("type", "asc", 4, []string{"node-1:c.cat", "node-2:d", "node-1:a.txt", "node-1:b.txt"}, []string{"node-2:e.txt"})
+	check("parts", "desc", 1, []string{"node-1:c.cat"}, []string{"node-2:e.txt"},
+		[]string{"node-2:d"}, []string{"node-1:b.txt"}, []string{"node-1:a.txt"})
+
+	// cursor mismatch
+	_, next, err := sortFilesList(items, "size", "", "", 2)
+	if assert.NoError(t, err) {
+		_, _, err = sortFilesList(items, "mtime", "", next, 2)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "cursor does not match sort parameters")
+		}
+	}
+
+	// bad cursor
+	_, _, err = sortFilesList(items, "", "", "bad-cursor", 2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to decode cursor")
+	}
+
+	// bad sort parameters
+	assert.NoError(t, checkFilesListSort("MTIME", "Desc"))
+	assert.Error(t, checkFilesListSort("foo", ""))
+	assert.Error(t, checkFilesListSort("", "foo"))
+}
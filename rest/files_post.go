@@ -45,6 +45,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/getryft/ryft-server/middleware/auth"
 	"github.com/getryft/ryft-server/search"
 	"github.com/getryft/ryft-server/search/utils"
 	"github.com/getryft/ryft-server/search/utils/catalog"
@@ -178,6 +179,13 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 			"no valid filename provided"))
 	}
 
+	// shared workspace
+	if len(params.Catalog) != 0 {
+		params.Catalog = s.useWorkspace(ctx, params.Local, true, params.Catalog)[0]
+	} else {
+		params.File = s.useWorkspace(ctx, params.Local, true, params.File)[0]
+	}
+
 	userName, authToken, homeDir, userTag := s.parseAuthAndHome(ctx)
 	mountPoint, err := s.getMountPoint()
 	if err != nil {
@@ -198,6 +206,14 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 				fmt.Sprintf("path %q is not relative to home", params.File)))
 		}
 	}
+	if len(params.Catalog) != 0 {
+		s.checkPathPermission(ctx, auth.PermFilesWrite, params.Catalog)
+		auditFiles(ctx, params.Catalog)
+		auditDetail(ctx, "file", params.File)
+	} else {
+		s.checkPathPermission(ctx, auth.PermFilesWrite, params.File)
+		auditFiles(ctx, params.File)
+	}
 
 	var file io.Reader
 
@@ -241,6 +257,9 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 		}
 	}
 
+	// storage quota is checked on each node locally
+	quota := s.getQuotaChecker(ctx, mountPoint)
+
 	results := make([]PostFileResult, 0, 1)
 	log.WithField("params", params).
 		WithField("user", userName).
@@ -260,6 +279,15 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 		}
 		log.WithField("tags", tags[0]).Debugf("related tags")
 
+		// replication factor (zero - write to all related nodes)
+		factors, err := s.getReplicationFactors(userTag, files)
+		if err != nil || len(factors) != len(files) {
+			panic(NewError(http.StatusInternalServerError,
+				err.Error()).WithDetails("failed to get replication factor"))
+		}
+		replicas := factors[0]
+		log.WithField("replicas", replicas).Debugf("replication factor")
+
 		type Node struct {
 			// input
 			IsLocal bool
@@ -294,6 +322,14 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 			nodes[i] = node
 		}
 
+		// limit number of copies to the replication factor
+		if replicas > 0 && Ncopies > replicas {
+			Ncopies = limitReplicas(len(nodes), replicas,
+				func(i int) bool { return nodes[i].IsLocal },
+				func(i int) bool { return !nodes[i].Params.isEmpty() },
+				func(i int) { nodes[i].Params = PostFilesParams{} })
+		}
+
 		if Ncopies > 1 {
 			// save to temp file to get multiple copies
 			if len(catalog.DefaultTempDirectory) > 0 {
@@ -355,7 +391,7 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 
 					if node.IsLocal {
 						log.WithField("what", node.Params).Debugf("[%s]: copying on local node", CORE)
-						status, err := s.postLocalFiles(mountPoint, node.Params, delim, node.data)
+						status, err := s.postLocalFiles(mountPoint, node.Params, delim, node.data, quota)
 						node.Results = append(node.Results, PostFileResult{
 							Status: status,
 							Host:   s.Config.HostName,
@@ -397,7 +433,7 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 
 				if node.IsLocal {
 					log.WithField("what", node.Params).Debugf("[%s]: *copying on local node", CORE)
-					status, err := s.postLocalFiles(mountPoint, node.Params, delim, file)
+					status, err := s.postLocalFiles(mountPoint, node.Params, delim, file, quota)
 					node.Results = append(node.Results, PostFileResult{
 						Status: status,
 						Host:   s.Config.HostName,
@@ -425,8 +461,20 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 				break // one node enough
 			}
 		}
+
+		// check the number of replicas written
+		if written := countWrittenReplicas(results); replicas > 0 && written < replicas {
+			results = append(results, PostFileResult{
+				Error: fmt.Sprintf("only %d of %d replicas written", written, replicas),
+			})
+			log.WithField("written", written).
+				WithField("replicas", replicas).
+				Warnf("[%s]: data is under-replicated", CORE)
+			ctx.JSON(http.StatusMultiStatus, results)
+			return
+		}
 	} else {
-		status, err := s.postLocalFiles(mountPoint, params, delim, file)
+		status, err := s.postLocalFiles(mountPoint, params, delim, file, quota)
 		result := PostFileResult{
 			Host:   s.Config.HostName,
 			Status: status,
@@ -439,6 +487,9 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 
 	// detect errors (skip in cluster mode)
 	if len(results) == 1 && results[0].Error != "" {
+		if quota.isExceeded() {
+			panic(quota.error())
+		}
 		panic(NewError(http.StatusInternalServerError, results[0].Error).
 			WithDetails("failed to POST files"))
 	}
@@ -446,8 +497,54 @@ func (s *Server) DoPostFiles(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, results)
 }
 
+// keep only the first N selected nodes (local node goes first)
+// return the number of selected nodes
+func limitReplicas(n int, replicas int, isLocal, isSelected func(int) bool, unselect func(int)) int {
+	// selection order: local node, then the rest
+	order := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		if isSelected(i) && isLocal(i) {
+			order = append(order, i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if isSelected(i) && !isLocal(i) {
+			order = append(order, i)
+		}
+	}
+
+	for k, i := range order {
+		if k >= replicas {
+			unselect(i)
+		}
+	}
+
+	if len(order) < replicas {
+		return len(order)
+	}
+	return replicas
+}
+
+// count successfully written replicas
+func countWrittenReplicas(results []PostFileResult) int {
+	written := 0
+	for _, r := range results {
+		if r.Error == "" {
+			written++
+		}
+	}
+
+	return written
+}
+
 // post local nodes: files, dirs, catalogs
-func (s *Server) postLocalFiles(mountPoint string, params PostFilesParams, delim *string, file io.Reader) (map[string]interface{}, error) {
+func (s *Server) postLocalFiles(mountPoint string, params PostFilesParams, delim *string, file io.Reader, quota *quotaChecker) (map[string]interface{}, error) {
+	// check storage quota (data length might be unknown)
+	if err := quota.check(params.Length); err != nil {
+		return nil, err
+	}
+	file = quota.reader(file)
+
 	if len(params.Catalog) != 0 { // append to catalog
 		catalog, filePath, length, err := updateCatalog(mountPoint, params, delim, file)
 
@@ -881,3 +978,14 @@ func hasSomeTag(tags []string, what []string) bool {
 
 	return false
 }
+
+// check all tags are present
+func hasAllTags(tags []string, what []string) bool {
+	for _, x := range what {
+		if !hasSomeTag(tags, []string{x}) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -41,6 +41,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/getryft/ryft-server/middleware/auth"
 	"github.com/getryft/ryft-server/search"
 	"github.com/getryft/ryft-server/search/utils"
 	"github.com/getryft/ryft-server/search/utils/catalog"
@@ -74,6 +75,7 @@ type filesRenamer interface {
 	Rename() (string, error)
 	Validate() error
 	GetPath() string
+	GetNewPath() string
 }
 
 // getRename factory method that creates fileRenamer instance
@@ -130,6 +132,10 @@ func (r fileRename) GetPath() string {
 	return r.path
 }
 
+func (r fileRename) GetNewPath() string {
+	return r.newPath
+}
+
 // Rename change name of a file on FS
 func (r fileRename) Rename() (string, error) {
 	// check file path can be derived
@@ -190,6 +196,10 @@ func (r dirRename) GetPath() string {
 	return r.path
 }
 
+func (r dirRename) GetNewPath() string {
+	return r.newPath
+}
+
 // Rename change directory name of one directory on FS
 func (r dirRename) Rename() (string, error) {
 	path := filepath.Join(r.mountPoint, r.path)
@@ -244,6 +254,10 @@ func (r catalogRename) GetPath() string {
 	return r.path
 }
 
+func (r catalogRename) GetNewPath() string {
+	return r.newPath
+}
+
 // Rename catalog (sql database and data directory)
 func (r catalogRename) Rename() (string, error) {
 	// rename catalog
@@ -290,6 +304,10 @@ func (r catalogFileRename) GetPath() string {
 	return r.catalogPath
 }
 
+func (r catalogFileRename) GetNewPath() string {
+	return r.catalogPath
+}
+
 // Rename change file name in catalog
 func (r catalogFileRename) Rename() (string, error) {
 	path := filepath.Join(r.mountPoint, r.catalogPath)
@@ -328,6 +346,18 @@ func (server *Server) DoRenameFiles(ctx *gin.Context) {
 		panic(NewError(http.StatusBadRequest, "missing source filename"))
 	}
 
+	// shared workspace (both source and new path)
+	prefix := ctx.Param("path")
+	if len(prefix) != 0 {
+		prefix = server.useWorkspace(ctx, params.Local, true, prefix)[0]
+	} else if len(params.Catalog) != 0 && len(params.File) != 0 {
+		params.Catalog = server.useWorkspace(ctx, params.Local, true, params.Catalog)[0]
+	} else {
+		paths := server.useWorkspace(ctx, params.Local, true,
+			params.Catalog, params.Dir, params.File, params.New)
+		params.Catalog, params.Dir, params.File, params.New = paths[0], paths[1], paths[2], paths[3]
+	}
+
 	userName, authToken, homeDir, userTag := server.parseAuthAndHome(ctx)
 	mountPoint, err := server.getMountPoint()
 	if err != nil {
@@ -336,10 +366,14 @@ func (server *Server) DoRenameFiles(ctx *gin.Context) {
 	}
 	mountPoint = filepath.Join(mountPoint, homeDir)
 
-	fileRename, err := getRename(mountPoint, params, ctx.Param("path"))
+	fileRename, err := getRename(mountPoint, params, prefix)
 	if err != nil {
 		panic(NewError(http.StatusBadRequest, err.Error()))
 	}
+	server.checkPathPermission(ctx, auth.PermFilesWrite,
+		fileRename.GetPath(), fileRename.GetNewPath())
+	auditFiles(ctx, fileRename.GetPath())
+	auditDetail(ctx, "new-path", fileRename.GetNewPath())
 
 	log.WithFields(map[string]interface{}{
 		"file":    params.File,
@@ -431,7 +465,7 @@ func (server *Server) DoRenameFiles(ctx *gin.Context) {
 					}).Debugf("[%s]: renaming on remote node", CORE)
 					node.Results, node.Error = server.renameRemoteFile(node.Address, authToken, node.Params, path)
 				}
-			}(node, ctx.Param("path"))
+			}(node, prefix)
 		}
 
 		// wait and report all results
@@ -0,0 +1,800 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/rest/codec"
+	"github.com/getryft/ryft-server/rest/pb"
+	"github.com/getryft/ryft-server/search"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	grpcMaxMessage = 64 * 1024 * 1024 // maximum incoming message size, bytes
+)
+
+// REST query parameters allowed in the SearchRequest.params map
+// the internal parameters (i.e. "--internal-format") cannot be passed
+var grpcSearchParams = map[string]bool{
+	"cs":                   true,
+	"reduce":               true,
+	"nodes":                true,
+	"backend":              true,
+	"backend-option":       true,
+	"backend-mode":         true,
+	"data":                 true,
+	"index":                true,
+	"view":                 true,
+	"delimiter":            true,
+	"lifetime":             true,
+	"transform":            true,
+	"ignore-missing-files": true,
+	"share-mode":           true,
+	"clusters":             true,
+}
+
+// REST query parameters allowed in the ShowRequest.params map
+var grpcShowParams = map[string]bool{
+	"data":      true,
+	"index":     true,
+	"view":      true,
+	"delimiter": true,
+	"transform": true,
+}
+
+// get gRPC status code from HTTP status
+func grpcCodeFromHTTP(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusRequestEntityTooLarge,
+		http.StatusTooManyRequests,
+		http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+
+	switch {
+	case status < 400:
+		return codes.OK
+	case status < 500:
+		return codes.Unknown
+	}
+
+	return codes.Internal
+}
+
+// grpcCall is a gRPC call in progress.
+// It replaces gin's response writer so the REST handlers can be reused:
+// headers, status and JSON body reported by a handler are captured,
+// protobuf messages are sent to the gRPC stream.
+type grpcCall struct {
+	gin.ResponseWriter // underlying writer (is used by gRPC transport)
+
+	ctx    context.Context   // call context
+	stream grpc.ServerStream // nil for unary calls
+	reply  proto.Message     // unary reply
+
+	header http.Header  // captured headers
+	status int          // captured status
+	body   bytes.Buffer // captured body
+	sent   bool         // response headers are sent
+}
+
+// create new gRPC call, stream is nil for unary calls
+func newGrpcCall(ctx context.Context, stream grpc.ServerStream) *grpcCall {
+	return &grpcCall{
+		ctx:    ctx,
+		stream: stream,
+		header: make(http.Header),
+	}
+}
+
+// unary call (no records reported)
+func (c *grpcCall) unary() bool {
+	return c.stream == nil
+}
+
+// Header gets the captured headers.
+func (c *grpcCall) Header() http.Header {
+	return c.header
+}
+
+// WriteHeader captures the HTTP status.
+func (c *grpcCall) WriteHeader(status int) {
+	c.status = status
+}
+
+// WriteHeaderNow does nothing, headers are sent along with the first message.
+func (c *grpcCall) WriteHeaderNow() {
+	// do nothing
+}
+
+// Write captures the response body.
+func (c *grpcCall) Write(data []byte) (int, error) {
+	return c.body.Write(data)
+}
+
+// WriteString captures the response body.
+func (c *grpcCall) WriteString(s string) (int, error) {
+	return c.body.WriteString(s)
+}
+
+// Flush does nothing, each message is sent by gRPC transport.
+func (c *grpcCall) Flush() {
+	// do nothing
+}
+
+// CloseNotify reports the call is cancelled or finished.
+func (c *grpcCall) CloseNotify() <-chan bool {
+	ch := make(chan bool, 1)
+	go func() {
+		<-c.ctx.Done()
+		ch <- true
+	}()
+	return ch
+}
+
+// Status gets the captured HTTP status.
+func (c *grpcCall) Status() int {
+	if c.status == 0 {
+		return http.StatusOK
+	}
+	return c.status
+}
+
+// Size gets the captured body size.
+func (c *grpcCall) Size() int {
+	return c.body.Len()
+}
+
+// Written checks if any message is sent.
+func (c *grpcCall) Written() bool {
+	return c.sent
+}
+
+// send the response headers (once)
+func (c *grpcCall) sendHeaders() {
+	if c.sent {
+		return // already sent
+	}
+	c.sent = true
+
+	md := metadata.MD{}
+	for _, name := range []string{"X-Request-Id", traceParentHeader} {
+		if v := c.header.Get(name); len(v) != 0 {
+			md.Set(strings.ToLower(name), v)
+		}
+	}
+	if len(md) != 0 {
+		grpc.SetHeader(c.ctx, md) // ignore errors
+	}
+}
+
+// send a protobuf message
+// unary reply is sent by the gRPC server once the call is finished
+// the HTTP/2 flow control blocks the stream if client is slow
+func (c *grpcCall) send(msg proto.Message) error {
+	c.sendHeaders()
+	if c.unary() {
+		c.reply = msg
+		return nil
+	}
+
+	return c.stream.SendMsg(msg)
+}
+
+// decode the captured JSON reply
+func (c *grpcCall) decodeReply(v interface{}) error {
+	if err := json.Unmarshal(c.body.Bytes(), v); err != nil {
+		return status.Errorf(codes.Internal, "failed to decode reply: %s", err)
+	}
+
+	return nil // OK
+}
+
+// get the unary reply reported by the search results encoder
+func (c *grpcCall) countReply() (*pb.CountReply, error) {
+	if reply, ok := c.reply.(*pb.CountReply); ok {
+		return reply, nil
+	}
+
+	return nil, status.Error(codes.Internal, "no reply")
+}
+
+// finish the call: get the gRPC status
+// the captured HTTP error is converted to the gRPC status
+func (c *grpcCall) finish() error {
+	c.sendHeaders()
+	if v := c.header.Get("Retry-After"); len(v) != 0 {
+		grpc.SetTrailer(c.ctx, metadata.Pairs("retry-after", v))
+	}
+
+	code := grpcCodeFromHTTP(c.Status())
+	if code == codes.OK {
+		return nil // OK
+	}
+
+	message := http.StatusText(c.Status())
+	var e Error
+	if err := json.Unmarshal(c.body.Bytes(), &e); err == nil && len(e.Message) != 0 {
+		message = e.Message
+		if len(e.Details) != 0 {
+			message = fmt.Sprintf("%s (%s)", e.Message, e.Details)
+		}
+	}
+
+	return status.Error(code, message)
+}
+
+// set REST query parameters from the params map
+// only allowed parameters are accepted
+func setGrpcParams(q url.Values, params map[string]string, allowed map[string]bool) error {
+	for k, v := range params {
+		if !allowed[k] {
+			return status.Errorf(codes.InvalidArgument,
+				"%q parameter is not allowed", k)
+		}
+		q.Set(k, v)
+	}
+
+	return nil // OK
+}
+
+// set non-empty query parameter
+func setGrpcQuery(q url.Values, name string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if len(v) != 0 {
+			q.Set(name, v)
+		}
+	case bool:
+		if v {
+			q.Set(name, "true")
+		}
+	case int64:
+		if v > 0 {
+			q.Set(name, strconv.FormatInt(v, 10))
+		}
+	case uint32:
+		if v > 0 {
+			q.Set(name, strconv.FormatUint(uint64(v), 10))
+		}
+	}
+}
+
+// get REST query parameters of the search request
+func grpcSearchQuery(req *pb.SearchRequest) (url.Values, error) {
+	q := url.Values{}
+	if err := setGrpcParams(q, req.Params, grpcSearchParams); err != nil {
+		return nil, err
+	}
+
+	q.Set("query", req.Query)
+	for _, file := range req.Files {
+		q.Add("file", file)
+	}
+	setGrpcQuery(q, "mode", req.Mode)
+	setGrpcQuery(q, "surrounding", req.Surrounding)
+	setGrpcQuery(q, "fuzziness", req.Fuzziness)
+	setGrpcQuery(q, "format", req.Format)
+	setGrpcQuery(q, "fields", req.Fields)
+	setGrpcQuery(q, "limit", req.Limit)
+	setGrpcQuery(q, "stats", req.Stats)
+	setGrpcQuery(q, "local", req.Local)
+	setGrpcQuery(q, "performance", req.Performance)
+	setGrpcQuery(q, "priority", req.Priority)
+	return q, nil
+}
+
+// get REST query parameters of the show request
+func grpcShowQuery(req *pb.ShowRequest) (url.Values, error) {
+	q := url.Values{}
+	if err := setGrpcParams(q, req.Params, grpcShowParams); err != nil {
+		return nil, err
+	}
+
+	setGrpcQuery(q, "session", req.Session)
+	setGrpcQuery(q, "offset", req.Offset)
+	setGrpcQuery(q, "count", req.Count)
+	setGrpcQuery(q, "format", req.Format)
+	setGrpcQuery(q, "fields", req.Fields)
+	setGrpcQuery(q, "local", req.Local)
+	setGrpcQuery(q, "performance", req.Performance)
+	return q, nil
+}
+
+// get REST query parameters of the files request
+func grpcFilesQuery(req *pb.FilesRequest) url.Values {
+	q := url.Values{}
+	setGrpcQuery(q, "dir", req.Dir)
+	setGrpcQuery(q, "catalog", req.Catalog)
+	setGrpcQuery(q, "hidden", req.Hidden)
+	setGrpcQuery(q, "recursive", req.Recursive)
+	setGrpcQuery(q, "glob", req.Glob)
+	setGrpcQuery(q, "regexp", req.Regexp)
+	setGrpcQuery(q, "checksum", req.Checksum)
+	setGrpcQuery(q, "local", req.Local)
+	return q
+}
+
+// get REST query parameters of the upload request
+func grpcUploadQuery(req *pb.UploadRequest) url.Values {
+	q := url.Values{}
+	setGrpcQuery(q, "file", req.File)
+	setGrpcQuery(q, "catalog", req.Catalog)
+	setGrpcQuery(q, "delimiter", req.Delimiter)
+	setGrpcQuery(q, "offset", req.Offset)
+	setGrpcQuery(q, "length", req.Length)
+	setGrpcQuery(q, "lifetime", req.Lifetime)
+	setGrpcQuery(q, "share-mode", req.ShareMode)
+	setGrpcQuery(q, "local", req.Local)
+	return q
+}
+
+// get JSON body with aggregations
+func grpcAggsBody(aggs []byte) (io.Reader, error) {
+	if len(aggs) == 0 {
+		return bytes.NewReader(nil), nil
+	}
+
+	body, err := json.Marshal(map[string]json.RawMessage{
+		"aggs": json.RawMessage(aggs),
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"failed to parse aggregations: %s", err)
+	}
+
+	return bytes.NewReader(body), nil
+}
+
+// grpcUploadReader reads data chunks of the client-streaming Upload call.
+type grpcUploadReader struct {
+	stream pb.Ryft_UploadServer
+	data   []byte // current chunk
+}
+
+// Read reads the data chunks.
+func (r *grpcUploadReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			return 0, err // io.EOF at the end
+		}
+		r.data = msg.Data
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// permissions required by gRPC methods
+var grpcPermissions = map[string]string{
+	"Search":       auth.PermSearch,
+	"Count":        auth.PermCount,
+	"Show":         auth.PermSearch,
+	"Aggregations": auth.PermSearch,
+	"Files":        auth.PermFilesRead,
+	"Upload":       auth.PermFilesWrite,
+}
+
+// audit actions of gRPC methods (not listed are not recorded)
+var grpcAuditActions = map[string]string{
+	"Search":       "search",
+	"Count":        "count",
+	"Show":         "show",
+	"Aggregations": "aggs",
+	"Upload":       "files.upload",
+}
+
+// gin context key of the gRPC call context
+type grpcContextKey struct{}
+
+// create gRPC server for the Ryft service
+func newGrpcServer(server *Server) *grpc.Server {
+	s := grpc.NewServer(grpc.MaxRecvMsgSize(grpcMaxMessage))
+	pb.RegisterRyftServer(s, &grpcService{server: server})
+	return s
+}
+
+// DoGrpc handles the Ryft gRPC service: POST /ryft.Ryft/:method
+// The HTTP/2 request is served by the gRPC server,
+// the authentication middleware has already been passed.
+func (server *Server) DoGrpc(ctx *gin.Context) {
+	setAuditAction(ctx, grpcAuditActions[ctx.Param("method")])
+
+	req := ctx.Request
+	ctx.Request = req.WithContext(context.WithValue(req.Context(), grpcContextKey{}, ctx))
+	server.grpcServer.ServeHTTP(ctx.Writer, ctx.Request)
+}
+
+// grpcService implements the Ryft gRPC service.
+// Each call is served by the corresponding REST handler,
+// so the authentication and all the checks are the same.
+type grpcService struct {
+	pb.UnimplementedRyftServer
+
+	server *Server
+}
+
+// serve the gRPC call by the REST handler
+// request's query parameters and body are replaced
+// so the REST handler can parse them as usual
+func (s *grpcService) serve(call *grpcCall, method string, query url.Values, body io.Reader, handler gin.HandlerFunc) error {
+	ctx, ok := call.ctx.Value(grpcContextKey{}).(*gin.Context)
+	if !ok {
+		return status.Error(codes.Internal, "no request context")
+	}
+
+	if perm, ok := grpcPermissions[method]; ok && !s.server.getAuthorizer().Check(getAuthUser(ctx), perm) {
+		return status.Errorf(codes.PermissionDenied, "%q permission required", perm)
+	}
+
+	// the original request body is read by the gRPC transport
+	// so the REST handler works with a copy
+	req := *ctx.Request
+	u := *req.URL
+	u.RawQuery = query.Encode()
+	req.URL = &u
+	req.Form = nil // to be parsed again
+	req.PostForm = nil
+	req.Body = ioutil.NopCloser(body)
+	req.ContentLength = -1 // unknown
+	req.Header = make(http.Header, len(ctx.Request.Header))
+	for k, v := range ctx.Request.Header {
+		req.Header[k] = v
+	}
+
+	origReq, origWriter := ctx.Request, ctx.Writer
+	call.ResponseWriter = origWriter
+	ctx.Request, ctx.Writer = req.WithContext(call.ctx), call
+	defer func() {
+		ctx.Request, ctx.Writer = origReq, origWriter
+	}()
+
+	handler(ctx)
+	return call.finish()
+}
+
+// Search is the gRPC equivalent of GET /search
+func (s *grpcService) Search(req *pb.SearchRequest, stream pb.Ryft_SearchServer) error {
+	query, err := grpcSearchQuery(req)
+	if err != nil {
+		return err
+	}
+	body, err := grpcAggsBody(req.Aggregations)
+	if err != nil {
+		return err
+	}
+
+	call := newGrpcCall(stream.Context(), stream)
+	return s.serve(call, "Search", query, body, s.server.DoSearch)
+}
+
+// Count is the gRPC equivalent of GET /count
+func (s *grpcService) Count(ctx context.Context, req *pb.SearchRequest) (*pb.CountReply, error) {
+	query, err := grpcSearchQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := grpcAggsBody(req.Aggregations)
+	if err != nil {
+		return nil, err
+	}
+
+	call := newGrpcCall(ctx, nil)
+	if err := s.serve(call, "Count", query, body, s.server.DoCount); err != nil {
+		return nil, err
+	}
+	return call.countReply()
+}
+
+// Show is the gRPC equivalent of GET /search/show
+func (s *grpcService) Show(req *pb.ShowRequest, stream pb.Ryft_ShowServer) error {
+	query, err := grpcShowQuery(req)
+	if err != nil {
+		return err
+	}
+	body, err := grpcAggsBody(req.Aggregations)
+	if err != nil {
+		return err
+	}
+
+	call := newGrpcCall(stream.Context(), stream)
+	return s.serve(call, "Show", query, body, s.server.DoSearchShow)
+}
+
+// Aggregations is the gRPC equivalent of GET /search/aggs
+func (s *grpcService) Aggregations(ctx context.Context, req *pb.ShowRequest) (*pb.CountReply, error) {
+	query, err := grpcShowQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := grpcAggsBody(req.Aggregations)
+	if err != nil {
+		return nil, err
+	}
+
+	call := newGrpcCall(ctx, nil)
+	if err := s.serve(call, "Aggregations", query, body, s.server.DoAggregations); err != nil {
+		return nil, err
+	}
+	return call.countReply()
+}
+
+// Files is the gRPC equivalent of GET /files
+func (s *grpcService) Files(ctx context.Context, req *pb.FilesRequest) (*pb.FilesReply, error) {
+	call := newGrpcCall(ctx, nil)
+	if err := s.serve(call, "Files", grpcFilesQuery(req), bytes.NewReader(nil), s.server.DoGetFiles); err != nil {
+		return nil, err
+	}
+
+	var info search.DirInfo
+	if err := call.decodeReply(&info); err != nil {
+		return nil, err
+	}
+
+	reply := &pb.FilesReply{
+		Dir:      info.DirPath,
+		Catalog:  info.Catalog,
+		Files:    info.Files,
+		Folders:  info.Dirs,
+		Catalogs: info.Catalogs,
+	}
+	if len(info.Details) != 0 {
+		reply.Details, _ = json.Marshal(info.Details)
+	}
+	return reply, nil
+}
+
+// Upload is the gRPC equivalent of POST /files
+func (s *grpcService) Upload(stream pb.Ryft_UploadServer) error {
+	req, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "no upload request")
+	} else if err != nil {
+		return err
+	}
+
+	call := newGrpcCall(stream.Context(), nil)
+	body := &grpcUploadReader{stream: stream, data: req.Data}
+	err = s.serve(call, "Upload", grpcUploadQuery(req), body, func(ctx *gin.Context) {
+		ctx.Request.Header.Set("Content-Type", "application/octet-stream")
+		s.server.DoPostFiles(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	var results []PostFileResult
+	if err := call.decodeReply(&results); err != nil {
+		return err
+	}
+
+	reply := new(pb.UploadReply)
+	for _, res := range results {
+		r := &pb.UploadResult{Host: res.Host, Error: res.Error}
+		if len(res.Status) != 0 {
+			r.Details, _ = json.Marshal(res.Status)
+		}
+		reply.Results = append(reply.Results, r)
+	}
+	return stream.SendAndClose(reply)
+}
+
+// create search results encoder
+// gRPC calls are reported by protobuf messages instead of negotiated format
+func newEncoder(ctx *gin.Context, mime string, stream bool) (codec.Encoder, error) {
+	if call, ok := ctx.Writer.(*grpcCall); ok {
+		return &grpcEncoder{call: call}, nil
+	}
+
+	return codec.NewEncoder(ctx.Writer, mime, stream)
+}
+
+// grpcEncoder reports search results as protobuf messages.
+// Streaming calls report each record, statistics and error as
+// separate SearchReply, unary calls report single CountReply on Close.
+type grpcEncoder struct {
+	call   *grpcCall
+	stat   *pb.Stat
+	errors []string
+	closed bool
+}
+
+// EncodeRecord sends the search record.
+func (enc *grpcEncoder) EncodeRecord(rec interface{}) error {
+	if enc.call.unary() {
+		return nil // no records
+	}
+
+	r, err := grpcRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	return enc.call.send(&pb.SearchReply{Record: r})
+}
+
+// EncodeStat sends the search statistics.
+func (enc *grpcEncoder) EncodeStat(stat interface{}) error {
+	s, err := grpcStat(stat)
+	if err != nil {
+		return err
+	}
+
+	if enc.call.unary() {
+		enc.stat = s
+		return nil // report on Close
+	}
+
+	return enc.call.send(&pb.SearchReply{Stat: s})
+}
+
+// EncodeError sends the error.
+func (enc *grpcEncoder) EncodeError(err error) error {
+	if enc.call.unary() {
+		enc.errors = append(enc.errors, err.Error())
+		return nil // report on Close
+	}
+
+	return enc.call.send(&pb.SearchReply{Error: err.Error()})
+}
+
+// Close sends unary reply.
+func (enc *grpcEncoder) Close() error {
+	if enc.closed || !enc.call.unary() {
+		return nil
+	}
+	enc.closed = true
+
+	return enc.call.send(&pb.CountReply{
+		Stat:   enc.stat,
+		Errors: enc.errors,
+	})
+}
+
+var (
+	searchRecordType = reflect.TypeOf(search.Record{})
+	searchStatType   = reflect.TypeOf(search.Stat{})
+)
+
+// convert transcoded record to protobuf message
+// structured formats are reported as JSON-encoded data
+func grpcRecord(rec interface{}) (*pb.Record, error) {
+	if v := reflect.ValueOf(rec); v.Kind() == reflect.Ptr && !v.IsNil() &&
+		v.Elem().Type().ConvertibleTo(searchRecordType) {
+		r := v.Elem().Convert(searchRecordType).Interface().(search.Record)
+		res := &pb.Record{Index: grpcIndex(r.Index)}
+		switch data := r.Data.(type) {
+		case nil:
+			res.Data = r.RawData
+		case []byte:
+			res.Data = data
+		case string:
+			res.Data = []byte(data)
+		default:
+			var err error
+			if res.Data, err = json.Marshal(data); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Record{Data: data}, nil
+}
+
+// convert index to protobuf message
+func grpcIndex(index *search.Index) *pb.Index {
+	if index == nil {
+		return nil
+	}
+
+	return &pb.Index{
+		File:      index.File,
+		Offset:    index.Offset,
+		Length:    index.Length,
+		Fuzziness: index.Fuzziness,
+		Host:      index.Host,
+		DataPos:   index.DataPos,
+	}
+}
+
+// convert transcoded statistics to protobuf message
+func grpcStat(stat interface{}) (*pb.Stat, error) {
+	v := reflect.ValueOf(stat)
+	if v.Kind() != reflect.Ptr || v.IsNil() ||
+		!v.Elem().Type().ConvertibleTo(searchStatType) {
+		return nil, fmt.Errorf("unexpected statistics type: %T", stat)
+	}
+
+	s := v.Elem().Convert(searchStatType).Interface().(search.Stat)
+	res := &pb.Stat{
+		Matches:        s.Matches,
+		TotalBytes:     s.TotalBytes,
+		Duration:       s.Duration,
+		DataRate:       s.DataRate,
+		FabricDuration: s.FabricDuration,
+		FabricDataRate: s.FabricDataRate,
+		Host:           s.Host,
+	}
+	for _, d := range s.Details {
+		dd, err := grpcStat(d)
+		if err != nil {
+			return nil, err
+		}
+		res.Details = append(res.Details, dd)
+	}
+	if len(s.Extra) != 0 {
+		var err error
+		if res.Extra, err = json.Marshal(s.Extra); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
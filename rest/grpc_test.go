@@ -0,0 +1,170 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getryft/ryft-server/rest/format/raw"
+	"github.com/getryft/ryft-server/rest/pb"
+	"github.com/getryft/ryft-server/search"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fake server stream, keeps all sent messages
+type testGrpcStream struct {
+	grpc.ServerStream
+	messages []interface{}
+}
+
+// Context gets the stream context.
+func (s *testGrpcStream) Context() context.Context {
+	return context.Background()
+}
+
+// SendMsg saves the message.
+func (s *testGrpcStream) SendMsg(m interface{}) error {
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+// test search results are sent as gRPC messages
+func TestGrpcStream(t *testing.T) {
+	stream := new(testGrpcStream)
+	router := gin.New()
+	router.GET("/search", func(ctx *gin.Context) {
+		call := newGrpcCall(stream.Context(), stream)
+		call.ResponseWriter = ctx.Writer
+		ctx.Writer = call
+
+		enc, err := newEncoder(ctx, "application/json", true)
+		assert.NoError(t, err)
+
+		rec := search.NewRecord(search.NewIndex("1.txt", 10, 5), []byte("hello"))
+		assert.NoError(t, enc.EncodeRecord(raw.FromRecord(rec)))
+		assert.NoError(t, enc.EncodeError(errors.New("oops")))
+		stat := search.NewStat("host")
+		stat.Matches = 1
+		assert.NoError(t, enc.EncodeStat(raw.FromStat(stat)))
+		assert.NoError(t, enc.Close())
+		assert.NoError(t, call.finish())
+	})
+
+	req, _ := http.NewRequest("GET", "/search", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if assert.Len(t, stream.messages, 3) {
+		msg := stream.messages[0].(*pb.SearchReply)
+		if assert.NotNil(t, msg.Record) {
+			assert.Equal(t, "hello", string(msg.Record.Data))
+			assert.Equal(t, "1.txt", msg.Record.Index.File)
+			assert.EqualValues(t, 10, msg.Record.Index.Offset)
+			assert.EqualValues(t, 5, msg.Record.Index.Length)
+		}
+		msg = stream.messages[1].(*pb.SearchReply)
+		assert.Equal(t, "oops", msg.Error)
+		msg = stream.messages[2].(*pb.SearchReply)
+		if assert.NotNil(t, msg.Stat) {
+			assert.EqualValues(t, 1, msg.Stat.Matches)
+			assert.Equal(t, "host", msg.Stat.Host)
+		}
+	}
+
+	// unary call reports single reply
+	call := newGrpcCall(context.Background(), nil)
+	enc := &grpcEncoder{call: call}
+	assert.NoError(t, enc.EncodeError(errors.New("oops")))
+	assert.NoError(t, enc.Close())
+	if reply, err := call.countReply(); assert.NoError(t, err) {
+		assert.Equal(t, []string{"oops"}, reply.Errors)
+	}
+}
+
+// test only allowed query parameters are accepted
+func TestGrpcParams(t *testing.T) {
+	q, err := grpcSearchQuery(&pb.SearchRequest{
+		Query:  "hello",
+		Files:  []string{"1.txt", "2.txt"},
+		Limit:  10,
+		Params: map[string]string{"cs": "false", "backend": "ryftx"},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "backend=ryftx&cs=false&file=1.txt&file=2.txt&limit=10&query=hello", q.Encode())
+	}
+
+	check := func(params map[string]string, expected string) {
+		_, err := grpcSearchQuery(&pb.SearchRequest{Query: "hello", Params: params})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, expected, status.Convert(err).Message())
+	}
+	check(map[string]string{"--internal-format": "raw"}, `"--internal-format" parameter is not allowed`)
+	check(map[string]string{"--internal-no-session-id": "true"}, `"--internal-no-session-id" parameter is not allowed`)
+	check(map[string]string{"request-id": "abc"}, `"request-id" parameter is not allowed`)
+	check(map[string]string{"query": "other"}, `"query" parameter is not allowed`)
+
+	_, err = grpcShowQuery(&pb.ShowRequest{Params: map[string]string{"data": "1.dat"}})
+	assert.NoError(t, err)
+	_, err = grpcShowQuery(&pb.ShowRequest{Params: map[string]string{"--internal-error-prefix": "true"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// test REST errors are reported as gRPC status
+func TestGrpcStatus(t *testing.T) {
+	router := gin.New()
+	router.GET("/search", func(ctx *gin.Context) {
+		call := newGrpcCall(context.Background(), nil)
+		call.ResponseWriter = ctx.Writer
+		ctx.Writer = call
+
+		func() {
+			defer RecoverFromPanic(ctx)
+			panic(NewError(http.StatusServiceUnavailable, "too many requests").
+				WithDetails("queue is full"))
+		}()
+
+		err := call.finish()
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, "too many requests (queue is full)", status.Convert(err).Message())
+	})
+
+	req, _ := http.NewRequest("GET", "/search", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, codes.Unavailable, grpcCodeFromHTTP(http.StatusServiceUnavailable))
+	assert.Equal(t, codes.Internal, grpcCodeFromHTTP(http.StatusInternalServerError))
+	assert.Equal(t, codes.OK, grpcCodeFromHTTP(http.StatusOK))
+}
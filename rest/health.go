@@ -0,0 +1,350 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	consul "github.com/hashicorp/consul/api"
+)
+
+// circuit states
+const (
+	circuitClosed   = "closed"    // node is healthy
+	circuitOpen     = "open"      // node is skipped
+	circuitHalfOpen = "half-open" // node is probed again
+)
+
+// NodeHealth is the health of a cluster node
+type NodeHealth struct {
+	Node      string  `json:"node"`
+	Address   string  `json:"address"`
+	State     string  `json:"state"`      // circuit state: "closed", "open" or "half-open"
+	Slow      bool    `json:"slow"`       // average latency exceeds the limit
+	Latency   string  `json:"latency"`    // average probe latency
+	ErrorRate float64 `json:"error-rate"` // average probe error rate [0..1]
+	Failures  int     `json:"failures"`   // number of consecutive failures
+	Probes    int     `json:"probes"`     // total number of probes
+	LastError string  `json:"last-error,omitempty"`
+	LastCheck string  `json:"last-check,omitempty"`
+
+	latency  time.Duration
+	openedAt time.Time
+}
+
+// health tracker of cluster nodes
+type healthTracker struct {
+	sync.Mutex
+	nodes map[string]*NodeHealth // by node name
+
+	threshold   int           // consecutive failures to open circuit
+	openTimeout time.Duration // time to keep circuit open
+	slowLatency time.Duration // slow nodes are deprioritized
+}
+
+// weight of the last probe in average values
+const healthAverageWeight = 0.2
+
+// create new health tracker
+func newHealthTracker(threshold int, openTimeout, slowLatency time.Duration) *healthTracker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	return &healthTracker{
+		nodes:       make(map[string]*NodeHealth),
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		slowLatency: slowLatency,
+	}
+}
+
+// report probe result
+func (h *healthTracker) report(node, address string, latency time.Duration, err error, now time.Time) {
+	h.Lock()
+	defer h.Unlock()
+
+	n := h.nodes[node]
+	if n == nil {
+		n = &NodeHealth{Node: node, State: circuitClosed, latency: latency}
+		h.nodes[node] = n
+	}
+	n.Address = address
+	n.Probes++
+	n.LastCheck = now.UTC().Format(time.RFC3339)
+
+	if err != nil {
+		n.Failures++
+		n.LastError = err.Error()
+		n.ErrorRate = n.ErrorRate*(1-healthAverageWeight) + healthAverageWeight
+
+		// open circuit (or re-open after failed probe)
+		if n.Failures >= h.threshold || h.state(n, now) == circuitHalfOpen {
+			n.State = circuitOpen
+			n.openedAt = now
+		}
+	} else {
+		n.Failures = 0
+		n.LastError = ""
+		n.ErrorRate = n.ErrorRate * (1 - healthAverageWeight)
+		n.latency = time.Duration(float64(n.latency)*(1-healthAverageWeight) +
+			float64(latency)*healthAverageWeight)
+		n.State = circuitClosed
+	}
+}
+
+// get current circuit state
+func (h *healthTracker) state(n *NodeHealth, now time.Time) string {
+	if n.State == circuitOpen && now.Sub(n.openedAt) >= h.openTimeout {
+		return circuitHalfOpen
+	}
+
+	return n.State
+}
+
+// get node priority: 0 - healthy, 1 - slow or half-open, 2 - open
+// unknown nodes are assumed healthy
+func (h *healthTracker) priority(node string, now time.Time) int {
+	if h == nil {
+		return 0 // no health checks
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	n := h.nodes[node]
+	if n == nil {
+		return 0
+	}
+
+	switch h.state(n, now) {
+	case circuitOpen:
+		return 2
+	case circuitHalfOpen:
+		return 1
+	}
+	if h.slowLatency > 0 && n.latency > h.slowLatency {
+		return 1
+	}
+
+	return 0
+}
+
+// get average probe latency, zero if unknown
+func (h *healthTracker) averageLatency(node string) time.Duration {
+	if h == nil {
+		return 0 // no health checks
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	if n := h.nodes[node]; n != nil {
+		return n.latency
+	}
+
+	return 0
+}
+
+// get health of all nodes (sorted by name)
+func (h *healthTracker) snapshot(now time.Time) []NodeHealth {
+	res := []NodeHealth{}
+	if h == nil {
+		return res
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	for _, n := range h.nodes {
+		c := *n
+		c.State = h.state(n, now)
+		c.Slow = h.slowLatency > 0 && n.latency > h.slowLatency
+		c.Latency = n.latency.String()
+		res = append(res, c)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Node < res[j].Node
+	})
+	return res
+}
+
+// arrange services: healthy first, then slow, then open circuit
+// keeps the original order within the same priority
+func (h *healthTracker) arrange(services []*consul.CatalogService, now time.Time) []*consul.CatalogService {
+	if h == nil {
+		return services
+	}
+
+	res := make([]*consul.CatalogService, 0, len(services))
+	for prio := 0; prio <= 2; prio++ {
+		for _, service := range services {
+			if h.priority(service.Node, now) == prio {
+				res = append(res, service)
+			}
+		}
+	}
+
+	return res
+}
+
+// split services into available and open circuit ones
+// keeps the original order
+func (h *healthTracker) split(services []*consul.CatalogService, now time.Time) (available, open []*consul.CatalogService) {
+	if h == nil {
+		return services, nil
+	}
+
+	available = make([]*consul.CatalogService, 0, len(services))
+	for _, service := range services {
+		if h.priority(service.Node, now) == 2 {
+			open = append(open, service)
+		} else {
+			available = append(available, service)
+		}
+	}
+
+	return
+}
+
+// check health probing configuration
+func (server *Server) prepareHealth() error {
+	cfg := &server.Config.Health
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("probe interval should be positive")
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("probe timeout should be positive")
+	}
+	if cfg.OpenTimeout <= 0 {
+		return fmt.Errorf("open timeout should be positive")
+	}
+	if cfg.SlowLatency < 0 {
+		return fmt.Errorf("slow latency cannot be negative")
+	}
+
+	return nil // OK
+}
+
+// start health probing thread
+func (server *Server) startHealthProbing() {
+	server.health = newHealthTracker(server.Config.Health.FailureThreshold,
+		server.Config.Health.OpenTimeout, server.Config.Health.SlowLatency)
+
+	client := &http.Client{Timeout: server.Config.Health.Timeout}
+
+	// dedicated goroutine to probe all nodes
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.WithField("error", r).Errorf("[%s]: health probing thread failed", CORE)
+			}
+		}()
+
+		for {
+			select {
+			case <-time.After(server.Config.Health.Interval):
+				if err := server.probeAllNodes(client); err != nil {
+					log.WithError(err).Warnf("[%s]: failed to probe cluster nodes", CORE)
+				}
+
+			case <-server.closeCh:
+				return
+			}
+		}
+	}()
+}
+
+// probe all cluster nodes (except local)
+func (server *Server) probeAllNodes(client *http.Client) error {
+	consulClient, err := server.getConsulClient()
+	if err != nil {
+		return fmt.Errorf("failed to get consul client: %s", err)
+	}
+	services, _, err := consulClient.Catalog().Service("ryft-rest-api", "", nil)
+	if err != nil {
+		return fmt.Errorf("failed to get consul services: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, service := range services {
+		if server.isLocalService(service) {
+			continue // local node is always available
+		}
+
+		wg.Add(1)
+		go func(node, address string) {
+			defer wg.Done()
+			start := time.Now()
+			err := probeNode(client, address)
+			server.health.report(node, address, time.Since(start), err, time.Now())
+			if err != nil {
+				log.WithError(err).WithField("node", node).Debugf("[%s]: health probe failed", CORE)
+			}
+		}(service.Node, getServiceUrl(service))
+	}
+	wg.Wait()
+
+	return nil // OK
+}
+
+// probe a node (lightweight /version request)
+func probeNode(client *http.Client, address string) error {
+	resp, err := client.Get(address + "/version")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid HTTP response status: %d (%s)", resp.StatusCode, resp.Status)
+	}
+
+	return nil // OK
+}
+
+// handle /cluster/health endpoint: health of cluster's nodes
+func (server *Server) DoClusterHealth(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	if server.Config.LocalOnly {
+		panic(NewError(http.StatusBadRequest,
+			"health checks are not available in local mode"))
+	}
+
+	ctx.JSON(http.StatusOK, server.health.snapshot(time.Now()))
+}
@@ -0,0 +1,156 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// circuit breaker test
+func TestHealthTracker(t *testing.T) {
+	h := newHealthTracker(2, time.Minute, 100*time.Millisecond)
+	now := time.Now()
+	fail := fmt.Errorf("connection refused")
+
+	// unknown nodes are healthy
+	assert.Equal(t, 0, h.priority("a", now))
+
+	h.report("a", "http://a:8765", 10*time.Millisecond, nil, now)
+	h.report("b", "http://b:8765", 10*time.Millisecond, fail, now)
+	assert.Equal(t, 0, h.priority("a", now))
+	assert.Equal(t, 0, h.priority("b", now)) // below threshold
+
+	// open circuit
+	h.report("b", "http://b:8765", 10*time.Millisecond, fail, now)
+	assert.Equal(t, 2, h.priority("b", now))
+
+	// half-open after timeout, re-open on failure
+	later := now.Add(time.Minute)
+	assert.Equal(t, 1, h.priority("b", later))
+	h.report("b", "http://b:8765", 10*time.Millisecond, fail, later)
+	assert.Equal(t, 2, h.priority("b", later))
+
+	// close on success
+	h.report("b", "http://b:8765", 10*time.Millisecond, nil, later)
+	assert.Equal(t, 0, h.priority("b", later))
+
+	// slow node
+	h.report("c", "http://c:8765", time.Second, nil, now)
+	assert.Equal(t, 1, h.priority("c", now))
+
+	// arrange services
+	services := []*consul.CatalogService{{Node: "c"}, {Node: "d"}, {Node: "b"}, {Node: "a"}}
+	h.report("d", "http://d:8765", 0, fail, now)
+	h.report("d", "http://d:8765", 0, fail, now)
+	var nodes []string
+	for _, s := range h.arrange(services, now) {
+		nodes = append(nodes, s.Node)
+	}
+	assert.Equal(t, []string{"b", "a", "c", "d"}, nodes)
+
+	// open circuit nodes are split
+	available, open := h.split(services, now)
+	nodes = nil
+	for _, s := range available {
+		nodes = append(nodes, s.Node)
+	}
+	assert.Equal(t, []string{"c", "b", "a"}, nodes)
+	if assert.Len(t, open, 1) {
+		assert.Equal(t, "d", open[0].Node)
+	}
+
+	// snapshot
+	snap := h.snapshot(now)
+	if assert.Len(t, snap, 4) {
+		assert.Equal(t, "a", snap[0].Node)
+		assert.Equal(t, circuitClosed, snap[0].State)
+		assert.Equal(t, "c", snap[2].Node)
+		assert.True(t, snap[2].Slow)
+		assert.Equal(t, "d", snap[3].Node)
+		assert.Equal(t, circuitOpen, snap[3].State)
+		assert.Equal(t, 2, snap[3].Failures)
+		assert.Equal(t, fail.Error(), snap[3].LastError)
+	}
+
+	// no health checks
+	var none *healthTracker
+	assert.Equal(t, services, none.arrange(services, now))
+	available, open = none.split(services, now)
+	assert.Equal(t, services, available)
+	assert.Empty(t, open)
+	assert.Empty(t, none.snapshot(now))
+}
+
+// health configuration test
+func TestHealthPrepare(t *testing.T) {
+	check := func(expectedError string, update func(s *Server)) {
+		s := NewServer()
+		update(s)
+		err := s.prepareHealth()
+		if len(expectedError) != 0 {
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), expectedError)
+			}
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+
+	check("", func(s *Server) {})
+	check("", func(s *Server) { s.Config.Health.SlowLatency = 0 })
+	check("probe interval should be positive", func(s *Server) { s.Config.Health.Interval = 0 })
+	check("probe interval should be positive", func(s *Server) { s.Config.Health.Interval = -time.Second })
+	check("probe timeout should be positive", func(s *Server) { s.Config.Health.Timeout = 0 })
+	check("open timeout should be positive", func(s *Server) { s.Config.Health.OpenTimeout = 0 })
+	check("slow latency cannot be negative", func(s *Server) { s.Config.Health.SlowLatency = -time.Second })
+}
+
+// health probe test
+func TestHealthProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Timeout: time.Second}
+	assert.NoError(t, probeNode(client, srv.URL))
+	assert.Error(t, probeNode(client, srv.URL+"/missing"))
+	assert.Error(t, probeNode(client, "http://127.0.0.1:1"))
+}
@@ -125,6 +125,9 @@ func (server *Server) doJob(job SettingsJobItem) bool {
 	switch strings.ToLower(job.Cmd) {
 	case "delete-file":
 		res := deleteAll("/", []string{job.Args})
+		if err := server.settings.DeleteResults([]string{job.Args}); err != nil {
+			jobsLog.WithError(err).Warnf("[%s]: failed to forget kept result", JOBS)
+		}
 		jobsLog.WithFields(map[string]interface{}{
 			"file":   job.Args,
 			"result": res,
@@ -0,0 +1,302 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestLimits contains request rate and concurrency limits.
+// zero value means unlimited.
+type RequestLimits struct {
+	Rate        float64 `yaml:"rate,omitempty" json:"rate,omitempty"`                 // requests per second
+	Burst       int     `yaml:"burst,omitempty" json:"burst,omitempty"`               // token bucket size, rate by default
+	MaxSearches int     `yaml:"max-searches,omitempty" json:"max-searches,omitempty"` // concurrent requests
+}
+
+// get token bucket size
+func (rl RequestLimits) burst() float64 {
+	if rl.Burst > 0 {
+		return float64(rl.Burst)
+	}
+
+	return math.Max(1.0, math.Ceil(rl.Rate))
+}
+
+// LimitUsage contains the limits and the current usage of a user (GET /searches/limits).
+type LimitUsage struct {
+	User     string        `json:"user"`
+	Limits   RequestLimits `json:"limits"`
+	Tokens   float64       `json:"tokens"`   // available requests
+	Active   int           `json:"active"`   // concurrent requests
+	Rejected uint64        `json:"rejected"` // rejected requests
+}
+
+// per-user limiter state
+type userLimiter struct {
+	limits   RequestLimits
+	tokens   float64
+	last     time.Time // last tokens update
+	active   int
+	rejected uint64
+}
+
+// request limiter (per node)
+type requestLimiter struct {
+	sync.Mutex
+	users    map[string]*userLimiter
+	rejected uint64 // total rejected requests
+	now      func() time.Time
+}
+
+// create new request limiter
+func newRequestLimiter() *requestLimiter {
+	return &requestLimiter{
+		users: make(map[string]*userLimiter),
+		now:   time.Now,
+	}
+}
+
+// refill tokens
+func (u *userLimiter) update(now time.Time) {
+	if u.limits.Rate > 0 {
+		u.tokens += now.Sub(u.last).Seconds() * u.limits.Rate
+		u.tokens = math.Min(u.tokens, u.limits.burst())
+	}
+	u.last = now
+}
+
+// acquire a request slot for the user.
+// returns release function or the delay the client should wait before retry.
+func (l *requestLimiter) acquire(name string, limits RequestLimits) (func(), time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	u, ok := l.users[name]
+	if !ok {
+		l.cleanup(now)
+		u = &userLimiter{tokens: limits.burst(), last: now}
+		l.users[name] = u
+	}
+	u.limits = limits // might be changed
+	u.update(now)
+
+	if limits.MaxSearches > 0 && u.active >= limits.MaxSearches {
+		u.rejected++
+		l.rejected++
+		return nil, time.Second // unknown, ask to retry soon
+	}
+	if limits.Rate > 0 {
+		if u.tokens < 1.0 {
+			u.rejected++
+			l.rejected++
+			wait := time.Duration((1.0 - u.tokens) / limits.Rate * float64(time.Second))
+			return nil, wait
+		}
+		u.tokens -= 1.0
+	}
+
+	u.active++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.Lock()
+			defer l.Unlock()
+			u.active--
+		})
+	}, 0
+}
+
+// remove idle users having full token bucket
+// (the total number of rejected requests is kept)
+func (l *requestLimiter) cleanup(now time.Time) {
+	for name, u := range l.users {
+		if u.active > 0 {
+			continue // in use
+		}
+		u.update(now)
+		if u.limits.Rate <= 0 || u.tokens >= u.limits.burst() {
+			delete(l.users, name)
+		}
+	}
+}
+
+// get the current usage (sorted by user name)
+// admin (or empty user if authentication is disabled) see all users
+func (l *requestLimiter) list(user string, admin bool) []LimitUsage {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	res := []LimitUsage{}
+	for name, u := range l.users {
+		if !admin && name != user {
+			continue // not visible
+		}
+
+		u.update(now)
+		res = append(res, LimitUsage{
+			User:     name,
+			Limits:   u.limits,
+			Tokens:   math.Floor(u.tokens*100) / 100,
+			Active:   u.active,
+			Rejected: u.rejected,
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].User < res[j].User
+	})
+
+	return res
+}
+
+// get total number of rejected requests
+func (l *requestLimiter) getRejected() uint64 {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.rejected
+}
+
+// get the request limits of user.
+// user's own limits have the highest priority, then the most permissive
+// limits of user's roles are used, then the default limits.
+func (s *Server) getUserLimits(user *auth.UserInfo) RequestLimits {
+	if user == nil {
+		return s.Config.Limits.Default
+	}
+
+	if rl, ok := s.Config.Limits.Users[user.Name]; ok {
+		return rl
+	}
+
+	found := false
+	var res RequestLimits
+	for _, role := range user.Roles {
+		rl, ok := s.Config.Limits.Roles[role]
+		if !ok {
+			continue
+		}
+		if !found {
+			res, found = rl, true
+			continue
+		}
+
+		// zero means unlimited
+		if res.Rate > 0 && (rl.Rate <= 0 || rl.Rate > res.Rate) {
+			res.Rate = rl.Rate
+		}
+		if rl.burst() > res.burst() {
+			res.Burst = int(rl.burst())
+		}
+		if res.MaxSearches > 0 && (rl.MaxSearches <= 0 || rl.MaxSearches > res.MaxSearches) {
+			res.MaxSearches = rl.MaxSearches
+		}
+	}
+	if found {
+		return res
+	}
+
+	return s.Config.Limits.Default
+}
+
+// LimitRequests is a route middleware: checks request rate and concurrency limits of the user.
+// node-to-node requests are not limited, they are already checked by the coordinator.
+func (server *Server) LimitRequests() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if server.isClusterRequest(ctx) {
+			return // internal request
+		}
+
+		user := getAuthUser(ctx)
+		limits := server.getUserLimits(user)
+		if limits.Rate <= 0 && limits.MaxSearches <= 0 {
+			return // unlimited
+		}
+
+		// anonymous requests are limited by client IP
+		// (forwarding headers are not trusted)
+		name := "ip:" + ctx.Request.RemoteAddr
+		if host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr); err == nil {
+			name = "ip:" + host
+		}
+		if user != nil {
+			name = user.Name
+		}
+
+		release, wait := server.limiter.acquire(name, limits)
+		if release == nil {
+			secs := int64(math.Ceil(wait.Seconds()))
+			if secs < 1 {
+				secs = 1
+			}
+			err := NewError(http.StatusTooManyRequests,
+				fmt.Sprintf("too many requests, retry in %ds", secs))
+			log.WithField("user", name).WithField("path", ctx.Request.URL.Path).
+				Warnf("[%s]: request rejected: %s", CORE, err)
+			ctx.Header("Retry-After", strconv.FormatInt(secs, 10))
+			ctx.IndentedJSON(err.Status, err)
+			ctx.Abort()
+			return
+		}
+
+		defer release()
+		ctx.Next()
+	}
+}
+
+// GET /searches/limits method
+/* to test method:
+curl -s "http://localhost:8765/searches/limits" | jq .
+*/
+func (server *Server) DoGetSearchLimits(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	user := getAuthUser(ctx)
+	name := ""
+	if user != nil {
+		name = user.Name
+	}
+
+	ctx.JSON(http.StatusOK, server.limiter.list(name, server.isAdmin(user)))
+}
@@ -0,0 +1,183 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// test token bucket and concurrency limits
+func TestRequestLimiter(t *testing.T) {
+	l := newRequestLimiter()
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	limits := RequestLimits{Rate: 2, Burst: 3, MaxSearches: 2}
+
+	// concurrency
+	r1, _ := l.acquire("foo", limits)
+	r2, _ := l.acquire("foo", limits)
+	r3, wait := l.acquire("foo", limits)
+	assert.NotNil(t, r1)
+	assert.NotNil(t, r2)
+	assert.Nil(t, r3)
+	assert.Equal(t, time.Second, wait)
+
+	r1()
+	r1() // released once only
+	r3, _ = l.acquire("foo", limits)
+	if assert.NotNil(t, r3) {
+		r3()
+	}
+	r2()
+
+	// bucket is empty
+	r4, wait := l.acquire("foo", limits)
+	assert.Nil(t, r4)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// other users are not affected
+	r5, _ := l.acquire("bar", limits)
+	if assert.NotNil(t, r5) {
+		r5()
+	}
+
+	// refill
+	now = now.Add(time.Second)
+	r4, _ = l.acquire("foo", limits)
+	if assert.NotNil(t, r4) {
+		r4()
+	}
+
+	usage := l.list("foo", false)
+	if assert.Len(t, usage, 1) {
+		assert.Equal(t, "foo", usage[0].User)
+		assert.Equal(t, 1.0, usage[0].Tokens)
+		assert.Equal(t, 0, usage[0].Active)
+		assert.EqualValues(t, 2, usage[0].Rejected)
+	}
+	assert.Len(t, l.list("", true), 2)
+	assert.EqualValues(t, 2, l.getRejected())
+
+	// idle "bar" and "foo" with full bucket are removed
+	r7, _ := l.acquire("foo", limits)
+	now = now.Add(time.Minute)
+	r6, _ := l.acquire("baz", limits)
+	if assert.NotNil(t, r6) {
+		r6()
+	}
+	usage = l.list("", true)
+	if assert.Len(t, usage, 2) {
+		assert.Equal(t, "baz", usage[0].User)
+		assert.Equal(t, "foo", usage[1].User) // still active
+	}
+	r7()
+	now = now.Add(time.Minute)
+	r8, _ := l.acquire("bar", limits)
+	if assert.NotNil(t, r8) {
+		r8()
+	}
+	usage = l.list("", true)
+	if assert.Len(t, usage, 1) {
+		assert.Equal(t, "bar", usage[0].User)
+	}
+	assert.EqualValues(t, 2, l.getRejected())
+}
+
+// test user limits resolution
+func TestUserLimits(t *testing.T) {
+	s := NewServer()
+	s.Config.Limits.Default = RequestLimits{Rate: 1, MaxSearches: 1}
+	s.Config.Limits.Roles = map[string]RequestLimits{
+		"analyst": {Rate: 5, Burst: 10, MaxSearches: 2},
+		"batch":   {Rate: 2, MaxSearches: 0},
+	}
+	s.Config.Limits.Users = map[string]RequestLimits{
+		"robot": {Rate: 100},
+	}
+
+	assert.Equal(t, RequestLimits{Rate: 1, MaxSearches: 1}, s.getUserLimits(nil))
+	assert.Equal(t, RequestLimits{Rate: 1, MaxSearches: 1},
+		s.getUserLimits(&auth.UserInfo{Name: "foo", Roles: []string{"user"}}))
+	assert.Equal(t, RequestLimits{Rate: 5, Burst: 10, MaxSearches: 2},
+		s.getUserLimits(&auth.UserInfo{Name: "foo", Roles: []string{"user", "analyst"}}))
+	assert.Equal(t, RequestLimits{Rate: 5, Burst: 10, MaxSearches: 0},
+		s.getUserLimits(&auth.UserInfo{Name: "foo", Roles: []string{"batch", "analyst"}}))
+	assert.Equal(t, RequestLimits{Rate: 100},
+		s.getUserLimits(&auth.UserInfo{Name: "robot", Roles: []string{"analyst"}}))
+}
+
+// test limits middleware
+func TestLimitRequests(t *testing.T) {
+	s := NewServer()
+	s.Config.Limits.Default = RequestLimits{Rate: 0.5, Burst: 1}
+	s.Config.Limits.Roles = map[string]RequestLimits{
+		"admin": {}, // unlimited
+	}
+
+	forwarded := 0
+	check := func(user *auth.UserInfo, expected int, retryAfter string) {
+		router := gin.New()
+		router.Use(func(ctx *gin.Context) {
+			if user != nil {
+				ctx.Set(gin.AuthUserKey, user)
+			}
+		})
+		router.GET("/search", s.LimitRequests(), func(ctx *gin.Context) {
+			ctx.String(http.StatusOK, "OK")
+		})
+
+		req, _ := http.NewRequest("GET", "/search", nil)
+		req.RemoteAddr = "192.168.1.1:12345"
+		forwarded++ // spoofed address should be ignored
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("10.0.0.%d", forwarded))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expected, w.Code, "%v", user)
+		assert.Equal(t, retryAfter, w.Header().Get("Retry-After"), "%v", user)
+	}
+
+	foo := &auth.UserInfo{Name: "foo"}
+	admin := &auth.UserInfo{Name: "admin", Roles: []string{"admin"}}
+
+	check(foo, http.StatusOK, "")
+	check(foo, http.StatusTooManyRequests, "2")
+	check(nil, http.StatusOK, "") // limited by client IP
+	check(nil, http.StatusTooManyRequests, "2")
+	check(admin, http.StatusOK, "")
+	check(admin, http.StatusOK, "")
+}
@@ -0,0 +1,397 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/getryft/ryft-server/search"
+	consul "github.com/hashicorp/consul/api"
+)
+
+// node balancing policies
+const (
+	policyBusyness     = "busyness"      // legacy: active searches and tolerance
+	policyLeastLoaded  = "least-loaded"  // minimum weighted load score first
+	policyLatencyAware = "latency-aware" // load score penalized by probe latency
+	policyRandomOfTwo  = "random-of-two" // the best of two random nodes
+)
+
+// NodeLoad is the load vector published by each cluster node
+type NodeLoad struct {
+	Searches  int     `json:"searches"`   // active search requests
+	Processes int     `json:"processes"`  // running backend processes
+	Jobs      int     `json:"jobs"`       // pending jobs
+	CPU       float64 `json:"cpu"`        // load average per CPU core
+	FreeDisk  uint64  `json:"free-disk"`  // free space on the mount point, bytes
+	DiskUsage float64 `json:"disk-usage"` // used part of the mount point, [0..1]
+	DataRate  float64 `json:"data-rate"`  // recent search data rate, MB/sec
+	Rejected  uint64  `json:"rejected"`   // requests rejected by rate limits
+}
+
+// get default load weights
+func defaultLoadWeights() map[string]float64 {
+	return map[string]float64{
+		"searches":   1.0,
+		"processes":  1.0,
+		"jobs":       0.1,
+		"cpu":        1.0,
+		"disk-usage": 1.0,
+	}
+}
+
+// get weighted load score (less is better)
+// capacity is relative node performance (1.0 is average)
+func (load NodeLoad) score(weights map[string]float64, capacity float64) float64 {
+	s := weights["searches"]*float64(load.Searches) +
+		weights["processes"]*float64(load.Processes) +
+		weights["jobs"]*float64(load.Jobs) +
+		weights["cpu"]*load.CPU +
+		weights["disk-usage"]*load.DiskUsage
+
+	if capacity < 0.1 {
+		capacity = 0.1 // avoid division by zero
+	}
+	return s / capacity
+}
+
+// get load scores for all nodes
+// faster nodes (by recent data rate) get lower scores
+func loadScores(loads map[string]NodeLoad, weights map[string]float64) map[string]float64 {
+	// average data rate of nodes which report it
+	var total float64
+	var count int
+	for _, load := range loads {
+		if load.DataRate > 0 {
+			total += load.DataRate
+			count++
+		}
+	}
+
+	scores := make(map[string]float64, len(loads))
+	for node, load := range loads {
+		capacity := 1.0 // unknown
+		if count > 0 && load.DataRate > 0 {
+			capacity = load.DataRate / (total / float64(count))
+		}
+		scores[node] = load.score(weights, capacity)
+	}
+
+	return scores
+}
+
+// arrange services by load scores according to policy
+// nodes with the same score: local node goes first, others are shuffled
+func arrangeByScore(services []*consul.CatalogService, scores map[string]float64, policy string,
+	isLocal func(*consul.CatalogService) bool, rnd *rand.Rand) []*consul.CatalogService {
+	// random order for the same scores
+	res := make([]*consul.CatalogService, 0, len(services))
+	for _, k := range rnd.Perm(len(services)) {
+		res = append(res, services[k])
+	}
+
+	// check if service `a` is better than `b`
+	better := func(a, b *consul.CatalogService) bool {
+		sa, sb := scores[a.Node], scores[b.Node]
+		if sa != sb {
+			return sa < sb
+		}
+		return isLocal(a) && !isLocal(b)
+	}
+
+	if policy != policyRandomOfTwo {
+		sort.SliceStable(res, func(i, j int) bool {
+			return better(res[i], res[j])
+		})
+		return res
+	}
+
+	// power of two choices: take the best of two random candidates
+	for i := 0; i+1 < len(res); i++ {
+		j := i + rnd.Intn(len(res)-i)
+		k := i + rnd.Intn(len(res)-i-1)
+		if k >= j {
+			k++ // should be different
+		}
+		if better(res[k], res[j]) {
+			j = k
+		}
+		res[i], res[j] = res[j], res[i]
+	}
+
+	return res
+}
+
+// re-arrange services using load vectors and configured policy
+func (s *Server) arrangeByLoad(services []*consul.CatalogService, loads map[string]NodeLoad, policy string) []*consul.CatalogService {
+	weights := s.Config.Busyness.Weights
+	if len(weights) == 0 {
+		weights = defaultLoadWeights()
+	}
+
+	scores := loadScores(loads, weights)
+	if policy == policyLatencyAware {
+		slow := s.Config.Health.SlowLatency
+		for node, score := range scores {
+			if lat := s.health.averageLatency(node); lat > 0 && slow > 0 {
+				// include fixed part to penalize idle but slow nodes
+				scores[node] = (score + 1.0) * (1.0 + float64(lat)/float64(slow))
+			}
+		}
+	}
+
+	for _, service := range services {
+		log.WithField("node", service.Node).WithField("score", scores[service.Node]).
+			WithField("load", loads[service.Node]).Debugf("service load details")
+	}
+
+	return arrangeByScore(services, scores, policy, s.isLocalService,
+		rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// check if load vectors are used
+func (s *Server) isLoadPolicy() bool {
+	switch s.Config.Busyness.Policy {
+	case "", policyBusyness:
+		return false
+	}
+
+	return true
+}
+
+// average data rate of recent searches
+type rateAverage struct {
+	sync.Mutex
+	value float64
+}
+
+// weight of the last search in average data rate
+const rateAverageWeight = 0.2
+
+// add new data rate
+func (r *rateAverage) add(rate float64) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.value == 0 {
+		r.value = rate
+	} else {
+		r.value = r.value*(1-rateAverageWeight) + rate*rateAverageWeight
+	}
+}
+
+// get average data rate
+func (r *rateAverage) get() float64 {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.value
+}
+
+// notify server a search statistics is ready
+func (server *Server) onSearchStat(stat *search.Stat) {
+	// merged cluster statistics are ignored
+	if stat == nil || len(stat.Details) != 0 || stat.DataRate <= 0 {
+		return
+	}
+
+	server.dataRate.add(stat.DataRate)
+}
+
+// collect load vector of the local node
+func (server *Server) collectNodeLoad() NodeLoad {
+	load := NodeLoad{
+		Searches: int(atomic.LoadInt32(&server.activeSearchCount)),
+		DataRate: server.dataRate.get(),
+		Rejected: server.limiter.getRejected(),
+	}
+
+	load.Processes = countProcesses("/proc", server.Config.Busyness.Processes)
+
+	if server.settings != nil {
+		if n, err := server.settings.GetJobCount(); err != nil {
+			busyLog.WithError(err).Debugf("[%s]: failed to get job count", BUSY)
+		} else {
+			load.Jobs = n
+		}
+	}
+
+	if avg, err := readLoadAverage("/proc/loadavg"); err != nil {
+		busyLog.WithError(err).Debugf("[%s]: failed to get load average", BUSY)
+	} else {
+		load.CPU = avg / float64(runtime.NumCPU())
+	}
+
+	if mountPoint, err := server.getMountPoint(); err == nil {
+		var fs syscall.Statfs_t
+		if err := syscall.Statfs(mountPoint, &fs); err != nil {
+			busyLog.WithError(err).Debugf("[%s]: failed to get disk usage", BUSY)
+		} else if fs.Blocks > 0 {
+			load.FreeDisk = fs.Bavail * uint64(fs.Bsize)
+			load.DiskUsage = 1.0 - float64(fs.Bfree)/float64(fs.Blocks)
+		}
+	}
+
+	return load
+}
+
+// count running processes by name
+func countProcesses(procDir string, names []string) int {
+	if len(names) == 0 {
+		return 0
+	}
+
+	dirs, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, dir := range dirs {
+		if _, err := strconv.Atoi(dir.Name()); err != nil {
+			continue // not a process
+		}
+
+		comm, err := ioutil.ReadFile(filepath.Join(procDir, dir.Name(), "comm"))
+		if err != nil {
+			continue // process is gone
+		}
+
+		name := strings.TrimSpace(string(comm))
+		for _, n := range names {
+			if name == n {
+				count++
+				break
+			}
+		}
+	}
+
+	return count
+}
+
+// read 1-minute load average
+func readLoadAverage(path string) (float64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("no load average found")
+	}
+
+	avg, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || math.IsNaN(avg) {
+		return 0, fmt.Errorf("bad load average: %q", fields[0])
+	}
+
+	return avg, nil // OK
+}
+
+// update the node load vector in the cluster
+func (server *Server) updateNodeLoad(load NodeLoad) error {
+	client, err := server.getConsulClient()
+	if err != nil {
+		return fmt.Errorf("failed to get consul client: %s", err)
+	}
+
+	name, err := client.Agent().NodeName()
+	if err != nil {
+		return fmt.Errorf("failed to get node name: %s", err)
+	}
+
+	data, err := json.Marshal(load)
+	if err != nil {
+		return fmt.Errorf("failed to encode node load: %s", err)
+	}
+
+	pair := new(consul.KVPair)
+	pair.Key = filepath.Join("load", name)
+	pair.Value = data
+	_, err = client.KV().Put(pair, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update node load: %s", err)
+	}
+
+	return nil // OK
+}
+
+// get load vectors for all nodes
+// the number of active searches is taken from the "busyness" metrics
+func (server *Server) getLoadForAllNodes(metrics map[string]int) (map[string]NodeLoad, error) {
+	client, err := server.getConsulClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consul client: %s", err)
+	}
+
+	prefix := "load/"
+	pairs, _, err := client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node loads from KV: %s", err)
+	}
+
+	loads := map[string]NodeLoad{}
+	for _, kvp := range pairs {
+		key, _ := url.QueryUnescape(kvp.Key)
+		node := strings.TrimPrefix(key, prefix)
+
+		var load NodeLoad
+		if err := json.Unmarshal(kvp.Value, &load); err != nil {
+			log.WithError(err).WithField("node", node).Warnf("[%s]: failed to decode node load", CORE)
+			continue
+		}
+		loads[node] = load
+	}
+
+	// nodes without load vector use just busyness metric
+	for node, metric := range metrics {
+		load := loads[node]
+		load.Searches = metric
+		loads[node] = load
+	}
+
+	return loads, nil // OK
+}
@@ -0,0 +1,142 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// load score test
+func TestLoadScores(t *testing.T) {
+	weights := defaultLoadWeights()
+
+	scores := loadScores(map[string]NodeLoad{
+		"a": {Searches: 2, CPU: 0.5},
+		"b": {Searches: 2, CPU: 0.5, DataRate: 300}, // 1.5x faster than average
+		"c": {Searches: 2, CPU: 0.5, DataRate: 100}, // 2x slower than average
+		"d": {Jobs: 10, DiskUsage: 0.5},
+	}, weights)
+
+	assert.InDelta(t, 2.5, scores["a"], 1e-9)
+	assert.InDelta(t, 2.5/1.5, scores["b"], 1e-9)
+	assert.InDelta(t, 2.5/0.5, scores["c"], 1e-9)
+	assert.InDelta(t, 1.5, scores["d"], 1e-9)
+
+	// custom weights
+	scores = loadScores(map[string]NodeLoad{
+		"a": {Searches: 2, Processes: 3},
+	}, map[string]float64{"processes": 2.0})
+	assert.InDelta(t, 6.0, scores["a"], 1e-9)
+}
+
+// arrange by load score test
+func TestArrangeByScore(t *testing.T) {
+	services := []*consul.CatalogService{
+		{Node: "a"}, {Node: "b"}, {Node: "c"}, {Node: "d"},
+	}
+	scores := map[string]float64{"a": 3, "b": 1, "c": 1, "d": 0.5}
+	isLocal := func(s *consul.CatalogService) bool { return s.Node == "c" }
+	names := func(services []*consul.CatalogService) (res []string) {
+		for _, s := range services {
+			res = append(res, s.Node)
+		}
+		return
+	}
+
+	// least loaded first, local node wins the tie
+	for i := 0; i < 10; i++ {
+		res := arrangeByScore(services, scores, policyLeastLoaded, isLocal, rand.New(rand.NewSource(int64(i))))
+		assert.Equal(t, []string{"d", "c", "b", "a"}, names(res))
+	}
+
+	// random of two: all nodes are present, the worst is never first
+	first := map[string]int{}
+	for i := 0; i < 100; i++ {
+		res := arrangeByScore(services, scores, policyRandomOfTwo, isLocal, rand.New(rand.NewSource(int64(i))))
+		first[res[0].Node]++
+		all := names(res)
+		sort.Strings(all)
+		assert.Equal(t, []string{"a", "b", "c", "d"}, all)
+	}
+	assert.Zero(t, first["a"])
+	assert.True(t, first["d"] > first["b"])
+
+	// input is not modified
+	assert.Equal(t, []string{"a", "b", "c", "d"}, names(services))
+}
+
+// process counter and load average test
+func TestNodeLoadSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proc")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	mkproc := func(pid, comm string) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, pid), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, pid, "comm"), []byte(comm+"\n"), 0644))
+	}
+	mkproc("1", "init")
+	mkproc("100", "ryftprim")
+	mkproc("101", "ryftx")
+	mkproc("102", "ryftx")
+	mkproc("self", "ryftx") // not a process
+
+	assert.Equal(t, 3, countProcesses(dir, []string{"ryftprim", "ryftx"}))
+	assert.Equal(t, 1, countProcesses(dir, []string{"ryftprim"}))
+	assert.Equal(t, 0, countProcesses(dir, nil))
+	assert.Equal(t, 0, countProcesses(filepath.Join(dir, "missing"), []string{"ryftx"}))
+
+	loadavg := filepath.Join(dir, "loadavg")
+	assert.NoError(t, ioutil.WriteFile(loadavg, []byte("1.25 0.80 0.50 2/345 6789\n"), 0644))
+	avg, err := readLoadAverage(loadavg)
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 1.25, avg, 1e-9)
+	}
+
+	assert.NoError(t, ioutil.WriteFile(loadavg, []byte(""), 0644))
+	_, err = readLoadAverage(loadavg)
+	assert.Error(t, err)
+
+	// data rate average
+	var r rateAverage
+	r.add(100)
+	assert.InDelta(t, 100.0, r.get(), 1e-9)
+	r.add(200)
+	assert.InDelta(t, 120.0, r.get(), 1e-9)
+}
@@ -0,0 +1,276 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getryft/ryft-server/search/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// timeout of the revocation request to another cluster node
+const remoteRevokeTimeout = 10 * time.Second
+
+// LogoutParams contains all the bound parameters for the /logout endpoint.
+type LogoutParams struct {
+	ID    string `form:"id" json:"id,omitempty"` // token ID (node-to-node requests only)
+	Local bool   `form:"local" json:"local,omitempty"`
+}
+
+// RevokeParams contains all the bound parameters for the /user/revoke endpoint.
+type RevokeParams struct {
+	Users []string `form:"user" json:"user,omitempty"` // users to revoke all tokens of
+	Local bool     `form:"local" json:"local,omitempty"`
+}
+
+// Handle POST /logout endpoint - revoke JWT token used to authenticate
+/* to test method:
+curl -X POST -s -H "Authorization: Bearer $TOKEN" "http://localhost:8765/logout" | jq .
+*/
+func (server *Server) DoLogout(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	// parse request parameters
+	var params LogoutParams
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+
+	user := getAuthUser(ctx)
+	if user == nil {
+		panic(NewError(http.StatusUnauthorized, "no authenticated user found"))
+	}
+
+	// other nodes cannot get token ID from cluster token
+	id := user.SessionID
+	if len(params.ID) != 0 && server.isClusterRequest(ctx) {
+		id = params.ID
+	}
+	if len(id) == 0 {
+		panic(NewError(http.StatusBadRequest, "no JWT token used to authenticate"))
+	}
+
+	if err := server.Revocation.RevokeToken(id, user.Name); err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to revoke token"))
+	}
+	log.WithField("user", user.Name).Infof("[%s/auth]: token revoked", CORE)
+
+	revoked := []string{server.Config.HostName}
+	var failed map[string]string
+	if !params.Local && !server.Config.LocalOnly {
+		q := url.Values{}
+		q.Set("id", id)
+		var others []string
+		others, failed = server.revokeOnAllNodes(ctx, "/logout", q)
+		revoked = append(revoked, others...)
+	}
+
+	reportRevoked(ctx, map[string]interface{}{
+		"user": user.Name,
+	}, revoked, failed)
+}
+
+// Handle POST /user/revoke endpoint - revoke all JWT tokens of the users
+/* to test method:
+curl -X POST -s "http://localhost:8765/user/revoke?user=foo" | jq .
+*/
+func (server *Server) DoUserRevoke(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	// parse request parameters
+	var params RevokeParams
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+
+	// own tokens by default
+	user := getAuthUser(ctx)
+	names := params.Users
+	if len(names) == 0 && user != nil {
+		names = []string{user.Name}
+	}
+	if len(names) == 0 {
+		panic(NewError(http.StatusBadRequest, "no user provided"))
+	}
+
+	// only admin can revoke tokens of other users
+	for _, name := range names {
+		if (user == nil || name != user.Name) && !server.isAdmin(user) {
+			panic(NewError(http.StatusForbidden,
+				fmt.Sprintf(`access to "%s" denied`, name)))
+		}
+	}
+	auditDetail(ctx, "target", strings.Join(names, ","))
+
+	for _, name := range names {
+		if err := server.Revocation.RevokeUser(name); err != nil {
+			panic(NewError(http.StatusInternalServerError, err.Error()).
+				WithDetails("failed to revoke user tokens"))
+		}
+		log.WithField("user", name).Infof("[%s/auth]: all tokens revoked", CORE)
+	}
+
+	revoked := []string{server.Config.HostName}
+	var failed map[string]string
+	if !params.Local && !server.Config.LocalOnly {
+		q := url.Values{}
+		for _, name := range names {
+			q.Add("user", name)
+		}
+		var others []string
+		others, failed = server.revokeOnAllNodes(ctx, "/user/revoke", q)
+		revoked = append(revoked, others...)
+	}
+
+	reportRevoked(ctx, map[string]interface{}{
+		"users": names,
+	}, revoked, failed)
+}
+
+// report the nodes the tokens are revoked on
+// "207 Multi-Status" is reported if some nodes failed
+func reportRevoked(ctx *gin.Context, res map[string]interface{}, revoked []string, failed map[string]string) {
+	status := http.StatusOK
+	sort.Strings(revoked)
+	res["revoked"] = revoked
+	if len(failed) != 0 {
+		res["failed"] = failed
+		status = http.StatusMultiStatus
+	}
+
+	ctx.JSON(status, res)
+}
+
+// propagate token revocation to all other cluster nodes
+// returns the list of nodes the tokens are revoked on
+// and errors of the nodes failed (by node name)
+func (server *Server) revokeOnAllNodes(ctx *gin.Context, path string, query url.Values) ([]string, map[string]string) {
+	services, _, err := server.getConsulInfo("", nil)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get cluster nodes"))
+	}
+
+	_, authToken, _, _ := server.parseAuthAndHome(ctx)
+
+	var res []string
+	failed := make(map[string]string)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for _, service := range services {
+		if server.isLocalService(service) {
+			continue // already done
+		}
+
+		wg.Add(1)
+		go func(node, address string) {
+			defer wg.Done()
+
+			err := callRemoteRevoke(address, authToken, path, query)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				log.WithError(err).WithField("node", node).Warnf("[%s/auth]: failed to revoke tokens", CORE)
+				failed[node] = err.Error()
+			} else {
+				res = append(res, node)
+			}
+		}(service.Node, getServiceUrl(service))
+	}
+	wg.Wait()
+
+	return res, failed
+}
+
+// call remote revoke endpoint
+func callRemoteRevoke(address string, authToken string, path string, query url.Values) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %s", err)
+	}
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("local", fmt.Sprintf("%t", true))
+	u.RawQuery = q.Encode()
+	u.Path += path
+
+	// prepare request
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %s", err)
+	}
+
+	// authorization
+	if len(authToken) != 0 {
+		req.Header.Set("Authorization", authToken)
+	}
+
+	// do HTTP request
+	client := &http.Client{Timeout: remoteRevokeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %s", err)
+	}
+
+	defer resp.Body.Close() // close it later
+
+	// check status code
+	if resp.StatusCode != http.StatusOK {
+		// try to decode error response
+		var errorBody map[string]interface{}
+		dec := json.NewDecoder(resp.Body)
+		if err := dec.Decode(&errorBody); err == nil {
+			if msg, err := utils.AsString(errorBody["message"]); err == nil {
+				return fmt.Errorf("%d: %s", resp.StatusCode, msg)
+			}
+		}
+
+		return fmt.Errorf("invalid HTTP response status: %d (%s)", resp.StatusCode, resp.Status)
+	}
+
+	return nil // OK
+}
@@ -0,0 +1,126 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// test /logout and /user/revoke endpoints
+func TestLogoutAndRevoke(t *testing.T) {
+	s := NewServer()
+	s.Config.LocalOnly = true
+	s.Config.HostName = "node-1"
+	var err error
+	s.Revocation, err = auth.NewRevocation(nil, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	check := func(user *auth.UserInfo, method string, url string, expected int) {
+		router := gin.New()
+		router.Use(func(ctx *gin.Context) {
+			if user != nil {
+				ctx.Set(gin.AuthUserKey, user)
+			}
+		})
+		router.POST("/logout", s.DoLogout)
+		router.POST("/user/revoke", s.DoUserRevoke)
+
+		req, _ := http.NewRequest(method, url, strings.NewReader(""))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expected, w.Code, "%v %s", user, url)
+	}
+
+	foo := &auth.UserInfo{Name: "foo", SessionID: "t1"}
+	bar := &auth.UserInfo{Name: "bar"} // Basic authentication
+	admin := &auth.UserInfo{Name: "admin", Roles: []string{auth.AdminRole}}
+
+	// logout
+	check(foo, "POST", "/logout", http.StatusOK)
+	assert.True(t, s.Revocation.IsRevoked("t1", "foo", time.Now()))
+	check(bar, "POST", "/logout", http.StatusBadRequest)
+	check(bar, "POST", "/logout?id=t2", http.StatusBadRequest) // not a cluster request
+	assert.False(t, s.Revocation.IsRevoked("t2", "bar", time.Now()))
+
+	// revoke all tokens
+	check(bar, "POST", "/user/revoke", http.StatusOK)
+	assert.True(t, s.Revocation.IsRevoked("", "bar", time.Now()))
+	check(bar, "POST", "/user/revoke?user=foo", http.StatusForbidden)
+	check(admin, "POST", "/user/revoke?user=foo&user=bar", http.StatusOK)
+	assert.True(t, s.Revocation.IsRevoked("", "foo", time.Now()))
+}
+
+// test revocation is reported with failed nodes
+func TestRevokeFailedNodes(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "true", req.URL.Query().Get("local"))
+		if req.Header.Get("Authorization") != "Cluster token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"status":403, "message":"access denied"}`))
+		}
+	}))
+	defer remote.Close()
+
+	q := url.Values{}
+	q.Set("id", "t1")
+	assert.NoError(t, callRemoteRevoke(remote.URL, "Cluster token", "/logout", q))
+	err := callRemoteRevoke(remote.URL, "Basic Zm9vOmJhcg==", "/logout", q)
+	if assert.Error(t, err) {
+		assert.Equal(t, "403: access denied", err.Error())
+	}
+
+	check := func(failed map[string]string, expectedStatus int, expectedBody string) {
+		router := gin.New()
+		router.POST("/logout", func(ctx *gin.Context) {
+			reportRevoked(ctx, map[string]interface{}{"user": "foo"},
+				[]string{"node-2", "node-1"}, failed)
+		})
+
+		req, _ := http.NewRequest("POST", "/logout", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expectedStatus, w.Code)
+		assert.JSONEq(t, expectedBody, w.Body.String())
+	}
+
+	check(nil, http.StatusOK, `{"user":"foo", "revoked":["node-1","node-2"]}`)
+	check(map[string]string{"node-3": "timeout"}, http.StatusMultiStatus,
+		`{"user":"foo", "revoked":["node-1","node-2"], "failed":{"node-3":"timeout"}}`)
+}
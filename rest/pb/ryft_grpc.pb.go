@@ -0,0 +1,344 @@
+// Ryft gRPC service.
+//
+// The service is served by ryft-server on the HTTPS listener (HTTP/2 is
+// negotiated via TLS ALPN) under the same authentication as the REST API:
+// pass the "authorization" metadata with a Basic or Bearer token.
+//
+// Messages mirror the search.Record, search.Index and search.Stat types
+// of the REST API. See docs/rest/grpc.md for the details.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ryft.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Ryft_Search_FullMethodName       = "/ryft.Ryft/Search"
+	Ryft_Count_FullMethodName        = "/ryft.Ryft/Count"
+	Ryft_Show_FullMethodName         = "/ryft.Ryft/Show"
+	Ryft_Aggregations_FullMethodName = "/ryft.Ryft/Aggregations"
+	Ryft_Files_FullMethodName        = "/ryft.Ryft/Files"
+	Ryft_Upload_FullMethodName       = "/ryft.Ryft/Upload"
+)
+
+// RyftClient is the client API for Ryft service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Ryft is the Ryft search service.
+type RyftClient interface {
+	// Search streams found records back, the statistics and errors are
+	// reported as separate messages. Equivalent of GET /search.
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SearchReply], error)
+	// Count reports the search statistics only. Equivalent of GET /count.
+	Count(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*CountReply, error)
+	// Show streams records of the previous search session.
+	// Equivalent of GET /search/show.
+	Show(ctx context.Context, in *ShowRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SearchReply], error)
+	// Aggregations reports aggregations of the previous search session.
+	// Equivalent of GET /search/aggs.
+	Aggregations(ctx context.Context, in *ShowRequest, opts ...grpc.CallOption) (*CountReply, error)
+	// Files reports directory or catalog content. Equivalent of GET /files.
+	Files(ctx context.Context, in *FilesRequest, opts ...grpc.CallOption) (*FilesReply, error)
+	// Upload saves the streamed data chunks into a file or catalog.
+	// Equivalent of POST /files.
+	Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, UploadReply], error)
+}
+
+type ryftClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRyftClient(cc grpc.ClientConnInterface) RyftClient {
+	return &ryftClient{cc}
+}
+
+func (c *ryftClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SearchReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ryft_ServiceDesc.Streams[0], Ryft_Search_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SearchRequest, SearchReply]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ryft_SearchClient = grpc.ServerStreamingClient[SearchReply]
+
+func (c *ryftClient) Count(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*CountReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CountReply)
+	err := c.cc.Invoke(ctx, Ryft_Count_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ryftClient) Show(ctx context.Context, in *ShowRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SearchReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ryft_ServiceDesc.Streams[1], Ryft_Show_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ShowRequest, SearchReply]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ryft_ShowClient = grpc.ServerStreamingClient[SearchReply]
+
+func (c *ryftClient) Aggregations(ctx context.Context, in *ShowRequest, opts ...grpc.CallOption) (*CountReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CountReply)
+	err := c.cc.Invoke(ctx, Ryft_Aggregations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ryftClient) Files(ctx context.Context, in *FilesRequest, opts ...grpc.CallOption) (*FilesReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FilesReply)
+	err := c.cc.Invoke(ctx, Ryft_Files_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ryftClient) Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, UploadReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ryft_ServiceDesc.Streams[2], Ryft_Upload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadRequest, UploadReply]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ryft_UploadClient = grpc.ClientStreamingClient[UploadRequest, UploadReply]
+
+// RyftServer is the server API for Ryft service.
+// All implementations must embed UnimplementedRyftServer
+// for forward compatibility.
+//
+// Ryft is the Ryft search service.
+type RyftServer interface {
+	// Search streams found records back, the statistics and errors are
+	// reported as separate messages. Equivalent of GET /search.
+	Search(*SearchRequest, grpc.ServerStreamingServer[SearchReply]) error
+	// Count reports the search statistics only. Equivalent of GET /count.
+	Count(context.Context, *SearchRequest) (*CountReply, error)
+	// Show streams records of the previous search session.
+	// Equivalent of GET /search/show.
+	Show(*ShowRequest, grpc.ServerStreamingServer[SearchReply]) error
+	// Aggregations reports aggregations of the previous search session.
+	// Equivalent of GET /search/aggs.
+	Aggregations(context.Context, *ShowRequest) (*CountReply, error)
+	// Files reports directory or catalog content. Equivalent of GET /files.
+	Files(context.Context, *FilesRequest) (*FilesReply, error)
+	// Upload saves the streamed data chunks into a file or catalog.
+	// Equivalent of POST /files.
+	Upload(grpc.ClientStreamingServer[UploadRequest, UploadReply]) error
+	mustEmbedUnimplementedRyftServer()
+}
+
+// UnimplementedRyftServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRyftServer struct{}
+
+func (UnimplementedRyftServer) Search(*SearchRequest, grpc.ServerStreamingServer[SearchReply]) error {
+	return status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedRyftServer) Count(context.Context, *SearchRequest) (*CountReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Count not implemented")
+}
+func (UnimplementedRyftServer) Show(*ShowRequest, grpc.ServerStreamingServer[SearchReply]) error {
+	return status.Errorf(codes.Unimplemented, "method Show not implemented")
+}
+func (UnimplementedRyftServer) Aggregations(context.Context, *ShowRequest) (*CountReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Aggregations not implemented")
+}
+func (UnimplementedRyftServer) Files(context.Context, *FilesRequest) (*FilesReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Files not implemented")
+}
+func (UnimplementedRyftServer) Upload(grpc.ClientStreamingServer[UploadRequest, UploadReply]) error {
+	return status.Errorf(codes.Unimplemented, "method Upload not implemented")
+}
+func (UnimplementedRyftServer) mustEmbedUnimplementedRyftServer() {}
+func (UnimplementedRyftServer) testEmbeddedByValue()              {}
+
+// UnsafeRyftServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RyftServer will
+// result in compilation errors.
+type UnsafeRyftServer interface {
+	mustEmbedUnimplementedRyftServer()
+}
+
+func RegisterRyftServer(s grpc.ServiceRegistrar, srv RyftServer) {
+	// If the following call pancis, it indicates UnimplementedRyftServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Ryft_ServiceDesc, srv)
+}
+
+func _Ryft_Search_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RyftServer).Search(m, &grpc.GenericServerStream[SearchRequest, SearchReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ryft_SearchServer = grpc.ServerStreamingServer[SearchReply]
+
+func _Ryft_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RyftServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ryft_Count_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RyftServer).Count(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ryft_Show_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ShowRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RyftServer).Show(m, &grpc.GenericServerStream[ShowRequest, SearchReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ryft_ShowServer = grpc.ServerStreamingServer[SearchReply]
+
+func _Ryft_Aggregations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShowRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RyftServer).Aggregations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ryft_Aggregations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RyftServer).Aggregations(ctx, req.(*ShowRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ryft_Files_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RyftServer).Files(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ryft_Files_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RyftServer).Files(ctx, req.(*FilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ryft_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RyftServer).Upload(&grpc.GenericServerStream[UploadRequest, UploadReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ryft_UploadServer = grpc.ClientStreamingServer[UploadRequest, UploadReply]
+
+// Ryft_ServiceDesc is the grpc.ServiceDesc for Ryft service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ryft_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ryft.Ryft",
+	HandlerType: (*RyftServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Count",
+			Handler:    _Ryft_Count_Handler,
+		},
+		{
+			MethodName: "Aggregations",
+			Handler:    _Ryft_Aggregations_Handler,
+		},
+		{
+			MethodName: "Files",
+			Handler:    _Ryft_Files_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Search",
+			Handler:       _Ryft_Search_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Show",
+			Handler:       _Ryft_Show_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Upload",
+			Handler:       _Ryft_Upload_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ryft.proto",
+}
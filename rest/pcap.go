@@ -69,6 +69,8 @@ type PcapSearchParams struct {
 	Local       bool   `form:"local" json:"local,omitempty" msgpack:"local,omitempty"`
 	ShareMode   string `form:"share-mode" json:"share-mode,omitempty" msgpack:"share-mode,omitempty"` // share mode to use
 	Performance bool   `form:"performance" json:"performance,omitempty" msgpack:"performance,omitempty"`
+	RequestID   string `form:"request-id" json:"request-id,omitempty" msgpack:"request-id,omitempty"` // assigned by the coordinator
+	Priority    string `form:"priority" json:"priority,omitempty" msgpack:"priority,omitempty"`       // "interactive" or "batch"
 
 	// internal parameters
 	InternalErrorPrefix bool   `form:"--internal-error-prefix" json:"-" msgpack:"-"` // include host prefixes for error messages
@@ -126,6 +128,11 @@ func (server *Server) doPcapSearch(ctx *gin.Context, params PcapSearchParams) {
 			"no file or catalog provided"))
 	}
 
+	// shared workspace files (outputs are written to the workspace)
+	keep := len(params.KeepDataAs) != 0 || len(params.KeepIndexAs) != 0
+	params.Files = server.useWorkspace(ctx, params.Local, keep, params.Files...)
+	server.checkOutputPermission(ctx, params.KeepDataAs, params.KeepIndexAs)
+
 	// PCAP limitations
 	if !format.IsNull(params.Format) {
 		panic(NewError(http.StatusBadRequest,
@@ -158,7 +165,7 @@ func (server *Server) doPcapSearch(ctx *gin.Context, params PcapSearchParams) {
 	// we can use two formats:
 	// - single JSON value (not appropriate for large data set)
 	// - with tags to report data records and the statistics in a stream
-	enc, err := codec.NewEncoder(ctx.Writer, accept, params.Stream)
+	enc, err := newEncoder(ctx, accept, params.Stream)
 	if err != nil {
 		panic(NewError(http.StatusBadRequest, err.Error()).
 			WithDetails("failed to get encoder"))
@@ -204,6 +211,8 @@ func (server *Server) doPcapSearch(ctx *gin.Context, params PcapSearchParams) {
 	// get search engine
 	var engine search.Engine
 	userName, authToken, homeDir, userTag := server.parseAuthAndHome(ctx)
+	cfg.User = userName
+	cfg.Priority = server.getPriority(ctx, params.Priority)
 	engine, err = server.getSearchEngine(params.Local, params.Files, authToken, homeDir, userTag)
 	if err != nil {
 		panic(NewError(http.StatusInternalServerError, err.Error()).
@@ -217,15 +226,33 @@ func (server *Server) doPcapSearch(ctx *gin.Context, params PcapSearchParams) {
 			WithDetails("failed to create session token"))
 	}
 
+	// the same request ID is used on all cluster nodes
+	var forwarded bool
+	cfg.RequestID, forwarded = server.getSearchID(ctx, params.RequestID)
+	ctx.Header("X-Request-Id", cfg.RequestID)
+
+	// the trace context is passed to all engines and cluster nodes
+	span := startSearchSpan(ctx, "rest-search", cfg)
+	span.SetAttribute("user", userName)
+
 	log.WithFields(map[string]interface{}{
 		"config":  cfg,
 		"user":    userName,
 		"home":    homeDir,
 		"cluster": userTag,
+		"trace":   cfg.TraceID(),
 	}).Infof("[%s]: start GET /pcap/search", CORE)
+	// check storage quota before any results are kept
+	server.prepareKeptResults(ctx, homeDir, cfg)
+
+	auditSearch(ctx, cfg, nil)
+
 	searchStartTime := time.Now() // performance metric
 	res, err := engine.PcapSearch(cfg)
 	if err != nil {
+		span.SetError(err)
+		span.Finish()
+		checkQueueTimeout(ctx, err)
 		if len(errorPrefix) != 0 {
 			err = fmt.Errorf("[%s]: %s", errorPrefix, err)
 		}
@@ -242,10 +269,25 @@ func (server *Server) doPcapSearch(ctx *gin.Context, params PcapSearchParams) {
 	server.onSearchStarted(cfg)
 	defer server.onSearchStopped(cfg)
 
+	// can be cancelled via DELETE /searches/:id
+	subtask := params.Local && forwarded
+	info := server.registerSearch(cfg, subtask, userName, res)
+	defer server.searches.remove(info)
+
 	// drain all results
 	transferStartTime := time.Now() // performance metric
 	server.drain(ctx, enc, tcode, cfg, res, errorPrefix)
 	transferStopTime := time.Now() // performance metric
+	server.onSearchStat(res.Stat)
+	auditSearch(ctx, cfg, res)
+
+	metrics := map[string]interface{}{
+		"prepare":  searchStartTime.Sub(requestStartTime).String(),
+		"engine":   transferStartTime.Sub(searchStartTime).String(),
+		"transfer": transferStopTime.Sub(transferStartTime).String(),
+		"total":    transferStopTime.Sub(requestStartTime).String(),
+	}
+	finishSearchSpan(span, res, metrics)
 
 	if params.Stats && res.Stat != nil {
 		if server.Config.ExtraRequest {
@@ -258,12 +300,6 @@ func (server *Server) doPcapSearch(ctx *gin.Context, params PcapSearchParams) {
 		}
 
 		if params.Performance {
-			metrics := map[string]interface{}{
-				"prepare":  searchStartTime.Sub(requestStartTime).String(),
-				"engine":   transferStartTime.Sub(searchStartTime).String(),
-				"transfer": transferStopTime.Sub(transferStartTime).String(),
-				"total":    transferStopTime.Sub(requestStartTime).String(),
-			}
 			res.Stat.AddPerfStat("rest-search", metrics)
 		}
 
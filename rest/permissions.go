@@ -0,0 +1,103 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// default permissions (if authorizer is not prepared)
+var defaultAuthorizer, _ = auth.NewAuthorizer(auth.PermissionsConfig{})
+
+// get role permissions checker
+func (server *Server) getAuthorizer() *auth.Authorizer {
+	if server.Authorizer != nil {
+		return server.Authorizer
+	}
+
+	return defaultAuthorizer
+}
+
+// check user has the "admin" permission
+// (no authentication - full access)
+func (server *Server) isAdmin(user *auth.UserInfo) bool {
+	return server.getAuthorizer().IsAdmin(user)
+}
+
+// RequirePermission is a route middleware:
+// checks authenticated user has all the permissions
+func (server *Server) RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user := getAuthUser(ctx)
+		for _, perm := range perms {
+			if !server.getAuthorizer().Check(user, perm) {
+				err := NewError(http.StatusForbidden,
+					fmt.Sprintf("%q permission required", perm))
+				log.WithField("user", user).WithField("path", ctx.Request.URL.Path).
+					Warnf("[%s]: access denied: %s", CORE, err)
+				ctx.IndentedJSON(err.Status, err)
+				ctx.Abort()
+				return
+			}
+		}
+	}
+}
+
+// check authenticated user has the permission on all the paths (relative to home)
+func (server *Server) checkPathPermission(ctx *gin.Context, perm string, paths ...string) {
+	user := getAuthUser(ctx)
+	for _, path := range paths {
+		if len(path) != 0 && !server.getAuthorizer().CheckPath(user, perm, path) {
+			panic(NewError(http.StatusForbidden,
+				fmt.Sprintf("%q permission required for %q", perm, path)))
+		}
+	}
+}
+
+// check authenticated user can write the search outputs (DATA, INDEX, VIEW files)
+func (server *Server) checkOutputPermission(ctx *gin.Context, paths ...string) {
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+
+		if !server.getAuthorizer().Check(getAuthUser(ctx), auth.PermFilesWrite) {
+			panic(NewError(http.StatusForbidden,
+				fmt.Sprintf("%q permission required", auth.PermFilesWrite)))
+		}
+
+		server.checkPathPermission(ctx, auth.PermFilesWrite, paths...)
+		return
+	}
+}
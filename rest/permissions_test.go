@@ -0,0 +1,114 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// test route and path permissions
+func TestPermissions(t *testing.T) {
+	s := NewServer()
+	var err error
+	s.Authorizer, err = auth.NewAuthorizer(auth.PermissionsConfig{
+		Roles: map[string][]string{
+			"analyst": {auth.PermSearch, auth.PermFilesRead},
+			"user":    {auth.PermAll},
+		},
+		Paths: []auth.PathRule{
+			{Prefix: "/shared", Allow: []string{auth.PermFilesRead}},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	check := func(user *auth.UserInfo, perm string, path string, expected int) {
+		router := gin.New()
+		router.Use(func(ctx *gin.Context) {
+			if user != nil {
+				ctx.Set(gin.AuthUserKey, user)
+			}
+		})
+		router.DELETE("/files", s.RequirePermission(perm), func(ctx *gin.Context) {
+			defer RecoverFromPanic(ctx)
+			s.checkPathPermission(ctx, perm, path)
+			ctx.String(http.StatusOK, "OK")
+		})
+
+		req, _ := http.NewRequest("DELETE", "/files", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expected, w.Code, "%v %s %s", user, perm, path)
+	}
+
+	analyst := &auth.UserInfo{Name: "a", Roles: []string{"analyst"}}
+	user := &auth.UserInfo{Name: "u", Roles: []string{"user"}}
+
+	check(nil, auth.PermFilesDelete, "/shared/a.txt", http.StatusOK)
+	check(analyst, auth.PermFilesDelete, "a.txt", http.StatusForbidden)
+	check(analyst, auth.PermFilesRead, "/shared/a.txt", http.StatusOK)
+	check(user, auth.PermFilesDelete, "a.txt", http.StatusOK)
+	check(user, auth.PermFilesDelete, "/shared/a.txt", http.StatusForbidden)
+	check(user, auth.PermFilesDelete, "*", http.StatusForbidden)
+	check(user, auth.PermAdmin, "", http.StatusForbidden)
+
+	// search outputs
+	checkOutput := func(user *auth.UserInfo, path string, expected int) {
+		router := gin.New()
+		router.Use(func(ctx *gin.Context) {
+			ctx.Set(gin.AuthUserKey, user)
+		})
+		router.GET("/search", func(ctx *gin.Context) {
+			defer RecoverFromPanic(ctx)
+			s.checkOutputPermission(ctx, "", path)
+			ctx.String(http.StatusOK, "OK")
+		})
+
+		req, _ := http.NewRequest("GET", "/search", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expected, w.Code, "%v %s", user, path)
+	}
+
+	checkOutput(analyst, "", http.StatusOK)
+	checkOutput(analyst, "out.dat", http.StatusForbidden)
+	checkOutput(user, "out.dat", http.StatusOK)
+	checkOutput(user, "/shared/out.dat", http.StatusForbidden)
+
+	assert.False(t, s.isAdmin(user))
+	assert.True(t, s.isAdmin(nil))
+	assert.True(t, NewServer().isAdmin(&auth.UserInfo{Roles: []string{auth.AdminRole}}))
+}
@@ -0,0 +1,481 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// QuotaUsage contains storage usage of the user's home directory.
+type QuotaUsage struct {
+	Quota    int64 `json:"quota" msgpack:"quota"`                           // storage quota in bytes, zero means unlimited
+	Used     int64 `json:"used" msgpack:"used"`                             // bytes used
+	Required int64 `json:"required,omitempty" msgpack:"required,omitempty"` // bytes required by request
+}
+
+// UserUsage contains detailed storage usage (GET /user/usage).
+type UserUsage struct {
+	QuotaUsage
+
+	User string `json:"user,omitempty"`
+	Home string `json:"home,omitempty"`
+	Host string `json:"host,omitempty"`
+
+	Categories  map[string]int64 `json:"categories"`  // bytes by category: uploads, catalogs, results
+	Directories map[string]int64 `json:"directories"` // bytes by directory (recursive)
+}
+
+// usage categories
+const (
+	usageUploads  = "uploads"
+	usageCatalogs = "catalogs"
+	usageResults  = "results"
+)
+
+// parse storage quotas from configuration
+func (s *Server) parseQuotas() error {
+	if len(s.Config.Quotas.Default) != 0 {
+		q, err := utils.ParseDataSize(s.Config.Quotas.Default)
+		if err != nil {
+			return fmt.Errorf("failed to parse default storage quota: %s", err)
+		}
+		s.Config.Quotas.defaultQuota = int64(q)
+	}
+
+	s.Config.Quotas.roleQuotas = make(map[string]int64)
+	for role, quota := range s.Config.Quotas.Roles {
+		q, err := utils.ParseDataSize(quota)
+		if err != nil {
+			return fmt.Errorf("failed to parse %q storage quota: %s", role, err)
+		}
+		s.Config.Quotas.roleQuotas[role] = int64(q)
+	}
+
+	s.usage.timeout = s.Config.Quotas.UsageCacheTime
+	return nil // OK
+}
+
+// get the storage quota of user (zero means unlimited).
+// user's own quota has the highest priority, then the largest
+// quota of user's roles is used, then the default quota.
+func (s *Server) getUserQuota(user *auth.UserInfo) (int64, error) {
+	if user != nil {
+		if len(user.Quota) != 0 {
+			q, err := utils.ParseDataSize(user.Quota)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse user's storage quota: %s", err)
+			}
+			return int64(q), nil
+		}
+
+		found := false
+		var res int64
+		for _, role := range user.Roles {
+			if q, ok := s.Config.Quotas.roleQuotas[role]; ok {
+				if q == 0 {
+					return 0, nil // unlimited role
+				}
+				if q > res {
+					res = q
+				}
+				found = true
+			}
+		}
+		if found {
+			return res, nil
+		}
+	}
+
+	return s.Config.Quotas.defaultQuota, nil
+}
+
+// get authenticated user from context (might be nil)
+func getAuthUser(ctx *gin.Context) *auth.UserInfo {
+	if v, exists := ctx.Get(gin.AuthUserKey); exists && v != nil {
+		if user, ok := v.(*auth.UserInfo); ok {
+			return user
+		}
+	}
+
+	return nil // no user
+}
+
+// cached storage usage of home directories.
+// the usage is re-calculated once in a while,
+// the bytes written in between are added to the cached value.
+type usageCache struct {
+	lock    sync.Mutex
+	entries map[string]*usageEntry // home -> usage
+	timeout time.Duration          // how long the calculated usage is valid
+	now     func() time.Time
+}
+
+// cached usage of one home directory
+type usageEntry struct {
+	used    int64
+	updated time.Time
+}
+
+// create new usage cache
+func newUsageCache(timeout time.Duration) *usageCache {
+	return &usageCache{
+		entries: make(map[string]*usageEntry),
+		timeout: timeout,
+		now:     time.Now,
+	}
+}
+
+// get storage usage of the home directory.
+// the home is walked only if the cached usage is expired.
+func (c *usageCache) get(home string) (int64, error) {
+	c.lock.Lock()
+	e, ok := c.entries[home]
+	if ok && c.now().Sub(e.updated) < c.timeout {
+		used := e.used
+		c.lock.Unlock()
+		return used, nil // cached
+	}
+	c.lock.Unlock()
+
+	// do not hold the lock while walking
+	updated := c.now()
+	used, err := utils.GetDiskUsage(home)
+	if err != nil {
+		return 0, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[home] = &usageEntry{used: used, updated: updated}
+	return used, nil // OK
+}
+
+// add the bytes written to the cached usage (if any)
+func (c *usageCache) add(home string, n int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.entries[home]; ok {
+		e.used += n
+	}
+}
+
+// forget the cached usage, the home will be walked again
+func (c *usageCache) reset(home string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, home)
+}
+
+// storage quota checker
+// nil checker means no quota
+type quotaChecker struct {
+	QuotaUsage
+	exceeded bool
+
+	usage *usageCache // to report the bytes written
+	home  string
+}
+
+// get the quota checker of the authenticated user,
+// `home` is the full path to the user's home directory.
+func (s *Server) getQuotaChecker(ctx *gin.Context, home string) *quotaChecker {
+	quota, err := s.getUserQuota(getAuthUser(ctx))
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get storage quota"))
+	}
+	if quota == 0 {
+		return nil // no quota
+	}
+
+	used, err := s.usage.get(home)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get storage usage"))
+	}
+
+	q := new(quotaChecker)
+	q.Quota = quota
+	q.Used = used
+	q.usage = s.usage
+	q.home = home
+	return q
+}
+
+// check the required number of bytes (negative if unknown)
+func (q *quotaChecker) check(required int64) error {
+	if q == nil {
+		return nil // no quota
+	}
+
+	if required < 0 {
+		required = 0
+	}
+	if q.Used+required > q.Quota || (required == 0 && q.Used >= q.Quota) {
+		q.Required = required
+		q.exceeded = true
+		return q.error()
+	}
+
+	return nil // OK
+}
+
+// wrap reader to count the bytes written
+func (q *quotaChecker) reader(r io.Reader) io.Reader {
+	if q == nil {
+		return r // no quota
+	}
+
+	return &quotaReader{r: r, q: q}
+}
+
+// is storage quota exceeded?
+func (q *quotaChecker) isExceeded() bool {
+	return q != nil && q.exceeded
+}
+
+// get HTTP error with usage details
+func (q *quotaChecker) error() *Error {
+	usage := q.QuotaUsage // copy
+	return NewError(http.StatusInsufficientStorage, "storage quota exceeded").
+		WithDetails(fmt.Sprintf("%d of %d bytes used", q.Used, q.Quota)).
+		WithUsage(&usage)
+}
+
+// reader that stops when storage quota is exceeded
+type quotaReader struct {
+	r io.Reader
+	q *quotaChecker
+}
+
+// read data
+func (qr *quotaReader) Read(buf []byte) (int, error) {
+	n, err := qr.r.Read(buf)
+	qr.q.Used += int64(n)
+	if qr.q.usage != nil {
+		qr.q.usage.add(qr.q.home, int64(n))
+	}
+	if qr.q.Used > qr.q.Quota {
+		qr.q.exceeded = true
+		return n, qr.q.error()
+	}
+
+	return n, err
+}
+
+// check storage quota for kept search results (INDEX, DATA, VIEW)
+// and remember them to report usage later
+func (s *Server) prepareKeptResults(ctx *gin.Context, homeDir string, cfg *search.Config) {
+	kept := make([]string, 0, 3)
+	for _, name := range []string{cfg.KeepIndexAs, cfg.KeepDataAs, cfg.KeepViewAs} {
+		if len(name) != 0 {
+			kept = append(kept, name)
+		}
+	}
+	if len(kept) == 0 {
+		return // nothing to do
+	}
+
+	mountPoint, err := s.getMountPoint()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get mount point"))
+	}
+	home := filepath.Join(mountPoint, homeDir)
+
+	// no output allowed if storage quota is already exceeded
+	quota := s.getQuotaChecker(ctx, home)
+	if err := quota.check(0); err != nil {
+		panic(err)
+	}
+	if quota != nil {
+		cfg.StorageQuota = quota.Quota
+	}
+
+	for i, name := range kept {
+		path := filepath.Join(home, name)
+		if name == cfg.KeepIndexAs && filepath.Ext(path) != ".txt" {
+			path += ".txt" // see ryftprim
+		}
+		kept[i] = path
+	}
+	if err := s.settings.AddResults(kept); err != nil {
+		log.WithError(err).Warnf("[%s]: failed to remember kept results", CORE)
+	}
+}
+
+// get the instance name (directory with temporary search results)
+func (s *Server) getInstanceName() string {
+	if name, err := utils.AsString(s.Config.BackendOptions["instance-name"]); err == nil && len(name) != 0 {
+		return name
+	}
+
+	return fmt.Sprintf(".rest-%d", s.listenAddress.Port)
+}
+
+// get detailed storage usage of the home directory
+func (s *Server) getUserUsage(home string) (*UserUsage, error) {
+	results, err := s.settings.GetResults(home)
+	if err != nil {
+		return nil, err
+	}
+	instance := filepath.Join(home, s.getInstanceName())
+
+	res := &UserUsage{
+		Categories: map[string]int64{
+			usageUploads:  0,
+			usageCatalogs: 0,
+			usageResults:  0,
+		},
+		Directories: make(map[string]int64),
+	}
+
+	// check the file is a catalog or catalog's internal file
+	isCatalog := func(path string) bool {
+		dir, name := filepath.Split(path)
+		name = strings.TrimSuffix(strings.TrimSuffix(name, "-shm"), "-wal")
+		info, err := os.Stat(filepath.Join(dir, fmt.Sprintf(".%s.catalog", name)))
+		return err == nil && info.IsDir()
+	}
+
+	// check the directory is a catalog's data directory
+	isCatalogData := func(path string) bool {
+		dir, name := filepath.Split(path)
+		if !strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".catalog") {
+			return false
+		}
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "."), ".catalog")
+		info, err := os.Stat(filepath.Join(dir, name))
+		return err == nil && info.Mode().IsRegular()
+	}
+
+	catalogData := make(map[string]bool) // catalog's data directories
+	err = filepath.Walk(home, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // ignore removed files
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(home, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if isCatalogData(path) || catalogData[filepath.Dir(path)] {
+				catalogData[path] = true
+			} else if !strings.HasPrefix(info.Name(), ".") || path == home {
+				res.Directories[rel] = 0
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil // skip links, etc.
+		}
+
+		// get the category
+		size := info.Size()
+		switch {
+		case results[path] || search.IsRelativeToHome(instance, path):
+			res.Categories[usageResults] += size
+		case catalogData[filepath.Dir(path)] || isCatalog(path):
+			res.Categories[usageCatalogs] += size
+		default:
+			res.Categories[usageUploads] += size
+		}
+		res.Used += size
+
+		// update all parent directories
+		for dir := filepath.Dir(rel); ; dir = filepath.Dir(dir) {
+			if _, ok := res.Directories[dir]; ok {
+				res.Directories[dir] += size
+			}
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+
+		return nil // OK
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil // OK
+}
+
+// Handle GET /user/usage endpoint - get storage usage
+/* to test method:
+curl -s "http://localhost:8765/user/usage" | jq .
+*/
+func (server *Server) DoUserUsage(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	user := getAuthUser(ctx)
+	userName, _, homeDir, _ := server.parseAuthAndHome(ctx)
+	mountPoint, err := server.getMountPoint()
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get mount point"))
+	}
+
+	quota, err := server.getUserQuota(user)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get storage quota"))
+	}
+
+	res, err := server.getUserUsage(filepath.Join(mountPoint, homeDir))
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get storage usage"))
+	}
+	res.Quota = quota
+	res.User = userName
+	res.Home = homeDir
+	res.Host = server.Config.HostName
+
+	ctx.JSON(http.StatusOK, res)
+}
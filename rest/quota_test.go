@@ -0,0 +1,230 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// test effective user quota
+func TestUserQuota(t *testing.T) {
+	s := NewServer()
+	s.Config.Quotas.Default = "1KB"
+	s.Config.Quotas.Roles = map[string]string{
+		"user":  "1MB",
+		"power": "10MB",
+		"admin": "0",
+	}
+	if !assert.NoError(t, s.parseQuotas()) {
+		return
+	}
+
+	check := func(user *auth.UserInfo, expected int64) {
+		q, err := s.getUserQuota(user)
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, expected, q)
+		}
+	}
+
+	check(nil, 1024)
+	check(&auth.UserInfo{Name: "foo"}, 1024)
+	check(&auth.UserInfo{Name: "foo", Roles: []string{"guest"}}, 1024)
+	check(&auth.UserInfo{Name: "foo", Roles: []string{"user"}}, 1024*1024)
+	check(&auth.UserInfo{Name: "foo", Roles: []string{"user", "power"}}, 10*1024*1024)
+	check(&auth.UserInfo{Name: "foo", Roles: []string{"user", "admin"}}, 0)
+	check(&auth.UserInfo{Name: "foo", Roles: []string{"admin"}, Quota: "2KB"}, 2048)
+
+	_, err := s.getUserQuota(&auth.UserInfo{Name: "foo", Quota: "bad"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to parse user's storage quota")
+	}
+
+	s.Config.Quotas.Default = "bad"
+	assert.Error(t, s.parseQuotas())
+}
+
+// test quota checker
+func TestQuotaChecker(t *testing.T) {
+	// no quota
+	var q *quotaChecker
+	assert.NoError(t, q.check(1000000))
+	assert.False(t, q.isExceeded())
+
+	q = new(quotaChecker)
+	q.Quota = 100
+	q.Used = 90
+
+	assert.NoError(t, q.check(10))
+	assert.NoError(t, q.check(-1))
+	assert.False(t, q.isExceeded())
+
+	// read a bit
+	data, err := ioutil.ReadAll(q.reader(bytes.NewBufferString("12345")))
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, "12345", string(data))
+		assert.EqualValues(t, 95, q.Used)
+	}
+
+	// read too much
+	_, err = ioutil.ReadAll(q.reader(bytes.NewBufferString("1234567890")))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "507 storage quota exceeded")
+		assert.True(t, q.isExceeded())
+	}
+
+	q.Used = 100
+	err = q.check(-1)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "100 of 100 bytes used")
+	}
+}
+
+// test usage cache
+func TestUsageCache(t *testing.T) {
+	home, err := ioutil.TempDir("", "usage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(home)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, "1.txt"), []byte("hello"), 0644))
+
+	now := time.Now()
+	c := newUsageCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	check := func(expected int64) {
+		used, err := c.get(home)
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, expected, used)
+		}
+	}
+
+	check(5)
+	c.add(home, 10) // bytes written
+	check(15)
+
+	// not walked until expired
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, "2.txt"), []byte("world!"), 0644))
+	check(15)
+	now = now.Add(time.Minute)
+	check(11)
+
+	// reset
+	assert.NoError(t, os.Remove(filepath.Join(home, "1.txt")))
+	check(11)
+	c.reset(home)
+	check(6)
+
+	// nothing cached
+	c.add("/missing", 100)
+	used, err := c.get("/missing")
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 0, used)
+	}
+}
+
+// POST /files with quota and GET /user/usage
+func TestUserUsage(t *testing.T) {
+	fs := newFake()
+	defer fs.cleanup()
+
+	go func() {
+		err := fs.worker.ListenAndServe()
+		assert.NoError(t, err, "failed to serve fake server")
+	}()
+	time.Sleep(testServerStartTO) // wait a bit until server is started
+	defer func() {
+		fs.worker.Stop(testServerStopTO)
+		<-fs.worker.StopChan()
+	}()
+
+	used, err := utils.GetDiskUsage(fs.homeDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// allow just 10 more bytes
+	fs.server.Config.Quotas.Default = fmt.Sprintf("%d", used+10)
+	if !assert.NoError(t, fs.server.parseQuotas()) {
+		return
+	}
+
+	TO := 30 * time.Second
+
+	// fits the quota
+	_, status, err := fs.POST("/files?file=ok.txt", "", "application/octet-stream", "12345", TO)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, http.StatusOK, status)
+	}
+
+	// too big
+	body, status, err := fs.POST("/files?file=big.txt", "", "application/octet-stream", "1234567890", TO)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, http.StatusInsufficientStorage, status)
+		assert.Contains(t, string(body), "storage quota exceeded")
+		assert.Contains(t, string(body), fmt.Sprintf(`"quota": %d`, used+10))
+		assert.Contains(t, string(body), fmt.Sprintf(`"used": %d`, used+5))
+		assert.Contains(t, string(body), `"required": 10`)
+	}
+
+	// too big for catalog
+	_, status, err = fs.POST("/files?catalog=catalog.test&file=big.txt", "", "application/octet-stream", "1234567890", TO)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, http.StatusInsufficientStorage, status)
+	}
+
+	// usage report
+	body, status, err = fs.GET("/user/usage", "", TO)
+	if assert.NoError(t, err) && assert.EqualValues(t, http.StatusOK, status) {
+		var usage UserUsage
+		if assert.NoError(t, json.Unmarshal(body, &usage)) {
+			assert.EqualValues(t, used+10, usage.Quota)
+			assert.EqualValues(t, used+5, usage.Used)
+			assert.EqualValues(t, used+5, usage.Directories["."])
+			assert.NotZero(t, usage.Directories["foo"])
+			assert.NotZero(t, usage.Categories[usageUploads])
+			assert.NotZero(t, usage.Categories[usageCatalogs])
+			assert.EqualValues(t, usage.Used, usage.Categories[usageUploads]+
+				usage.Categories[usageCatalogs]+usage.Categories[usageResults])
+		}
+	}
+}
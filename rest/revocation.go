@@ -0,0 +1,157 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	consul "github.com/hashicorp/consul/api"
+)
+
+// revocation keys in consul KV
+const (
+	revokedTokensPrefix = "revoked/tokens/"
+	revokedUsersPrefix  = "revoked/users/"
+)
+
+// clusterRevocationStore keeps revoked JWT tokens in the server settings
+// and shares them via consul KV, so the nodes started (or joined) later
+// get all the revocations too.
+type clusterRevocationStore struct {
+	auth.RevocationStore // local store
+
+	server *Server
+}
+
+// GetRevocationStore gets the store of revoked JWT tokens.
+func (server *Server) GetRevocationStore() auth.RevocationStore {
+	if server.Config.LocalOnly {
+		return server.GetSettings()
+	}
+
+	return &clusterRevocationStore{
+		RevocationStore: server.GetSettings(),
+		server:          server,
+	}
+}
+
+// RevokeToken saves the revoked token.
+func (s *clusterRevocationStore) RevokeToken(id string, user string, expires time.Time) error {
+	if err := s.RevocationStore.RevokeToken(id, user, expires); err != nil {
+		return err
+	}
+
+	s.share(revokedTokensPrefix+url.QueryEscape(id), expires)
+	return nil // OK
+}
+
+// RevokeUserTokens saves the revoked user.
+func (s *clusterRevocationStore) RevokeUserTokens(user string, before time.Time) error {
+	if err := s.RevocationStore.RevokeUserTokens(user, before); err != nil {
+		return err
+	}
+
+	s.share(revokedUsersPrefix+url.QueryEscape(user), before)
+	return nil // OK
+}
+
+// GetRevocations gets both local and shared revocations.
+// The local revocations are enough if consul is not available.
+func (s *clusterRevocationStore) GetRevocations(now time.Time) (map[string]time.Time, map[string]time.Time, error) {
+	tokens, users, err := s.RevocationStore.GetRevocations(now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := s.server.getConsulClient()
+	if err == nil {
+		err = getSharedRevocations(client, now, tokens, users)
+	}
+	if err != nil {
+		log.WithError(err).Warnf("[%s/auth]: failed to get shared revocations", CORE)
+	}
+
+	return tokens, users, nil // OK
+}
+
+// save the revocation to consul KV
+// the revocation is already saved locally, so errors are just logged
+func (s *clusterRevocationStore) share(key string, when time.Time) {
+	client, err := s.server.getConsulClient()
+	if err == nil {
+		pair := new(consul.KVPair)
+		pair.Key = key
+		pair.Value = []byte(when.UTC().Format(time.RFC3339))
+		_, err = client.KV().Put(pair, nil)
+	}
+	if err != nil {
+		log.WithError(err).WithField("key", key).
+			Warnf("[%s/auth]: failed to share revocation", CORE)
+	}
+}
+
+// get revocations from consul KV, expired tokens are removed
+func getSharedRevocations(client *consul.Client, now time.Time, tokens, users map[string]time.Time) error {
+	pairs, _, err := client.KV().List("revoked/", nil)
+	if err != nil {
+		return err
+	}
+
+	for _, kvp := range pairs {
+		when, err := time.Parse(time.RFC3339, string(kvp.Value))
+		if err != nil {
+			continue // ignore bad values
+		}
+
+		switch {
+		case strings.HasPrefix(kvp.Key, revokedTokensPrefix):
+			if now.After(when) {
+				client.KV().Delete(kvp.Key, nil) // expired
+				continue
+			}
+			id, _ := url.QueryUnescape(strings.TrimPrefix(kvp.Key, revokedTokensPrefix))
+			if when.After(tokens[id]) {
+				tokens[id] = when
+			}
+
+		case strings.HasPrefix(kvp.Key, revokedUsersPrefix):
+			user, _ := url.QueryUnescape(strings.TrimPrefix(kvp.Key, revokedUsersPrefix))
+			if when.After(users[user]) {
+				users[user] = when
+			}
+		}
+	}
+
+	return nil // OK
+}
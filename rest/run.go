@@ -73,6 +73,10 @@ func (server *Server) DoRun(ctx *gin.Context) {
 			WithDetails("failed to get ryftone mount point"))
 	}
 
+	auditDetail(ctx, "image", params.Image)
+	auditDetail(ctx, "command", params.Command)
+	auditDetail(ctx, "args", params.Args)
+
 	// build executable command
 	var args []string
 	if image, ok := server.Config.Docker.Images[params.Image]; !ok {
@@ -0,0 +1,102 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/getryft/ryft-server/search/utils/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// prepare admission control of backend executions
+func (s *Server) prepareScheduler() error {
+	if !scheduler.IsValidPriority(s.Config.Scheduler.DefaultPriority) {
+		return fmt.Errorf("unknown default priority: %q", s.Config.Scheduler.DefaultPriority)
+	}
+	for role, priority := range s.Config.Scheduler.Roles {
+		if !scheduler.IsValidPriority(priority) {
+			return fmt.Errorf("unknown %q role priority: %q", role, priority)
+		}
+	}
+	for backend, n := range s.Config.Scheduler.MaxRuns {
+		if n < 0 {
+			return fmt.Errorf("%q maximum runs cannot be negative", backend)
+		}
+	}
+
+	if len(s.Config.Scheduler.MaxRuns) != 0 || s.Config.Scheduler.DefaultMaxRuns > 0 {
+		scheduler.SetDefault(scheduler.New(s.Config.Scheduler.MaxRuns,
+			s.Config.Scheduler.DefaultMaxRuns, s.Config.Scheduler.QueueTimeout))
+	} else {
+		scheduler.SetDefault(nil) // disabled
+	}
+
+	return nil // OK
+}
+
+// get priority class of the search request.
+// user's roles define the highest priority allowed,
+// requested priority can only lower it.
+func (s *Server) getPriority(ctx *gin.Context, requested string) string {
+	if len(requested) != 0 && !scheduler.IsValidPriority(requested) {
+		panic(NewError(http.StatusBadRequest, fmt.Sprintf("unknown priority: %q", requested)).
+			WithDetails("failed to get search priority"))
+	}
+
+	allowed := s.Config.Scheduler.DefaultPriority
+	if user := getAuthUser(ctx); user != nil {
+		found := false
+		for _, role := range user.Roles {
+			if p, ok := s.Config.Scheduler.Roles[role]; ok {
+				if !found || p == scheduler.PriorityInteractive {
+					allowed = p
+				}
+				found = true
+			}
+		}
+	}
+
+	if requested == scheduler.PriorityBatch {
+		return requested
+	}
+
+	return allowed
+}
+
+// report 503 Service Unavailable if backend execution was not admitted in time
+func checkQueueTimeout(ctx *gin.Context, err error) {
+	if qerr, ok := scheduler.IsTimeout(err); ok {
+		ctx.Header("Retry-After", fmt.Sprintf("%d", int64(qerr.RetryAfter.Seconds())))
+		panic(NewError(http.StatusServiceUnavailable, err.Error()).
+			WithDetails("search queue is full"))
+	}
+}
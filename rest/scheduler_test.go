@@ -0,0 +1,111 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search/utils/scheduler"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// test search priority of users
+func TestSearchPriority(t *testing.T) {
+	s := NewServer()
+	s.Config.Scheduler.Roles = map[string]string{
+		"analyst": scheduler.PriorityInteractive,
+		"robot":   scheduler.PriorityBatch,
+	}
+	s.Config.Scheduler.DefaultPriority = scheduler.PriorityBatch
+	if !assert.NoError(t, s.prepareScheduler()) {
+		return
+	}
+
+	check := func(user *auth.UserInfo, requested string, expected string) {
+		router := gin.New()
+		router.GET("/", func(ctx *gin.Context) {
+			defer RecoverFromPanic(ctx)
+			if user != nil {
+				ctx.Set(gin.AuthUserKey, user)
+			}
+			ctx.String(http.StatusOK, s.getPriority(ctx, requested))
+		})
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if len(expected) != 0 {
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, expected, w.Body.String())
+		} else {
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	analyst := &auth.UserInfo{Name: "a", Roles: []string{"robot", "analyst"}}
+	robot := &auth.UserInfo{Name: "r", Roles: []string{"robot"}}
+	other := &auth.UserInfo{Name: "o", Roles: []string{"user"}}
+
+	check(nil, "", scheduler.PriorityBatch)
+	check(analyst, "", scheduler.PriorityInteractive)
+	check(analyst, "batch", scheduler.PriorityBatch)
+	check(robot, "interactive", scheduler.PriorityBatch)
+	check(other, "", scheduler.PriorityBatch)
+	check(other, "urgent", "")
+
+	// bad configuration
+	s.Config.Scheduler.Roles["robot"] = "urgent"
+	assert.Error(t, s.prepareScheduler())
+}
+
+// test 503 is reported on queue timeout
+func TestQueueTimeout(t *testing.T) {
+	router := gin.New()
+	router.GET("/", func(ctx *gin.Context) {
+		defer RecoverFromPanic(ctx)
+		checkQueueTimeout(ctx, &scheduler.TimeoutError{
+			Backend:    "ryftprim",
+			Position:   3,
+			RetryAfter: 5 * time.Second,
+		})
+		ctx.String(http.StatusOK, "OK")
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "queue timeout")
+}
@@ -100,15 +100,18 @@ type SearchParams struct {
 	Format string `form:"format" json:"format,omitempty" msgpack:"format,omitempty"`
 	Fields string `form:"fields" json:"fields,omitempty" msgpack:"fields,omitempty"` // for XML and JSON formats
 	// job information for post-processing cmds
-	JobID  		string 			`form:"jobid" json:"jobid,omitempty" msgpack:"jobid,omitempty"`
-	JobType 	string 			`form:"jobtype" json:"jobtype,omitempty" msgpack:"jobtype,omitempty"`
+	JobID     string `form:"jobid" json:"jobid,omitempty" msgpack:"jobid,omitempty"`
+	JobType   string `form:"jobtype" json:"jobtype,omitempty" msgpack:"jobtype,omitempty"`
+	RequestID string `form:"request-id" json:"request-id,omitempty" msgpack:"request-id,omitempty"` // assigned by the coordinator
+	Priority  string `form:"priority" json:"priority,omitempty" msgpack:"priority,omitempty"`       // "interactive" or "batch"
 
 	Stats  bool   `form:"stats" json:"stats,omitempty" msgpack:"stats,omitempty"`    // include statistics
 	Stream bool   `form:"stream" json:"stream,omitempty" msgpack:"stream,omitempty"`
 
-	Local       bool   `form:"local" json:"local,omitempty" msgpack:"local,omitempty"`
-	ShareMode   string `form:"share-mode" json:"share-mode,omitempty" msgpack:"share-mode,omitempty"` // share mode to use
-	Performance bool   `form:"performance" json:"performance,omitempty" msgpack:"performance,omitempty"`
+	Local       bool     `form:"local" json:"local,omitempty" msgpack:"local,omitempty"`
+	Clusters    []string `form:"clusters" json:"clusters,omitempty" msgpack:"clusters,omitempty"`       // federated search
+	ShareMode   string   `form:"share-mode" json:"share-mode,omitempty" msgpack:"share-mode,omitempty"` // share mode to use
+	Performance bool     `form:"performance" json:"performance,omitempty" msgpack:"performance,omitempty"`
 
 	// internal parameters
 	InternalErrorPrefix bool   `form:"--internal-error-prefix" json:"-" msgpack:"-"` // include host prefixes for error messages
@@ -161,6 +164,15 @@ func (server *Server) doSearch(ctx *gin.Context, params SearchParams) {
 			"no file or catalog provided"))
 	}
 
+	// shared workspace files (outputs are written to the workspace)
+	keep := len(params.KeepDataAs) != 0 || len(params.KeepIndexAs) != 0 || len(params.KeepViewAs) != 0
+	params.Files = server.useWorkspace(ctx, params.Local, keep, params.Files...)
+	server.checkOutputPermission(ctx, params.KeepDataAs, params.KeepIndexAs, params.KeepViewAs)
+	if len(params.Clusters) != 0 && getWorkspace(ctx) != nil {
+		panic(NewError(http.StatusBadRequest,
+			"shared workspaces cannot be searched across clusters"))
+	}
+
 	// setting up transcoder to convert raw data
 	// CSV, XML and JSON support additional fields filtration
 	tcode_opts := getFormatOptions(params.Tweaks.Format, params.Fields)
@@ -181,7 +193,7 @@ func (server *Server) doSearch(ctx *gin.Context, params SearchParams) {
 	// we can use two formats:
 	// - single JSON value (not appropriate for large data set)
 	// - with tags to report data records and the statistics in a stream
-	enc, err := codec.NewEncoder(ctx.Writer, accept, params.Stream)
+	enc, err := newEncoder(ctx, accept, params.Stream)
 	if err != nil {
 		panic(NewError(http.StatusBadRequest, err.Error()).
 			WithDetails("failed to get encoder"))
@@ -263,9 +275,23 @@ func (server *Server) doSearch(ctx *gin.Context, params SearchParams) {
 	// get search engine
 	var engine search.Engine
 	userName, authToken, homeDir, userTag := server.parseAuthAndHome(ctx)
+	cfg.User = userName
+	cfg.Priority = server.getPriority(ctx, params.Priority)
 	if /*!server.Config.LocalOnly && !params.Local &&*/ len(params.Tweaks.Cluster) != 0 {
 		log.WithField("config", params.Tweaks.Cluster).Debugf("[%s]: create tweaked search engine", CORE)
 		engine, err = server.getClusterTweakEngine(authToken, homeDir, cfg, params.Tweaks.Cluster)
+	} else if len(params.Clusters) != 0 {
+		var clusters []string
+		if clusters, err = server.parseClusters(params.Clusters); err != nil {
+			panic(NewError(http.StatusBadRequest, err.Error()).
+				WithDetails("failed to parse clusters"))
+		}
+		var remoteTokens map[string]string
+		if remoteTokens, err = server.getRemoteAuthTokens(getAuthUser(ctx), clusters); err != nil {
+			panic(NewError(http.StatusForbidden, err.Error()).
+				WithDetails("failed to access clusters"))
+		}
+		engine, err = server.getFederatedSearchEngine(clusters, remoteTokens, params.Local, params.Files, authToken, homeDir, userTag)
 	} else {
 		engine, err = server.getSearchEngine(params.Local, params.Files, authToken, homeDir, userTag)
 	}
@@ -280,6 +306,18 @@ func (server *Server) doSearch(ctx *gin.Context, params SearchParams) {
 		panic(NewError(http.StatusInternalServerError, err.Error()).
 			WithDetails("failed to create session token"))
 	}
+	if len(params.Clusters) != 0 {
+		session = nil // not supported across clusters
+	}
+
+	// the same request ID is used on all cluster nodes
+	var forwarded bool
+	cfg.RequestID, forwarded = server.getSearchID(ctx, params.RequestID)
+	ctx.Header("X-Request-Id", cfg.RequestID)
+
+	// the trace context is passed to all engines and cluster nodes
+	span := startSearchSpan(ctx, "rest-search", cfg)
+	span.SetAttribute("user", userName)
 
 	log.WithFields(map[string]interface{}{
 		"config":    cfg,
@@ -287,10 +325,19 @@ func (server *Server) doSearch(ctx *gin.Context, params SearchParams) {
 		"home":      homeDir,
 		"cluster":   userTag,
 		"post-proc": cfg.Transforms,
+		"trace":     cfg.TraceID(),
 	}).Infof("[%s]: start GET /search", CORE)
+	// check storage quota before any results are kept
+	server.prepareKeptResults(ctx, homeDir, cfg)
+
+	auditSearch(ctx, cfg, nil)
+
 	searchStartTime := time.Now() // performance metric
 	res, err := engine.Search(cfg)
 	if err != nil {
+		span.SetError(err)
+		span.Finish()
+		checkQueueTimeout(ctx, err)
 		if len(errorPrefix) != 0 {
 			err = fmt.Errorf("[%s]: %s", errorPrefix, err)
 		}
@@ -307,10 +354,25 @@ func (server *Server) doSearch(ctx *gin.Context, params SearchParams) {
 	server.onSearchStarted(cfg)
 	defer server.onSearchStopped(cfg)
 
+	// can be cancelled via DELETE /searches/:id
+	subtask := params.Local && forwarded
+	info := server.registerSearch(cfg, subtask, userName, res)
+	defer server.searches.remove(info)
+
 	// drain all results
 	transferStartTime := time.Now() // performance metric
 	server.drain(ctx, enc, tcode, cfg, res, errorPrefix)
 	transferStopTime := time.Now() // performance metric
+	server.onSearchStat(res.Stat)
+	auditSearch(ctx, cfg, res)
+
+	metrics := map[string]interface{}{
+		"prepare":  searchStartTime.Sub(requestStartTime).String(),
+		"engine":   transferStartTime.Sub(searchStartTime).String(),
+		"transfer": transferStopTime.Sub(transferStartTime).String(),
+		"total":    transferStopTime.Sub(requestStartTime).String(),
+	}
+	finishSearchSpan(span, res, metrics)
 
 	// If post processing executable, do now
 	if len(cfg.JobID) > 0  {
@@ -350,12 +412,6 @@ func (server *Server) doSearch(ctx *gin.Context, params SearchParams) {
 		}
 
 		if params.Performance {
-			metrics := map[string]interface{}{
-				"prepare":  searchStartTime.Sub(requestStartTime).String(),
-				"engine":   transferStartTime.Sub(searchStartTime).String(),
-				"transfer": transferStopTime.Sub(transferStartTime).String(),
-				"total":    transferStopTime.Sub(requestStartTime).String(),
-			}
 			res.Stat.AddPerfStat("rest-search", metrics)
 		}
 
@@ -395,6 +451,7 @@ func (server *Server) drain(ctx *gin.Context, enc codec.Encoder, tcode format.Fo
 	cfg *search.Config, res *search.Result, errorPrefix string) {
 	// ctx.Stream() logic
 	var lastError error
+	var lastCause error // without prefix
 	var dataF	*os.File
 	var indexF	*os.File
 	var err error
@@ -403,6 +460,8 @@ func (server *Server) drain(ctx *gin.Context, enc codec.Encoder, tcode format.Fo
 
 	// put error to stream
 	putErr := func(err_ error) {
+		lastCause = err_
+
 		// to distinguish nodes in cluster mode
 		// mark all errors with a prefix
 		if len(errorPrefix) != 0 {
@@ -511,10 +570,16 @@ func (server *Server) drain(ctx *gin.Context, enc codec.Encoder, tcode format.Fo
 				putErr(err)
 			}
 
+			// cancelled via DELETE /searches/:id
+			if res.IsCancelled() {
+				putErr(fmt.Errorf("search %s is cancelled", cfg.RequestID))
+			}
+
 			// special case: if no records and no stats were received
 			// but just an error, we panic to return 500 status code
 			if res.RecordsReported() == 0 && res.Stat == nil &&
 				res.ErrorsReported() == 1 && lastError != nil {
+				checkQueueTimeout(ctx, lastCause) // 503 if not started in time
 				panic(NewError(http.StatusInternalServerError, lastError.Error()).
 					WithDetails("failed to do search"))
 			}
@@ -0,0 +1,458 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// SearchesParams query parameters for /searches
+type SearchesParams struct {
+	Local bool `form:"local" json:"local"`
+}
+
+// SearchInfo contains information about an active search
+type SearchInfo struct {
+	ID       string   `json:"id"`
+	User     string   `json:"user,omitempty"`
+	Query    string   `json:"query"`
+	Files    []string `json:"files"`
+	Started  string   `json:"started"`  // start time, RFC3339
+	Duration string   `json:"duration"` // processing time so far
+	Records  uint64   `json:"records"`  // records reported so far
+	Bytes    uint64   `json:"bytes"`    // data reported so far
+	Nodes    []string `json:"nodes"`    // nodes involved
+	Subtask  bool     `json:"subtask,omitempty"`
+
+	started time.Time
+	res     *search.Result
+}
+
+// registry key, the subtask shares the coordinator's ID
+type searchKey struct {
+	id      string
+	subtask bool
+}
+
+// registry of active searches
+type searchRegistry struct {
+	sync.Mutex
+	searches map[searchKey]*SearchInfo
+}
+
+// create new search registry
+func newSearchRegistry() *searchRegistry {
+	return &searchRegistry{
+		searches: make(map[searchKey]*SearchInfo),
+	}
+}
+
+// generate new search request ID
+func newSearchID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// add active search
+// returns false if the search ID is already in use
+func (r *searchRegistry) add(info *SearchInfo) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	key := searchKey{id: info.ID, subtask: info.Subtask}
+	if _, ok := r.searches[key]; ok {
+		return false // collision
+	}
+
+	r.searches[key] = info
+	return true // OK
+}
+
+// remove search once it's done
+func (r *searchRegistry) remove(info *SearchInfo) {
+	r.Lock()
+	defer r.Unlock()
+
+	key := searchKey{id: info.ID, subtask: info.Subtask}
+	if r.searches[key] == info {
+		delete(r.searches, key)
+	}
+}
+
+// get active searches visible to the user (sorted by start time)
+// admin (or empty user if authentication is disabled) see all searches
+func (r *searchRegistry) list(user string, admin bool, now time.Time) []SearchInfo {
+	r.Lock()
+	defer r.Unlock()
+
+	res := []SearchInfo{}
+	for _, info := range r.searches {
+		if !admin && info.User != user {
+			continue // not visible
+		}
+
+		c := *info // copy
+		c.Duration = now.Sub(info.started).String()
+		if info.res != nil {
+			c.Records = info.res.RecordsReported()
+			c.Bytes = info.res.BytesReported()
+		}
+		res = append(res, c)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].started.Equal(res[j].started) {
+			return res[i].started.Before(res[j].started)
+		}
+		return res[i].ID < res[j].ID
+	})
+
+	return res
+}
+
+// cancel active search, returns HTTP status
+func (r *searchRegistry) cancel(id string, user string, admin bool) int {
+	r.Lock()
+	info := r.searches[searchKey{id: id}]
+	if info == nil {
+		info = r.searches[searchKey{id: id, subtask: true}]
+	}
+	r.Unlock()
+
+	if info == nil {
+		return http.StatusNotFound
+	}
+	if !admin && info.User != user {
+		return http.StatusForbidden
+	}
+
+	if info.res != nil {
+		info.res.JustCancel()
+	}
+	return http.StatusOK
+}
+
+// merge searches reported by all nodes
+// the same search is reported by each node involved,
+// the coordinator's information is used if present
+func mergeSearches(all []SearchInfo) []SearchInfo {
+	res := []SearchInfo{}
+	byID := make(map[string]int)
+	for _, info := range all {
+		k, ok := byID[info.ID]
+		if !ok {
+			byID[info.ID] = len(res)
+			res = append(res, info)
+			continue
+		}
+
+		nodes := append(append([]string{}, res[k].Nodes...), info.Nodes...)
+		if res[k].Subtask && !info.Subtask {
+			res[k] = info // coordinator
+		}
+		res[k].Nodes = nil
+		for _, node := range nodes {
+			if !hasSomeTag(res[k].Nodes, []string{node}) {
+				res[k].Nodes = append(res[k].Nodes, node)
+			}
+		}
+	}
+
+	for i := range res {
+		sort.Strings(res[i].Nodes)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Started != res[j].Started {
+			return res[i].Started < res[j].Started
+		}
+		return res[i].ID < res[j].ID
+	})
+
+	return res
+}
+
+// get the search request ID
+// the coordinator's ID is accepted from other cluster nodes only,
+// a new ID is generated otherwise
+func (server *Server) getSearchID(ctx *gin.Context, requestID string) (id string, forwarded bool) {
+	if len(requestID) != 0 && server.isInternalRequest(ctx) {
+		return requestID, true
+	}
+
+	return newSearchID(), false
+}
+
+// register a new search
+// subtasks are started by the coordinator and share its request ID
+func (server *Server) registerSearch(cfg *search.Config, subtask bool, userName string, res *search.Result) *SearchInfo {
+	info := &SearchInfo{
+		ID:      cfg.RequestID,
+		User:    userName,
+		Query:   cfg.Query,
+		Files:   cfg.Files,
+		Nodes:   []string{server.Config.HostName},
+		Subtask: subtask,
+		started: time.Now(),
+		res:     res,
+	}
+	info.Started = info.started.UTC().Format(time.RFC3339)
+
+	if !server.searches.add(info) {
+		panic(NewError(http.StatusConflict, cfg.RequestID).
+			WithDetails("search request ID is already in use"))
+	}
+	return info
+}
+
+// GET /searches method
+/* to test method:
+curl -s "http://localhost:8765/searches" | jq .
+*/
+func (server *Server) DoGetSearches(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	var params SearchesParams
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+
+	userName, authToken, _, _ := server.parseAuthAndHome(ctx)
+	admin := server.isAdmin(getAuthUser(ctx))
+	res := server.searches.list(userName, admin, time.Now())
+
+	if !params.Local && !server.Config.LocalOnly {
+		services, _, err := server.getConsulInfo("", nil)
+		if err != nil {
+			panic(NewError(http.StatusInternalServerError, err.Error()).
+				WithDetails("failed to get cluster nodes"))
+		}
+
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		for _, service := range services {
+			if server.isLocalService(service) {
+				continue // already done
+			}
+
+			wg.Add(1)
+			go func(node, address string) {
+				defer wg.Done()
+
+				var infos []SearchInfo
+				status, err := callRemoteSearches("GET", address, authToken, "", &infos)
+				if err == nil && status != http.StatusOK {
+					err = fmt.Errorf("invalid HTTP response status: %d", status)
+				}
+				if err != nil {
+					log.WithError(err).WithField("node", node).Warnf("[%s]: failed to get searches", CORE)
+					return
+				}
+
+				lock.Lock()
+				defer lock.Unlock()
+				res = append(res, infos...)
+			}(service.Node, getServiceUrl(service))
+		}
+		wg.Wait()
+
+		res = mergeSearches(res)
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
+
+// DELETE /searches/:id method
+/* to test method:
+curl -X DELETE -s "http://localhost:8765/searches/0123456789abcdef" | jq .
+*/
+func (server *Server) DoCancelSearch(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	var params SearchesParams
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+
+	id := ctx.Param("id")
+	userName, authToken, _, _ := server.parseAuthAndHome(ctx)
+	admin := server.isAdmin(getAuthUser(ctx))
+
+	log.WithFields(map[string]interface{}{
+		"id":   id,
+		"user": userName,
+	}).Infof("[%s]: cancelling search...", CORE)
+
+	// cancel local search first
+	// it also cancels all remote subtasks (if coordinator)
+	status := server.searches.cancel(id, userName, admin)
+	cancelled := []string{}
+	if status == http.StatusOK {
+		cancelled = append(cancelled, server.Config.HostName)
+	}
+
+	// propagate to all other nodes
+	if !params.Local && !server.Config.LocalOnly {
+		services, _, err := server.getConsulInfo("", nil)
+		if err != nil {
+			panic(NewError(http.StatusInternalServerError, err.Error()).
+				WithDetails("failed to get cluster nodes"))
+		}
+
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		for _, service := range services {
+			if server.isLocalService(service) {
+				continue // already done
+			}
+
+			wg.Add(1)
+			go func(node, address string) {
+				defer wg.Done()
+
+				st, err := callRemoteSearches("DELETE", address, authToken, id, nil)
+				if err != nil {
+					log.WithError(err).WithField("node", node).Warnf("[%s]: failed to cancel search", CORE)
+					return
+				}
+
+				lock.Lock()
+				defer lock.Unlock()
+				switch st {
+				case http.StatusOK:
+					cancelled = append(cancelled, node)
+					status = http.StatusOK
+				case http.StatusForbidden:
+					if status == http.StatusNotFound {
+						status = st
+					}
+				}
+			}(service.Node, getServiceUrl(service))
+		}
+		wg.Wait()
+	}
+
+	switch status {
+	case http.StatusNotFound:
+		panic(NewError(status, fmt.Sprintf("search %q not found", id)))
+	case http.StatusForbidden:
+		panic(NewError(status, fmt.Sprintf("access to search %q denied", id)))
+	}
+
+	sort.Strings(cancelled)
+	ctx.JSON(http.StatusOK, map[string]interface{}{
+		"id":        id,
+		"cancelled": cancelled,
+	})
+}
+
+// call remote /searches endpoint, returns HTTP status
+func callRemoteSearches(method string, address string, authToken string, id string, out interface{}) (int, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse URL: %s", err)
+	}
+	q := url.Values{}
+	q.Set("local", fmt.Sprintf("%t", true))
+	u.RawQuery = q.Encode()
+	u.Path += "/searches"
+	if len(id) != 0 {
+		u.Path += "/" + url.PathEscape(id)
+	}
+
+	// prepare request
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %s", err)
+	}
+
+	// authorization
+	if len(authToken) != 0 {
+		req.Header.Set("Authorization", authToken)
+	}
+
+	// do HTTP request
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send HTTP request: %s", err)
+	}
+
+	defer resp.Body.Close() // close it later
+
+	// check status code
+	switch resp.StatusCode {
+	case http.StatusOK:
+		break // decode below
+
+	case http.StatusNotFound, http.StatusForbidden:
+		return resp.StatusCode, nil
+
+	default:
+		// try to decode error response
+		var errorBody map[string]interface{}
+		dec := json.NewDecoder(resp.Body)
+		if err := dec.Decode(&errorBody); err == nil {
+			if msg, err := utils.AsString(errorBody["message"]); err == nil {
+				return resp.StatusCode, fmt.Errorf("%d: %s", resp.StatusCode, msg)
+			}
+		}
+
+		return resp.StatusCode, fmt.Errorf("invalid HTTP response status: %d (%s)", resp.StatusCode, resp.Status)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode response: %s", err)
+		}
+	}
+
+	return resp.StatusCode, nil // OK
+}
@@ -0,0 +1,191 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// search registry test
+func TestSearchRegistry(t *testing.T) {
+	r := newSearchRegistry()
+	now := time.Now()
+
+	res1 := search.NewResult()
+	res2 := search.NewResult()
+	s1 := &SearchInfo{ID: "1", User: "foo", Query: "hello", started: now, res: res1}
+	s2 := &SearchInfo{ID: "2", User: "bar", Query: "world", started: now.Add(time.Second), res: res2}
+	assert.True(t, r.add(s2))
+	assert.True(t, r.add(s1))
+	assert.False(t, r.add(&SearchInfo{ID: "1", User: "bar"})) // collision
+
+	// admin sees all, others only their own
+	all := r.list("admin", true, now.Add(2*time.Second))
+	if assert.Len(t, all, 2) {
+		assert.Equal(t, "1", all[0].ID)
+		assert.Equal(t, "2s", all[0].Duration)
+		assert.Equal(t, "2", all[1].ID)
+	}
+	own := r.list("bar", false, now)
+	if assert.Len(t, own, 1) {
+		assert.Equal(t, "2", own[0].ID)
+	}
+	assert.Empty(t, r.list("baz", false, now))
+
+	// progress
+	go res1.ReportRecord(search.NewRecord(nil, []byte("hello")))
+	<-res1.RecordChan
+	all = r.list("", true, now)
+	assert.EqualValues(t, 1, all[0].Records)
+	assert.EqualValues(t, 5, all[0].Bytes)
+
+	// cancel
+	assert.Equal(t, http.StatusNotFound, r.cancel("3", "foo", false))
+	assert.Equal(t, http.StatusForbidden, r.cancel("2", "foo", false))
+	assert.False(t, res2.IsCancelled())
+	assert.Equal(t, http.StatusOK, r.cancel("1", "foo", false))
+	assert.True(t, res1.IsCancelled())
+	assert.Equal(t, http.StatusOK, r.cancel("2", "admin", true))
+	assert.True(t, res2.IsCancelled())
+
+	// subtask shares the coordinator's ID
+	res3 := search.NewResult()
+	s3 := &SearchInfo{ID: "1", User: "foo", Subtask: true, started: now, res: res3}
+	assert.True(t, r.add(s3))
+	assert.Len(t, r.list("", true, now), 3)
+
+	// remove
+	r.remove(&SearchInfo{ID: "1"}) // another search with the same ID
+	assert.Len(t, r.list("", true, now), 3)
+	r.remove(s1)
+	assert.Equal(t, http.StatusOK, r.cancel("1", "foo", false)) // subtask
+	assert.True(t, res3.IsCancelled())
+	r.remove(s3)
+	r.remove(s2)
+	assert.Empty(t, r.list("", true, now))
+}
+
+// search request ID test
+func TestSearchID(t *testing.T) {
+	s := NewServer()
+	var err error
+	s.ClusterAuth, err = auth.NewClusterToken([]byte("secret"), "HS256", time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	check := func(user *auth.UserInfo, authorization string, requestID string, forwarded bool) {
+		router := gin.New()
+		router.GET("/search", func(ctx *gin.Context) {
+			if user != nil {
+				ctx.Set(gin.AuthUserKey, user)
+			}
+			id, ok := s.getSearchID(ctx, requestID)
+			assert.Equal(t, forwarded, ok, "%v %q", user, authorization)
+			if forwarded {
+				assert.Equal(t, requestID, id)
+			} else {
+				assert.NotEqual(t, requestID, id)
+				assert.Len(t, id, 16)
+			}
+		})
+
+		req, _ := http.NewRequest("GET", "/search", nil)
+		req.Header.Set("Authorization", authorization)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	foo := &auth.UserInfo{Name: "foo"}
+	check(nil, "", "abc", true)                    // no authentication
+	check(foo, "Cluster token", "abc", true)       // another cluster node
+	check(foo, "Basic Zm9vOmJhcg==", "abc", false) // client
+	check(foo, "Bearer token", "abc", false)       // client
+	check(foo, "Cluster token", "", false)         // coordinator
+}
+
+// merge cluster searches test
+func TestMergeSearches(t *testing.T) {
+	res := mergeSearches([]SearchInfo{
+		{ID: "b", Started: "2018-01-01T00:00:02Z", Nodes: []string{"node-2"}, Subtask: true, Records: 1},
+		{ID: "a", Started: "2018-01-01T00:00:01Z", Nodes: []string{"node-1"}},
+		{ID: "b", Started: "2018-01-01T00:00:01Z", Nodes: []string{"node-1"}, Records: 10},
+		{ID: "b", Started: "2018-01-01T00:00:02Z", Nodes: []string{"node-3"}, Subtask: true, Records: 2},
+	})
+
+	if assert.Len(t, res, 2) {
+		assert.Equal(t, "a", res[0].ID)
+		assert.Equal(t, []string{"node-1"}, res[0].Nodes)
+
+		// coordinator information is used
+		assert.Equal(t, "b", res[1].ID)
+		assert.False(t, res[1].Subtask)
+		assert.EqualValues(t, 10, res[1].Records)
+		assert.Equal(t, []string{"node-1", "node-2", "node-3"}, res[1].Nodes)
+	}
+}
+
+// remote searches call test
+func TestRemoteSearches(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Get("local") != "true":
+			w.WriteHeader(http.StatusBadRequest)
+		case r.Method == "GET" && r.URL.Path == "/searches":
+			w.Write([]byte(`[{"id":"1","query":"hello","files":["*.txt"],"nodes":["node-2"]}]`))
+		case r.Method == "DELETE" && r.URL.Path == "/searches/1":
+			w.Write([]byte(`{"id":"1","cancelled":["node-2"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	var infos []SearchInfo
+	status, err := callRemoteSearches("GET", srv.URL, "", "", &infos)
+	if assert.NoError(t, err) && assert.Equal(t, http.StatusOK, status) && assert.Len(t, infos, 1) {
+		assert.Equal(t, "1", infos[0].ID)
+		assert.Equal(t, []string{"node-2"}, infos[0].Nodes)
+	}
+
+	status, err = callRemoteSearches("DELETE", srv.URL, "", "1", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, err = callRemoteSearches("DELETE", srv.URL, "", "2", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -34,16 +34,22 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/getryft/ryft-server/search/utils"
+	"github.com/getryft/ryft-server/search/utils/audit"
 	"github.com/getryft/ryft-server/search/utils/catalog"
+	"github.com/getryft/ryft-server/search/utils/scheduler"
+	"github.com/getryft/ryft-server/search/utils/trace"
 
 	"github.com/getryft/ryft-server/middleware/auth"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
 	"gopkg.in/yaml.v2"
 )
 
@@ -118,23 +124,97 @@ type ServerConfig struct {
 	AuthType string `yaml:"auth-type,omitempty"`
 
 	AuthFile struct {
-		UsersFile string `yaml:"users-file,omitempty"`
+		UsersFile      string              `yaml:"users-file,omitempty"`
+		PasswordPolicy auth.PasswordPolicy `yaml:"password-policy,omitempty"`
 	} `yaml:"auth-file,omitempty"`
 
+	// failed login throttling (Basic and /login)
+	AuthLockout auth.LockoutConfig `yaml:"auth-lockout,omitempty"`
+
 	AuthLdap auth.LdapConfig `yaml:"auth-ldap,omitempty"`
 
+	AuthOidc auth.OidcConfig `yaml:"auth-oidc,omitempty"`
+
+	// ordered list of authentication providers ("auth-type: chain")
+	AuthChain struct {
+		Providers     []string `yaml:"providers,omitempty"` // "file", "ldap"
+		StopOnFailure bool     `yaml:"stop-on-failure,omitempty"`
+	} `yaml:"auth-chain,omitempty"`
+
 	AuthJwt struct {
 		Algorithm string `yaml:"algorithm,omitempty"`
 		Secret    string `yaml:"secret,omitempty"`
 		Lifetime  string `yaml:"lifetime,omitempty"`
 	} `yaml:"auth-jwt,omitempty"`
 
+	// node-to-node authentication (cluster-signed service tokens)
+	ClusterAuth struct {
+		Algorithm string `yaml:"algorithm,omitempty"`
+		Secret    string `yaml:"secret,omitempty"` // the same on all nodes
+		Lifetime  string `yaml:"lifetime,omitempty"`
+	} `yaml:"cluster-auth,omitempty"`
+
 	Busyness struct {
 		Tolerance      int           `yaml:"tolerance,omitempty"`
 		UpdateLatency_ TimeDuration  `yaml:"update-latency,omitempty"`
 		UpdateLatency  time.Duration `yaml:"-"`
+
+		// load vector based balancing
+		Policy        string             `yaml:"policy,omitempty"`        // "busyness", "least-loaded", "latency-aware", "random-of-two"
+		Weights       map[string]float64 `yaml:"weights,omitempty"`       // load score weights
+		Processes     []string           `yaml:"processes,omitempty"`     // backend process names
+		LoadInterval_ TimeDuration       `yaml:"load-interval,omitempty"` // load vector update interval
+		LoadInterval  time.Duration      `yaml:"-"`
 	} `yaml:"busyness,omitempty"`
 
+	// active health checks of cluster nodes
+	Health struct {
+		Interval_        TimeDuration  `yaml:"interval,omitempty"` // probe interval
+		Interval         time.Duration `yaml:"-"`
+		Timeout_         TimeDuration  `yaml:"timeout,omitempty"` // probe timeout
+		Timeout          time.Duration `yaml:"-"`
+		FailureThreshold int           `yaml:"failure-threshold,omitempty"` // consecutive failures to open circuit
+		OpenTimeout_     TimeDuration  `yaml:"open-timeout,omitempty"`      // time to keep circuit open
+		OpenTimeout      time.Duration `yaml:"-"`
+		SlowLatency_     TimeDuration  `yaml:"slow-latency,omitempty"` // slow nodes are deprioritized
+		SlowLatency      time.Duration `yaml:"-"`
+	} `yaml:"health,omitempty"`
+
+	// admission control of backend executions
+	Scheduler struct {
+		MaxRuns         map[string]int    `yaml:"max-runs,omitempty"`         // maximum concurrent runs per backend tool
+		DefaultMaxRuns  int               `yaml:"default-max-runs,omitempty"` // for other backends, zero means unlimited
+		QueueTimeout_   TimeDuration      `yaml:"queue-timeout,omitempty"`    // 503 is reported if exceeded
+		QueueTimeout    time.Duration     `yaml:"-"`
+		DefaultPriority string            `yaml:"default-priority,omitempty"` // "interactive" or "batch"
+		Roles           map[string]string `yaml:"roles,omitempty"`            // role -> highest priority allowed
+	} `yaml:"scheduler,omitempty"`
+
+	// export of request tracing spans
+	Tracing struct {
+		Endpoint  string        `yaml:"endpoint,omitempty"` // OTLP/HTTP collector, empty to disable
+		Service   string        `yaml:"service,omitempty"`  // reported service name
+		Interval_ TimeDuration  `yaml:"interval,omitempty"` // batch send interval
+		Interval  time.Duration `yaml:"-"`
+		Timeout_  TimeDuration  `yaml:"timeout,omitempty"` // export request timeout
+		Timeout   time.Duration `yaml:"-"`
+	} `yaml:"tracing,omitempty"`
+
+	// audit log of data access and mutations
+	Audit struct {
+		File       string        `yaml:"file,omitempty"`     // JSON Lines file, empty to disable
+		MaxSize    string        `yaml:"max-size,omitempty"` // rotate if exceeded, "100MB" for example
+		MaxAge_    TimeDuration  `yaml:"max-age,omitempty"`  // rotate if older
+		MaxAge     time.Duration `yaml:"-"`
+		MaxBackups int           `yaml:"max-backups,omitempty"` // number of rotated files to keep
+	} `yaml:"audit,omitempty"`
+
+	// federated search across independent clusters
+	Federation struct {
+		Name     string          `yaml:"name,omitempty"`     // local cluster name, "local" by default
+		Clusters []RemoteCluster `yaml:"clusters,omitempty"` // remote clusters
+	} `yaml:"federation,omitempty"`
+
 	// catalogs related options
 	Catalogs struct {
 		MaxDataFileSize   string        `yaml:"max-data-file-size"`
@@ -144,6 +224,31 @@ type ServerConfig struct {
 		TempDirectory     string        `yaml:"temp-dir"`
 	} `yaml:"catalogs,omitempty"`
 
+	// storage quotas of the user home directories
+	Quotas struct {
+		Default string            `yaml:"default,omitempty"` // if user has no quota and no role quota
+		Roles   map[string]string `yaml:"roles,omitempty"`   // role -> quota
+
+		UsageCacheTime_ TimeDuration  `yaml:"usage-cache-time,omitempty"` // how long the home usage is cached
+		UsageCacheTime  time.Duration `yaml:"-"`
+
+		defaultQuota int64            `yaml:"-"`
+		roleQuotas   map[string]int64 `yaml:"-"`
+	} `yaml:"quotas,omitempty"`
+
+	// request rate and concurrency limits
+	Limits struct {
+		Default RequestLimits            `yaml:"default,omitempty"` // if user has no limits and no role limits
+		Roles   map[string]RequestLimits `yaml:"roles,omitempty"`   // role -> limits
+		Users   map[string]RequestLimits `yaml:"users,omitempty"`   // user -> limits
+	} `yaml:"limits,omitempty"`
+
+	// permissions of the user roles and path restrictions
+	Permissions auth.PermissionsConfig `yaml:"permissions,omitempty"`
+
+	// shared workspaces addressed as "@name/..."
+	Workspaces map[string]auth.Workspace `yaml:"workspaces,omitempty"`
+
 	InstanceHome string `yaml:"instance-home,omitempty"` // TODO: move to some tweaks
 	SettingsPath string `yaml:"settings-path,omitempty"`
 	HostName     string `yaml:"hostname,omitempty"`
@@ -188,11 +293,45 @@ type Server struct {
 	// auth manager
 	AuthManager auth.Manager
 
+	// API keys manager
+	TokenManager auth.TokenManager
+
+	// failed login tracker (nil if disabled)
+	Lockout *auth.Lockout
+
+	// JWT token denylist (nil if JWT is disabled)
+	Revocation *auth.Revocation
+
+	// node-to-node authentication (nil if disabled)
+	ClusterAuth *auth.ClusterToken
+
+	// role permissions checker
+	Authorizer *auth.Authorizer
+
 	// the number of active search requests on this node
 	// is used as a metric for "busyness"
 	// worker thread is started if "local mode" is disabled
 	activeSearchCount int32
 	busynessChanged   chan int32
+	dataRate          rateAverage // recent search data rate
+
+	// health of cluster nodes
+	health *healthTracker
+
+	// active searches
+	searches *searchRegistry
+
+	// request rate and concurrency limits
+	limiter *requestLimiter
+
+	// storage usage of home directories
+	usage *usageCache
+
+	// Ryft gRPC service
+	grpcServer *grpc.Server
+
+	// audit log (nil if disabled)
+	auditLog *audit.Log
 
 	// consul client is cached here
 	consulClient interface{}
@@ -214,6 +353,33 @@ func NewServer() *Server {
 	s.Config.BackendOptions = map[string]interface{}{}
 	s.Config.Busyness.UpdateLatency = 1 * time.Second
 	s.Config.Busyness.UpdateLatency_ = NewTimeDuration(&s.Config.Busyness.UpdateLatency)
+	s.Config.Busyness.Policy = policyBusyness
+	s.Config.Busyness.Weights = defaultLoadWeights()
+	s.Config.Busyness.Processes = []string{"ryftprim", "ryftx", "ryftpcre2"}
+	s.Config.Busyness.LoadInterval = 5 * time.Second
+	s.Config.Busyness.LoadInterval_ = NewTimeDuration(&s.Config.Busyness.LoadInterval)
+	s.Config.Health.Interval = 5 * time.Second
+	s.Config.Health.Interval_ = NewTimeDuration(&s.Config.Health.Interval)
+	s.Config.Health.Timeout = 2 * time.Second
+	s.Config.Health.Timeout_ = NewTimeDuration(&s.Config.Health.Timeout)
+	s.Config.Health.FailureThreshold = 3
+	s.Config.Health.OpenTimeout = 30 * time.Second
+	s.Config.Health.OpenTimeout_ = NewTimeDuration(&s.Config.Health.OpenTimeout)
+	s.Config.Health.SlowLatency = 1 * time.Second
+	s.Config.Health.SlowLatency_ = NewTimeDuration(&s.Config.Health.SlowLatency)
+	s.Config.Scheduler.QueueTimeout = 1 * time.Minute
+	s.Config.Scheduler.QueueTimeout_ = NewTimeDuration(&s.Config.Scheduler.QueueTimeout)
+	s.Config.Scheduler.DefaultPriority = scheduler.PriorityInteractive
+	s.Config.Tracing.Service = "ryft-server"
+	s.Config.Tracing.Interval = 1 * time.Second
+	s.Config.Tracing.Interval_ = NewTimeDuration(&s.Config.Tracing.Interval)
+	s.Config.Tracing.Timeout = 5 * time.Second
+	s.Config.Tracing.Timeout_ = NewTimeDuration(&s.Config.Tracing.Timeout)
+	s.Config.Quotas.UsageCacheTime = 1 * time.Minute
+	s.Config.Quotas.UsageCacheTime_ = NewTimeDuration(&s.Config.Quotas.UsageCacheTime)
+	s.Config.Audit.MaxSize = "100MB"
+	s.Config.Audit.MaxAge_ = NewTimeDuration(&s.Config.Audit.MaxAge)
+	s.Config.Audit.MaxBackups = 10
 	s.Config.HttpTimeout = 1 * time.Hour
 	s.Config.HttpTimeout_ = NewTimeDuration(&s.Config.HttpTimeout)
 	s.Config.ShutdownTimeout = 10 * time.Minute
@@ -223,14 +389,29 @@ func NewServer() *Server {
 	s.Config.SettingsPath = "/var/ryft/server.settings"
 	s.Config.Sessions.Algorithm = "HS256"
 	s.Config.Sessions.Secret = "session-secret-key"
+	s.Config.ClusterAuth.Algorithm = "HS256"
+	s.Config.ClusterAuth.Lifetime = "1h"
+	s.Config.AuthFile.PasswordPolicy.MinLength = 8
+	s.Config.AuthLockout.MaxFailures = 5
+	s.Config.AuthLockout.MaxIpFailures = 20
+	s.Config.AuthLockout.Delay = "1m"
+	s.Config.AuthLockout.MaxDelay = "1h"
+	s.Config.AuthLockout.ResetAfter = "1h"
 
 	s.closeCh = make(chan struct{})
+	s.searches = newSearchRegistry()
+	s.limiter = newRequestLimiter()
+	s.usage = newUsageCache(s.Config.Quotas.UsageCacheTime)
+	s.grpcServer = newGrpcServer(s)
 	return s // OK
 }
 
 // Close() closes the server
 func (s *Server) Close() {
 	close(s.closeCh)
+	if s.auditLog != nil {
+		s.auditLog.Close()
+	}
 }
 
 // ParseConfig parses server configuration from YML file
@@ -288,6 +469,37 @@ func (s *Server) Prepare() (err error) {
 		return fmt.Errorf("failed to parse session secret: %s", err)
 	}
 
+	// node-to-node authentication
+	if len(s.Config.ClusterAuth.Secret) != 0 {
+		secret, err := auth.ParseSecret(s.Config.ClusterAuth.Secret)
+		if err != nil {
+			return fmt.Errorf("failed to parse cluster secret: %s", err)
+		}
+		lifetime, err := time.ParseDuration(s.Config.ClusterAuth.Lifetime)
+		if err != nil {
+			return fmt.Errorf("failed to parse cluster token lifetime: %s", err)
+		}
+		s.ClusterAuth, err = auth.NewClusterToken(secret, s.Config.ClusterAuth.Algorithm, lifetime)
+		if err != nil {
+			return err
+		}
+	}
+
+	// parse storage quotas
+	if err := s.parseQuotas(); err != nil {
+		return err
+	}
+
+	// role permissions
+	if s.Authorizer, err = auth.NewAuthorizer(s.Config.Permissions); err != nil {
+		return fmt.Errorf("failed to parse permissions: %s", err)
+	}
+
+	// shared workspaces
+	if err := s.prepareWorkspaces(); err != nil {
+		return fmt.Errorf("failed to prepare workspaces: %s", err)
+	}
+
 	// hostname
 	if len(s.Config.HostName) == 0 {
 		if h, err := os.Hostname(); err != nil {
@@ -324,19 +536,80 @@ func (s *Server) Prepare() (err error) {
 	}
 
 	// busyness update
+	switch s.Config.Busyness.Policy {
+	case "", policyBusyness, policyLeastLoaded, policyLatencyAware, policyRandomOfTwo:
+		// OK
+	default:
+		return fmt.Errorf("unknown busyness policy: %q", s.Config.Busyness.Policy)
+	}
 	if !s.Config.LocalOnly {
 		s.startUpdatingBusyness()
 	}
 
+	// health checks
+	if err := s.prepareHealth(); err != nil {
+		return fmt.Errorf("failed to prepare health checks: %s", err)
+	}
+	if !s.Config.LocalOnly {
+		s.startHealthProbing()
+	}
+
+	// admission control
+	if err := s.prepareScheduler(); err != nil {
+		return fmt.Errorf("failed to prepare scheduler: %s", err)
+	}
+
+	if err := s.prepareFederation(); err != nil {
+		return fmt.Errorf("failed to prepare federation: %s", err)
+	}
+
+	// span export
+	if len(s.Config.Tracing.Endpoint) != 0 {
+		if s.Config.Tracing.Interval <= 0 {
+			return fmt.Errorf("tracing interval should be positive")
+		}
+		trace.SetExporter(trace.NewOTLPExporter(s.Config.Tracing.Endpoint,
+			s.Config.Tracing.Service, s.Config.HostName,
+			s.Config.Tracing.Interval, s.Config.Tracing.Timeout))
+	}
+
+	// audit log
+	if err := s.prepareAudit(); err != nil {
+		return fmt.Errorf("failed to prepare audit log: %s", err)
+	}
+
 	// pending jobs
 	s.startJobsProcessing()
 
 	return nil // OK
 }
 
+// GetSettings gets the server settings (opened on Prepare).
+func (s *Server) GetSettings() *ServerSettings {
+	return s.settings
+}
+
+// check request is authenticated by node-to-node token
+func (s *Server) isClusterRequest(ctx *gin.Context) bool {
+	return s.ClusterAuth != nil && getAuthUser(ctx) != nil &&
+		strings.HasPrefix(ctx.Request.Header.Get("Authorization"), auth.ClusterAuthScheme)
+}
+
+// check request is sent by another cluster node
+// (or authentication is disabled), so internal parameters are trusted
+func (s *Server) isInternalRequest(ctx *gin.Context) bool {
+	return getAuthUser(ctx) == nil || s.isClusterRequest(ctx)
+}
+
 // parse authentication token and home directory from context
 func (s *Server) parseAuthAndHome(ctx *gin.Context) (userName string, authToken string, homeDir string, userTag string) {
 	authToken = ctx.Request.Header.Get("Authorization") // may be empty
+	if key := ctx.Request.Header.Get(auth.ApiKeyHeader); len(key) != 0 && len(authToken) == 0 {
+		authToken = "Bearer " + key // forward API key
+	}
+
+	// shared workspace is used instead of home
+	ws := getWorkspace(ctx)
 
 	// get home directory
 	if v, exists := ctx.Get(gin.AuthUserKey); exists && v != nil {
@@ -344,9 +617,28 @@ func (s *Server) parseAuthAndHome(ctx *gin.Context) (userName string, authToken
 			userName = user.Name
 			homeDir = user.HomeDir
 			userTag = user.ClusterTag
+			if ws != nil {
+				u := *user // copy
+				u.HomeDir = ws.Dir
+				user = &u // other nodes use the same workspace
+			}
+
+			// do not forward user's credentials to other nodes
+			if s.ClusterAuth != nil {
+				token, err := s.ClusterAuth.Issue(user, s.Config.HostName)
+				if err != nil {
+					panic(NewError(http.StatusInternalServerError, err.Error()).
+						WithDetails("failed to issue cluster token"))
+				}
+				authToken = token
+			}
 		}
 	}
 
+	if ws != nil {
+		homeDir = ws.Dir
+	}
+
 	// update HOME with custom prefix (usually empty)
 	homeDir = filepath.Join(s.Config.InstanceHome, homeDir)
 
@@ -117,6 +117,12 @@ func newFake() *fakeServer {
 	mux.DELETE("/files/*path", fs.server.DoDeleteFiles)
 	mux.PUT("/rename", fs.server.DoRenameFiles)
 	mux.PUT("/rename/*path", fs.server.DoRenameFiles)
+	mux.PUT("/copy", fs.server.DoCopyFiles)
+	mux.PUT("/copy/*path", fs.server.DoCopyFiles)
+	mux.PUT("/move", fs.server.DoMoveFiles)
+	mux.PUT("/move/*path", fs.server.DoMoveFiles)
+
+	mux.GET("/user/usage", fs.server.DoUserUsage)
 
 	// aliases used for swagger clients
 	mux.GET("/file", fs.server.DoGetFiles)
@@ -42,7 +42,7 @@ import (
 )
 
 const (
-	settingsSchemeVersion = 1 // current scheme version
+	settingsSchemeVersion = 3 // current scheme version
 
 	jobTimeFormat = "2006-01-02 15:04:05.999999999"
 )
@@ -167,11 +167,25 @@ func (ss *ServerSettings) updateScheme() error {
 		}
 	}
 
-	// 1 => 2 (example)
-	/*if version <= 1 {
+	// 1 => 2
+	if version <= 1 {
 		if err := ss.updateSchemeToVersion2(tx); err != nil {
 			return fmt.Errorf("failed to update to version 2: %s", err)
 		}
+	}
+
+	// 2 => 3
+	if version <= 2 {
+		if err := ss.updateSchemeToVersion3(tx); err != nil {
+			return fmt.Errorf("failed to update to version 3: %s", err)
+		}
+	}
+
+	// 3 => 4 (example)
+	/*if version <= 3 {
+		if err := ss.updateSchemeToVersion4(tx); err != nil {
+			return fmt.Errorf("failed to update to version 4: %s", err)
+		}
 	}*/
 
 	// commit changes
@@ -203,13 +217,53 @@ PRAGMA user_version = 1;`
 	return nil // OK
 }
 
-// version2: update tables (example)
-/*func (ss *ServerSettings) updateSchemeToVersion2(tx *sql.Tx) error {
+// version2: kept search results
+func (ss *ServerSettings) updateSchemeToVersion2(tx *sql.Tx) error {
+	SCRIPT := `-- create tables
+CREATE TABLE IF NOT EXISTS results (
+	path STRING PRIMARY KEY NOT NULL -- absolute path of INDEX, DATA or VIEW file
+);
+
+-- update scheme version
+PRAGMA user_version = 2;`
+
+	if _, err := tx.Exec(SCRIPT); err != nil {
+		return fmt.Errorf("failed to create tables: %s", err)
+	}
+
+	return nil // OK
+}
+
+// version3: revoked JWT tokens
+func (ss *ServerSettings) updateSchemeToVersion3(tx *sql.Tx) error {
+	SCRIPT := `-- create tables
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	id STRING PRIMARY KEY NOT NULL, -- token ID
+	user STRING,                    -- token owner
+	expires STRING NOT NULL         -- datetime when token is expired anyway, UTC
+);
+CREATE TABLE IF NOT EXISTS revoked_users (
+	user STRING PRIMARY KEY NOT NULL, -- user name
+	before STRING NOT NULL            -- datetime, all tokens issued before are revoked, UTC
+);
+
+-- update scheme version
+PRAGMA user_version = 3;`
+
+	if _, err := tx.Exec(SCRIPT); err != nil {
+		return fmt.Errorf("failed to create tables: %s", err)
+	}
+
+	return nil // OK
+}
+
+// version4: update tables (example)
+/*func (ss *ServerSettings) updateSchemeToVersion4(tx *sql.Tx) error {
 	SCRIPT := ` -- just an example
 ALTER TABLE jobs ADD COLUMN foo INTEGER;
 
 -- update scheme version
-PRAGMA user_version = 2;`
+PRAGMA user_version = 4;`
 
 	if _, err := tx.Exec(SCRIPT); err != nil {
 		return fmt.Errorf("failed to update tables: %s", err)
@@ -296,7 +350,199 @@ func (ss *ServerSettings) deleteJobs(ids []int64) error {
 	return nil // OK
 }
 
-// clear all jobs
+// AddResults marks files as kept search results.
+func (ss *ServerSettings) AddResults(paths []string) error {
+	// TODO: several attempts if DB is locked
+	return ss.addResultsSync(paths)
+}
+
+// adds results (synchronized).
+func (ss *ServerSettings) addResultsSync(paths []string) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	return ss.addResults(paths)
+}
+
+// adds results (unsynchronized).
+func (ss *ServerSettings) addResults(paths []string) error {
+	// should be done under exclusive transaction
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %s", err)
+	}
+	defer tx.Rollback() // just in case
+
+	for _, path := range paths {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO results(path) VALUES (?)`, path)
+		if err != nil {
+			return fmt.Errorf("failed to insert result: %s", err)
+		}
+	}
+
+	// commit transaction
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %s", err)
+	}
+
+	return nil // OK
+}
+
+// DeleteResults removes files from the kept search results.
+func (ss *ServerSettings) DeleteResults(paths []string) error {
+	// TODO: several attempts if DB is locked
+	return ss.deleteResultsSync(paths)
+}
+
+// removes results (synchronized).
+func (ss *ServerSettings) deleteResultsSync(paths []string) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	return ss.deleteResults(paths)
+}
+
+// removes results (unsynchronized).
+func (ss *ServerSettings) deleteResults(paths []string) error {
+	if len(paths) == 0 {
+		return nil // nothing to delete
+	}
+
+	// convert to interfaces
+	path_set := make([]interface{}, len(paths))
+	for i, path := range paths {
+		path_set[i] = path
+	}
+
+	set := "?" + strings.Repeat(",?", len(paths)-1)
+	_, err := ss.db.Exec("DELETE FROM results WHERE path IN ("+set+")", path_set...)
+	if err != nil {
+		return fmt.Errorf("failed to delete results: %s", err)
+	}
+
+	return nil // OK
+}
+
+// GetResults gets the set of kept search results inside the directory.
+func (ss *ServerSettings) GetResults(dir string) (map[string]bool, error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	return ss.getResults(dir)
+}
+
+// gets results (unsynchronized).
+func (ss *ServerSettings) getResults(dir string) (map[string]bool, error) {
+	rows, err := ss.db.Query(`SELECT path FROM results`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query results: %s", err)
+	}
+	defer rows.Close()
+
+	prefix := filepath.Clean(dir)
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	res := make(map[string]bool)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %s", err)
+		}
+
+		if strings.HasPrefix(path, prefix) {
+			res[path] = true
+		}
+	}
+
+	return res, rows.Err()
+}
+
+// RevokeToken adds JWT token to the denylist.
+func (ss *ServerSettings) RevokeToken(id string, user string, expires time.Time) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	_, err := ss.db.Exec(`INSERT OR REPLACE
+INTO revoked_tokens(id,user,expires)
+VALUES (?,?,?)`, id, user, expires.UTC().Format(jobTimeFormat))
+	if err != nil {
+		return fmt.Errorf("failed to insert revoked token: %s", err)
+	}
+
+	return nil // OK
+}
+
+// RevokeUserTokens revokes all user's JWT tokens issued before.
+func (ss *ServerSettings) RevokeUserTokens(user string, before time.Time) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	_, err := ss.db.Exec(`INSERT OR REPLACE
+INTO revoked_users(user,before)
+VALUES (?,?)`, user, before.UTC().Format(jobTimeFormat))
+	if err != nil {
+		return fmt.Errorf("failed to insert revoked user: %s", err)
+	}
+
+	return nil // OK
+}
+
+// GetRevocations gets revoked JWT tokens and users.
+// expired tokens are removed.
+func (ss *ServerSettings) GetRevocations(now time.Time) (map[string]time.Time, map[string]time.Time, error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	return ss.getRevocations(now)
+}
+
+// gets revocations (unsynchronized).
+func (ss *ServerSettings) getRevocations(now time.Time) (map[string]time.Time, map[string]time.Time, error) {
+	_, err := ss.db.Exec(`DELETE FROM revoked_tokens WHERE expires < ?`,
+		now.UTC().Format(jobTimeFormat))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to delete expired tokens: %s", err)
+	}
+
+	tokens := make(map[string]time.Time)
+	if err := ss.queryTimes(`SELECT id,expires FROM revoked_tokens`, tokens); err != nil {
+		return nil, nil, fmt.Errorf("failed to query revoked tokens: %s", err)
+	}
+
+	users := make(map[string]time.Time)
+	if err := ss.queryTimes(`SELECT user,before FROM revoked_users`, users); err != nil {
+		return nil, nil, fmt.Errorf("failed to query revoked users: %s", err)
+	}
+
+	return tokens, users, nil // OK
+}
+
+// query (key, time) pairs (unsynchronized).
+func (ss *ServerSettings) queryTimes(query string, res map[string]time.Time) error {
+	rows, err := ss.db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, when string
+		if err := rows.Scan(&key, &when); err != nil {
+			return err
+		}
+
+		t, err := time.ParseInLocation(jobTimeFormat, when, time.UTC)
+		if err != nil {
+			return fmt.Errorf("failed to parse time: %s", err)
+		}
+		res[key] = t
+	}
+
+	return rows.Err()
+}
+
+// clear all jobs and results
 func (ss *ServerSettings) ClearAll() error {
 	ss.mutex.Lock()
 	defer ss.mutex.Unlock()
@@ -311,6 +557,11 @@ func (ss *ServerSettings) clearAll() error {
 		return fmt.Errorf("failed to delete jobs: %s", err)
 	}
 
+	_, err = ss.db.Exec(`DELETE FROM results`)
+	if err != nil {
+		return fmt.Errorf("failed to delete results: %s", err)
+	}
+
 	return nil // OK
 }
 
@@ -365,6 +616,18 @@ WHERE datetime(whenToRun) <= datetime(?);`, now.UTC().Format(jobTimeFormat))
 	return ch, nil // OK
 }
 
+// get the number of pending jobs
+func (ss *ServerSettings) GetJobCount() (int, error) {
+	row := ss.db.QueryRow(`SELECT COUNT(*) FROM jobs`)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil // OK
+}
+
 // get next Job time
 func (ss *ServerSettings) GetNextJobTime() (time.Time, error) {
 	row := ss.db.QueryRow(`SELECT MIN(datetime(whenToRun)) FROM jobs`)
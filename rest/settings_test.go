@@ -80,3 +80,65 @@ func TestSettingsJobs(t *testing.T) {
 	assert.NoError(t, s.Close())
 	assert.NoError(t, s.Close())
 }
+
+// test kept search results
+func TestSettingsResults(t *testing.T) {
+	path := fmt.Sprintf("/tmp/ryft-test-%x.settings", time.Now().UnixNano())
+	defer os.RemoveAll(path)
+
+	s, err := OpenSettings(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	assert.NoError(t, s.AddResults([]string{"/ryftone/foo/data.bin", "/ryftone/foo/index.txt", "/ryftone/bar/data.bin"}))
+	assert.NoError(t, s.AddResults([]string{"/ryftone/foo/data.bin"})) // duplicate
+
+	res, err := s.GetResults("/ryftone/foo")
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, map[string]bool{
+			"/ryftone/foo/data.bin":  true,
+			"/ryftone/foo/index.txt": true,
+		}, res)
+	}
+
+	assert.NoError(t, s.DeleteResults([]string{"/ryftone/foo/data.bin"}))
+	res, err = s.GetResults("/ryftone")
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, map[string]bool{
+			"/ryftone/foo/index.txt": true,
+			"/ryftone/bar/data.bin":  true,
+		}, res)
+	}
+
+	assert.NoError(t, s.ClearAll())
+	res, err = s.GetResults("/")
+	if assert.NoError(t, err) {
+		assert.Empty(t, res)
+	}
+}
+
+// test revoked JWT tokens
+func TestSettingsRevocations(t *testing.T) {
+	path := fmt.Sprintf("/tmp/ryft-test-%x.settings", time.Now().UnixNano())
+	defer os.RemoveAll(path)
+
+	s, err := OpenSettings(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	assert.NoError(t, s.RevokeToken("t1", "foo", now.Add(time.Hour)))
+	assert.NoError(t, s.RevokeToken("t2", "foo", now.Add(-time.Hour)))
+	assert.NoError(t, s.RevokeUserTokens("bar", now))
+	assert.NoError(t, s.RevokeUserTokens("bar", now.Add(time.Minute))) // replace
+
+	tokens, users, err := s.GetRevocations(now)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, map[string]time.Time{"t1": now.Add(time.Hour)}, tokens)
+		assert.EqualValues(t, map[string]time.Time{"bar": now.Add(time.Minute)}, users)
+	}
+}
@@ -165,7 +165,7 @@ func (server *Server) doSearchShow(ctx *gin.Context, params SearchShowParams) {
 	// we can use two formats:
 	// - single JSON value (not appropriate for large data set)
 	// - with tags to report data records and the statistics in a stream
-	enc, err := codec.NewEncoder(ctx.Writer, accept, params.Stream)
+	enc, err := newEncoder(ctx, accept, params.Stream)
 	if err != nil {
 		panic(NewError(http.StatusBadRequest, err.Error()).
 			WithDetails("failed to get encoder"))
@@ -225,6 +225,8 @@ func (server *Server) doSearchShow(ctx *gin.Context, params SearchShowParams) {
 		"home":    homeDir,
 		"cluster": userTag,
 	}).Infof("[%s]: start GET /search/show", CORE)
+	auditSearch(ctx, cfg, nil)
+
 	searchStartTime := time.Now() // performance metric
 	res, err := engine.Show(cfg)
 	if err != nil {
@@ -245,6 +247,7 @@ func (server *Server) doSearchShow(ctx *gin.Context, params SearchShowParams) {
 	transferStartTime := time.Now() // performance metric
 	server.drain(ctx, enc, tcode, cfg, res, errorPrefix)
 	transferStopTime := time.Now() // performance metric
+	auditSearch(ctx, cfg, res)
 
 	if /*params.Stats &&*/ res.Stat != nil && (cfg.Aggregations != nil || params.Performance) {
 		if server.Config.ExtraRequest {
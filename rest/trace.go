@@ -0,0 +1,76 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils/trace"
+	"github.com/gin-gonic/gin"
+)
+
+// name of W3C trace context header
+const traceParentHeader = "traceparent"
+
+// start server span of the search request.
+// the incoming `traceparent` header is accepted,
+// new trace is started if it's missing or invalid.
+// the trace context is reported back and passed to the search engine.
+func startSearchSpan(ctx *gin.Context, name string, cfg *search.Config) *trace.Span {
+	var parent trace.Context
+	if h := ctx.Request.Header.Get(traceParentHeader); len(h) != 0 {
+		if tc, err := trace.Parse(h); err != nil {
+			log.WithError(err).Warnf("[%s]: bad trace context, new trace is started", CORE)
+		} else {
+			parent = tc
+		}
+	}
+
+	span := trace.Start(parent, name, trace.KindServer)
+	span.SetAttribute("request-id", cfg.RequestID)
+	span.SetAttribute("query", cfg.Query)
+
+	cfg.Trace = span.TraceContext()
+	ctx.Header(traceParentHeader, cfg.Trace.String())
+	return span
+}
+
+// finish server span of the search request
+func finishSearchSpan(span *trace.Span, res *search.Result, metrics map[string]interface{}) {
+	if res != nil {
+		span.SetAttribute("errors", res.ErrorsReported())
+		span.SetAttribute("records", res.RecordsReported())
+		if stat := res.Stat; stat != nil {
+			span.SetAttribute("matches", stat.Matches)
+			span.SetAttribute("total-bytes", stat.TotalBytes)
+		}
+	}
+	span.SetAttributes(metrics)
+	span.Finish()
+}
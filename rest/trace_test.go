@@ -0,0 +1,82 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils/trace"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// test trace context is accepted or generated
+func TestSearchSpan(t *testing.T) {
+	var cfg *search.Config
+	var span *trace.Span
+
+	router := gin.New()
+	router.GET("/search", func(ctx *gin.Context) {
+		cfg = search.NewConfig("hello", "1.txt")
+		cfg.RequestID = "req-1"
+		span = startSearchSpan(ctx, "rest-search", cfg)
+		finishSearchSpan(span, nil, map[string]interface{}{"total": "1s"})
+	})
+
+	check := func(traceparent string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/search", nil)
+		if len(traceparent) != 0 {
+			req.Header.Set("traceparent", traceparent)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// accepted
+	w := check("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", cfg.TraceID())
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentID)
+	assert.Equal(t, cfg.Trace.String(), w.Header().Get("traceparent"))
+	assert.Equal(t, "req-1", span.Attributes["request-id"])
+	assert.Equal(t, "1s", span.Attributes["total"])
+	assert.False(t, span.End.IsZero())
+
+	// generated
+	for _, tp := range []string{"", "bad-traceparent"} {
+		w = check(tp)
+		assert.True(t, cfg.Trace.IsValid())
+		assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", cfg.TraceID())
+		assert.Empty(t, span.ParentID)
+		assert.Equal(t, cfg.Trace.String(), w.Header().Get("traceparent"))
+	}
+}
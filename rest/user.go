@@ -37,6 +37,7 @@ import (
 	"time"
 
 	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/getryft/ryft-server/search/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -73,13 +74,13 @@ func (server *Server) DoUserGet(ctx *gin.Context) {
 	var res []*auth.UserInfo
 	var err error
 	if len(params.Names) == 0 {
-		if user.HasRole(auth.AdminRole) {
+		if server.isAdmin(user) {
 			res, err = server.AuthManager.GetAllUsers()
 		} else {
 			res = append(res, user.WipeOut())
 		}
 	} else {
-		if user.HasRole(auth.AdminRole) {
+		if server.isAdmin(user) {
 			res, err = server.AuthManager.GetUsers(params.Names)
 		} else {
 			for _, name := range params.Names {
@@ -127,14 +128,20 @@ func (server *Server) DoUserPost(ctx *gin.Context) {
 	if len(newUser.Password) == 0 {
 		panic(NewError(http.StatusBadRequest, "no password provided"))
 	}
+	auditDetail(ctx, "target", newUser.Name)
+	auditDetail(ctx, "roles", newUser.Roles)
 
-	if !user.HasRole(auth.AdminRole) {
+	if !server.isAdmin(user) {
 		panic(NewError(http.StatusForbidden, "only admin can create new users"))
 	}
+	if _, err := utils.ParseDataSize(newUser.Quota); len(newUser.Quota) != 0 && err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse storage quota"))
+	}
 
 	res, err := server.AuthManager.CreateNew(&newUser)
 	if err != nil {
-		panic(NewError(http.StatusInternalServerError, err.Error()).
+		panic(NewError(getUserErrorStatus(err), err.Error()).
 			WithDetails("failed to create new user"))
 	}
 
@@ -163,6 +170,7 @@ func (server *Server) DoUserPut(ctx *gin.Context) {
 		Roles:      []string{missing},
 		HomeDir:    missing,
 		ClusterTag: missing,
+		Quota:      missing,
 	}
 	if err := binding.JSON.Bind(ctx.Request, &newUser); err != nil {
 		panic(NewError(http.StatusBadRequest, err.Error()).
@@ -173,11 +181,18 @@ func (server *Server) DoUserPut(ctx *gin.Context) {
 	if newUser.Name == missing {
 		newUser.Name = user.Name
 	}
+	auditDetail(ctx, "target", newUser.Name)
+	if strings.Join(newUser.Roles, ":") != missing {
+		auditDetail(ctx, "roles", newUser.Roles)
+	}
+	if newUser.Password != missing {
+		auditDetail(ctx, "password", "changed") // never the password itself
+	}
 
 	// do we need to change password?
 	if newUser.Password != missing {
 		// anyone can change password
-		if newUser.Name != user.Name && !user.HasRole(auth.AdminRole) {
+		if newUser.Name != user.Name && !server.isAdmin(user) {
 			panic(NewError(http.StatusForbidden, "only admin can change other user passwords"))
 		}
 	}
@@ -186,23 +201,34 @@ func (server *Server) DoUserPut(ctx *gin.Context) {
 	}
 
 	// do we need to change home directory?
-	if newUser.HomeDir != missing && !user.HasRole(auth.AdminRole) {
+	if newUser.HomeDir != missing && !server.isAdmin(user) {
 		panic(NewError(http.StatusForbidden, "only admin can change home directories"))
 	}
 
 	// do we need to change cluster tag?
-	if newUser.ClusterTag != missing && !user.HasRole(auth.AdminRole) {
+	if newUser.ClusterTag != missing && !server.isAdmin(user) {
 		panic(NewError(http.StatusForbidden, "only admin can change cluster tag"))
 	}
 
+	// do we need to change storage quota?
+	if newUser.Quota != missing {
+		if !server.isAdmin(user) {
+			panic(NewError(http.StatusForbidden, "only admin can change storage quota"))
+		}
+		if _, err := utils.ParseDataSize(newUser.Quota); len(newUser.Quota) != 0 && err != nil {
+			panic(NewError(http.StatusBadRequest, err.Error()).
+				WithDetails("failed to parse storage quota"))
+		}
+	}
+
 	// do we need to change roles?
-	if strings.Join(newUser.Roles, ":") != missing && !user.HasRole(auth.AdminRole) {
+	if strings.Join(newUser.Roles, ":") != missing && !server.isAdmin(user) {
 		panic(NewError(http.StatusForbidden, "only admin can change roles"))
 	}
 
 	res, err := server.AuthManager.Update(&newUser, missing)
 	if err != nil {
-		panic(NewError(http.StatusInternalServerError, err.Error()).
+		panic(NewError(getUserErrorStatus(err), err.Error()).
 			WithDetails("failed to update user"))
 	}
 
@@ -233,9 +259,10 @@ func (server *Server) DoUserDelete(ctx *gin.Context) {
 			WithDetails("failed to parse request parameters"))
 	}
 
-	if !user.HasRole(auth.AdminRole) {
+	if !server.isAdmin(user) {
 		panic(NewError(http.StatusForbidden, "only admin can delete users"))
 	}
+	auditDetail(ctx, "target", params.Names)
 
 	res, err := server.AuthManager.Delete(params.Names)
 	if err != nil {
@@ -246,3 +273,12 @@ func (server *Server) DoUserDelete(ctx *gin.Context) {
 	log.WithField("users", res).Debugf("[%s/auth]: users deleted", CORE)
 	ctx.JSON(http.StatusOK, res)
 }
+
+// get HTTP status of user management error
+func getUserErrorStatus(err error) int {
+	if _, ok := err.(*auth.PasswordPolicyError); ok {
+		return http.StatusBadRequest // weak password
+	}
+
+	return http.StatusInternalServerError
+}
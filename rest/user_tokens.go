@@ -0,0 +1,197 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// default API key lifetime
+const defaultApiKeyLifetime = 30 * 24 * time.Hour
+
+// TokenParams contains all the bound parameters for the /user/tokens endpoint.
+type TokenParams struct {
+	User string `form:"user" json:"user,omitempty"` // another user (admin only)
+	ID   string `form:"id" json:"id,omitempty"`     // API key to revoke
+}
+
+// NewTokenParams contains new API key parameters (POST /user/tokens body)
+type NewTokenParams struct {
+	Name     string   `json:"name"`
+	Lifetime string   `json:"lifetime"` // "720h" for example, "0" - never expires
+	Scope    []string `json:"scope"`    // permissions, empty - all user's permissions
+	AllowIPs []string `json:"allow-ips"`
+}
+
+// NewTokenResult contains new API key (reported once)
+type NewTokenResult struct {
+	*auth.ApiToken
+	Key string `json:"key"`
+}
+
+// get authenticated user and the user API keys are managed for
+func (server *Server) getTokensUser(ctx *gin.Context, name string) *auth.UserInfo {
+	user := getAuthUser(ctx)
+	if user == nil {
+		panic(NewError(http.StatusUnauthorized, "no authenticated user found"))
+	}
+
+	// API key cannot be used to manage API keys
+	if len(user.TokenID) != 0 {
+		panic(NewError(http.StatusForbidden, "API key cannot be used to manage API keys"))
+	}
+
+	if len(name) != 0 && name != user.Name {
+		if !server.isAdmin(user) {
+			panic(NewError(http.StatusForbidden,
+				fmt.Sprintf(`access to "%s" denied`, name)))
+		}
+
+		return &auth.UserInfo{Name: name}
+	}
+
+	return user
+}
+
+// Handle GET /user/tokens endpoint - get user's API keys
+func (server *Server) DoUserTokensGet(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	// parse request parameters
+	var params TokenParams
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+
+	user := server.getTokensUser(ctx, params.User)
+	res, err := server.TokenManager.GetTokens(user.Name)
+	if err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to get API keys"))
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
+
+// Handle POST /user/tokens endpoint - create new API key
+func (server *Server) DoUserTokensPost(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	// parse request parameters
+	var params TokenParams
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+	var newToken NewTokenParams
+	if err := bindOptionalJson(ctx.Request, &newToken); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request JSON parameters"))
+	}
+
+	lifetime := defaultApiKeyLifetime
+	if len(newToken.Lifetime) != 0 {
+		var err error
+		if lifetime, err = time.ParseDuration(newToken.Lifetime); err != nil || lifetime < 0 {
+			panic(NewError(http.StatusBadRequest, fmt.Sprintf("%q is not a valid lifetime", newToken.Lifetime)).
+				WithDetails("failed to parse API key lifetime"))
+		}
+	}
+
+	user := server.getTokensUser(ctx, params.User)
+	auditDetail(ctx, "target", user.Name)
+
+	// scope should be a subset of the user's permissions
+	// (admin creating API key for another user is trusted)
+	if user == getAuthUser(ctx) {
+		for _, perm := range newToken.Scope {
+			if perm != auth.PermAll && !server.getAuthorizer().Check(user, perm) {
+				panic(NewError(http.StatusForbidden,
+					fmt.Sprintf("%q permission is not granted", perm)))
+			}
+		}
+	}
+
+	key, token, err := auth.NewApiToken(newToken.Name, lifetime, newToken.Scope, newToken.AllowIPs)
+	if err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to create API key"))
+	}
+	if err := server.TokenManager.CreateToken(user.Name, token); err != nil {
+		panic(NewError(http.StatusInternalServerError, err.Error()).
+			WithDetails("failed to create API key"))
+	}
+	auditDetail(ctx, "id", token.ID)
+
+	log.WithField("user", user.Name).WithField("id", token.ID).
+		Infof("[%s/auth]: API key created", CORE)
+	ctx.JSON(http.StatusOK, NewTokenResult{
+		ApiToken: token.WipeOut(),
+		Key:      key,
+	})
+}
+
+// Handle DELETE /user/tokens endpoint - revoke API key
+func (server *Server) DoUserTokensDelete(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	// parse request parameters
+	var params TokenParams
+	if err := binding.Form.Bind(ctx.Request, &params); err != nil {
+		panic(NewError(http.StatusBadRequest, err.Error()).
+			WithDetails("failed to parse request parameters"))
+	}
+	if len(params.ID) == 0 {
+		panic(NewError(http.StatusBadRequest, "no API key identifier provided"))
+	}
+
+	user := server.getTokensUser(ctx, params.User)
+	auditDetail(ctx, "target", user.Name)
+	auditDetail(ctx, "id", params.ID)
+	res, err := server.TokenManager.RevokeToken(user.Name, params.ID)
+	if err != nil {
+		panic(NewError(http.StatusNotFound, err.Error()).
+			WithDetails("failed to revoke API key"))
+	}
+
+	log.WithField("user", user.Name).WithField("id", res.ID).
+		Infof("[%s/auth]: API key revoked", CORE)
+	ctx.JSON(http.StatusOK, res)
+}
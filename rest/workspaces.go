@@ -0,0 +1,171 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/getryft/ryft-server/middleware/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// shared workspace used by the request
+const workspaceKey = "workspace"
+
+// WorkspaceInfo contains shared workspace available to user.
+type WorkspaceInfo struct {
+	Name   string `json:"name"`
+	Access string `json:"access"` // "read" or "write"
+}
+
+// workspace used instead of user's home
+type usedWorkspace struct {
+	Name string
+	Dir  string
+}
+
+// check shared workspaces configuration
+func (s *Server) prepareWorkspaces() error {
+	for name, ws := range s.Config.Workspaces {
+		if len(name) == 0 || strings.Contains(name, "/") {
+			return fmt.Errorf("%q is not a valid workspace name", name)
+		}
+
+		ws.Dir = filepath.Clean("/" + ws.Dir)
+		if ws.Dir == "/" {
+			return fmt.Errorf("no valid directory provided for %q workspace", name)
+		}
+		s.Config.Workspaces[name] = ws
+	}
+
+	return nil // OK
+}
+
+// resolve shared workspace paths like "@team/data.txt"
+// all non-empty paths should be inside the user's home or inside the same workspace.
+// the workspace is used instead of user's home for the rest of the request
+// (including requests to other cluster nodes). paths inside workspace are reported.
+func (server *Server) useWorkspace(ctx *gin.Context, local bool, write bool, paths ...string) []string {
+	res := make([]string, len(paths))
+	var name string
+	var inWorkspace, inHome bool
+	for i, path := range paths {
+		res[i] = path
+		if len(path) == 0 {
+			continue
+		}
+
+		ws, rel, ok := auth.ParseWorkspacePath(path)
+		if !ok {
+			inHome = true
+			continue
+		}
+		if inWorkspace && ws != name {
+			panic(NewError(http.StatusBadRequest,
+				fmt.Sprintf("cannot use both %q and %q workspaces", name, ws)))
+		}
+		name, inWorkspace = ws, true
+		res[i] = rel
+	}
+
+	if !inWorkspace {
+		return res // home is used
+	}
+	if inHome {
+		panic(NewError(http.StatusBadRequest,
+			fmt.Sprintf("cannot use both home and %q workspace", name)))
+	}
+
+	ws, ok := server.Config.Workspaces[name]
+	if !ok {
+		panic(NewError(http.StatusNotFound,
+			fmt.Sprintf("workspace %q not found", name)))
+	}
+
+	user := getAuthUser(ctx)
+	if !server.isAdmin(user) {
+		if write && !ws.CanWrite(user) {
+			panic(NewError(http.StatusForbidden,
+				fmt.Sprintf("write access to %q workspace denied", name)))
+		} else if !ws.CanRead(user) {
+			panic(NewError(http.StatusForbidden,
+				fmt.Sprintf("access to %q workspace denied", name)))
+		}
+	}
+
+	// other nodes get workspace via cluster token
+	if !local && !server.Config.LocalOnly && (server.ClusterAuth == nil || user == nil) {
+		panic(NewError(http.StatusNotImplemented,
+			"shared workspaces require node-to-node authentication in cluster mode"))
+	}
+
+	ctx.Set(workspaceKey, &usedWorkspace{Name: name, Dir: ws.Dir})
+	auditDetail(ctx, "workspace", name)
+	return res
+}
+
+// get shared workspace used by the request
+func getWorkspace(ctx *gin.Context) *usedWorkspace {
+	if v, ok := ctx.Get(workspaceKey); ok && v != nil {
+		if ws, ok := v.(*usedWorkspace); ok {
+			return ws
+		}
+	}
+
+	return nil // home is used
+}
+
+// Handle GET /workspaces endpoint - list of available shared workspaces
+func (server *Server) DoWorkspaces(ctx *gin.Context) {
+	// recover from panics if any
+	defer RecoverFromPanic(ctx)
+
+	user := getAuthUser(ctx)
+	admin := server.isAdmin(user)
+
+	res := make([]WorkspaceInfo, 0, len(server.Config.Workspaces))
+	for name, ws := range server.Config.Workspaces {
+		switch {
+		case admin || ws.CanWrite(user):
+			res = append(res, WorkspaceInfo{Name: name, Access: "write"})
+		case ws.CanRead(user):
+			res = append(res, WorkspaceInfo{Name: name, Access: "read"})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	ctx.JSON(http.StatusOK, res)
+}
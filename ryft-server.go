@@ -31,6 +31,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"mime"
 	"net/http"
@@ -95,6 +96,7 @@ func main() {
 	kingpin.Flag("instance-home", "Instance home directory.").StringVar(&server.Config.InstanceHome)
 	kingpin.Flag("logging", "Fine-tuned logging levels.").StringVar(&server.Config.Logging)
 	kingpin.Flag("busyness-tolerance", "Cluster busyness tolerance.").Default("0").IntVar(&server.Config.Busyness.Tolerance)
+	kingpin.Flag("busyness-policy", "Cluster load balancing policy.").StringVar(&server.Config.Busyness.Policy)
 
 	kingpin.Flag("address", "Address:port to listen on.").Short('l').Default(":8765").StringVar(&server.Config.ListenAddress)
 	kingpin.Flag("tls", "Enable TLS/SSL.").Short('t').BoolVar(&server.Config.TLS.Enabled)
@@ -102,7 +104,7 @@ func main() {
 	kingpin.Flag("tls-key", "Key-file. Required for --tls enabled.").StringVar(&server.Config.TLS.KeyFile)
 	kingpin.Flag("tls-address", "HTTPS address:port to listen on.").Default(":8766").StringVar(&server.Config.TLS.ListenAddress)
 
-	kingpin.Flag("auth", "Authentication type: none, file, ldap.").Short('a').Default("none").EnumVar(&server.Config.AuthType, "none", "file", "ldap")
+	kingpin.Flag("auth", "Authentication type: none, file, ldap, oidc, chain.").Short('a').Default("none").EnumVar(&server.Config.AuthType, "none", "file", "ldap", "oidc", "chain")
 	kingpin.Flag("users-file", "User credentials filename. Required for --auth=file.").ExistingFileVar(&server.Config.AuthFile.UsersFile)
 	kingpin.Flag("jwt-alg", "JWT signing algorithm.").Default("HS256").StringVar(&server.Config.AuthJwt.Algorithm)
 	kingpin.Flag("jwt-secret", "JWT secret. Required for --auth=file or --auth=ldap.").StringVar(&server.Config.AuthJwt.Secret)
@@ -146,6 +148,20 @@ func main() {
 		case len(server.Config.AuthJwt.Secret) == 0:
 			kingpin.FatalUsage("jwt-secret is required for any authentication.")
 		}
+
+	case "oidc":
+		switch {
+		case len(server.Config.AuthOidc.JwksUrl) == 0 && len(server.Config.AuthOidc.JwksFile) == 0:
+			kingpin.FatalUsage("auth-oidc jwks-url or jwks-file is required for oidc authentication.")
+		}
+
+	case "chain":
+		switch {
+		case len(server.Config.AuthChain.Providers) == 0:
+			kingpin.FatalUsage("auth-chain providers are required for chained authentication.")
+		case len(server.Config.AuthJwt.Secret) == 0:
+			kingpin.FatalUsage("jwt-secret is required for any authentication.")
+		}
 	}
 
 	if server.Config.TLS.Enabled {
@@ -196,6 +212,7 @@ func main() {
 		"tls-address":        server.Config.TLS.ListenAddress,
 		"auth-type":          server.Config.AuthType,
 		"busyness-tolerance": server.Config.Busyness.Tolerance,
+		"busyness-policy":    server.Config.Busyness.Policy,
 	}).Debug("other configuration")
 	log.WithFields(map[string]interface{}{
 		"scripts": server.Config.PostProcScripts,
@@ -265,106 +282,192 @@ func main() {
 	// Enable authentication if configured
 	var authProvider auth.Provider
 	switch strings.ToLower(server.Config.AuthType) {
-	case "file":
-		file, err := auth.NewFile(server.Config.AuthFile.UsersFile)
-		if err != nil {
-			log.WithError(err).Fatal("Failed to read users file")
+	case "chain":
+		providers := make([]auth.Provider, 0, len(server.Config.AuthChain.Providers))
+		for _, authType := range server.Config.AuthChain.Providers {
+			provider, err := newAuthProvider(server, authType)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to init authentication")
+			}
+			providers = append(providers, provider)
 		}
-		authProvider = file
-
-		log.WithFields(map[string]interface{}{
-			"file": server.Config.AuthFile.UsersFile,
-		}).Info("file-based authentication is used")
-
-	case "ldap":
-		ldap, err := auth.NewLDAP(server.Config.AuthLdap)
+		chain, err := auth.NewChain(providers, server.Config.AuthChain.StopOnFailure)
 		if err != nil {
-			log.WithError(err).Fatal("Failed to init LDAP authentication")
+			log.WithError(err).Fatal("Failed to init chained authentication")
 		}
-		authProvider = ldap
+		authProvider = chain
 
 		log.WithFields(map[string]interface{}{
-			"LDAP": server.Config.AuthLdap.ServerAddress,
-		}).Info("LDAP-based authentication is used")
+			"providers":       server.Config.AuthChain.Providers,
+			"stop-on-failure": server.Config.AuthChain.StopOnFailure,
+		}).Info("chained authentication is used")
 
 	case "none", "":
 		log.Info("authentication is disabled")
 		break
 
 	default:
-		log.WithFields(map[string]interface{}{
-			"auth": server.Config.AuthType,
-		}).Fatal("unknown authentication type")
+		provider, err := newAuthProvider(server, server.Config.AuthType)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to init authentication")
+		}
+		authProvider = provider
 	}
 
 	// authentication enabled
 	if authProvider != nil {
 		mw := auth.NewMiddleware(authProvider, "")
-		secret, err := auth.ParseSecret(server.Config.AuthJwt.Secret)
-		if err != nil {
-			log.WithError(err).Fatal("Failed to parse JWT secret")
+		_, external := authProvider.(auth.BearerVerifier)
+		if !external { // tokens are issued by identity provider otherwise
+			secret, err := auth.ParseSecret(server.Config.AuthJwt.Secret)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to parse JWT secret")
+			}
+			lifetime, err := time.ParseDuration(server.Config.AuthJwt.Lifetime)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to parse JWT lifetime")
+			}
+			mw.EnableJwt(secret, server.Config.AuthJwt.Algorithm, lifetime)
+
+			// revoked tokens are kept in the settings (and shared via consul)
+			revocation, err := auth.NewRevocation(server.GetRevocationStore(), mw.TokenMaxAge())
+			if err != nil {
+				log.WithError(err).Fatal("Failed to init JWT revocation")
+			}
+			mw.EnableRevocation(revocation)
+			server.Revocation = revocation // keep it for operations
 		}
-		lifetime, err := time.ParseDuration(server.Config.AuthJwt.Lifetime)
-		if err != nil {
-			log.WithError(err).Fatal("Failed to parse JWT lifetime")
+		if server.ClusterAuth != nil {
+			mw.EnableClusterAuth(server.ClusterAuth)
+			log.Info("node-to-node authentication is enabled")
+		}
+		if cfg := server.Config.AuthLockout; cfg.MaxFailures > 0 || cfg.MaxIpFailures > 0 {
+			lockout, err := auth.NewLockout(cfg)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to init login lockout")
+			}
+			mw.EnableLockout(lockout)
+			server.Lockout = lockout // keep it for operations
+			log.WithFields(map[string]interface{}{
+				"max-failures":    cfg.MaxFailures,
+				"max-ip-failures": cfg.MaxIpFailures,
+			}).Info("failed login lockout is enabled")
 		}
-		mw.EnableJwt(secret, server.Config.AuthJwt.Algorithm, lifetime)
 		private.Use(mw.Authentication())
-		private.GET("/token/refresh", mw.RefreshHandler())
-		router.POST("/login", mw.LoginHandler())
+		if !external {
+			private.GET("/token/refresh", mw.RefreshHandler())
+			router.POST("/login", mw.LoginHandler())
+		}
 	}
 
+	// role permissions are checked for each endpoint
+	perm := server.RequirePermission
+
+	// data access and mutations are recorded to the audit log
+	audit := server.AuditAction
+
+	// request rate and concurrency limits of search requests
+	limit := server.LimitRequests()
+
 	// main API endpoints
-	private.GET("/search", server.DoSearch)
-	private.GET("/search/show", server.DoSearchShow)
-	private.GET("/search/aggs", server.DoAggregations)
-	private.GET("/count", server.DoCount)
+	private.GET("/search", audit("search"), perm(auth.PermSearch), limit, server.DoSearch)
+	private.GET("/search/show", audit("show"), perm(auth.PermSearch), limit, server.DoSearchShow)
+	private.GET("/search/aggs", audit("aggs"), perm(auth.PermSearch), limit, server.DoAggregations)
+	private.GET("/count", audit("count"), perm(auth.PermCount), limit, server.DoCount)
 	private.GET("/cluster/members", server.DoClusterMembers)
-	private.GET("/run", server.DoRun)
+	private.POST("/cluster/repair", perm(auth.PermAdmin), server.DoClusterRepair)
+	private.GET("/cluster/partitions", perm(auth.PermAdmin), server.DoGetPartitions)
+	private.PUT("/cluster/partitions", perm(auth.PermAdmin), server.DoPutPartition)
+	private.DELETE("/cluster/partitions", perm(auth.PermAdmin), server.DoDeletePartition)
+	private.GET("/cluster/balance", perm(auth.PermAdmin), server.DoClusterBalance)
+	private.POST("/cluster/rebalance", perm(auth.PermAdmin), server.DoClusterRebalance)
+	private.GET("/cluster/health", server.DoClusterHealth)
+	private.GET("/searches", server.DoGetSearches)
+	private.GET("/searches/limits", server.DoGetSearchLimits)
+	private.DELETE("/searches/:id", server.DoCancelSearch)
+	private.GET("/run", audit("run"), perm(auth.PermRun), server.DoRun)
 
 	// PCAP support
-	private.GET("/pcap/search", server.DoPcapSearch)
-	private.GET("/pcap/count", server.DoPcapCount)
-	private.POST("/pcap/search", server.DoPcapSearch)
-	private.POST("/pcap/count", server.DoPcapCount)
-	private.PUT("/pcap/search", server.DoPcapSearch)
-	private.PUT("/pcap/count", server.DoPcapCount)
+	private.GET("/pcap/search", audit("pcap.search"), perm(auth.PermPcap), limit, server.DoPcapSearch)
+	private.GET("/pcap/count", audit("pcap.count"), perm(auth.PermPcap), limit, server.DoPcapCount)
+	private.POST("/pcap/search", audit("pcap.search"), perm(auth.PermPcap), limit, server.DoPcapSearch)
+	private.POST("/pcap/count", audit("pcap.count"), perm(auth.PermPcap), limit, server.DoPcapCount)
+	private.PUT("/pcap/search", audit("pcap.search"), perm(auth.PermPcap), limit, server.DoPcapSearch)
+	private.PUT("/pcap/count", audit("pcap.count"), perm(auth.PermPcap), limit, server.DoPcapCount)
 
 	// POST & PUT aliases for requests with JSON body
-	private.POST("/search", server.DoSearch)
-	private.POST("/count", server.DoCount)
-	private.POST("/search/show", server.DoSearchShow)
-	private.POST("/search/aggs", server.DoAggregations)
-	private.PUT("/search", server.DoSearch)
-	private.PUT("/count", server.DoCount)
-	private.PUT("/search/show", server.DoSearchShow)
-	private.PUT("/search/aggs", server.DoAggregations)
+	private.POST("/search", audit("search"), perm(auth.PermSearch), limit, server.DoSearch)
+	private.POST("/count", audit("count"), perm(auth.PermCount), limit, server.DoCount)
+	private.POST("/search/show", audit("show"), perm(auth.PermSearch), limit, server.DoSearchShow)
+	private.POST("/search/aggs", audit("aggs"), perm(auth.PermSearch), limit, server.DoAggregations)
+	private.PUT("/search", audit("search"), perm(auth.PermSearch), limit, server.DoSearch)
+	private.PUT("/count", audit("count"), perm(auth.PermCount), limit, server.DoCount)
+	private.PUT("/search/show", audit("show"), perm(auth.PermSearch), limit, server.DoSearchShow)
+	private.PUT("/search/aggs", audit("aggs"), perm(auth.PermSearch), limit, server.DoAggregations)
 
 	// need to provide both URLs to disable redirecting
-	private.GET("/files", server.DoGetFiles)
-	private.GET("/files/*path", server.DoGetFiles)
-	private.DELETE("/files", server.DoDeleteFiles)
-	private.DELETE("/files/*path", server.DoDeleteFiles)
-	private.POST("/files", server.DoPostFiles)
-	private.POST("/files/*path", server.DoPostFiles)
-	private.PUT("/rename", server.DoRenameFiles)
-	private.PUT("/rename/*path", server.DoRenameFiles)
+	// gRPC service (HTTP/2 over TLS only)
+	private.POST("/ryft.Ryft/:method", audit("grpc"), limit, server.DoGrpc)
+
+	private.GET("/files", perm(auth.PermFilesRead), server.DoGetFiles)
+	private.GET("/files/*path", perm(auth.PermFilesRead), server.DoGetFiles)
+	private.DELETE("/files", audit("files.delete"), perm(auth.PermFilesDelete), server.DoDeleteFiles)
+	private.DELETE("/files/*path", audit("files.delete"), perm(auth.PermFilesDelete), server.DoDeleteFiles)
+	private.POST("/files", audit("files.upload"), perm(auth.PermFilesWrite), server.DoPostFiles)
+	private.POST("/files/*path", audit("files.upload"), perm(auth.PermFilesWrite), server.DoPostFiles)
+	private.PUT("/rename", audit("files.rename"), perm(auth.PermFilesWrite), server.DoRenameFiles)
+	private.PUT("/rename/*path", audit("files.rename"), perm(auth.PermFilesWrite), server.DoRenameFiles)
+	private.PUT("/copy", audit("files.copy"), perm(auth.PermFilesWrite), server.DoCopyFiles)
+	private.PUT("/copy/*path", audit("files.copy"), perm(auth.PermFilesWrite), server.DoCopyFiles)
+	private.PUT("/move", audit("files.move"), perm(auth.PermFilesWrite, auth.PermFilesDelete), server.DoMoveFiles)
+	private.PUT("/move/*path", audit("files.move"), perm(auth.PermFilesWrite, auth.PermFilesDelete), server.DoMoveFiles)
 
 	// alias used for swagger clients
-	private.GET("/file", server.DoGetFiles)
-	private.GET("/file/*path", server.DoGetFiles)
-	private.POST("/file", server.DoPostFiles)
-	private.POST("/file/*path", server.DoPostFiles)
-	private.POST("/raw", server.DoPostFiles)
-	private.POST("/raw/*path", server.DoPostFiles)
+	private.GET("/file", perm(auth.PermFilesRead), server.DoGetFiles)
+	private.GET("/file/*path", perm(auth.PermFilesRead), server.DoGetFiles)
+	private.POST("/file", audit("files.upload"), perm(auth.PermFilesWrite), server.DoPostFiles)
+	private.POST("/file/*path", audit("files.upload"), perm(auth.PermFilesWrite), server.DoPostFiles)
+	private.POST("/raw", audit("files.upload"), perm(auth.PermFilesWrite), server.DoPostFiles)
+	private.POST("/raw/*path", audit("files.upload"), perm(auth.PermFilesWrite), server.DoPostFiles)
+
+	// storage usage (any authentication)
+	private.GET("/user/usage", server.DoUserUsage)
+
+	// shared workspaces available to user
+	private.GET("/workspaces", server.DoWorkspaces)
 
 	// user management (file-based only)
 	if am, ok := authProvider.(auth.Manager); ok {
 		server.AuthManager = am // keep it for operations
 		private.GET("/user", server.DoUserGet)
-		private.POST("/user", server.DoUserPost)
-		private.PUT("/user", server.DoUserPut)
-		private.DELETE("/user", server.DoUserDelete)
+		private.POST("/user", audit("user.create"), server.DoUserPost)
+		private.PUT("/user", audit("user.update"), server.DoUserPut)
+		private.DELETE("/user", audit("user.delete"), server.DoUserDelete)
+	}
+
+	// API keys (file-based only)
+	if tm, ok := authProvider.(auth.TokenManager); ok {
+		server.TokenManager = tm // keep it for operations
+		private.GET("/user/tokens", server.DoUserTokensGet)
+		private.POST("/user/tokens", audit("user.token.create"), server.DoUserTokensPost)
+		private.DELETE("/user/tokens", audit("user.token.revoke"), server.DoUserTokensDelete)
+	}
+
+	// locked users and client IPs
+	if server.Lockout != nil {
+		private.GET("/user/lockout", perm(auth.PermAdmin), server.DoUserLockoutGet)
+		private.DELETE("/user/lockout", audit("user.unlock"), perm(auth.PermAdmin), server.DoUserLockoutDelete)
+	}
+
+	// JWT token revocation
+	if server.Revocation != nil {
+		private.POST("/logout", audit("logout"), server.DoLogout)
+		private.POST("/user/revoke", audit("user.sessions.revoke"), server.DoUserRevoke)
+	}
+
+	// audit log query (admin only)
+	if server.IsAuditEnabled() {
+		private.GET("/audit", audit("audit.query"), perm(auth.PermAdmin), server.DoAudit)
 	}
 
 	// debug API endpoints
@@ -374,10 +477,10 @@ func main() {
 		router.POST("/logging/level", server.DoLoggingLevel)
 
 		// a few aliases for "dry-run"...
-		private.GET("/search/dry-run", server.DoCountDryRun)
-		private.GET("/count/dry-run", server.DoCountDryRun)
-		private.GET("/search/dryrun", server.DoCountDryRun)
-		private.GET("/count/dryrun", server.DoCountDryRun)
+		private.GET("/search/dry-run", perm(auth.PermCount), server.DoCountDryRun)
+		private.GET("/count/dry-run", perm(auth.PermCount), server.DoCountDryRun)
+		private.GET("/search/dryrun", perm(auth.PermCount), server.DoCountDryRun)
+		private.GET("/count/dryrun", perm(auth.PermCount), server.DoCountDryRun)
 	}
 
 	// static assets
@@ -397,21 +500,23 @@ func main() {
 
 	// start listening on HTTPS port
 	var httpsServer *graceful.Server
-	if tls := server.Config.TLS; tls.Enabled {
+	if cfg := server.Config.TLS; cfg.Enabled {
 		httpsServer = &graceful.Server{
 			Timeout: server.Config.ShutdownTimeout,
 			Server: &http.Server{
-				Addr: tls.ListenAddress, Handler: router,
+				Addr: cfg.ListenAddress, Handler: router,
 				ReadTimeout:  server.Config.HttpTimeout,
 				WriteTimeout: server.Config.HttpTimeout,
+				// negotiate HTTP/2 (required by gRPC clients)
+				TLSConfig: &tls.Config{NextProtos: []string{"h2", "http/1.1"}},
 			},
 		}
 
 		go func() {
 			defer log.Debugf("HTTPS server has stopped")
-			log.WithField("address", tls.ListenAddress).Debugf("starting HTTPS server")
-			if err := httpsServer.ListenAndServeTLS(tls.CertFile, tls.KeyFile); err != nil {
-				log.WithError(err).WithField("address", tls.ListenAddress).Fatal("failed to listen HTTPS")
+			log.WithField("address", cfg.ListenAddress).Debugf("starting HTTPS server")
+			if err := httpsServer.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile); err != nil {
+				log.WithError(err).WithField("address", cfg.ListenAddress).Fatal("failed to listen HTTPS")
 			}
 		}()
 	}
@@ -447,3 +552,45 @@ func main() {
 
 	log.Info("server stopped")
 }
+
+// create authentication provider of the given type
+func newAuthProvider(server *rest.Server, authType string) (auth.Provider, error) {
+	switch strings.ToLower(authType) {
+	case "file":
+		file, err := auth.NewFile(server.Config.AuthFile.UsersFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read users file: %s", err)
+		}
+
+		file.Policy = server.Config.AuthFile.PasswordPolicy
+
+		log.WithFields(map[string]interface{}{
+			"file": server.Config.AuthFile.UsersFile,
+		}).Info("file-based authentication is used")
+		return file, nil
+
+	case "ldap":
+		ldap, err := auth.NewLDAP(server.Config.AuthLdap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init LDAP authentication: %s", err)
+		}
+
+		log.WithFields(map[string]interface{}{
+			"LDAP": server.Config.AuthLdap.ServerAddress,
+		}).Info("LDAP-based authentication is used")
+		return ldap, nil
+
+	case "oidc":
+		oidc, err := auth.NewOIDC(server.Config.AuthOidc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init OIDC authentication: %s", err)
+		}
+
+		log.WithFields(map[string]interface{}{
+			"issuer": server.Config.AuthOidc.Issuer,
+		}).Info("OIDC-based authentication is used")
+		return oidc, nil
+	}
+
+	return nil, fmt.Errorf("%q is unknown authentication type", authType)
+}
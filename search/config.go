@@ -37,23 +37,28 @@ import (
 	"time"
 
 	"github.com/getryft/ryft-server/search/utils"
+	"github.com/getryft/ryft-server/search/utils/trace"
 )
 
 // Config is a search configuration.
 // Contains all query related parameters.
 type Config struct {
-	Query  string   // search criteria
-	Files  []string // input file set: regular files or catalogs
-	Mode   string   // es, fhs, feds, ds, ts... "" for general syntax
-	Width  int      // surrounding width, -1 for "line"
-	Case   bool     // case sensitive flag (ES, FHS, FEDS)
-	Dist   uint     // fuzziness distance (FHS, FEDS)
-	Reduce bool     // reduce for FEDS
-	Nodes  uint     // number of hardware nodes to use (0..4)
-	Limit  int64    // limit the number of records (-1 - no limit)
-	Offset int64    // first record index (/show feature)
-	JobID  string   // Job ID to link blgeo work
-	JobType string	// type of post processing (blgeo for now)
+	Query     string        // search criteria
+	Files     []string      // input file set: regular files or catalogs
+	Mode      string        // es, fhs, feds, ds, ts... "" for general syntax
+	Width     int           // surrounding width, -1 for "line"
+	Case      bool          // case sensitive flag (ES, FHS, FEDS)
+	Dist      uint          // fuzziness distance (FHS, FEDS)
+	Reduce    bool          // reduce for FEDS
+	Nodes     uint          // number of hardware nodes to use (0..4)
+	Limit     int64         // limit the number of records (-1 - no limit)
+	Offset    int64         // first record index (/show feature)
+	JobID     string        // Job ID to link blgeo work
+	RequestID string        // search request ID, the same on all cluster nodes
+	Trace     trace.Context // request tracing, parent span
+	User      string        // user name, used for fair sharing of backend runs
+	Priority  string        // backend run priority class: "interactive" or "batch"
+	JobType   string        // type of post processing (blgeo for now)
 
 	// if not empty keep the INDEX and/or DATA file
 	// delimiter is used between records in DATA file
@@ -66,6 +71,10 @@ type Config struct {
 	KeepJobOutputAs  string
 	Delimiter   string
 	Lifetime    time.Duration
+
+	// storage quota (in bytes) of the user's home directory
+	// checked before the kept files are allocated, zero means unlimited
+	StorageQuota int64
 	Fields		string
 
 	// post-processing transformations
@@ -153,6 +162,15 @@ func (cfg *Config) Clone() *Config {
 	return newCfg
 }
 
+// TraceID gets the trace identifier (empty if tracing is disabled).
+func (cfg *Config) TraceID() string {
+	if cfg == nil {
+		return ""
+	}
+
+	return cfg.Trace.TraceID
+}
+
 // AddFile adds one or more files to the search configuration.
 func (cfg *Config) AddFile(files ...string) {
 	cfg.AddFiles(files)
@@ -275,6 +293,11 @@ func (cfg Config) String() string {
 		props = append(props, fmt.Sprintf("jobOutput:%q", cfg.KeepJobOutputAs))
 	}
 
+	// storage quota
+	if cfg.StorageQuota != 0 {
+		props = append(props, fmt.Sprintf("quota:%d", cfg.StorageQuota))
+	}
+
 	// delimiter
 	if len(cfg.Delimiter) != 0 {
 		props = append(props, fmt.Sprintf("delim:#%x", cfg.Delimiter))
@@ -51,7 +51,7 @@ type Engine interface {
 	Show(cfg *Config) (*Result, error)
 
 	// Run *synchronous* "/files" operation.
-	Files(path string, hidden bool) (*DirInfo, error)
+	Files(path string, opts FilesOptions) (*DirInfo, error)
 }
 
 // NewEngine creates new search engine by name.
@@ -71,3 +71,26 @@ func NewEngine(name string, opts map[string]interface{}) (engine Engine, err err
 
 	return nil, fmt.Errorf("%q is unknown search engine", name)
 }
+
+// NodeError is an error caused by a cluster node failure:
+// connection refused, 5xx response status, broken response stream, etc.
+// The same request can be retried on another node having the same data.
+type NodeError struct {
+	Err error
+}
+
+// NewNodeError creates new node failure error.
+func NewNodeError(err error) *NodeError {
+	return &NodeError{Err: err}
+}
+
+// Error gets the error message.
+func (e *NodeError) Error() string {
+	return e.Err.Error()
+}
+
+// IsNodeError checks if the error is caused by a cluster node failure.
+func IsNodeError(err error) bool {
+	_, ok := err.(*NodeError)
+	return ok
+}
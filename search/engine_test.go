@@ -29,6 +29,7 @@
 package search
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -59,3 +60,12 @@ func TestEngineRegister(t *testing.T) {
 	RegisterEngine(name, nil)
 	assert.Empty(t, GetAvailableEngines())
 }
+
+// test node error
+func TestNodeError(t *testing.T) {
+	err := NewNodeError(fmt.Errorf("connection refused"))
+	assert.EqualError(t, err, "connection refused")
+	assert.True(t, IsNodeError(err))
+	assert.False(t, IsNodeError(fmt.Errorf("connection refused")))
+	assert.False(t, IsNodeError(nil))
+}
@@ -33,9 +33,59 @@ package search
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
+// FilesOptions contains "/files" operation options.
+type FilesOptions struct {
+	Hidden    bool   // report hidden files
+	Recursive bool   // report content of all subdirectories
+	Glob      string // optional name filter (wildcard pattern)
+	Regexp    string // optional name filter (regular expression)
+	Checksum  bool   // report checksum of regular files
+}
+
+// String gets string representation of options.
+func (opts FilesOptions) String() string {
+	return fmt.Sprintf("Files{hidden:%t, recursive:%t, glob:%q, regexp:%q, checksum:%t}",
+		opts.Hidden, opts.Recursive, opts.Glob, opts.Regexp, opts.Checksum)
+}
+
+// NameFilter gets the name filter function.
+// Both glob and regexp filters (if provided) are applied to the base name.
+func (opts FilesOptions) NameFilter() (func(name string) bool, error) {
+	glob := opts.Glob
+	if len(glob) != 0 {
+		// check glob pattern is valid
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("bad glob pattern %q: %s", glob, err)
+		}
+	}
+
+	var re *regexp.Regexp
+	if len(opts.Regexp) != 0 {
+		var err error
+		if re, err = regexp.Compile(opts.Regexp); err != nil {
+			return nil, fmt.Errorf("bad regexp pattern %q: %s", opts.Regexp, err)
+		}
+	}
+
+	return func(name string) bool {
+		name = filepath.Base(name)
+		if len(glob) != 0 {
+			if ok, _ := filepath.Match(glob, name); !ok {
+				return false
+			}
+		}
+		if re != nil && !re.MatchString(name) {
+			return false
+		}
+
+		return true // match
+	}, nil // OK
+}
+
 type PartInfo struct {
 	Length int64 `json:"length"` // file part size, bytes.
 	Offset int64 `json:"offset"` // file part offset, bytes.
@@ -50,6 +100,9 @@ type NodeInfo struct {
 	ModTime string `json:"mtime,omitempty"` // modification time
 	Perm    string `json:"perm,omitempty"`  // permission flags
 
+	PartCount int64  `json:"part-count,omitempty"` // number of catalog's file parts
+	Checksum  string `json:"checksum,omitempty"`   // SHA-1 of regular file's content
+
 	Parts []PartInfo `json:"parts,omitempty"` // file parts
 }
 
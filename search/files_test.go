@@ -94,3 +94,33 @@ func TestIsRelativeToHome(t *testing.T) {
 	assert.False(t, IsRelativeToHome("/ryftone/", "/home/abc.txt"))
 	assert.False(t, IsRelativeToHome("/ryftone/", "home/abc.txt"))
 }
+
+// test files name filter
+func TestFilesOptionsNameFilter(t *testing.T) {
+	check := func(opts FilesOptions, name string, expected bool) {
+		match, err := opts.NameFilter()
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, match(name), "name:%q opts:%s", name, opts)
+		}
+	}
+
+	check(FilesOptions{}, "a.txt", true)
+	check(FilesOptions{Glob: "*.txt"}, "a.txt", true)
+	check(FilesOptions{Glob: "*.txt"}, "foo/a.txt", true)
+	check(FilesOptions{Glob: "*.txt"}, "a.dat", false)
+	check(FilesOptions{Regexp: "^a"}, "foo/a.dat", true)
+	check(FilesOptions{Regexp: "^a"}, "b.dat", false)
+	check(FilesOptions{Glob: "*.txt", Regexp: "^a"}, "a.txt", true)
+	check(FilesOptions{Glob: "*.txt", Regexp: "^a"}, "a.dat", false)
+	check(FilesOptions{Glob: "*.txt", Regexp: "^a"}, "b.txt", false)
+
+	_, err := FilesOptions{Glob: "["}.NameFilter()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bad glob pattern")
+	}
+
+	_, err = FilesOptions{Regexp: "("}.NameFilter()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bad regexp pattern")
+	}
+}
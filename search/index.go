@@ -113,6 +113,19 @@ func (idx *Index) UpdateHost(host string) *Index {
 	return idx
 }
 
+// AttachCluster prefixes the host with the cluster name (federated search).
+// returns the `self` pointer.
+func (idx *Index) AttachCluster(cluster string) *Index {
+	if len(cluster) != 0 {
+		if len(idx.Host) != 0 {
+			idx.Host = cluster + "/" + idx.Host
+		} else {
+			idx.Host = cluster
+		}
+	}
+	return idx
+}
+
 // SetDataPos sets position in DATA file.
 // returns the `self` pointer.
 func (idx *Index) SetDataPos(pos uint64) *Index {
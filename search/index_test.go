@@ -57,6 +57,11 @@ func TestIndexSimple(t *testing.T) {
 	idx.Release()
 	assert.Empty(t, idx.File)
 	assert.Empty(t, idx.Host)
+
+	// federated search
+	assert.Equal(t, "site-a", NewIndex("a.txt", 1, 2).AttachCluster("site-a").Host)
+	assert.Equal(t, "site-a/host", NewIndex("a.txt", 1, 2).UpdateHost("host").AttachCluster("site-a").Host)
+	assert.Equal(t, "host", NewIndex("a.txt", 1, 2).UpdateHost("host").AttachCluster("").Host)
 }
 
 // test CSV marshaling
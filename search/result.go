@@ -51,6 +51,7 @@ type Result struct {
 	// Channel of processed records (Engine -> Client)
 	RecordChan      chan *Record
 	recordsReported uint64 // number of records reported
+	bytesReported   uint64 // total data of records reported
 
 	// Done channel is used to notify client search is done (Engine -> Client)
 	DoneChan chan struct{}
@@ -104,6 +105,9 @@ func (res *Result) ErrorsReported() uint64 {
 // ReportRecord sends data record to records channel.
 func (res *Result) ReportRecord(rec *Record) {
 	atomic.AddUint64(&res.recordsReported, 1)
+	if rec != nil {
+		atomic.AddUint64(&res.bytesReported, uint64(len(rec.RawData)))
+	}
 	res.RecordChan <- rec // might be blocked!
 }
 
@@ -112,8 +116,14 @@ func (res *Result) RecordsReported() uint64 {
 	return atomic.LoadUint64(&res.recordsReported)
 }
 
+// BytesReported gets the total data size of records reported
+func (res *Result) BytesReported() uint64 {
+	return atomic.LoadUint64(&res.bytesReported)
+}
+
 // Cancel stops the search processing and ignores all records and errors.
-//  return number of ignored errors and records
+//
+//	return number of ignored errors and records
 func (res *Result) Cancel() (errors uint64, records uint64) {
 	res.JustCancel()
 
@@ -64,6 +64,12 @@ func TestResultSimple(t *testing.T) {
 	assert.EqualValues(t, 2, res.RecordsReported())
 	assert.Nil(t, <-res.RecordChan)
 	assert.Nil(t, <-res.RecordChan)
+	assert.EqualValues(t, 0, res.BytesReported())
+
+	res.ReportRecord(NewRecord(nil, []byte("hello")))
+	assert.EqualValues(t, 3, res.RecordsReported())
+	assert.EqualValues(t, 5, res.BytesReported())
+	assert.NotNil(t, <-res.RecordChan)
 
 	// simulate records reporting
 	go func() {
@@ -431,8 +431,8 @@ func (engine *Engine) Show(cfg *search.Config) (*search.Result, error) {
 }
 
 // Files starts synchronous "/files" operation.
-func (engine *Engine) Files(path string, hidden bool) (*search.DirInfo, error) {
-	return engine.Backend.Files(path, hidden)
+func (engine *Engine) Files(path string, opts search.FilesOptions) (*search.DirInfo, error) {
+	return engine.Backend.Files(path, opts)
 }
 
 // SetLogLevelString changes global module log level.
@@ -458,7 +458,11 @@ func GetLogLevel() logrus.Level {
 
 // log returns task related logger.
 func (task *Task) log() *logrus.Entry {
-	return log.WithField("task", task.Identifier)
+	entry := log.WithField("task", task.Identifier)
+	if id := task.config.TraceID(); len(id) != 0 {
+		entry = entry.WithField("trace", id)
+	}
+	return entry
 }
 
 // factory creates RyftDEC engine.
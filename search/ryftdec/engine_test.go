@@ -34,6 +34,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/getryft/ryft-server/search"
 	"github.com/getryft/ryft-server/search/testfake"
 	"github.com/getryft/ryft-server/search/utils/catalog"
 	"github.com/getryft/ryft-server/search/utils/query"
@@ -68,7 +69,7 @@ func TestEngineFiles(t *testing.T) {
 	// valid (usual case)
 	engine, err := NewEngine(f1, nil)
 	if assert.NoError(t, err) && assert.NotNil(t, engine) {
-		info, err := engine.Files("foo", false)
+		info, err := engine.Files("foo", search.FilesOptions{})
 		if assert.NoError(t, err) && assert.NotNil(t, info) {
 			assert.EqualValues(t, "foo", info.DirPath)
 
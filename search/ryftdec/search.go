@@ -42,6 +42,7 @@ import (
 	"github.com/getryft/ryft-server/search/utils"
 	"github.com/getryft/ryft-server/search/utils/catalog"
 	"github.com/getryft/ryft-server/search/utils/query"
+	"github.com/getryft/ryft-server/search/utils/trace"
 )
 
 // get backend aggregation options
@@ -370,11 +371,18 @@ func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
 	}
 
 	mux := search.NewResult()
+	if cfg.Trace.IsValid() {
+		task.span = trace.Start(cfg.Trace, TAG, trace.KindInternal)
+		task.span.SetAttribute("task", task.Identifier)
+		task.span.SetAttribute("query", task.rootQuery.String())
+	}
 	go func() {
 		// some futher cleanup
 		defer func() {
 			mux.ReportUnhandledPanic(log)
 			task.result.Drop(engine.KeepResultFiles)
+			task.span.SetAttribute("errors", mux.ErrorsReported())
+			task.span.Finish()
 			mux.ReportDone()
 			mux.Close()
 		}()
@@ -472,7 +480,7 @@ func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
 		}
 
 		// performance metrics
-		if mux.Stat != nil && cfg.Performance {
+		if mux.Stat != nil && (cfg.Performance || task.span != nil) {
 			if n := len(task.callPerfStat); n > 0 {
 				// update the last Ryft call metrics
 				task.callPerfStat[n-1]["post-proc"] = drainStart.Sub(addingStart).String()
@@ -492,7 +500,16 @@ func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
 				metrics["aggregations"] = aggsTime.String()
 			}
 
-			mux.Stat.AddPerfStat("ryftdec", metrics)
+			if cfg.Performance {
+				mux.Stat.AddPerfStat("ryftdec", metrics)
+			}
+			// intermediate steps are reported as dedicated spans
+			task.span.SetAttribute("prepare", metrics["prepare"])
+			task.span.SetAttribute("final-post-proc", metrics["final-post-proc"])
+			if v, ok := metrics["aggregations"]; ok {
+				task.span.SetAttribute("aggregations", v)
+			}
+			task.span.SetAttribute("matches", matches)
 		}
 
 		if mux.Stat != nil {
@@ -543,15 +560,27 @@ func (engine *Engine) doSearch(task *Task, opts backendOptions, query query.Quer
 	cfg.ReportData = false
 	cfg.Aggregations = nil // disable
 
+	// each Ryft call is traced as a dedicated span
+	var span *trace.Span
+	if task.span != nil {
+		span = trace.Start(task.span.TraceContext(), TAG+"-call", trace.KindInternal)
+		span.SetAttribute("step", task.subtaskId)
+		span.SetAttribute("query", cfg.Query)
+		cfg.Trace = span.TraceContext()
+	}
+	defer span.Finish()
+
 	task.log().WithFields(map[string]interface{}{
 		"query": cfg.Query,
 		"files": cfg.Files,
 	}).Infof("[%s/%d]: running backend search", TAG, task.subtaskId)
 	if err := engine.updateBackend(cfg); err != nil {
+		span.SetError(err)
 		return nil, err
 	}
 	res, err := engine.Backend.Search(cfg)
 	if err != nil {
+		span.SetError(err)
 		return nil, err
 	}
 
@@ -585,6 +614,7 @@ func (engine *Engine) doSearch(task *Task, opts backendOptions, query query.Quer
 		}
 
 		task.callPerfStat = append(task.callPerfStat, metrics)
+		span.SetAttributes(metrics)
 	}
 
 	return &result, nil // OK
@@ -45,6 +45,7 @@ import (
 	"github.com/getryft/ryft-server/search/ryftprim"
 	"github.com/getryft/ryft-server/search/utils/catalog"
 	"github.com/getryft/ryft-server/search/utils/query"
+	"github.com/getryft/ryft-server/search/utils/trace"
 	"github.com/getryft/ryft-server/search/utils/view"
 )
 
@@ -69,6 +70,8 @@ type Task struct {
 	procPerfStat map[string]interface{}   // final post-processing
 
 	UpdateHostTo string // for cluster mode
+
+	span *trace.Span // tracing span (nil if disabled)
 }
 
 // NewTask creates new task.
@@ -162,13 +162,19 @@ func (engine *Engine) prepareSearchUrl(cfg *search.Config, isShow bool) *url.URL
 	for _, t := range cfg.Transforms {
 		q.Add("transform", t.String())
 	}
+	if len(cfg.RequestID) != 0 {
+		q.Set("request-id", cfg.RequestID) // to cancel subtasks
+	}
+	if len(cfg.Priority) != 0 {
+		q.Set("priority", cfg.Priority)
+	}
 
 	u.RawQuery = q.Encode()
 	return u
 }
 
 // prepareFilesUrl formats proper /files URL based on directory name provided.
-func (engine *Engine) prepareFilesUrl(path string, hidden bool) *url.URL {
+func (engine *Engine) prepareFilesUrl(path string, opts search.FilesOptions) *url.URL {
 	// server URL should be parsed in engine initialization
 	// so we can omit error checking here
 	u, _ := url.Parse(engine.ServerURL)
@@ -177,8 +183,20 @@ func (engine *Engine) prepareFilesUrl(path string, hidden bool) *url.URL {
 	// prepare query
 	q := url.Values{}
 	q.Set("dir", path)
-	q.Set("hidden", fmt.Sprintf("%t", hidden))
+	q.Set("hidden", fmt.Sprintf("%t", opts.Hidden))
 	q.Set("local", fmt.Sprintf("%t", engine.LocalOnly))
+	if opts.Recursive {
+		q.Set("recursive", fmt.Sprintf("%t", opts.Recursive))
+	}
+	if len(opts.Glob) != 0 {
+		q.Set("glob", opts.Glob)
+	}
+	if len(opts.Regexp) != 0 {
+		q.Set("regexp", opts.Regexp)
+	}
+	if opts.Checksum {
+		q.Set("checksum", fmt.Sprintf("%t", opts.Checksum))
+	}
 
 	u.RawQuery = q.Encode()
 	return u
@@ -207,7 +225,11 @@ func GetLogLevel() logrus.Level {
 
 // log returns task related logger.
 func (task *Task) log() *logrus.Entry {
-	return log.WithField("task", task.Identifier)
+	entry := log.WithField("task", task.Identifier)
+	if id := task.config.TraceID(); len(id) != 0 {
+		entry = entry.WithField("trace", id)
+	}
+	return entry
 }
 
 // factory creates RyftHTTP engine.
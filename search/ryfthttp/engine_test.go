@@ -193,6 +193,16 @@ func TestEnginePrepareSearchUrl(t *testing.T) {
 		"http://localhost:12345/count?--internal-error-prefix=true&--internal-no-session-id=true&cs=true&format=null&local=true&nodes=3&query=hello&stats=true&stream=true")
 	cfg.Nodes = 0
 
+	cfg.RequestID = "abc123"
+	check(cfg, "http://localhost:12345", true,
+		"http://localhost:12345/count?--internal-error-prefix=true&--internal-no-session-id=true&cs=true&format=null&local=true&query=hello&request-id=abc123&stats=true&stream=true")
+	cfg.RequestID = ""
+
+	cfg.Priority = "batch"
+	check(cfg, "http://localhost:12345", true,
+		"http://localhost:12345/count?--internal-error-prefix=true&--internal-no-session-id=true&cs=true&format=null&local=true&priority=batch&query=hello&stats=true&stream=true")
+	cfg.Priority = ""
+
 	cfg.KeepDataAs = "data.bin"
 	check(cfg, "http://localhost:12345", false,
 		"http://localhost:12345/count?--internal-error-prefix=true&--internal-no-session-id=true&cs=true&data=data.bin&format=null&local=false&query=hello&stats=true&stream=true")
@@ -231,19 +241,23 @@ func TestEnginePrepareSearchUrl(t *testing.T) {
 
 // test prepare files url
 func TestEnginePrepareFilesUrl(t *testing.T) {
-	check := func(dir string, url string, hidden bool, local bool, expected string) {
+	check := func(dir string, url string, opts search.FilesOptions, local bool, expected string) {
 		engine, err := NewEngine(map[string]interface{}{
 			"server-url": url,
 			"local-only": local,
 		})
 		if assert.NoError(t, err) {
-			url := engine.prepareFilesUrl(dir, hidden)
+			url := engine.prepareFilesUrl(dir, opts)
 			assert.EqualValues(t, expected, url.String())
 		}
 	}
 
-	check("foo", "http://localhost:12345", true, false,
+	check("foo", "http://localhost:12345", search.FilesOptions{Hidden: true}, false,
 		"http://localhost:12345/files?dir=foo&hidden=true&local=false")
-	check("foo", "http://localhost:12345", false, true,
+	check("foo", "http://localhost:12345", search.FilesOptions{}, true,
 		"http://localhost:12345/files?dir=foo&hidden=false&local=true")
+	check("foo", "http://localhost:12345", search.FilesOptions{Recursive: true, Glob: "*.txt", Regexp: "^a"}, true,
+		"http://localhost:12345/files?dir=foo&glob=%2A.txt&hidden=false&local=true&recursive=true&regexp=%5Ea")
+	check("foo", "http://localhost:12345", search.FilesOptions{Checksum: true}, true,
+		"http://localhost:12345/files?checksum=true&dir=foo&hidden=false&local=true")
 }
@@ -35,6 +35,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/getryft/ryft-server/search"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -83,7 +84,7 @@ func TestFilesValid(t *testing.T) {
 		"local-only": true,
 	})
 	if assert.NoError(t, err) && assert.NotNil(t, engine) {
-		info, err := engine.Files("foo", false)
+		info, err := engine.Files("foo", search.FilesOptions{})
 		if assert.NoError(t, err) && assert.NotNil(t, info) {
 			assert.EqualValues(t, "foo", info.DirPath)
 
@@ -99,7 +100,7 @@ func TestFilesValid(t *testing.T) {
 	oldUrl := engine.ServerURL
 	engine.ServerURL = "bad-" + oldUrl
 	if assert.NotNil(t, engine) {
-		_, err := engine.Files("foo", false)
+		_, err := engine.Files("foo", search.FilesOptions{})
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "failed to send request")
 		}
@@ -110,7 +111,7 @@ func TestFilesValid(t *testing.T) {
 	oldUrl = engine.ServerURL
 	engine.ServerURL = oldUrl + "/bad"
 	if assert.NotNil(t, engine) {
-		_, err := engine.Files("foo", false)
+		_, err := engine.Files("foo", search.FilesOptions{})
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "invalid response status")
 		}
@@ -120,7 +121,7 @@ func TestFilesValid(t *testing.T) {
 	// bad case (failed to decode)
 	fs.FilesPrefix = "}"
 	if assert.NotNil(t, engine) {
-		_, err := engine.Files("foo", false)
+		_, err := engine.Files("foo", search.FilesOptions{})
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "failed to decode response")
 		}
@@ -130,7 +131,7 @@ func TestFilesValid(t *testing.T) {
 	// bad case (failed to decode - extra data)
 	fs.FilesSuffix = "{}"
 	if assert.NotNil(t, engine) {
-		_, err := engine.Files("foo", false)
+		_, err := engine.Files("foo", search.FilesOptions{})
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "failed to decode response")
 			assert.Contains(t, err.Error(), "extra data")
@@ -101,6 +101,12 @@ func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
 		req.Header.Set("Authorization", engine.AuthToken)
 	}
 
+	// tracing (remote node continues the trace)
+	if tp := task.span.TraceContext().String(); len(tp) != 0 {
+		req.Header.Set("traceparent", tp)
+	}
+	task.span.SetAttribute("url", req.URL.String())
+
 	res := search.NewResult()
 	go engine.doSearch(task, req, res)
 
@@ -143,6 +149,12 @@ func (engine *Engine) PcapSearch(cfg *search.Config) (*search.Result, error) {
 		req.Header.Set("Authorization", engine.AuthToken)
 	}
 
+	// tracing (remote node continues the trace)
+	if tp := task.span.TraceContext().String(); len(tp) != 0 {
+		req.Header.Set("traceparent", tp)
+	}
+	task.span.SetAttribute("url", req.URL.String())
+
 	res := search.NewResult()
 	go engine.doSearch(task, req, res)
 
@@ -192,6 +204,12 @@ func (engine *Engine) Show(cfg *search.Config) (*search.Result, error) {
 		req.Header.Set("Authorization", engine.AuthToken)
 	}
 
+	// tracing (remote node continues the trace)
+	if tp := task.span.TraceContext().String(); len(tp) != 0 {
+		req.Header.Set("traceparent", tp)
+	}
+	task.span.SetAttribute("url", req.URL.String())
+
 	res := search.NewResult()
 	go engine.doSearch(task, req, res)
 
@@ -203,6 +221,9 @@ func (engine *Engine) doSearch(task *Task, req *http.Request, res *search.Result
 	// some futher cleanup
 	defer func() {
 		res.ReportUnhandledPanic(log)
+		task.span.SetAttribute("records", res.RecordsReported())
+		task.span.SetAttribute("errors", res.ErrorsReported())
+		task.span.Finish()
 		res.ReportDone()
 		res.Close()
 	}()
@@ -219,7 +240,8 @@ func (engine *Engine) doSearch(task *Task, req *http.Request, res *search.Result
 	resp, err := engine.httpClient.Do(req)
 	if err != nil {
 		task.log().WithError(err).Warnf("[%s]: failed to send request", TAG)
-		res.ReportError(fmt.Errorf("failed to send request: %s", err))
+		task.span.SetError(err)
+		res.ReportError(search.NewNodeError(fmt.Errorf("failed to send request: %s", err)))
 		return // failed
 	}
 
@@ -229,7 +251,13 @@ func (engine *Engine) doSearch(task *Task, req *http.Request, res *search.Result
 	if resp.StatusCode != http.StatusOK {
 		message := getOptionalErrorMessage(resp.Body)
 		task.log().WithField("status", resp.Status).Warnf("[%s]: invalid response status: %s", TAG, message)
-		res.ReportError(fmt.Errorf("invalid response status: %s (%s)", resp.Status, message))
+		err := fmt.Errorf("invalid response status: %s (%s)", resp.Status, message)
+		task.span.SetError(err)
+		if resp.StatusCode >= 500 {
+			res.ReportError(search.NewNodeError(err)) // server failure
+		} else {
+			res.ReportError(err)
+		}
 		return // failed (not 200)
 	}
 
@@ -256,14 +284,18 @@ func (engine *Engine) doSearch(task *Task, req *http.Request, res *search.Result
 	transferStart := time.Now()
 	defer func() {
 		// performance metrics
-		if res.Stat != nil && task.config.Performance {
+		if res.Stat != nil && (task.config.Performance || task.span != nil) {
 			metrics := map[string]interface{}{
 				"prepare":  startTime.Sub(task.startTime).String(),
 				"request":  transferStart.Sub(startTime).String(),
 				"transfer": time.Since(transferStart).String(),
 			}
 
-			res.Stat.AddPerfStat("ryfthttp", metrics)
+			if task.config.Performance {
+				res.Stat.AddPerfStat("ryfthttp", metrics)
+			}
+			task.span.SetAttributes(metrics)
+			task.span.SetAttribute("matches", res.Stat.Matches)
 		}
 	}()
 
@@ -272,7 +304,7 @@ func (engine *Engine) doSearch(task *Task, req *http.Request, res *search.Result
 		tag, err := dec.NextTag()
 		if err != nil {
 			task.log().WithError(err).Warnf("[%s]: failed to decode next tag", TAG)
-			res.ReportError(fmt.Errorf("failed to decode next tag: %s", err))
+			res.ReportError(search.NewNodeError(fmt.Errorf("failed to decode next tag: %s", err)))
 			return // failed
 		}
 
@@ -285,7 +317,7 @@ func (engine *Engine) doSearch(task *Task, req *http.Request, res *search.Result
 			item := format.NewRecord()
 			if err := dec.Next(item); err != nil {
 				task.log().WithError(err).Warnf("[%s]: failed to decode record", TAG)
-				res.ReportError(fmt.Errorf("failed to decode record: %s", err))
+				res.ReportError(search.NewNodeError(fmt.Errorf("failed to decode record: %s", err)))
 				return // failed
 			} else {
 				rec := format.ToRecord(item)
@@ -312,7 +344,7 @@ func (engine *Engine) doSearch(task *Task, req *http.Request, res *search.Result
 			stat := format.NewStat()
 			if err := dec.Next(stat); err != nil {
 				task.log().WithError(err).Warnf("[%s]: failed to decode statistics", TAG)
-				res.ReportError(fmt.Errorf("failed to decode statistics: %s", err))
+				res.ReportError(search.NewNodeError(fmt.Errorf("failed to decode statistics: %s", err)))
 				return // failed
 			} else {
 				res.Stat = format.ToStat(stat)
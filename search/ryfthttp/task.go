@@ -36,6 +36,7 @@ import (
 	"time"
 
 	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils/trace"
 )
 
 var (
@@ -49,6 +50,7 @@ type Task struct {
 
 	config    *search.Config // search configuration
 	startTime time.Time      // task start time
+	span      *trace.Span    // tracing span (nil if disabled)
 }
 
 // NewTask creates new task.
@@ -60,5 +62,9 @@ func NewTask(cfg *search.Config) *Task {
 	task.startTime = time.Now()
 
 	task.config = cfg
+	if cfg != nil && cfg.Trace.IsValid() {
+		task.span = trace.Start(cfg.Trace, TAG, trace.KindClient)
+		task.span.SetAttribute("task", task.Identifier)
+	}
 	return task
 }
@@ -51,8 +51,10 @@ type Engine struct {
 	Backends  []search.Engine
 	IndexHost string // optional host in cluster mode
 
-	options  map[string]interface{}
-	override map[search.Engine]*search.Config
+	options   map[string]interface{}
+	override  map[search.Engine]*search.Config
+	fallbacks map[search.Engine][]search.Engine
+	clusters  map[search.Engine]string // federated cluster names
 }
 
 // NewEngine creates new RyftMUX search engine.
@@ -70,6 +72,27 @@ func (engine *Engine) AddBackend(backend search.Engine, cfg *search.Config) {
 	engine.override[backend] = cfg
 }
 
+// AddFallback adds replica backends for the backend.
+// If backend fails (node failure) the search is transparently
+// retried on the next replica having the same data.
+func (engine *Engine) AddFallback(backend search.Engine, replicas ...search.Engine) {
+	if engine.fallbacks == nil {
+		engine.fallbacks = make(map[search.Engine][]search.Engine)
+	}
+	engine.fallbacks[backend] = append(engine.fallbacks[backend], replicas...)
+}
+
+// AddCluster adds backend of the federated cluster.
+// The cluster name is attached to the host of all the records
+// reported by the backend and to the backend's statistics.
+func (engine *Engine) AddCluster(backend search.Engine, name string) {
+	if engine.clusters == nil {
+		engine.clusters = make(map[search.Engine]string)
+	}
+	engine.Backends = append(engine.Backends, backend)
+	engine.clusters[backend] = name
+}
+
 // String gets string representation of the engine.
 func (engine *Engine) String() string {
 	return fmt.Sprintf("ryftmux{backends:%s}", engine.Backends)
@@ -132,7 +155,11 @@ func GetLogLevel() logrus.Level {
 
 // log returns task related logger.
 func (task *Task) log() *logrus.Entry {
-	return log.WithField("task", task.Identifier)
+	entry := log.WithField("task", task.Identifier)
+	if id := task.config.TraceID(); len(id) != 0 {
+		entry = entry.WithField("trace", id)
+	}
+	return entry
 }
 
 /*
@@ -37,16 +37,19 @@ import (
 )
 
 // Files starts synchronous "/files" operation.
-func (engine *Engine) Files(path string, hidden bool) (*search.DirInfo, error) {
+func (engine *Engine) Files(path string, opts search.FilesOptions) (*search.DirInfo, error) {
 	// redirect if we have only one backend
 	if len(engine.Backends) == 1 {
 		backend := engine.Backends[0]
-		return backend.Files(path, hidden)
+		return backend.Files(path, opts)
 	}
 
 	task := NewTask(nil)
 
-	task.log().WithField("path", path).Infof("[%s]: start /files", TAG)
+	task.log().WithFields(map[string]interface{}{
+		"path": path,
+		"opts": opts,
+	}).Infof("[%s]: start /files", TAG)
 	defer task.log().Debugf("[%s]: done", TAG)
 
 	resCh := make(chan *search.DirInfo, len(engine.Backends))
@@ -61,7 +64,7 @@ func (engine *Engine) Files(path string, hidden bool) (*search.DirInfo, error) {
 				}
 			}()
 
-			res, err := backend.Files(path, hidden)
+			res, err := backend.Files(path, opts)
 			if err != nil {
 				task.log().WithError(err).Warnf("failed to start /files backend")
 				// TODO: report as multiplexed error?
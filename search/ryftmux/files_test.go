@@ -33,6 +33,7 @@ import (
 	"sort"
 	"testing"
 
+	"github.com/getryft/ryft-server/search"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -55,7 +56,7 @@ func TestEngineFiles(t *testing.T) {
 	// valid (usual case)
 	engine, err := NewEngine(f1, f2, f3)
 	if assert.NoError(t, err) && assert.NotNil(t, engine) {
-		info, err := engine.Files("foo", false)
+		info, err := engine.Files("foo", search.FilesOptions{})
 		if assert.NoError(t, err) && assert.NotNil(t, info) {
 			assert.EqualValues(t, "foo", info.DirPath)
 
@@ -70,7 +71,7 @@ func TestEngineFiles(t *testing.T) {
 	// one backend fail
 	f1.FilesReportError = fmt.Errorf("disabled")
 	if assert.Error(t, f1.FilesReportError) {
-		info, err := engine.Files("foo", false)
+		info, err := engine.Files("foo", search.FilesOptions{})
 		if assert.NoError(t, err) && assert.NotNil(t, info) {
 			assert.EqualValues(t, "foo", info.DirPath)
 
@@ -86,7 +87,7 @@ func TestEngineFiles(t *testing.T) {
 	// path inconsistency
 	f1.FilesPathSuffix = "-1"
 	if assert.NoError(t, f1.FilesReportError) {
-		info, err := engine.Files("foo", false)
+		info, err := engine.Files("foo", search.FilesOptions{})
 		if assert.Error(t, err) && assert.Nil(t, info) {
 			assert.Contains(t, err.Error(), "inconsistent directory path")
 		}
@@ -34,19 +34,33 @@ import (
 	"fmt"
 
 	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils/trace"
 )
 
+// get backend configuration
+// custom (override) configuration keeps the request ID, scheduling and trace
+func (engine *Engine) backendConfig(backend search.Engine, cfg *search.Config, parent trace.Context) *search.Config {
+	var bcfg *search.Config
+	if ocfg, ok := engine.override[backend]; ok {
+		bcfg = ocfg.Clone()
+		bcfg.RequestID = cfg.RequestID
+		bcfg.User = cfg.User
+		bcfg.Priority = cfg.Priority
+	} else {
+		bcfg = cfg.Clone()
+	}
+
+	bcfg.Trace = parent
+	return bcfg
+}
+
 // Search starts asynchronous "/search" or "/count" operation.
 func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
-	// redirect if we have only one backend
-	if len(engine.Backends) == 1 {
+	// redirect if we have only one backend (and no replicas, not federated)
+	if len(engine.Backends) == 1 && len(engine.fallbacks[engine.Backends[0]]) == 0 &&
+		len(engine.clusters) == 0 {
 		backend := engine.Backends[0]
-		var bcfg *search.Config
-		if ocfg, ok := engine.override[backend]; ok {
-			bcfg = ocfg.Clone()
-		} else {
-			bcfg = cfg.Clone()
-		}
+		bcfg := engine.backendConfig(backend, cfg, cfg.Trace)
 
 		return backend.Search(bcfg)
 	}
@@ -54,23 +68,40 @@ func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
 	task := NewTask(cfg)
 	mux := search.NewResult()
 
+	// start backend search
+	start := func(backend search.Engine, cfg *search.Config) (*search.Result, error) {
+		return backend.Search(cfg)
+	}
+
 	// prepare requests
 	for _, backend := range engine.Backends {
-		var bcfg *search.Config
-		if ocfg, ok := engine.override[backend]; ok {
-			bcfg = ocfg.Clone()
-		} else {
-			bcfg = cfg.Clone()
+		bcfg := engine.backendConfig(backend, cfg, task.span.TraceContext())
+
+		sub := &subtask{
+			backend:   backend,
+			config:    bcfg.Clone(), // keep original for failover
+			fallbacks: engine.fallbacks[backend],
+			restart:   start,
+			cluster:   engine.clusters[backend],
 		}
 
 		res, err := backend.Search(bcfg)
+		for err != nil && len(sub.fallbacks) != 0 {
+			task.log().WithError(err).Warnf("[%s]: failed to start /search backend, trying replica", TAG)
+			sub.failovers = append(sub.failovers, map[string]interface{}{
+				"error": fmt.Sprintf("failed to start /search backend: %s%s", err, getBackendInfo(sub.backend)),
+			})
+			sub.backend, sub.fallbacks = sub.fallbacks[0], sub.fallbacks[1:]
+			res, err = sub.backend.Search(sub.config.Clone())
+		}
 		if err != nil {
 			task.log().WithError(err).Warnf("[%s]: failed to start /search backend", TAG)
-			mux.ReportError(fmt.Errorf("failed to start /search backend: %s%s", err, getBackendInfo(backend)))
+			mux.ReportError(fmt.Errorf("failed to start /search backend: %s%s", err, getBackendInfo(sub.backend)))
 			continue
 		}
 
-		task.add(res)
+		sub.result = res
+		task.add(sub)
 	}
 
 	go engine.run(task, mux)
@@ -87,12 +118,7 @@ func (engine *Engine) Show(cfg *search.Config) (*search.Result, error) {
 	// redirect if we have only one backend
 	if len(engine.Backends) == 1 {
 		backend := engine.Backends[0]
-		var bcfg *search.Config
-		if ocfg, ok := engine.override[backend]; ok {
-			bcfg = ocfg.Clone()
-		} else {
-			bcfg = cfg.Clone()
-		}
+		bcfg := engine.backendConfig(backend, cfg, cfg.Trace)
 
 		return backend.Show(bcfg)
 	}
@@ -102,12 +128,7 @@ func (engine *Engine) Show(cfg *search.Config) (*search.Result, error) {
 
 	// prepare requests
 	for _, backend := range engine.Backends {
-		var bcfg *search.Config
-		if ocfg, ok := engine.override[backend]; ok {
-			bcfg = ocfg.Clone()
-		} else {
-			bcfg = cfg.Clone()
-		}
+		bcfg := engine.backendConfig(backend, cfg, task.span.TraceContext())
 
 		res, err := backend.Show(bcfg)
 		if err != nil {
@@ -116,7 +137,8 @@ func (engine *Engine) Show(cfg *search.Config) (*search.Result, error) {
 			continue
 		}
 
-		task.add(res)
+		// no failover: session data is node specific
+		task.add(&subtask{backend: backend, result: res, config: bcfg})
 	}
 
 	go engine.run(task, mux)
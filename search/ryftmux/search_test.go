@@ -169,3 +169,115 @@ func TestEngineSearchCancel(t *testing.T) {
 		}
 	}
 }
+
+// Check failover to replica backend
+func TestEngineSearchFailover(t *testing.T) {
+	testSetLogLevel()
+
+	check := func(failAfter int, withReplica bool) {
+		f1 := newFake(100, 0)
+		f1.HostName = "host-1"
+		f1.SearchFailNode = true
+		f1.SearchFailAfter = failAfter
+
+		r1 := newFake(100, 0)
+		r1.HostName = "replica-1"
+
+		f2 := newFake(10, 0)
+		f2.HostName = "host-2"
+
+		engine, err := NewEngine(f1, f2)
+		if !assert.NoError(t, err) || !assert.NotNil(t, engine) {
+			return
+		}
+		if withReplica {
+			engine.AddFallback(f1, r1)
+		}
+
+		res, err := engine.Search(search.NewConfig("hello"))
+		if !assert.NoError(t, err) || !assert.NotNil(t, res) {
+			return
+		}
+
+		records, errors := testfake.Drain(res)
+		if !withReplica {
+			assert.EqualValues(t, failAfter+f2.SearchReportRecords, len(records))
+			if assert.Len(t, errors, 1) {
+				assert.Contains(t, errors[0].Error(), `node "host-1" failed`)
+			}
+			return
+		}
+
+		// no duplicates
+		assert.EqualValues(t, r1.SearchReportRecords+f2.SearchReportRecords, len(records))
+		assert.Empty(t, errors)
+		unique := make(map[string]bool)
+		for _, rec := range records {
+			unique[fmt.Sprintf("%s#%d", rec.Index.File, rec.Index.Offset)] = true
+		}
+		assert.Len(t, unique, r1.SearchReportRecords)
+
+		// failover is reported in statistics
+		if assert.NotNil(t, res.Stat) && assert.Len(t, res.Stat.Details, 2) {
+			var failovers []interface{}
+			for _, d := range res.Stat.Details {
+				if f, ok := d.Extra[search.ExtraFailover]; ok {
+					assert.Equal(t, "replica-1", d.Host)
+					failovers = append(failovers, f)
+				}
+			}
+			if assert.Len(t, failovers, 1) {
+				assert.Contains(t, fmt.Sprintf("%v", failovers[0]), `node "host-1" failed`)
+			}
+		}
+	}
+
+	check(0, true)   // before any record
+	check(50, true)  // in the middle of stream
+	check(50, false) // no replica
+}
+
+// Check federated clusters are attached to results
+func TestEngineSearchClusters(t *testing.T) {
+	testSetLogLevel()
+
+	check := func(clusters ...string) {
+		engine, err := NewEngine()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		fakes := make(map[string]*testfake.Engine)
+		for i, name := range clusters {
+			f := newFake(10*(i+1), 0)
+			f.HostName = fmt.Sprintf("host-%d", i+1)
+			engine.AddCluster(f, name)
+			fakes[name] = f
+		}
+
+		res, err := engine.Search(search.NewConfig("hello"))
+		if !assert.NoError(t, err) || !assert.NotNil(t, res) {
+			return
+		}
+
+		records, errors := testfake.Drain(res)
+		assert.Empty(t, errors)
+		hosts := make(map[string]int)
+		for _, rec := range records {
+			hosts[rec.Index.Host]++
+		}
+		for i, name := range clusters {
+			assert.Equal(t, fakes[name].SearchReportRecords,
+				hosts[fmt.Sprintf("%s/host-%d", name, i+1)])
+		}
+
+		if assert.NotNil(t, res.Stat) && assert.Len(t, res.Stat.Details, len(clusters)) {
+			for _, d := range res.Stat.Details {
+				assert.NotNil(t, fakes[fmt.Sprintf("%v", d.Extra[search.ExtraCluster])])
+			}
+		}
+	}
+
+	check("local", "site-b")
+	check("site-b") // single cluster is not redirected
+}
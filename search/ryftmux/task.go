@@ -38,6 +38,7 @@ import (
 	"time"
 
 	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils/trace"
 )
 
 var (
@@ -52,7 +53,23 @@ type Task struct {
 	// config & results
 	config   *search.Config
 	subtasks sync.WaitGroup
-	results  []*search.Result // from each backend
+	results  []*subtask // from each backend
+	lock     sync.Mutex // protects current result of subtasks
+
+	span *trace.Span // tracing span (nil if disabled)
+}
+
+// subtask is a backend search with optional failover.
+type subtask struct {
+	backend search.Engine  // current backend
+	result  *search.Result // current result
+	config  *search.Config // backend configuration
+	cluster string         // federated cluster name (empty if not federated)
+
+	// replica backends to retry on node failure
+	fallbacks []search.Engine
+	restart   func(backend search.Engine, cfg *search.Config) (*search.Result, error)
+	failovers []map[string]interface{} // failover history
 }
 
 // NewTask creates new task.
@@ -63,13 +80,24 @@ func NewTask(cfg *search.Config) *Task {
 	task.Identifier = fmt.Sprintf("mux-%08x", id)
 
 	task.config = cfg
+	if cfg != nil && cfg.Trace.IsValid() {
+		task.span = trace.Start(cfg.Trace, TAG, trace.KindInternal)
+		task.span.SetAttribute("task", task.Identifier)
+	}
 	return task
 }
 
 // add new subtask
-func (task *Task) add(res *search.Result) {
+func (task *Task) add(sub *subtask) {
 	task.subtasks.Add(1)
-	task.results = append(task.results, res)
+	task.results = append(task.results, sub)
+}
+
+// get current result of subtask
+func (task *Task) current(sub *subtask) *search.Result {
+	task.lock.Lock()
+	defer task.lock.Unlock()
+	return sub.result
 }
 
 // process and wait all subtasks
@@ -77,12 +105,18 @@ func (engine *Engine) run(task *Task, mux *search.Result) {
 	// some futher cleanup
 	defer func() {
 		mux.ReportUnhandledPanic(log)
+		if mux.Stat != nil {
+			task.span.SetAttribute("matches", mux.Stat.Matches)
+			task.span.SetAttribute("total-bytes", mux.Stat.TotalBytes)
+		}
+		task.span.SetAttribute("subtasks", len(task.results))
+		task.span.Finish()
 		mux.ReportDone()
 		mux.Close()
 	}()
 
-	// communication channel to report completed results
-	resCh := make(chan *search.Result, len(task.results))
+	// communication channel to report completed subtasks
+	subCh := make(chan *subtask, len(task.results))
 
 	// start multiplexing results and errors
 	task.log().Debugf("[%s]: start subtask processing...", TAG)
@@ -93,98 +127,44 @@ func (engine *Engine) run(task *Task, mux *search.Result) {
 	} else {
 		recordsLimit = math.MaxUint64
 	}
-	for i, res := range task.results {
-		go func(backend search.Engine, res *search.Result) {
+	for _, sub := range task.results {
+		go func(sub *subtask) {
 			defer func() {
-				res.ReportUnhandledPanic(log)
+				task.current(sub).ReportUnhandledPanic(log)
 				task.subtasks.Done()
-				resCh <- res
+				subCh <- sub
 			}()
 
-			// drain subtask's records and errors
-			for {
-				select {
-				case err, ok := <-res.ErrorChan:
-					if ok && err != nil {
-						// TODO: mark error with subtask's tag?
-						// task.log().WithError(err).Debugf("[%s]: new error received", TAG) // FIXME: DEBUG
-						mux.ReportError(fmt.Errorf("%s%s", err, getBackendInfo(backend)))
-					}
-
-				case rec, ok := <-res.RecordChan:
-					if ok && rec != nil {
-						if atomic.AddUint64(&recordsReported, 1) <= recordsLimit {
-							// task.log().WithField("rec", rec).Debugf("[%s]: new record received", TAG) // FIXME: DEBUG
-							rec.Index.UpdateHost(engine.IndexHost) // cluster mode!
-							mux.ReportRecord(rec)
-						} else if false {
-							// we should not cancel the request here because
-							// we still need statistics and aggregations!!!
-							task.log().WithField("limit", recordsLimit).Infof("[%s]: stopped by limit", TAG)
-							errors, records := res.Cancel()
-							if errors > 0 || records > 0 {
-								task.log().WithFields(map[string]interface{}{
-									"errors":  errors,
-									"records": records,
-								}).Debugf("[%s]: some errors/records are ignored", TAG)
-							}
-							return // done!
-						}
-					}
-
-				case <-res.DoneChan:
-					// drain the whole errors channel
-					for err := range res.ErrorChan {
-						// task.log().WithError(err).Debugf("[%s]: *** new error received", TAG) // FIXME: DEBUG
-						mux.ReportError(fmt.Errorf("%s%s", err, getBackendInfo(backend)))
-					}
-
-					// drain the whole records channel
-					for rec := range res.RecordChan {
-						if atomic.AddUint64(&recordsReported, 1) <= recordsLimit {
-							// task.log().WithField("rec", rec).Debugf("[%s]: *** new record received", TAG) // FIXME: DEBUG
-							rec.Index.UpdateHost(engine.IndexHost) // cluster mode!
-							mux.ReportRecord(rec)
-						} else if false {
-							// we should not cancel the request here because
-							// we still need statistics and aggregations!!!
-							task.log().WithField("limit", recordsLimit).Infof("[%s]: *** stopped by limit", TAG)
-							errors, records := res.Cancel()
-							if errors > 0 || records > 0 {
-								task.log().WithFields(map[string]interface{}{
-									"errors":  errors,
-									"records": records,
-								}).Debugf("[%s]: *** some errors/records are ignored", TAG)
-							}
-							return // done!
-						}
-					}
-
-					// set some session specific data
-					if opts := backend.Options(); opts != nil && res.Stat != nil {
-						if url, ok := opts["--cluster-node-addr"]; ok {
-							res.Stat.AddSessionData("location", url)
-						}
-						if node, ok := opts["--cluster-node-name"]; ok {
-							res.Stat.AddSessionData("node", node)
-						}
-					}
+			// records reported by failed backends (for deduplication)
+			var reported map[string]bool
+			if len(sub.fallbacks) != 0 {
+				reported = make(map[string]bool)
+			}
 
+			for {
+				failure := engine.drain(task, mux, sub, reported, &recordsReported, recordsLimit)
+				if failure == nil {
 					return // done!
 				}
-			}
 
-		}(engine.Backends[i], res)
+				// try to retry on a replica node
+				if !engine.failover(task, mux, sub, failure) {
+					mux.ReportError(fmt.Errorf("%s%s", failure, getBackendInfo(sub.backend)))
+					return // failed
+				}
+			}
+		}(sub)
 	}
 
 	// wait for statistics and process cancellation
-	finished := make(map[*search.Result]bool)
+	finished := make(map[*subtask]bool)
 WaitLoop:
 	for _ = range task.results {
 		select {
-		case res, ok := <-resCh:
-			if ok && res != nil {
+		case sub, ok := <-subCh:
+			if ok && sub != nil {
 				// once subtask is finished combine statistics
+				res := task.current(sub)
 				task.log().WithField("result", res).
 					Infof("[%s]: subtask is finished", TAG)
 				if res.Stat != nil {
@@ -192,19 +172,28 @@ WaitLoop:
 						// create multiplexed statistics
 						mux.Stat = search.NewStat(engine.IndexHost)
 					}
+					if res.Stat.Extra == nil {
+						res.Stat.Extra = make(map[string]interface{})
+					}
 					res.Stat.Extra["--internal-cluster-mode"] = true // ! mark for sessions
+					if len(sub.failovers) != 0 {
+						res.Stat.Extra[search.ExtraFailover] = sub.failovers
+					}
+					if len(sub.cluster) != 0 {
+						res.Stat.Extra[search.ExtraCluster] = sub.cluster
+					}
 					mux.Stat.Merge(res.Stat)
 				}
-				finished[res] = true
+				finished[sub] = true
 			}
 			continue WaitLoop
 
 		case <-mux.CancelChan:
 			// cancel all unfinished tasks
 			task.log().Warnf("[%s]: cancelling by client", TAG)
-			for _, r := range task.results {
-				if !finished[r] {
-					errors, records := r.Cancel()
+			for _, sub := range task.results {
+				if !finished[sub] {
+					errors, records := task.current(sub).Cancel()
 					if errors > 0 || records > 0 {
 						task.log().WithFields(map[string]interface{}{
 							"errors":  errors,
@@ -222,3 +211,126 @@ WaitLoop:
 	task.subtasks.Wait()
 	task.log().Debugf("[%s]: done", TAG)
 }
+
+// drain subtask's records and errors.
+// return node failure error if subtask could be retried on another node.
+func (engine *Engine) drain(task *Task, mux *search.Result, sub *subtask, reported map[string]bool, recordsReported *uint64, recordsLimit uint64) (failure error) {
+	backend, res := sub.backend, task.current(sub)
+
+	// report error (node failures are reported later if there is no replica)
+	reportError := func(err error) {
+		if search.IsNodeError(err) && len(sub.fallbacks) != 0 {
+			if failure == nil {
+				failure = err
+			}
+			return
+		}
+
+		// TODO: mark error with subtask's tag?
+		mux.ReportError(fmt.Errorf("%s%s", err, getBackendInfo(backend)))
+	}
+
+	// report record (skip records already reported by failed backend)
+	reportRecord := func(rec *search.Record) {
+		if reported != nil {
+			key := fmt.Sprintf("%s#%d#%d", rec.Index.File, rec.Index.Offset, rec.Index.Length)
+			if reported[key] {
+				rec.Release()
+				return // duplicate
+			}
+			reported[key] = true
+		}
+
+		// we should not cancel the request by limit because
+		// we still need statistics and aggregations!!!
+		if atomic.AddUint64(recordsReported, 1) <= recordsLimit {
+			rec.Index.UpdateHost(engine.IndexHost) // cluster mode!
+			rec.Index.AttachCluster(sub.cluster)
+			mux.ReportRecord(rec)
+		}
+	}
+
+	for {
+		select {
+		case err, ok := <-res.ErrorChan:
+			if ok && err != nil {
+				reportError(err)
+			}
+
+		case rec, ok := <-res.RecordChan:
+			if ok && rec != nil {
+				reportRecord(rec)
+			}
+
+		case <-res.DoneChan:
+			// drain the whole errors channel
+			for err := range res.ErrorChan {
+				reportError(err)
+			}
+
+			// drain the whole records channel
+			for rec := range res.RecordChan {
+				reportRecord(rec)
+			}
+
+			if failure != nil {
+				return // failed, no session data
+			}
+
+			// set some session specific data
+			if opts := backend.Options(); opts != nil && res.Stat != nil {
+				if url, ok := opts["--cluster-node-addr"]; ok {
+					res.Stat.AddSessionData("location", url)
+				}
+				if node, ok := opts["--cluster-node-name"]; ok {
+					res.Stat.AddSessionData("node", node)
+				}
+			}
+
+			return // done!
+		}
+	}
+}
+
+// restart failed subtask on the next replica backend.
+// return false if there is no more replicas.
+func (engine *Engine) failover(task *Task, mux *search.Result, sub *subtask, failure error) bool {
+	for len(sub.fallbacks) != 0 && !mux.IsCancelled() {
+		backend := sub.fallbacks[0]
+		sub.fallbacks = sub.fallbacks[1:]
+
+		// failover details
+		info := map[string]interface{}{
+			"error": failure.Error(),
+		}
+		if opts := sub.backend.Options(); opts != nil {
+			if url, ok := opts["--cluster-node-addr"]; ok {
+				info["location"] = url
+			}
+			if node, ok := opts["--cluster-node-name"]; ok {
+				info["node"] = node
+			}
+		}
+		sub.failovers = append(sub.failovers, info)
+
+		task.log().WithError(failure).WithField("backend", backend).
+			Warnf("[%s]: subtask failed, retrying on replica%s", TAG, getBackendInfo(backend))
+		res, err := sub.restart(backend, sub.config.Clone())
+		if err != nil {
+			failure = fmt.Errorf("failed to start replica backend: %s", err)
+			sub.backend = backend // for error reporting
+			continue
+		}
+
+		task.lock.Lock()
+		sub.backend, sub.result = backend, res
+		task.lock.Unlock()
+		if mux.IsCancelled() {
+			res.Cancel() // too late
+		}
+
+		return true // OK
+	}
+
+	return false // no more replicas
+}
@@ -37,6 +37,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils/scheduler"
 )
 
 var (
@@ -112,12 +113,14 @@ func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
 	home := filepath.Join(engine.MountPoint, engine.HomeDir)
 	if err := cfg.CheckRelativeToHome(home); err != nil {
 		task.log().WithError(err).Warnf("[%s]: bad file names detected", TAG)
+		task.span.SetError(err)
+		task.span.Finish()
 		return nil, err
 	}
 
 	defer func() {
 		// in case of errors release all "read" locks
-		// run() should set lockInProgress=true until ryftprim is finished
+		// acquireAndRun() takes care of them once the search is started
 		if !task.lockInProgress {
 			task.releaseLockedFiles()
 		}
@@ -126,6 +129,8 @@ func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
 	// prepare command line arguments
 	if err := engine.prepare(cfg.Backend.Tool, task); err != nil {
 		task.log().WithError(err).Warnf("[%s]: failed to prepare", TAG)
+		task.span.SetError(err)
+		task.span.Finish()
 		return nil, fmt.Errorf("failed to prepare %s: %s", TAG, err)
 	}
 
@@ -137,12 +142,52 @@ func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
 		return res, nil // OK
 	}
 
-	err := engine.run(task, res)
+	// wait for the execution slot in background,
+	// so the queued search can be reported and cancelled
+	task.lockInProgress = true // locked files are released by the task
+	go engine.acquireAndRun(task, res)
+
+	return res, nil // OK
+}
+
+// wait for the execution slot and run the tool.
+// task.finish() is called anyway if the tool is not started.
+func (engine *Engine) acquireAndRun(task *Task, res *search.Result) {
+	defer res.ReportUnhandledPanic(log)
+
+	ticket, err := scheduler.Acquire(scheduler.Request{
+		Backend:  task.config.Backend.Tool,
+		User:     task.config.User,
+		Priority: task.config.Priority,
+		Cancel:   res.CancelChan,
+	})
+	task.ticket = ticket
 	if err != nil {
+		task.log().WithError(err).Warnf("[%s]: failed to wait in queue", TAG)
+	} else {
+		if task.ticket != nil && task.ticket.Position != 0 {
+			task.log().WithField("queue", task.ticket.Report()).
+				Infof("[%s]: started after waiting in queue", TAG)
+		}
+
+		if err = engine.run(task, res); err == nil {
+			return // processing in background
+		}
 		task.log().WithError(err).Warnf("[%s]: failed to run", TAG)
-		return nil, fmt.Errorf("failed to run %s: %s", TAG, err)
+		err = fmt.Errorf("failed to run %s: %s", TAG, err)
 	}
-	return res, nil // OK
+
+	task.ticket.Release()
+	task.lockInProgress = false
+	task.releaseLockedFiles()
+
+	if err == scheduler.ErrCancelled {
+		task.span.SetAttribute("cancelled", true)
+	} else {
+		task.span.SetError(err)
+		res.ReportError(err) // queue timeout is reported as is
+	}
+	task.finish(res)
 }
 
 // Search starts asynchronous "/pcap/search" operation.
@@ -164,12 +209,16 @@ func (engine *Engine) Show(cfg *search.Config) (*search.Result, error) {
 	home := filepath.Join(engine.MountPoint, engine.HomeDir)
 	if err := cfg.CheckRelativeToHome(home); err != nil {
 		task.log().WithError(err).Warnf("[%s]: bad file names detected", TAG)
+		task.span.SetError(err)
+		task.span.Finish()
 		return nil, err
 	}
 
 	// prepare command line arguments
 	if err := engine.prepare(cfg.Backend.Tool, task); err != nil {
 		task.log().WithError(err).Warnf("[%s]: failed to prepare", TAG)
+		task.span.SetError(err)
+		task.span.Finish()
 		return nil, fmt.Errorf("failed to prepare %s: %s", TAG, err)
 	}
 
@@ -189,7 +238,7 @@ func (engine *Engine) Show(cfg *search.Config) (*search.Result, error) {
 }
 
 // Files starts synchronous "/files" operation.
-func (engine *Engine) Files(path string, hidden bool) (*search.DirInfo, error) {
+func (engine *Engine) Files(path string, opts search.FilesOptions) (*search.DirInfo, error) {
 	home := filepath.Join(engine.MountPoint, engine.HomeDir)
 	if !search.IsRelativeToHome(home, filepath.Join(home, path)) {
 		return nil, fmt.Errorf("%q is not relative to user's home", path)
@@ -198,10 +247,11 @@ func (engine *Engine) Files(path string, hidden bool) (*search.DirInfo, error) {
 	log.WithFields(map[string]interface{}{
 		"home": home,
 		"path": path,
+		"opts": opts,
 	}).Infof("[%s]: start /files", TAG)
 
 	// read directory content
-	info, err := ReadDirOrCatalog(home, path, hidden, true, engine.IndexHost)
+	info, err := ReadDirOrCatalog(home, path, opts, true, engine.IndexHost)
 	if err != nil {
 		log.WithError(err).Warnf("[%s]: failed to read directory content", TAG)
 		return nil, fmt.Errorf("failed to read directory content: %s", err)
@@ -234,7 +284,11 @@ func GetLogLevel() logrus.Level {
 
 // log returns task related log entry.
 func (task *Task) log() *logrus.Entry {
-	return log.WithField("task", task.Identifier)
+	entry := log.WithField("task", task.Identifier)
+	if id := task.config.TraceID(); len(id) != 0 {
+		entry = entry.WithField("trace", id)
+	}
+	return entry
 }
 
 // log returns reader related log entry.
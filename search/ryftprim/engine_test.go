@@ -30,6 +30,7 @@ package ryftprim
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -140,7 +141,7 @@ func TestEngineFiles(t *testing.T) {
 		return
 	}
 
-	res, err := engine.Files("/", false)
+	res, err := engine.Files("/", search.FilesOptions{})
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -149,13 +150,13 @@ func TestEngineFiles(t *testing.T) {
 	assert.NotEmpty(t, res.Files)
 
 	// fail on missing directory
-	_, err = engine.Files("missing-tmp-dir", false)
+	_, err = engine.Files("missing-tmp-dir", search.FilesOptions{})
 	if assert.Error(t, err) {
 		assert.Contains(t, err.Error(), "failed to read directory content")
 	}
 
 	// fail on bad file
-	_, err = engine.Files("../dir", false)
+	_, err = engine.Files("../dir", search.FilesOptions{})
 	if assert.Error(t, err) {
 		assert.Contains(t, err.Error(), "is not relative to user's home")
 	}
@@ -411,6 +412,63 @@ func TestEngineUsualNoOutput(t *testing.T) {
 	}
 }
 
+// kept results exceed storage quota
+func TestEngineQuotaExceeded(t *testing.T) {
+	SetLogLevelString(testLogLevel)
+
+	// prepare ryftprim emulation script
+	root := fmt.Sprintf("/tmp/ryft-%x", time.Now().UnixNano())
+	prim := fmt.Sprintf("/tmp/ryftprim-%x.sh", time.Now().UnixNano())
+	assert.NoError(t, testWriteScript3(prim, root))
+	assert.NoError(t, os.MkdirAll(root, 0755))
+	defer os.RemoveAll(prim)
+	defer os.RemoveAll(root)
+
+	cfg := search.NewConfig("hello", "1.txt", "2.txt")
+	cfg.Mode = "es"
+	cfg.KeepIndexAs = "ryftprim-index.txt"
+	cfg.KeepDataAs = "ryftprim-data.bin"
+	cfg.Delimiter = "\r\n\f"
+	cfg.ReportIndex = true
+	cfg.ReportData = true
+	cfg.StorageQuota = 50 // less than written
+	cfg.Backend.Path = []string{prim}
+	cfg.Backend.Tool = "testprim"
+
+	engine, err := factory(map[string]interface{}{
+		"instance-name":           ".test",
+		"ryftprim-legacy":         true,
+		"ryftprim-kill-on-cancel": true,
+		"ryftone-mount":           root,
+		"home-dir":                "ryftprim",
+		"minimize-latency":        true,
+		"index-host":              "hozt",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	res, err := engine.Search(cfg)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	<-res.DoneChan // wait results
+
+	if assert.EqualValues(t, 1, res.ErrorsReported()) {
+		if err := <-res.ErrorChan; assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "storage quota exceeded")
+			assert.Contains(t, err.Error(), "of 50 bytes used")
+		}
+	}
+
+	// kept files are removed
+	_, err = os.Stat(filepath.Join(root, "ryftprim", "ryftprim-index.txt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "ryftprim", "ryftprim-data.bin"))
+	assert.True(t, os.IsNotExist(err))
+}
+
 // bad search mode
 func TestEngineBadSearchMode(t *testing.T) {
 	SetLogLevelString(testLogLevel)
@@ -496,6 +554,18 @@ func TestEngineBadPath(t *testing.T) {
 		assert.Contains(t, err.Error(), "is not relative to home")
 	}
 	cfg.KeepDataAs = ""
+
+	// storage quota exceeded
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "ryftprim"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "ryftprim", "1.txt"), []byte("hello"), 0644))
+	cfg.KeepDataAs = "data.txt"
+	cfg.StorageQuota = 5
+	_, err = engine.Search(cfg)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "storage quota exceeded: 5 of 5 bytes used")
+	}
+	cfg.KeepDataAs = ""
+	cfg.StorageQuota = 0
 }
 
 // failed to start tool
@@ -530,9 +600,14 @@ func TestEngineFailedToStartTool(t *testing.T) {
 
 	os.RemoveAll(prim)
 
-	_, err = engine.Search(cfg)
-	if assert.Error(t, err) {
-		assert.Contains(t, err.Error(), "failed to start tool")
+	// the tool is started in background
+	res, err := engine.Search(cfg)
+	if assert.NoError(t, err) {
+		err = <-res.ErrorChan
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "failed to start tool")
+		}
+		<-res.DoneChan
 	}
 }
 
@@ -31,8 +31,12 @@
 package ryftprim
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -42,42 +46,67 @@ import (
 )
 
 // ReadDirOrCatalog gets directory or catalog content from filesystem.
-func ReadDirOrCatalog(mountPoint, dirPath string, hidden, details bool, host string) (*search.DirInfo, error) {
+func ReadDirOrCatalog(mountPoint, dirPath string, opts search.FilesOptions, details bool, host string) (*search.DirInfo, error) {
 	// try to detect catalogs
 	if cat, err := catalog.OpenCatalogReadOnly(filepath.Join(mountPoint, dirPath)); err == nil {
 		defer cat.Close()
-		return ReadCatalog(mountPoint, dirPath, details, host)
+		return ReadCatalog(mountPoint, dirPath, opts, details, host)
 	}
 
-	return ReadDir(mountPoint, dirPath, hidden, details, host)
+	return ReadDir(mountPoint, dirPath, opts, details, host)
 }
 
 // ReadDir gets directory content from filesystem.
-// if hidden is `true` then all hidden files are also reported.
-func ReadDir(mountPoint, dirPath string, hidden, details bool, host string) (*search.DirInfo, error) {
-	// read directory content
-	items, err := ioutil.ReadDir(filepath.Join(mountPoint, dirPath))
+// if opts.Hidden is `true` then all hidden files are also reported.
+// if opts.Recursive is `true` then content of all subdirectories
+// is also reported (names are relative to the dirPath).
+func ReadDir(mountPoint, dirPath string, opts search.FilesOptions, details bool, host string) (*search.DirInfo, error) {
+	match, err := opts.NameFilter()
 	if err != nil {
 		return nil, err
 	}
 
+	res := search.NewDirInfo(dirPath, "")
+	nodes := make(map[string]search.NodeInfo)
+	if err := readDir(filepath.Join(mountPoint, dirPath), "", opts, match, res, nodes); err != nil {
+		return nil, err
+	}
+
+	if details {
+		res.Details[host] = nodes
+	}
+
+	return res, nil // OK
+}
+
+// readDir reads one directory level.
+// the prefix is the relative path of the directory being read.
+func readDir(root, prefix string, opts search.FilesOptions, match func(string) bool, res *search.DirInfo, nodes map[string]search.NodeInfo) error {
+	dirPath := filepath.Join(root, prefix)
+
+	// read directory content
+	items, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+
 	// need to hide catalog's data directory
-	dirsToHide := make([]string, 0)
+	dirsToHide := make(map[string]bool)
 
 	// and some catalog's worker files
-	filesToHide := make([]string, 0)
+	filesToHide := make(map[string]bool)
 
 	// useful files and directories
 	catalogs := make([]string, 0)
 	files := make(map[string]int)
 	dirs := make(map[string]int)
-	nodes := make(map[string]search.NodeInfo)
+	level := make(map[string]search.NodeInfo)
 
 	// process directory content
 	for _, item := range items {
 		name := item.Name()
 
-		if hidden {
+		if opts.Hidden {
 			/*if name == "." || name == ".." {
 				continue // skip "." and ".."
 			}*/
@@ -97,68 +126,98 @@ func ReadDir(mountPoint, dirPath string, hidden, details bool, host string) (*se
 			files[name]++
 
 			// try to detect catalogs
-			if cat, err := catalog.OpenCatalogReadOnly(filepath.Join(mountPoint, dirPath, name)); err == nil {
+			if cat, err := catalog.OpenCatalogReadOnly(filepath.Join(dirPath, name)); err == nil {
 				defer cat.Close()
 
 				catalogs = append(catalogs, name)
 
 				// hide catalog's data directory from result
 				dataDir := cat.GetDataDir()
-				if dir, err := filepath.Rel(filepath.Join(mountPoint, dirPath), dataDir); err == nil {
-					dirsToHide = append(dirsToHide, dir)
+				if dir, err := filepath.Rel(dirPath, dataDir); err == nil {
+					dirsToHide[dir] = true
 				}
 
 				// SQLite uses these files for internal purposes
-				filesToHide = append(filesToHide,
-					fmt.Sprintf("%s-shm", name),
-					fmt.Sprintf("%s-wal", name))
+				filesToHide[fmt.Sprintf("%s-shm", name)] = true
+				filesToHide[fmt.Sprintf("%s-wal", name)] = true
 
 				info.Type = "catalog"
 				info.Length, err = cat.GetTotalDataSize()
 				if err != nil {
-					return nil, fmt.Errorf("failed to get catalog's length: %s", err)
+					return fmt.Errorf("failed to get catalog's length: %s", err)
+				}
+				info.PartCount, err = cat.GetPartCount()
+				if err != nil {
+					return fmt.Errorf("failed to get catalog's part count: %s", err)
 				}
 			} else if err != catalog.ErrNotACatalog {
-				return nil, fmt.Errorf("failed to open catalog: %s", err)
+				return fmt.Errorf("failed to open catalog: %s", err)
 			} else {
 				info.Type = "file"
 				info.Length = item.Size()
+				if opts.Checksum {
+					// unreadable files have no checksum
+					info.Checksum, _ = getFileChecksum(filepath.Join(dirPath, name))
+				}
 			}
 		}
 
-		nodes[name] = info
+		level[name] = info
 	}
 
 	// hide catalog's data directories
-	for _, dir := range dirsToHide {
-		delete(nodes, dir)
+	for dir := range dirsToHide {
+		delete(level, dir)
 		delete(dirs, dir)
 	}
 
 	// hide catalog's internal files
-	for _, file := range filesToHide {
-		delete(nodes, file)
+	for file := range filesToHide {
+		delete(level, file)
 		delete(files, file)
 	}
 
-	// populate result
-	res := search.NewDirInfo(dirPath, "")
+	// populate result (filtered)
 	for name := range files {
-		res.AddFile(name)
+		if match(name) {
+			res.AddFile(filepath.Join(prefix, name))
+		}
+	}
+	for _, name := range catalogs {
+		if match(name) {
+			res.AddCatalog(filepath.Join(prefix, name))
+		}
 	}
-	res.AddCatalog(catalogs...)
 	for name := range dirs {
-		res.AddDir(name)
+		if match(name) {
+			res.AddDir(filepath.Join(prefix, name))
+		}
 	}
-	if details {
-		res.Details[host] = nodes
+	for name, info := range level {
+		if match(name) {
+			nodes[filepath.Join(prefix, name)] = info
+		}
 	}
 
-	return res, nil // OK
+	// go deeper (all subdirectories are processed, even not matched)
+	if opts.Recursive {
+		for name := range dirs {
+			if err := readDir(root, filepath.Join(prefix, name), opts, match, res, nodes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil // OK
 }
 
 // ReadCatalog gets catalog content.
-func ReadCatalog(mountPoint, catPath string, details bool, host string) (*search.DirInfo, error) {
+func ReadCatalog(mountPoint, catPath string, opts search.FilesOptions, details bool, host string) (*search.DirInfo, error) {
+	match, err := opts.NameFilter()
+	if err != nil {
+		return nil, err
+	}
+
 	// read directory content
 	cat, err := catalog.OpenCatalogReadOnly(filepath.Join(mountPoint, catPath))
 	if err != nil {
@@ -170,16 +229,17 @@ func ReadCatalog(mountPoint, catPath string, details bool, host string) (*search
 	if err != nil {
 		return nil, fmt.Errorf("failed to get catalog content: %s", err)
 	}
-	files := make(map[string]int)
 
 	// process catalog content
 	for name, _ := range parts {
-		files[name]++
+		if !match(name) {
+			delete(parts, name)
+		}
 	}
 
 	// populate result
 	res := search.NewDirInfo("", catPath)
-	for name := range files {
+	for name := range parts {
 		res.AddFile(name)
 	}
 	if details {
@@ -188,3 +248,19 @@ func ReadCatalog(mountPoint, catPath string, details bool, host string) (*search
 
 	return res, nil // OK
 }
+
+// get SHA-1 checksum of file content (hex)
+func getFileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil // OK
+}
@@ -37,6 +37,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/getryft/ryft-server/search"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,7 +50,7 @@ func TestDirInfoRead(t *testing.T) {
 	ioutil.WriteFile(filepath.Join(root, "foo/.789"), []byte("hello"), 0644)
 	defer os.RemoveAll(root)
 
-	info, err := ReadDir(root, "foo", false, true, "host")
+	info, err := ReadDir(root, "foo", search.FilesOptions{}, true, "host")
 	if assert.NoError(t, err) {
 		sort.Strings(info.Files)
 		assert.EqualValues(t, "foo", info.DirPath)
@@ -57,7 +58,7 @@ func TestDirInfoRead(t *testing.T) {
 		assert.EqualValues(t, []string{"dir"}, info.Dirs)
 	}
 
-	info, err = ReadDir(root, "foo", true, true, "host")
+	info, err = ReadDir(root, "foo", search.FilesOptions{Hidden: true}, true, "host")
 	if assert.NoError(t, err) {
 		sort.Strings(info.Files)
 		assert.EqualValues(t, "foo", info.DirPath)
@@ -66,9 +67,59 @@ func TestDirInfoRead(t *testing.T) {
 	}
 }
 
+// test read dir info (recursive and filtered)
+func TestDirInfoReadRecursive(t *testing.T) {
+	root := fmt.Sprintf("/tmp/ryft-%x", time.Now().UnixNano())
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "foo/dir/sub"), 0755))
+	ioutil.WriteFile(filepath.Join(root, "foo/123.txt"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "foo/456.dat"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "foo/dir/789.txt"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "foo/dir/sub/000.txt"), []byte("hello world"), 0644)
+	defer os.RemoveAll(root)
+
+	info, err := ReadDir(root, "foo", search.FilesOptions{Recursive: true}, true, "host")
+	if assert.NoError(t, err) {
+		sort.Strings(info.Files)
+		sort.Strings(info.Dirs)
+		assert.EqualValues(t, "foo", info.DirPath)
+		assert.EqualValues(t, []string{"123.txt", "456.dat", "dir/789.txt", "dir/sub/000.txt"}, info.Files)
+		assert.EqualValues(t, []string{"dir", "dir/sub"}, info.Dirs)
+		if node, ok := info.Details["host"]["dir/sub/000.txt"]; assert.True(t, ok) {
+			assert.EqualValues(t, "file", node.Type)
+			assert.EqualValues(t, 11, node.Length)
+		}
+	}
+
+	info, err = ReadDir(root, "foo", search.FilesOptions{Recursive: true, Glob: "*.txt"}, true, "host")
+	if assert.NoError(t, err) {
+		sort.Strings(info.Files)
+		assert.EqualValues(t, []string{"123.txt", "dir/789.txt", "dir/sub/000.txt"}, info.Files)
+		assert.Empty(t, info.Dirs)
+		assert.Len(t, info.Details["host"], 3)
+	}
+
+	info, err = ReadDir(root, "foo", search.FilesOptions{Glob: "*.txt", Regexp: "^[0-4]"}, true, "host")
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, []string{"123.txt"}, info.Files)
+		assert.Empty(t, info.Dirs)
+	}
+
+	info, err = ReadDir(root, "foo", search.FilesOptions{Glob: "123.txt", Checksum: true}, true, "host")
+	if assert.NoError(t, err) {
+		if node, ok := info.Details["host"]["123.txt"]; assert.True(t, ok) {
+			assert.EqualValues(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", node.Checksum) // sha1("hello")
+		}
+	}
+
+	_, err = ReadDir(root, "foo", search.FilesOptions{Regexp: "("}, true, "host")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bad regexp pattern")
+	}
+}
+
 // test read missing dir info
 func TestDirInfoReadBad(t *testing.T) {
-	info, err := ReadDir("/", "etc-missing-directory-name", false, true, "host")
+	info, err := ReadDir("/", "etc-missing-directory-name", search.FilesOptions{}, true, "host")
 	if assert.Error(t, err) {
 		assert.Contains(t, err.Error(), "no such file or directory")
 		assert.Nil(t, info)
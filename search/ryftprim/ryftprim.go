@@ -55,6 +55,59 @@ func (task *Task) releaseLockedFiles() {
 	task.lockedFiles = nil
 }
 
+// get output files to be kept (absolute)
+func (task *Task) keptFiles() []string {
+	var files []string
+	if task.KeepIndexFile && len(task.IndexFileName) != 0 {
+		files = append(files, task.IndexFileName)
+	}
+	if task.KeepDataFile && len(task.DataFileName) != 0 {
+		files = append(files, task.DataFileName)
+	}
+	if len(task.ViewFileName) != 0 {
+		files = append(files, task.ViewFileName)
+	}
+
+	return files
+}
+
+// get total size of existing files
+func getFilesSize(files []string) int64 {
+	var total int64
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+	}
+
+	return total
+}
+
+// check storage quota on bytes actually written to the kept output files.
+// the kept files are removed if quota is exceeded.
+func (task *Task) checkQuota() error {
+	quota := task.config.StorageQuota
+	files := task.keptFiles()
+	if quota <= 0 || len(files) == 0 {
+		return nil // no quota or nothing kept
+	}
+
+	used := task.quotaUsed + getFilesSize(files)
+	if used <= quota {
+		return nil // OK
+	}
+
+	for _, path := range files {
+		if err := os.RemoveAll(path); err != nil {
+			task.log().WithError(err).WithField("path", path).
+				Warnf("[%s]: failed to remove kept file", TAG)
+			// WARN: error actually ignored!
+		}
+	}
+
+	return fmt.Errorf("storage quota exceeded: %d of %d bytes used", used, quota)
+}
+
 // Prepare `ryftprim` command line arguments.
 // This function converts search configuration to `ryftprim` command line arguments.
 // See `ryftprim -h` for option description.
@@ -179,6 +232,19 @@ func (engine *Engine) prepare(backend string, task *Task) error {
 		args = append(args, "-n", fmt.Sprintf("%d", cfg.Nodes))
 	}
 
+	// check storage quota before any output file is kept
+	if cfg.StorageQuota > 0 && (len(cfg.KeepIndexAs) != 0 ||
+		len(cfg.KeepDataAs) != 0 || len(cfg.KeepViewAs) != 0) {
+		used, err := utils.GetDiskUsage(filepath.Join(engine.MountPoint, engine.HomeDir))
+		if err != nil {
+			return fmt.Errorf("failed to get storage usage: %s", err)
+		}
+		if used >= cfg.StorageQuota {
+			return fmt.Errorf("storage quota exceeded: %d of %d bytes used", used, cfg.StorageQuota)
+		}
+		task.quotaUsed = used
+	}
+
 	// INDEX output file
 	if cfg.ReportIndex || len(cfg.KeepIndexAs) != 0 || cfg.Aggregations != nil {
 		if len(cfg.KeepIndexAs) != 0 {
@@ -220,6 +286,11 @@ func (engine *Engine) prepare(backend string, task *Task) error {
 		task.ViewFileName = filepath.Join(engine.MountPoint, engine.HomeDir, cfg.KeepViewAs)
 	}
 
+	// existing kept files are overwritten
+	if cfg.StorageQuota > 0 {
+		task.quotaUsed -= getFilesSize(task.keptFiles())
+	}
+
 	// backend options (should be added to the END)
 	args = append(args, cfg.Backend.Opts...)
 
@@ -338,7 +409,7 @@ func (engine *Engine) process(task *Task, res *search.Result, minimizeLatency bo
 
 // Finish the `ryftprim` task processing.
 func (task *Task) finish(res *search.Result) {
-	if res.Stat != nil && task.config.Performance {
+	if res.Stat != nil && (task.config.Performance || task.span != nil) {
 		metrics := make(map[string]interface{})
 
 		if !task.toolStartTime.IsZero() {
@@ -351,11 +422,19 @@ func (task *Task) finish(res *search.Result) {
 			metrics["read-data"] = time.Since(task.readStartTime).String()
 		}
 
+		if task.ticket != nil {
+			metrics["queue"] = task.ticket.Wait.String()
+		}
 		if !task.aggsStartTime.IsZero() {
 			metrics["aggregations"] = task.aggsStopTime.Sub(task.aggsStartTime).String()
 		}
 
-		res.Stat.AddPerfStat("ryftprim", metrics)
+		if task.config.Performance {
+			res.Stat.AddPerfStat("ryftprim", metrics)
+		}
+		task.span.SetAttributes(metrics)
+		task.span.SetAttribute("matches", res.Stat.Matches)
+		task.span.SetAttribute("total-bytes", res.Stat.TotalBytes)
 	}
 
 	if res.Stat != nil {
@@ -374,8 +453,16 @@ func (task *Task) finish(res *search.Result) {
 
 		// save backend tool used
 		res.Stat.Extra["backend"] = task.config.Backend.Tool
+
+		// queue position and wait time
+		if task.ticket != nil {
+			res.Stat.Extra[search.ExtraQueue] = task.ticket.Report()
+		}
 	}
 
+	task.span.SetAttribute("backend", task.config.Backend.Tool)
+	task.span.Finish()
+
 	res.ReportDone()
 	res.Close()
 }
@@ -383,6 +470,7 @@ func (task *Task) finish(res *search.Result) {
 // Finish the `ryftprim` tool processing.
 func (engine *Engine) finish(err error, task *Task, res *search.Result) {
 	task.toolStopTime = time.Now() // performance metric
+	task.ticket.Release()          // the tool is finished, next one can be started
 
 	// some futher cleanup
 	defer task.finish(res)
@@ -425,6 +513,11 @@ func (engine *Engine) finish(err error, task *Task, res *search.Result) {
 	}
 
 	// notify client about error
+	if err == ErrCancelled {
+		task.span.SetAttribute("cancelled", true)
+	} else if err != nil {
+		task.span.SetError(err)
+	}
 	if err != nil && err != ErrCancelled {
 		res.ReportError(fmt.Errorf("%s failed with %s\n%s",
 			task.config.Backend.Tool, err, out))
@@ -530,6 +623,14 @@ func (engine *Engine) finish(err error, task *Task, res *search.Result) {
 		}()
 	}
 
+	// enforce storage quota on the kept output files
+	if !task.isShow {
+		if err := task.checkQuota(); err != nil {
+			task.log().WithError(err).Warnf("[%s]: kept files removed", TAG)
+			res.ReportError(err)
+		}
+	}
+
 	// cleanup: remove INDEX&DATA files at the end of processing
 	if !task.isShow && !engine.KeepResultFiles && !task.KeepIndexFile && len(task.IndexFileName) != 0 {
 		if err := os.RemoveAll(task.IndexFileName); err != nil {
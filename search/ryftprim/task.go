@@ -40,6 +40,8 @@ import (
 	"time"
 
 	"github.com/getryft/ryft-server/search"
+	"github.com/getryft/ryft-server/search/utils/scheduler"
+	"github.com/getryft/ryft-server/search/utils/trace"
 )
 
 var (
@@ -74,6 +76,9 @@ type Task struct {
 	lockedFiles    []string
 	lockInProgress bool
 
+	// storage used by other files if quota is set
+	quotaUsed int64
+
 	// performance metrics
 	taskStartTime time.Time // task start time
 	toolStartTime time.Time
@@ -81,6 +86,12 @@ type Task struct {
 	readStartTime time.Time
 	aggsStartTime time.Time
 	aggsStopTime  time.Time
+
+	// tracing span (nil if disabled)
+	span *trace.Span
+
+	// execution slot (nil if admission control is disabled)
+	ticket *scheduler.Ticket
 }
 
 // NewTask creates new task.
@@ -93,6 +104,10 @@ func NewTask(config *search.Config, isShow bool) *Task {
 
 	task.config = config
 	task.isShow = isShow
+	if config != nil && config.Trace.IsValid() {
+		task.span = trace.Start(config.Trace, TAG, trace.KindInternal)
+		task.span.SetAttribute("task", task.Identifier)
+	}
 	return task
 }
 
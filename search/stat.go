@@ -179,6 +179,9 @@ const (
 	ExtraSessionData  = "session-data"
 	ExtraAggregations = "aggregations"
 	ExtraDebug        = "debug"
+	ExtraFailover     = "failover"
+	ExtraQueue        = "queue"
+	ExtraCluster      = "cluster"
 )
 
 // AddPerfStat adds extra performance metrics.
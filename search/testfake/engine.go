@@ -63,6 +63,8 @@ type Engine struct {
 	SearchReportLatency time.Duration
 	SearchCfgLogTrace   []search.Config
 	SearchIsJsonArray   bool
+	SearchFailNode      bool // report node failure (no stat)...
+	SearchFailAfter     int  // ...after a number of records reported
 
 	// report to /files
 	FilesReportError error
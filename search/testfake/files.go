@@ -39,7 +39,7 @@ import (
 )
 
 // Files starts synchronous "/files" operation.
-func (engine *Engine) Files(path string, hidden bool) (*search.DirInfo, error) {
+func (engine *Engine) Files(path string, opts search.FilesOptions) (*search.DirInfo, error) {
 	// report pre-defined error?
 	if engine.FilesReportError != nil {
 		return nil, engine.FilesReportError
@@ -61,7 +61,7 @@ func (engine *Engine) Files(path string, hidden bool) (*search.DirInfo, error) {
 	}).Infof("[%s]: start /files", TAG)
 
 	// read directory content
-	info, err := ryftprim.ReadDir(home, path, hidden, true, engine.HostName)
+	info, err := ryftprim.ReadDir(home, path, opts, true, engine.HostName)
 	if err != nil {
 		log.WithError(err).Warnf("[%s]: failed to read directory content", TAG)
 		return nil, fmt.Errorf("failed to read directory content: %s", err)
@@ -65,6 +65,11 @@ func (engine *Engine) Search(cfg *search.Config) (*search.Result, error) {
 			ne := int64(engine.SearchReportErrors)
 			cancelled := 0
 			for (nr > 0 || ne > 0) && cancelled <= engine.SearchCancelDelay {
+				if engine.SearchFailNode && int64(engine.SearchReportRecords)-nr >= int64(engine.SearchFailAfter) {
+					res.ReportError(search.NewNodeError(fmt.Errorf("node %q failed", engine.HostName)))
+					return // no stat
+				}
+
 				if rand.Int63n(ne+nr) >= ne {
 					data := []byte(fmt.Sprintf("data-%x", nr))
 					idx := search.NewIndex(fmt.Sprintf("file-%d.txt", nr), uint64(nr), uint64(len(data)))
@@ -0,0 +1,343 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backup file suffix time format (sortable)
+const backupTimeFormat = "20060102-150405.000000"
+
+// Record is an audit record of data access or mutation.
+type Record struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"` // "search", "files.delete", "user.create", ...
+	User     string    `json:"user,omitempty"`
+	ClientIP string    `json:"client-ip,omitempty"`
+	Node     string    `json:"node,omitempty"` // the node handled request
+	Method   string    `json:"method,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Status   int       `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Duration float64   `json:"duration"` // milliseconds
+
+	// search related
+	RequestID  string   `json:"request-id,omitempty"`
+	Query      string   `json:"query,omitempty"`
+	Files      []string `json:"files,omitempty"`
+	Matches    uint64   `json:"matches,omitempty"`     // result count
+	TotalBytes uint64   `json:"total-bytes,omitempty"` // bytes scanned
+	Nodes      []string `json:"nodes,omitempty"`       // cluster nodes involved
+
+	// other details: target paths, user names, command, etc.
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// SetDetail puts additional detail to the record.
+func (r *Record) SetDetail(name string, value interface{}) {
+	if r.Details == nil {
+		r.Details = make(map[string]interface{})
+	}
+	r.Details[name] = value
+}
+
+// Filter contains audit query conditions.
+// Empty conditions are ignored.
+type Filter struct {
+	User   string    // exact user name
+	Action string    // exact action or its prefix: "files" matches "files.delete"
+	From   time.Time // inclusive
+	To     time.Time // exclusive
+	Limit  int       // the most recent records, zero means unlimited
+}
+
+// Match checks the record matches the filter.
+func (f Filter) Match(r *Record) bool {
+	if len(f.User) != 0 && r.User != f.User {
+		return false
+	}
+	if len(f.Action) != 0 && r.Action != f.Action && !strings.HasPrefix(r.Action, f.Action+".") {
+		return false
+	}
+	if !f.From.IsZero() && r.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Time.Before(f.To) {
+		return false
+	}
+
+	return true
+}
+
+// Log is an append-only JSON Lines audit log.
+// The file is rotated when it's too big or too old,
+// the most recent backups are kept.
+type Log struct {
+	path       string
+	maxSize    int64         // zero means unlimited
+	maxAge     time.Duration // zero means unlimited
+	maxBackups int           // zero means unlimited
+
+	mx     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// Open opens (or creates) audit log file.
+func Open(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*Log, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no audit log file provided")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %s", err)
+	}
+
+	l := &Log{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := l.open(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return l, nil // OK
+}
+
+// open log file for appending (should be called under lock)
+func (l *Log) open(now time.Time) error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %s", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit log: %s", err)
+	}
+
+	l.file = f
+	l.size = info.Size()
+	l.opened = now
+	return nil // OK
+}
+
+// Write appends the record to the log.
+func (l *Log) Write(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %s", err)
+	}
+	data = append(data, '\n')
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+
+	// rotate if needed
+	now := time.Now()
+	if l.size > 0 && ((l.maxSize > 0 && l.size+int64(len(data)) > l.maxSize) ||
+		(l.maxAge > 0 && now.Sub(l.opened) >= l.maxAge)) {
+		if err := l.rotate(now); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit record: %s", err)
+	}
+
+	return nil // OK
+}
+
+// rotate log file (should be called under lock)
+func (l *Log) rotate(now time.Time) error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %s", err)
+	}
+	l.file = nil
+
+	backup := l.path + "." + now.UTC().Format(backupTimeFormat)
+	if err := os.Rename(l.path, backup); err != nil {
+		// keep writing to the current file
+		if err := l.open(now); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed to rotate audit log: %s", err)
+	}
+	if err := l.open(now); err != nil {
+		return err
+	}
+
+	// remove old backups
+	if l.maxBackups > 0 {
+		backups, err := l.backups()
+		if err != nil {
+			return err
+		}
+		for len(backups) > l.maxBackups {
+			if err := os.Remove(backups[0]); err != nil {
+				return fmt.Errorf("failed to remove old audit log: %s", err)
+			}
+			backups = backups[1:]
+		}
+	}
+
+	return nil // OK
+}
+
+// get list of backup files (the oldest first)
+func (l *Log) backups() ([]string, error) {
+	files, err := filepath.Glob(l.path + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit logs: %s", err)
+	}
+
+	res := make([]string, 0, len(files))
+	for _, f := range files {
+		suffix := f[len(l.path)+1:]
+		if _, err := time.Parse(backupTimeFormat, suffix); err == nil {
+			res = append(res, f)
+		}
+	}
+	sort.Strings(res)
+
+	return res, nil // OK
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.file == nil {
+		return nil // already closed
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Query reads all log files (including backups) and
+// reports matched records in chronological order.
+// The lock is held only to get the list of files, so writes are not blocked.
+func (l *Log) Query(f Filter) ([]*Record, error) {
+	if f.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit: %d", f.Limit)
+	}
+
+	l.mx.Lock()
+	files, err := l.backups()
+	l.mx.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, l.path)
+
+	// a backup removed by rotation meanwhile is just skipped
+	res := &recordRing{limit: f.Limit}
+	for _, name := range files {
+		if err := readRecords(name, f, res); err != nil {
+			return nil, err
+		}
+	}
+
+	return res.records(), nil // OK
+}
+
+// recordRing keeps the most recent records.
+type recordRing struct {
+	recs  []*Record
+	limit int // zero means unlimited
+	next  int // the oldest record position once the ring is full
+}
+
+// add the record, the oldest one is dropped if the ring is full
+func (r *recordRing) add(rec *Record) {
+	if r.limit == 0 || len(r.recs) < r.limit {
+		r.recs = append(r.recs, rec)
+		return
+	}
+
+	r.recs[r.next] = rec
+	r.next = (r.next + 1) % r.limit
+}
+
+// get records in chronological order
+func (r *recordRing) records() []*Record {
+	res := make([]*Record, 0, len(r.recs))
+	res = append(res, r.recs[r.next:]...)
+	return append(res, r.recs[:r.next]...)
+}
+
+// read matched records from a log file
+func readRecords(name string, f Filter, res *recordRing) error {
+	file, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // might be removed
+		}
+		return fmt.Errorf("failed to open audit log: %s", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			rec := new(Record)
+			if json.Unmarshal(line, rec) == nil && f.Match(rec) {
+				res.add(rec)
+			}
+		}
+		if err != nil {
+			break // EOF
+		}
+	}
+
+	return nil // OK
+}
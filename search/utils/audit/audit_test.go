@@ -0,0 +1,232 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test record filtering
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	rec := &Record{Time: now, Action: "files.delete", User: "joe"}
+
+	assert.True(t, Filter{}.Match(rec))
+	assert.True(t, Filter{User: "joe"}.Match(rec))
+	assert.False(t, Filter{User: "foo"}.Match(rec))
+	assert.True(t, Filter{Action: "files"}.Match(rec))
+	assert.True(t, Filter{Action: "files.delete"}.Match(rec))
+	assert.False(t, Filter{Action: "file"}.Match(rec))
+	assert.False(t, Filter{Action: "search"}.Match(rec))
+	assert.True(t, Filter{From: now, To: now.Add(time.Second)}.Match(rec))
+	assert.False(t, Filter{From: now.Add(time.Millisecond)}.Match(rec))
+	assert.False(t, Filter{To: now}.Match(rec))
+}
+
+// test log writing, rotation and query
+func TestLog(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "audit_test_")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join(tmpdir, "audit", "audit.jsonl")
+	l, err := Open(path, 400, 0, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	for i := 0; i < 10; i++ {
+		rec := &Record{
+			Time:   time.Now(),
+			Action: "search",
+			User:   "joe",
+			Query:  "hello",
+			Files:  []string{"*.txt"},
+			Status: 200,
+		}
+		if i%2 != 0 {
+			rec.Action = "files.delete"
+			rec.User = "foo"
+			rec.SetDetail("n", i)
+		}
+		if !assert.NoError(t, l.Write(rec)) {
+			return
+		}
+	}
+
+	// rotated, old backups removed
+	backups, err := l.backups()
+	if assert.NoError(t, err) {
+		assert.Len(t, backups, 2)
+	}
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.True(t, info.Size() <= 400)
+	}
+
+	all, err := l.Query(Filter{})
+	if assert.NoError(t, err) && assert.NotEmpty(t, all) {
+		assert.True(t, len(all) < 10) // some records removed
+		last := all[len(all)-1]
+		assert.Equal(t, "files.delete", last.Action)
+		assert.EqualValues(t, 9, last.Details["n"])
+		for i := 1; i < len(all); i++ {
+			assert.False(t, all[i].Time.Before(all[i-1].Time))
+		}
+	}
+
+	res, err := l.Query(Filter{User: "joe"})
+	if assert.NoError(t, err) {
+		for _, r := range res {
+			assert.Equal(t, "search", r.Action)
+			assert.Equal(t, []string{"*.txt"}, r.Files)
+		}
+	}
+
+	res, err = l.Query(Filter{Action: "files", Limit: 1})
+	if assert.NoError(t, err) && assert.Len(t, res, 1) {
+		assert.EqualValues(t, 9, res[0].Details["n"])
+	}
+	res, err = l.Query(Filter{Limit: 2})
+	if assert.NoError(t, err) && assert.Len(t, res, 2) {
+		assert.Equal(t, all[len(all)-2:], res)
+	}
+	_, err = l.Query(Filter{Limit: -1})
+	assert.Error(t, err)
+
+	// reopen existing log
+	assert.NoError(t, l.Close())
+	assert.Error(t, l.Write(&Record{}))
+	l, err = Open(path, 0, 0, 0)
+	if assert.NoError(t, err) {
+		assert.NoError(t, l.Write(&Record{Time: time.Now(), Action: "run"}))
+		res, err = l.Query(Filter{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, len(all)+1, len(res))
+		}
+	}
+}
+
+// test the most recent records are kept
+func TestRecordRing(t *testing.T) {
+	check := func(limit int, n int, expected ...int) {
+		r := &recordRing{limit: limit}
+		for i := 0; i < n; i++ {
+			r.add(&Record{Details: map[string]interface{}{"n": i}})
+		}
+		var res []int
+		for _, rec := range r.records() {
+			res = append(res, rec.Details["n"].(int))
+		}
+		assert.Equal(t, expected, res, "limit:%d n:%d", limit, n)
+	}
+
+	check(0, 0)
+	check(0, 3, 0, 1, 2)
+	check(3, 2, 0, 1)
+	check(3, 3, 0, 1, 2)
+	check(3, 4, 1, 2, 3)
+	check(3, 7, 4, 5, 6)
+	check(1, 5, 4)
+}
+
+// test time based rotation
+func TestLogMaxAge(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "audit_test_")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	l, err := Open(filepath.Join(tmpdir, "audit.jsonl"), 0, time.Hour, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	assert.NoError(t, l.Write(&Record{Time: time.Now(), Action: "search"}))
+	l.opened = l.opened.Add(-2 * time.Hour) // emulate time passed
+	assert.NoError(t, l.Write(&Record{Time: time.Now(), Action: "count"}))
+
+	backups, err := l.backups()
+	if assert.NoError(t, err) {
+		assert.Len(t, backups, 1)
+	}
+	res, err := l.Query(Filter{})
+	if assert.NoError(t, err) && assert.Len(t, res, 2) {
+		assert.Equal(t, "search", res[0].Action)
+		assert.Equal(t, "count", res[1].Action)
+	}
+}
+
+// test failed rotation keeps the log open
+func TestLogRotateFailed(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "audit_test_")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	l, err := Open(filepath.Join(tmpdir, "audit.jsonl"), 0, 0, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	assert.NoError(t, l.Write(&Record{Time: time.Now(), Action: "search"}))
+
+	// backup path is busy with non-empty directory
+	now := time.Now()
+	busy := l.path + "." + now.UTC().Format(backupTimeFormat)
+	if !assert.NoError(t, os.MkdirAll(filepath.Join(busy, "foo"), 0755)) {
+		return
+	}
+	l.mx.Lock()
+	err = l.rotate(now)
+	l.mx.Unlock()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to rotate audit log")
+	}
+
+	assert.NoError(t, l.Write(&Record{Time: time.Now(), Action: "count"}))
+	res, err := l.Query(Filter{})
+	if assert.NoError(t, err) && assert.Len(t, res, 2) {
+		assert.Equal(t, "search", res[0].Action)
+		assert.Equal(t, "count", res[1].Action)
+	}
+}
@@ -31,7 +31,9 @@
 package catalog
 
 import (
+	"crypto/sha1"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -219,6 +221,32 @@ func (cat *Catalog) getAllParts() (map[string]search.NodeInfo, error) {
 	return res, nil // OK
 }
 
+// GetPartCount gets the total number of file parts.
+func (cat *Catalog) GetPartCount() (int64, error) {
+	// TODO: several attempts if DB is locked
+	return cat.getPartCountSync()
+}
+
+// gets the total number of file parts (synchronized).
+func (cat *Catalog) getPartCountSync() (int64, error) {
+	cat.mutex.Lock()
+	defer cat.mutex.Unlock()
+
+	return cat.getPartCount()
+}
+
+// gets the total number of file parts.
+func (cat *Catalog) getPartCount() (int64, error) {
+	row := cat.db.QueryRow(`SELECT COUNT(*) FROM parts;`)
+
+	var res int64
+	if err := row.Scan(&res); err != nil {
+		return 0, fmt.Errorf("failed to get part count: %s", err)
+	}
+
+	return res, nil // OK
+}
+
 // RenameFileParts renames file parts (synchronized)
 func (cat *Catalog) RenameFileParts(filename string, newname string) (int, error) {
 	cat.mutex.Lock()
@@ -272,6 +300,35 @@ func (cat *Catalog) renameFileParts(filename string, newname string) (int, error
 	return int(affected), nil // OK
 }
 
+// DeleteFileParts deletes file parts (synchronized).
+// Note, the data files are not changed.
+func (cat *Catalog) DeleteFileParts(filename string) (int, error) {
+	cat.mutex.Lock()
+	defer cat.mutex.Unlock()
+
+	return cat.deleteFileParts(filename)
+}
+
+// deleteFileParts deletes file parts.
+// return number of parts affected.
+func (cat *Catalog) deleteFileParts(filename string) (int, error) {
+	rows, err := cat.db.Exec("DELETE FROM parts WHERE name=?", filename)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete parts: %s", err)
+	}
+	affected, err := rows.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get number of rows affected: %s", err)
+	}
+
+	cat.log().WithFields(map[string]interface{}{
+		"filename": filename,
+		"affected": affected,
+	}).Debugf("[%s]: delete file part", TAG)
+
+	return int(affected), nil // OK
+}
+
 // GetFile get file parts from catalog.
 func (cat *Catalog) GetFile(filename string) (f *File, err error) {
 	// TODO: several attempts if DB is locked
@@ -303,7 +360,8 @@ func (cat *Catalog) getFile(filename string) (*File, error) {
 p.pos,p.len,p.d_pos,d.file
 FROM parts AS p
 JOIN data AS d ON d.id = p.d_id
-WHERE p.name IS ?;`, filename)
+WHERE p.name IS ?
+ORDER BY p.pos;`, filename)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -446,6 +504,29 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 	return f.pos, nil // OK
 }
 
+// Size gets the total file size, bytes.
+func (f *File) Size() int64 {
+	var size int64
+	for _, p := range f.parts {
+		size += p.length
+	}
+
+	return size
+}
+
+// Tag gets the file's tag based on parts metadata.
+// Catalog's data is never overwritten, so the same set
+// of parts always means the same file content.
+func (f *File) Tag() string {
+	h := sha1.New()
+	for _, p := range f.parts {
+		fmt.Fprintf(h, "%s:%d:%d:%d;", p.dataPath,
+			p.dataPos, p.offset, p.length)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // Close closes all open resources (io.Closer interface).
 func (f *File) Close() error {
 	// close all open files
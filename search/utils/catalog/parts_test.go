@@ -91,9 +91,11 @@ func TestParts(t *testing.T) {
 			assert.True(t, err == os.ErrNotExist)
 		}
 
+		var tag1 string
 		f, err := cat.GetFile("1.txt")
 		if assert.NoError(t, err) && assert.NotNil(t, f) {
 			defer f.Close()
+			tag1 = f.Tag()
 
 			if assert.EqualValues(t, 3, len(f.parts)) {
 				assert.EqualValues(t, 0, f.parts[0].dataPos)
@@ -130,6 +132,10 @@ func TestParts(t *testing.T) {
 			// remove fake part
 			f.parts = f.parts[0:3]
 
+			// size & tag test
+			assert.EqualValues(t, 17+17+200, f.Size())
+			assert.Len(t, f.Tag(), 40)
+
 			// seek test
 			L, err := f.Seek(0, os.SEEK_END)
 			assert.NoError(t, err)
@@ -176,6 +182,9 @@ func TestParts(t *testing.T) {
 					assert.EqualValues(t, 2*17, f.parts[2].offset)
 					assert.EqualValues(t, 200, f.parts[2].length)
 				}
+
+				// the same content
+				assert.EqualValues(t, tag1, f.Tag())
 			}
 
 			// rename it back
@@ -184,5 +193,32 @@ func TestParts(t *testing.T) {
 				assert.EqualValues(t, 3, x) // 3 parts
 			}
 		}
+
+		if true { // check delete files
+			n, err := cat.GetPartCount()
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, 9, n)
+			}
+
+			x, err := cat.DeleteFileParts("0.txt")
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, 0, x) // nothing deleted
+			}
+
+			x, err = cat.DeleteFileParts("2.txt")
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, 3, x) // 3 parts
+			}
+
+			_, err = cat.GetFile("2.txt")
+			if assert.Error(t, err) {
+				assert.True(t, err == os.ErrNotExist)
+			}
+
+			n, err = cat.GetPartCount()
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, 6, n)
+			}
+		}
 	}
 }
@@ -0,0 +1,399 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Priority classes
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+// IsValidPriority checks the priority class is known.
+func IsValidPriority(priority string) bool {
+	switch priority {
+	case PriorityInteractive, PriorityBatch:
+		return true
+	}
+
+	return false
+}
+
+// get priority rank, higher is served first
+// unknown priority is treated as interactive
+func priorityRank(priority string) int {
+	if priority == PriorityBatch {
+		return 0
+	}
+
+	return 1
+}
+
+// ErrCancelled is reported if the waiting execution is cancelled.
+var ErrCancelled = errors.New("cancelled while waiting in queue")
+
+// Request is a backend execution waiting for admission.
+type Request struct {
+	Backend  string          // backend tool: "ryftprim", "ryftx", ...
+	User     string          // used for fair sharing
+	Priority string          // "interactive" or "batch"
+	Cancel   <-chan struct{} // stop waiting once closed (optional)
+}
+
+// TimeoutError is reported if backend execution is not admitted in time.
+type TimeoutError struct {
+	Backend    string
+	Position   int           // one-based queue position on timeout
+	RetryAfter time.Duration // estimated time to retry
+}
+
+// Error gets the error message.
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s queue timeout at position %d, retry after %s",
+		e.Backend, e.Position, e.RetryAfter)
+}
+
+// IsTimeout checks the error is a queue timeout.
+func IsTimeout(err error) (*TimeoutError, bool) {
+	e, ok := err.(*TimeoutError)
+	return e, ok
+}
+
+// queued execution
+type waiter struct {
+	Request
+	seq      uint64
+	ready    chan struct{}
+	admitted bool
+}
+
+// Scheduler limits the number of concurrent backend executions.
+// Waiting executions are served by priority class first,
+// then the user having the fewest running executions,
+// then in order of arrival.
+type Scheduler struct {
+	Limits       map[string]int // maximum concurrent runs per backend
+	DefaultLimit int            // for backends not in Limits, zero means unlimited
+	Timeout      time.Duration  // queue timeout, zero means no timeout
+
+	lock    sync.Mutex
+	seq     uint64
+	running map[string]map[string]int // backend -> user -> number of runs
+	total   map[string]int            // backend -> number of runs
+	queue   map[string][]*waiter      // backend -> waiting executions
+	average map[string]time.Duration  // backend -> average run duration
+}
+
+// New creates new scheduler.
+func New(limits map[string]int, defaultLimit int, timeout time.Duration) *Scheduler {
+	return &Scheduler{
+		Limits:       limits,
+		DefaultLimit: defaultLimit,
+		Timeout:      timeout,
+		running:      make(map[string]map[string]int),
+		total:        make(map[string]int),
+		queue:        make(map[string][]*waiter),
+		average:      make(map[string]time.Duration),
+	}
+}
+
+// get maximum concurrent runs of backend
+func (s *Scheduler) limit(backend string) int {
+	if n, ok := s.Limits[backend]; ok {
+		return n
+	}
+
+	return s.DefaultLimit
+}
+
+// check waiter a should be served before waiter b
+func (s *Scheduler) less(a, b *waiter) bool {
+	if ra, rb := priorityRank(a.Priority), priorityRank(b.Priority); ra != rb {
+		return ra > rb
+	}
+
+	running := s.running[a.Backend]
+	if na, nb := running[a.User], running[b.User]; na != nb {
+		return na < nb
+	}
+
+	return a.seq < b.seq
+}
+
+// get the number of waiters to be served before w
+func (s *Scheduler) position(w *waiter) int {
+	n := 0
+	for _, o := range s.queue[w.Backend] {
+		if o != w && s.less(o, w) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// remove waiter from the queue
+func (s *Scheduler) remove(w *waiter) {
+	q := s.queue[w.Backend]
+	for i, o := range q {
+		if o == w {
+			s.queue[w.Backend] = append(q[:i], q[i+1:]...)
+			break
+		}
+	}
+}
+
+// start as many waiting executions as possible
+func (s *Scheduler) dispatch(backend string) {
+	for {
+		q := s.queue[backend]
+		if len(q) == 0 {
+			return
+		}
+		if limit := s.limit(backend); limit > 0 && s.total[backend] >= limit {
+			return
+		}
+
+		// find the next one
+		next := q[0]
+		for _, w := range q[1:] {
+			if s.less(w, next) {
+				next = w
+			}
+		}
+
+		s.remove(next)
+		if s.running[backend] == nil {
+			s.running[backend] = make(map[string]int)
+		}
+		s.running[backend][next.User]++
+		s.total[backend]++
+		next.admitted = true
+		close(next.ready)
+	}
+}
+
+// estimate time to retry: average run duration
+// multiplied by the number of "rounds" of the queue
+func (s *Scheduler) retryAfter(backend string) time.Duration {
+	d := s.average[backend]
+	if limit := s.limit(backend); limit > 0 {
+		rounds := (len(s.queue[backend]) + limit) / limit
+		d *= time.Duration(rounds)
+	}
+	if d < time.Second {
+		d = time.Second
+	}
+
+	return d.Round(time.Second)
+}
+
+// Acquire waits until the backend execution is admitted.
+// TimeoutError is returned if queue timeout is exceeded,
+// ErrCancelled is returned if the request is cancelled.
+// Ticket should be released once execution is finished.
+func (s *Scheduler) Acquire(req Request) (*Ticket, error) {
+	start := time.Now()
+
+	s.lock.Lock()
+	s.seq++
+	w := &waiter{
+		Request: req,
+		seq:     s.seq,
+		ready:   make(chan struct{}),
+	}
+	s.queue[req.Backend] = append(s.queue[req.Backend], w)
+	s.dispatch(req.Backend)
+	position := 0 // started immediately
+	if !w.admitted {
+		position = s.position(w) + 1
+	}
+	s.lock.Unlock()
+
+	ticket := &Ticket{
+		s:        s,
+		req:      req,
+		Position: position,
+	}
+
+	var timeoutCh <-chan time.Time
+	if s.Timeout > 0 {
+		timer := time.NewTimer(s.Timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case <-w.ready:
+		// admitted
+
+	case <-timeoutCh:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if !w.admitted {
+			err := &TimeoutError{
+				Backend:    req.Backend,
+				Position:   s.position(w) + 1,
+				RetryAfter: s.retryAfter(req.Backend),
+			}
+			s.remove(w)
+			return nil, err
+		}
+
+	case <-req.Cancel:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if !w.admitted {
+			s.remove(w)
+			return nil, ErrCancelled
+		}
+	}
+
+	ticket.Wait = time.Since(start)
+	ticket.started = time.Now()
+	return ticket, nil // OK
+}
+
+// Status gets the number of running and waiting executions per backend.
+func (s *Scheduler) Status() map[string]interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := make(map[string]interface{})
+	backends := make(map[string]bool)
+	for b := range s.total {
+		backends[b] = true
+	}
+	for b := range s.queue {
+		backends[b] = true
+	}
+	for b := range backends {
+		res[b] = map[string]interface{}{
+			"running": s.total[b],
+			"waiting": len(s.queue[b]),
+			"limit":   s.limit(b),
+		}
+	}
+
+	return res
+}
+
+// Ticket is an admitted backend execution.
+// All ticket methods are safe to call on nil ticket.
+type Ticket struct {
+	Position int           // one-based queue position on arrival (0 if started immediately)
+	Wait     time.Duration // time spent in the queue
+
+	s       *Scheduler
+	req     Request
+	started time.Time
+	once    sync.Once
+}
+
+// Release releases the execution slot.
+// Can be called several times.
+func (t *Ticket) Release() {
+	if t == nil {
+		return
+	}
+
+	t.once.Do(func() {
+		s := t.s
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		backend := t.req.Backend
+		if running := s.running[backend]; running != nil {
+			if running[t.req.User]--; running[t.req.User] <= 0 {
+				delete(running, t.req.User)
+			}
+		}
+		s.total[backend]--
+
+		// exponential moving average of run duration
+		d := time.Since(t.started)
+		if avg := s.average[backend]; avg != 0 {
+			d = (avg*7 + d) / 8
+		}
+		s.average[backend] = d
+
+		s.dispatch(backend)
+	})
+}
+
+// Report gets the queue related statistics.
+func (t *Ticket) Report() map[string]interface{} {
+	if t == nil {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"position": t.Position,
+		"wait":     t.Wait.String(),
+		"priority": t.req.Priority,
+	}
+}
+
+var (
+	global     *Scheduler
+	globalLock sync.Mutex
+)
+
+// SetDefault sets the global scheduler, nil to disable admission control.
+func SetDefault(s *Scheduler) {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
+	global = s
+}
+
+// Default gets the global scheduler (might be nil).
+func Default() *Scheduler {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
+	return global
+}
+
+// Acquire waits for admission using the global scheduler.
+// If admission control is disabled nil ticket is returned.
+func Acquire(req Request) (*Ticket, error) {
+	if s := Default(); s != nil {
+		return s.Acquire(req)
+	}
+
+	return nil, nil // disabled
+}
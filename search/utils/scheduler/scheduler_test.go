@@ -0,0 +1,186 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// wait ticket in background
+func acquireAsync(s *Scheduler, req Request) chan *Ticket {
+	ch := make(chan *Ticket, 1)
+	go func() {
+		t, _ := s.Acquire(req)
+		ch <- t
+	}()
+	return ch
+}
+
+// wait until the number of queued executions
+func waitQueued(s *Scheduler, backend string, n int) {
+	for i := 0; i < 1000; i++ {
+		s.lock.Lock()
+		queued := len(s.queue[backend])
+		s.lock.Unlock()
+		if queued >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// test limits and order
+func TestSchedulerOrder(t *testing.T) {
+	s := New(map[string]int{"ryftprim": 2}, 0, 0)
+
+	// unlimited backend
+	t1, err := s.Acquire(Request{Backend: "ryftx", User: "a"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, t1.Position)
+		t1.Release()
+		t1.Release() // twice is OK
+	}
+
+	// all slots are used by user "a"
+	t2, err := s.Acquire(Request{Backend: "ryftprim", User: "a"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	t2b, err := s.Acquire(Request{Backend: "ryftprim", User: "a"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	batch := acquireAsync(s, Request{Backend: "ryftprim", User: "b", Priority: PriorityBatch})
+	waitQueued(s, "ryftprim", 1)
+	sameUser := acquireAsync(s, Request{Backend: "ryftprim", User: "a"})
+	waitQueued(s, "ryftprim", 2)
+	otherUser := acquireAsync(s, Request{Backend: "ryftprim", User: "c"})
+	waitQueued(s, "ryftprim", 3)
+
+	// interactive first, user "c" has no running executions
+	t2.Release()
+	t3 := <-otherUser
+	assert.Equal(t, "c", t3.req.User)
+	assert.Equal(t, 1, t3.Position) // ahead of all others
+
+	t3.Release()
+	t4 := <-sameUser
+	assert.Equal(t, "a", t4.req.User)
+
+	t4.Release()
+	t2b.Release()
+	t5 := <-batch
+	assert.Equal(t, "b", t5.req.User)
+	assert.Equal(t, 1, t5.Position)
+	t5.Release()
+
+	status := s.Status()["ryftprim"].(map[string]interface{})
+	assert.Equal(t, 0, status["running"])
+	assert.Equal(t, 0, status["waiting"])
+	assert.Equal(t, 2, status["limit"])
+}
+
+// test queue timeout
+func TestSchedulerTimeout(t *testing.T) {
+	s := New(nil, 1, 50*time.Millisecond)
+
+	t1, err := s.Acquire(Request{Backend: "ryftx", User: "a"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t2, err := s.Acquire(Request{Backend: "ryftx", User: "b"})
+	assert.Nil(t, t2)
+	if e, ok := IsTimeout(err); assert.True(t, ok) {
+		assert.Equal(t, "ryftx", e.Backend)
+		assert.Equal(t, 1, e.Position)
+		assert.Equal(t, time.Second, e.RetryAfter)
+		assert.Contains(t, e.Error(), "queue timeout")
+	}
+
+	// the waiter is removed
+	t1.Release()
+	t3, err := s.Acquire(Request{Backend: "ryftx", User: "b"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, t3.Position)
+		t3.Release()
+	}
+}
+
+// test cancel while waiting
+func TestSchedulerCancel(t *testing.T) {
+	s := New(map[string]int{"ryftx": 1}, 0, 0) // no timeout
+	t1, err := s.Acquire(Request{Backend: "ryftx", User: "a"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cancel := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		t2, err := s.Acquire(Request{Backend: "ryftx", User: "b", Cancel: cancel})
+		assert.Nil(t, t2)
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 1, s.Status()["ryftx"].(map[string]interface{})["waiting"])
+	close(cancel)
+	assert.Equal(t, ErrCancelled, <-done)
+	assert.EqualValues(t, 0, s.Status()["ryftx"].(map[string]interface{})["waiting"])
+
+	// the cancelled waiter is not admitted
+	t1.Release()
+	assert.EqualValues(t, 0, s.Status()["ryftx"].(map[string]interface{})["running"])
+}
+
+// test global scheduler
+func TestSchedulerDefault(t *testing.T) {
+	SetDefault(nil)
+	ticket, err := Acquire(Request{Backend: "ryftprim"})
+	assert.NoError(t, err)
+	assert.Nil(t, ticket)
+	ticket.Release() // nil is OK
+	assert.Nil(t, ticket.Report())
+
+	SetDefault(New(nil, 0, 0))
+	defer SetDefault(nil)
+	ticket, err = Acquire(Request{Backend: "ryftprim", Priority: PriorityBatch})
+	if assert.NoError(t, err) {
+		assert.Equal(t, PriorityBatch, ticket.Report()["priority"])
+		ticket.Release()
+	}
+
+	assert.True(t, IsValidPriority(PriorityInteractive))
+	assert.False(t, IsValidPriority("urgent"))
+}
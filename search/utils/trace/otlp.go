@@ -0,0 +1,249 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	otlpQueueSize = 4096 // spans queued
+	otlpBatchSize = 256  // spans per request
+)
+
+// OTLPExporter sends spans to OTLP/HTTP (JSON) compatible collector,
+// for example OpenTelemetry Collector or Jaeger (port 4318).
+type OTLPExporter struct {
+	Endpoint string // collector URL, http://localhost:4318/v1/traces
+	Service  string // service name
+	Host     string // host name
+
+	interval time.Duration // flush interval
+	client   *http.Client
+
+	queue   chan *Span
+	closeCh chan struct{}
+	doneCh  chan struct{}
+}
+
+// NewOTLPExporter creates new exporter and starts background sender.
+// queued spans are sent each interval (should be positive).
+func NewOTLPExporter(endpoint, service, host string, interval, timeout time.Duration) *OTLPExporter {
+	e := &OTLPExporter{
+		Endpoint: endpoint,
+		Service:  service,
+		Host:     host,
+		interval: interval,
+		client:   &http.Client{Timeout: timeout},
+		queue:    make(chan *Span, otlpQueueSize),
+		closeCh:  make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+
+	go e.run()
+	return e
+}
+
+// Export puts span to the queue, span is dropped if queue is full.
+func (e *OTLPExporter) Export(span *Span) {
+	select {
+	case e.queue <- span:
+	default: // drop
+	}
+}
+
+// Close sends all queued spans and stops background sender.
+func (e *OTLPExporter) Close() {
+	close(e.closeCh)
+	<-e.doneCh
+}
+
+// background sender
+func (e *OTLPExporter) run() {
+	defer close(e.doneCh)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) != 0 {
+			_ = e.send(batch) // errors are ignored
+			batch = nil
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+
+		case <-e.closeCh:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send batch of spans
+func (e *OTLPExporter) send(spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %s", err)
+	}
+
+	resp, err := e.client.Post(e.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("invalid HTTP response status: %d (%s)", resp.StatusCode, resp.Status)
+	}
+
+	return nil // OK
+}
+
+// encode spans in OTLP JSON format
+func (e *OTLPExporter) encode(spans []*Span) map[string]interface{} {
+	items := make([]interface{}, 0, len(spans))
+	for _, s := range spans {
+		s.lock.Lock()
+		item := map[string]interface{}{
+			"traceId":           s.TraceID,
+			"spanId":            s.SpanID,
+			"name":              s.Name,
+			"kind":              s.Kind,
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+		}
+		if len(s.ParentID) != 0 {
+			item["parentSpanId"] = s.ParentID
+		}
+		if len(s.Error) != 0 {
+			item["status"] = map[string]interface{}{
+				"code":    2, // STATUS_CODE_ERROR
+				"message": s.Error,
+			}
+		}
+		s.lock.Unlock()
+
+		items = append(items, item)
+	}
+
+	resource := map[string]interface{}{
+		"service.name": e.Service,
+	}
+	if len(e.Host) != 0 {
+		resource["host.name"] = e.Host
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(resource),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": e.Service},
+						"spans": items,
+					},
+				},
+			},
+		},
+	}
+}
+
+// convert attributes to OTLP key-value list (sorted by key)
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		var value map[string]interface{}
+		switch v := attrs[k].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case uint64:
+			value = map[string]interface{}{"intValue": strconv.FormatUint(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		case fmt.Stringer:
+			value = map[string]interface{}{"stringValue": v.String()}
+		default:
+			// complex values are encoded as JSON
+			data, err := json.Marshal(v)
+			if err != nil {
+				data = []byte(fmt.Sprintf("%v", v))
+			}
+			value = map[string]interface{}{"stringValue": string(data)}
+		}
+
+		res = append(res, map[string]interface{}{
+			"key":   k,
+			"value": value,
+		})
+	}
+
+	return res
+}
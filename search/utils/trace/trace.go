@@ -0,0 +1,258 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Context is a W3C trace context (see `traceparent` header).
+type Context struct {
+	TraceID string // 32 hex digits
+	SpanID  string // 16 hex digits
+	Sampled bool   // spans should be exported
+}
+
+// generate random hex identifier
+func newID(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		// fallback to time based identifier
+		ts := fmt.Sprintf("%016x", time.Now().UnixNano())
+		return strings.Repeat(ts, (2*n+len(ts)-1)/len(ts))[:2*n]
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// check identifier is valid: hex digits, not all zeros
+func isValidID(id string, n int) bool {
+	if len(id) != 2*n || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
+
+// New creates new trace context.
+func New() Context {
+	return Context{
+		TraceID: newID(16),
+		SpanID:  newID(8),
+		Sampled: true,
+	}
+}
+
+// Parse parses the `traceparent` header value.
+// Format is "version-traceid-spanid-flags", for example:
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func Parse(traceparent string) (Context, error) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 {
+		return Context{}, fmt.Errorf("bad traceparent format: %q", traceparent)
+	}
+	if len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return Context{}, fmt.Errorf("unsupported traceparent version: %q", parts[0])
+	}
+	if !isValidID(parts[1], 16) {
+		return Context{}, fmt.Errorf("bad trace ID: %q", parts[1])
+	}
+	if !isValidID(parts[2], 8) {
+		return Context{}, fmt.Errorf("bad parent ID: %q", parts[2])
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return Context{}, fmt.Errorf("bad trace flags: %q", parts[3])
+	}
+
+	return Context{
+		TraceID: parts[1],
+		SpanID:  parts[2],
+		Sampled: (flags[0] & 0x01) != 0,
+	}, nil // OK
+}
+
+// IsValid checks the trace context is valid (not empty).
+func (c Context) IsValid() bool {
+	return len(c.TraceID) != 0 && len(c.SpanID) != 0
+}
+
+// String gets the `traceparent` header value.
+func (c Context) String() string {
+	if !c.IsValid() {
+		return ""
+	}
+
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", c.TraceID, c.SpanID, flags)
+}
+
+// Span kinds
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Span is a single timed operation of a trace.
+type Span struct {
+	Context           // span's own context
+	ParentID   string // parent span, empty for root
+	Name       string
+	Kind       int
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Error      string
+
+	lock sync.Mutex
+}
+
+// Start starts a new child span.
+// All span methods are safe to call on nil span.
+// New trace is started if parent context is not valid.
+func Start(parent Context, name string, kind int) *Span {
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+	}
+
+	if parent.IsValid() {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+		span.Sampled = parent.Sampled
+		span.SpanID = newID(8)
+	} else {
+		span.Context = New()
+	}
+
+	return span
+}
+
+// TraceContext gets the span's own context to pass to children.
+func (s *Span) TraceContext() Context {
+	if s == nil {
+		return Context{}
+	}
+
+	return s.Context
+}
+
+// SetAttribute sets the span attribute.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Attributes[key] = value
+}
+
+// SetAttributes sets a set of span attributes.
+func (s *Span) SetAttributes(attrs map[string]interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for k, v := range attrs {
+		s.Attributes[k] = v
+	}
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Error = err.Error()
+}
+
+// Finish finishes the span and exports it (if sampled).
+// Should be called once.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	s.End = time.Now()
+	s.lock.Unlock()
+
+	if e := getExporter(); e != nil && s.Sampled {
+		e.Export(s)
+	}
+}
+
+// Exporter sends finished spans to a collector.
+type Exporter interface {
+	// Export should not block
+	Export(span *Span)
+}
+
+var (
+	exporter     Exporter
+	exporterLock sync.Mutex
+)
+
+// SetExporter sets global span exporter, nil to disable.
+func SetExporter(e Exporter) {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+
+	exporter = e
+}
+
+// get global span exporter
+func getExporter() Exporter {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+
+	return exporter
+}
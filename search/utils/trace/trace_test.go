@@ -0,0 +1,198 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2015, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used *   to endorse or promote products derived from this software without specific prior written permission. *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+
+package trace
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// trace context test
+func TestContext(t *testing.T) {
+	c, err := Parse("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", c.TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", c.SpanID)
+		assert.True(t, c.Sampled)
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", c.String())
+	}
+
+	c, err = Parse("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	if assert.NoError(t, err) {
+		assert.False(t, c.Sampled)
+	}
+
+	// future versions may have extra fields
+	_, err = Parse("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.NoError(t, err)
+
+	bad := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	}
+	for _, s := range bad {
+		_, err := Parse(s)
+		assert.Error(t, err, "%q", s)
+	}
+
+	n := New()
+	assert.True(t, n.IsValid())
+	assert.True(t, n.Sampled)
+	_, err = Parse(n.String())
+	assert.NoError(t, err)
+	assert.Empty(t, Context{}.String())
+}
+
+// test exporter
+type testExporter struct {
+	spans []*Span
+}
+
+// Export saves span
+func (e *testExporter) Export(span *Span) {
+	e.spans = append(e.spans, span)
+}
+
+// span test
+func TestSpan(t *testing.T) {
+	e := &testExporter{}
+	SetExporter(e)
+	defer SetExporter(nil)
+
+	root := Start(Context{}, "root", KindServer)
+	assert.True(t, root.IsValid())
+	assert.Empty(t, root.ParentID)
+
+	child := Start(root.Context, "child", KindClient)
+	assert.Equal(t, root.TraceID, child.TraceID)
+	assert.Equal(t, root.SpanID, child.ParentID)
+	assert.NotEqual(t, root.SpanID, child.SpanID)
+	child.SetAttribute("host", "node-1")
+	child.SetAttributes(map[string]interface{}{"matches": 5})
+	child.SetError(nil)
+	child.Finish()
+	root.Finish()
+
+	// not sampled
+	ns := Start(Context{TraceID: root.TraceID, SpanID: root.SpanID}, "skip", KindInternal)
+	ns.Finish()
+
+	// nil span does nothing
+	var none *Span
+	none.SetAttribute("a", 1)
+	none.SetError(assert.AnError)
+	none.Finish()
+	assert.False(t, none.TraceContext().IsValid())
+	assert.Equal(t, child.Context, child.TraceContext())
+
+	if assert.Len(t, e.spans, 2) {
+		assert.Equal(t, "child", e.spans[0].Name)
+		assert.Equal(t, "node-1", e.spans[0].Attributes["host"])
+		assert.Equal(t, 5, e.spans[0].Attributes["matches"])
+		assert.Equal(t, "root", e.spans[1].Name)
+		assert.False(t, e.spans[1].End.Before(e.spans[1].Start))
+	}
+}
+
+// OTLP exporter test
+func TestOTLPExporter(t *testing.T) {
+	bodies := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		bodies <- data
+	}))
+	defer srv.Close()
+
+	e := NewOTLPExporter(srv.URL+"/v1/traces", "ryft-server", "node-1", 10*time.Millisecond, time.Second)
+
+	span := Start(Context{}, "ryftprim", KindInternal)
+	span.SetAttributes(map[string]interface{}{
+		"tool-exec": "1.5s",
+		"matches":   uint64(10),
+		"steps":     []string{"a", "b"},
+	})
+	span.SetError(assert.AnError)
+	span.Finish()
+	e.Export(span)
+	e.Close()
+
+	select {
+	case data := <-bodies:
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []struct {
+						TraceID    string `json:"traceId"`
+						SpanID     string `json:"spanId"`
+						Name       string `json:"name"`
+						Attributes []struct {
+							Key   string                 `json:"key"`
+							Value map[string]interface{} `json:"value"`
+						} `json:"attributes"`
+						Status map[string]interface{} `json:"status"`
+					} `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if assert.NoError(t, json.Unmarshal(data, &body)) &&
+			assert.Len(t, body.ResourceSpans, 1) &&
+			assert.Len(t, body.ResourceSpans[0].ScopeSpans, 1) &&
+			assert.Len(t, body.ResourceSpans[0].ScopeSpans[0].Spans, 1) {
+			s := body.ResourceSpans[0].ScopeSpans[0].Spans[0]
+			assert.Equal(t, span.TraceID, s.TraceID)
+			assert.Equal(t, span.SpanID, s.SpanID)
+			assert.Equal(t, "ryftprim", s.Name)
+			if assert.Len(t, s.Attributes, 3) {
+				assert.Equal(t, "matches", s.Attributes[0].Key)
+				assert.Equal(t, "10", s.Attributes[0].Value["intValue"])
+				assert.Equal(t, "steps", s.Attributes[1].Key)
+				assert.Equal(t, `["a","b"]`, s.Attributes[1].Value["stringValue"])
+				assert.Equal(t, "tool-exec", s.Attributes[2].Key)
+				assert.Equal(t, "1.5s", s.Attributes[2].Value["stringValue"])
+			}
+			assert.EqualValues(t, 2, s.Status["code"])
+		}
+
+	case <-time.After(time.Second):
+		assert.Fail(t, "no spans exported")
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * ============= Ryft-Customized BSD License ============
+ * Copyright (c) 2018, Ryft Systems, Inc.
+ * All rights reserved.
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ *
+ * 1. Redistributions of source code must retain the above copyright notice,
+ *   this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ *   this list of conditions and the following disclaimer in the documentation and/or
+ *   other materials provided with the distribution.
+ * 3. All advertising materials mentioning features or use of this software must display the following acknowledgement:
+ *   This product includes software developed by Ryft Systems, Inc.
+ * 4. Neither the name of Ryft Systems, Inc. nor the names of its contributors may be used
+ *   to endorse or promote products derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY RYFT SYSTEMS, INC. ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL RYFT SYSTEMS, INC. BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ * ============
+ */
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test GetDiskUsage
+func TestGetDiskUsage(t *testing.T) {
+	root := fmt.Sprintf("/tmp/ryft-usage-%x", time.Now().UnixNano())
+	defer os.RemoveAll(root)
+
+	// missing directory
+	used, err := GetDiskUsage(root)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 0, used)
+	}
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "foo", "bar"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "1.txt"), []byte("hello"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "foo", "2.txt"), []byte("hello world"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "foo", "bar", "3.txt"), []byte("!"), 0644))
+	assert.NoError(t, os.Symlink(filepath.Join(root, "foo", "2.txt"), filepath.Join(root, "link.txt")))
+
+	used, err = GetDiskUsage(root)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 5+11+1, used)
+	}
+
+	used, err = GetDiskUsage(filepath.Join(root, "foo"))
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 11+1, used)
+	}
+}